@@ -8,7 +8,10 @@ import (
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
 	"github.com/USA-RedDragon/mesh-manager/internal/db"
 	"github.com/USA-RedDragon/mesh-manager/internal/services/babel"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/dnsmasq"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/meshlink"
 	"github.com/USA-RedDragon/mesh-manager/internal/services/olsr"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/vtun"
 	"github.com/spf13/cobra"
 )
 
@@ -66,5 +69,25 @@ func runGenerate(cmd *cobra.Command, _ []string) error {
 		}
 	}
 
+	slog.Info("Generating meshlink hosts and services")
+	err = meshlink.GenerateAndSave(config, db)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Generating dnsmasq hosts")
+	err = dnsmasq.GenerateAndSave(db)
+	if err != nil {
+		return err
+	}
+
+	if config.VTun.Enabled {
+		slog.Info("Generating vtund config")
+		err = vtun.GenerateAndSave(config, db)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
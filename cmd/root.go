@@ -27,6 +27,7 @@ func NewCommand(version, commit string) *cobra.Command {
 	cmd.AddCommand(newMigrateCommand(version, commit))
 	cmd.AddCommand(newNotifyCommand(version, commit))
 	cmd.AddCommand(newServerCommand(version, commit))
+	cmd.AddCommand(newTunnelsCommand(version, commit))
 	cmd.AddCommand(newWalkCommand(version, commit))
 	return cmd
 }
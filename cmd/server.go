@@ -1,12 +1,16 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"syscall"
+	"time"
 
 	"github.com/USA-RedDragon/configulator"
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
 	"github.com/USA-RedDragon/mesh-manager/internal/db"
 	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
@@ -20,10 +24,13 @@ import (
 	"github.com/USA-RedDragon/mesh-manager/internal/services/lqm"
 	"github.com/USA-RedDragon/mesh-manager/internal/services/meshlink"
 	"github.com/USA-RedDragon/mesh-manager/internal/services/olsr"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/vtun"
+	"github.com/USA-RedDragon/mesh-manager/internal/tunnels"
 	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
 	"github.com/spf13/cobra"
 	"github.com/ztrue/shutdown"
 	"golang.org/x/sync/errgroup"
+	"gorm.io/gorm"
 )
 
 func newServerCommand(version, commit string) *cobra.Command {
@@ -71,9 +78,6 @@ func runServer(cmd *cobra.Command, _ []string) error {
 		serviceRegistry.Register(services.MeshLinkServiceName, meshlink.NewService(config))
 	}
 	serviceRegistry.Register(services.DNSMasqServiceName, dnsmasq.NewService(config))
-	serviceRegistry.Register(services.LQMServiceName, lqm.NewService(config))
-
-	go serviceRegistry.StartAll()
 
 	// Start the metrics server
 	go metrics.CreateMetricsServer(config, cmd.Root().Version)
@@ -85,6 +89,28 @@ func runServer(cmd *cobra.Command, _ []string) error {
 	}
 	slog.Info("Database connection established")
 
+	// LQM saves peer locations onto their tunnels
+	serviceRegistry.Register(services.LQMServiceName, lqm.NewService(config, db))
+
+	// vtund's client tunnels come from the database
+	if config.VTun.Enabled {
+		serviceRegistry.Register(services.VTunServiceName, vtun.NewService(config, db))
+	}
+
+	go func() {
+		err := serviceRegistry.StartAll()
+		if err != nil {
+			slog.Error("Failed to start services", "error", err)
+		}
+	}()
+
+	// End sessions left open by an unclean shutdown before clearing
+	// active status, which would move the time they're ended at
+	err = models.EndOpenTunnelSessions(db, time.Now(), models.TunnelSessionEndUnknown)
+	if err != nil {
+		return err
+	}
+
 	// Clear active status from all tunnels in the db
 	err = models.ClearActiveFromAllTunnels(db)
 	if err != nil {
@@ -92,6 +118,13 @@ func runServer(cmd *cobra.Command, _ []string) error {
 	}
 	slog.Info("Cleared active status from all tunnels in the database")
 
+	// Give existing tunnels an address if IPv6 was turned on since they
+	// were created
+	err = models.AssignMissingWireguardIPv6(db, config)
+	if err != nil {
+		return fmt.Errorf("failed to assign tunnel IPv6 addresses: %w", err)
+	}
+
 	// Start the wireguard manager
 	wireguardManager, err := wireguard.NewManager(db)
 	if err != nil {
@@ -105,6 +138,20 @@ func runServer(cmd *cobra.Command, _ []string) error {
 	}
 	slog.Info("Wireguard manager started")
 
+	// Check the public endpoints in the background, since DNS may be slow
+	if len(config.Wireguard.Endpoints) > 0 {
+		go checkWireguardEndpoints(config, db)
+	}
+
+	// Start the tunnel scheduler
+	tunnelController := tunnels.NewController(config, db, serviceRegistry, wireguardManager)
+	tunnelScheduler := tunnels.NewScheduler(db, clock.Real{}, tunnelController)
+	err = tunnelScheduler.Start()
+	if err != nil {
+		return err
+	}
+	slog.Info("Tunnel scheduler started")
+
 	if config.OLSR {
 		// Run the OLSR metrics watcher
 		go metrics.OLSRWatcher(db)
@@ -115,6 +162,35 @@ func runServer(cmd *cobra.Command, _ []string) error {
 	eventBus := events.NewEventBus()
 	slog.Info("Event bus initialized")
 
+	// Start the tunnel quota enforcer
+	quotaEnforcer := tunnels.NewQuotaEnforcer(db, clock.Real{}, tunnelController, eventBus.GetChannel())
+	err = quotaEnforcer.Start()
+	if err != nil {
+		return err
+	}
+	slog.Info("Tunnel quota enforcer started")
+
+	// Start the tunnel telemetry poller
+	tunnelTelemetry, err := tunnels.NewTelemetry(db, clock.Real{}, eventBus.GetChannel())
+	if err != nil {
+		return err
+	}
+	err = tunnelTelemetry.Start()
+	if err != nil {
+		return err
+	}
+	slog.Info("Tunnel telemetry poller started")
+
+	// Start the tunnel remediator
+	tunnelRemediator := tunnels.NewRemediator(config, clock.Real{}, tunnelController, tunnels.MeshProbe{})
+	if config.Remediation.Enabled {
+		err = tunnelRemediator.Start()
+		if err != nil {
+			return err
+		}
+		slog.Info("Tunnel remediator started")
+	}
+
 	// Start the interface watcher
 	ifWatcher, err := ifacewatcher.NewWatcher(db, eventBus.GetChannel())
 	if err != nil {
@@ -127,7 +203,7 @@ func runServer(cmd *cobra.Command, _ []string) error {
 	slog.Info("Interface watcher started")
 
 	// Start the server
-	srv := server.NewServer(config, db, ifWatcher.Stats, eventBus.GetChannel(), wireguardManager)
+	srv := server.NewServer(config, db, ifWatcher.Stats, eventBus.GetChannel(), wireguardManager, tunnelScheduler, quotaEnforcer)
 	err = srv.Run(cmd.Root().Version, serviceRegistry)
 	if err != nil {
 		return err
@@ -152,6 +228,30 @@ func runServer(cmd *cobra.Command, _ []string) error {
 		errGrp := errgroup.Group{}
 		errGrp.SetLimit(1)
 
+		errGrp.Go(func() error {
+			slog.Debug("Stopping tunnel scheduler")
+			defer slog.Debug("Tunnel scheduler stopped")
+			return tunnelScheduler.Stop()
+		})
+
+		errGrp.Go(func() error {
+			slog.Debug("Stopping tunnel quota enforcer")
+			defer slog.Debug("Tunnel quota enforcer stopped")
+			return quotaEnforcer.Stop()
+		})
+
+		errGrp.Go(func() error {
+			slog.Debug("Stopping tunnel telemetry poller")
+			defer slog.Debug("Tunnel telemetry poller stopped")
+			return tunnelTelemetry.Stop()
+		})
+
+		errGrp.Go(func() error {
+			slog.Debug("Stopping tunnel remediator")
+			defer slog.Debug("Tunnel remediator stopped")
+			return tunnelRemediator.Stop()
+		})
+
 		errGrp.Go(func() error {
 			slog.Debug("Stopping wireguard manager")
 			defer slog.Debug("Wireguard manager stopped")
@@ -170,6 +270,12 @@ func runServer(cmd *cobra.Command, _ []string) error {
 			return ifWatcher.Stop()
 		})
 
+		errGrp.Go(func() error {
+			slog.Debug("Ending tunnel sessions")
+			defer slog.Debug("Ended tunnel sessions")
+			return models.EndOpenTunnelSessions(db, time.Now(), models.TunnelSessionEndShutdown)
+		})
+
 		errGrp.Go(func() error {
 			slog.Debug("Clearing active status from all tunnels")
 			defer slog.Debug("Cleared active status from all tunnels")
@@ -200,3 +306,24 @@ func runServer(cmd *cobra.Command, _ []string) error {
 
 	return <-stopChan
 }
+
+// checkWireguardEndpoints warns about public endpoints that peers may not be
+// able to reach
+func checkWireguardEndpoints(config *config.Config, db *gorm.DB) {
+	tunnels, err := models.ListWireguardTunnels(db)
+	if err != nil {
+		slog.Error("Failed to list tunnels to check endpoints", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, check := range wireguard.CheckEndpoints(ctx, config, tunnels, net.DefaultResolver) {
+		if check.OK() {
+			slog.Info("Wireguard endpoint check passed", "endpoint", check.Endpoint, "addresses", check.Addresses)
+			continue
+		}
+		for _, problem := range check.Problems {
+			slog.Warn("Wireguard endpoint may not be reachable", "endpoint", check.Endpoint, "problem", problem)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/configulator"
+	"github.com/USA-RedDragon/mesh-manager/internal/bundle"
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// passphraseEnv is read when --passphrase-file isn't given, so the
+// passphrase doesn't end up in shell history or the process list
+const passphraseEnv = "MESH_MANAGER_BUNDLE_PASSPHRASE"
+
+func newTunnelsCommand(version, commit string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "tunnels",
+		Short:   "Manage tunnels from the command line",
+		Version: fmt.Sprintf("%s - %s", version, commit),
+		Annotations: map[string]string{
+			"version": version,
+			"commit":  commit,
+		},
+		SilenceErrors:     true,
+		DisableAutoGenTag: true,
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write every tunnel, including its keys, to an encrypted bundle",
+		Long: "Writes every tunnel, including its WireGuard keys, port, and IP assignment, to a\n" +
+			"bundle encrypted with a passphrase read from --passphrase-file or the\n" +
+			passphraseEnv + " environment variable.",
+		Annotations:       cmd.Annotations,
+		RunE:              runTunnelsExport,
+		SilenceErrors:     true,
+		DisableAutoGenTag: true,
+	}
+	exportCmd.Flags().StringP("output", "o", "", "File to write the bundle to")
+	exportCmd.Flags().String("passphrase-file", "", "File containing the bundle passphrase")
+	_ = exportCmd.MarkFlagRequired("output")
+
+	importCmd := &cobra.Command{
+		Use:   "import <bundle>",
+		Short: "Create tunnels from an encrypted bundle",
+		Long: "Creates the tunnels in a bundle written by \"tunnels export\". Tunnels whose\n" +
+			"hostname, IP, or port is already in use are conflicts, handled according to\n" +
+			"--conflicts. Restart mesh-manager afterwards to bring the tunnels up.",
+		Args:              cobra.ExactArgs(1),
+		Annotations:       cmd.Annotations,
+		RunE:              runTunnelsImport,
+		SilenceErrors:     true,
+		DisableAutoGenTag: true,
+	}
+	importCmd.Flags().String("passphrase-file", "", "File containing the bundle passphrase")
+	importCmd.Flags().String("conflicts", string(bundle.ConflictFail), "How to handle conflicting tunnels: fail, skip, or reassign")
+	importCmd.Flags().Bool("dry-run", false, "Report what would be imported without changing anything")
+
+	rotateCmd := &cobra.Command{
+		Use:   "rotate-keys [tunnel ID...]",
+		Short: "Give server tunnels new WireGuard keys",
+		Long: "Gives the listed server tunnels, or with --older-than-days every server tunnel\n" +
+			"whose keys are at least that old, a new client keypair. Clients may keep using\n" +
+			"their old key for the grace period, or until they connect with the new one.\n" +
+			"A running mesh-manager applies the new keys within a few seconds.",
+		Annotations:       cmd.Annotations,
+		RunE:              runTunnelsRotateKeys,
+		SilenceErrors:     true,
+		DisableAutoGenTag: true,
+	}
+	rotateCmd.Flags().Uint("older-than-days", 0, "Rotate every server tunnel whose keys are at least this many days old")
+	rotateCmd.Flags().Uint("grace-hours", 0, "Hours clients may keep using their old key, defaults to the configured grace period")
+	rotateCmd.Flags().Bool("server-key", false, "Rotate the server key too, which ends the old keys immediately")
+	rotateCmd.Flags().String("endpoint", "", "Host clients connect to, used to print each tunnel's new wg-quick config. Defaults to the tunnel's public endpoint")
+
+	cmd.AddCommand(exportCmd, importCmd, rotateCmd)
+	return cmd
+}
+
+func runTunnelsExport(cmd *cobra.Command, _ []string) error {
+	cfg, err := loadCommandConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := readPassphrase(cmd)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.MakeDB(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+
+	b, err := bundle.Export(database, time.Now())
+	if err != nil {
+		return err
+	}
+	sealed, err := bundle.Seal(b, passphrase)
+	if err != nil {
+		return err
+	}
+
+	outPath, _ := cmd.Flags().GetString("output")
+	//nolint:gosec // operator-supplied output path
+	if err := os.WriteFile(outPath, sealed, 0600); err != nil {
+		return fmt.Errorf("failed to write bundle to %s: %w", outPath, err)
+	}
+	slog.Info("Exported tunnels", "count", len(b.Tunnels), "path", outPath)
+	return nil
+}
+
+func runTunnelsImport(cmd *cobra.Command, args []string) error {
+	cfg, err := loadCommandConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	conflicts, _ := cmd.Flags().GetString("conflicts")
+	mode := bundle.ConflictMode(conflicts)
+	if !mode.IsValid() {
+		return bundle.ErrInvalidConflictMode
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	passphrase, err := readPassphrase(cmd)
+	if err != nil {
+		return err
+	}
+
+	//nolint:gosec // operator-supplied bundle path
+	sealed, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read bundle: %w", err)
+	}
+	b, err := bundle.Open(sealed, passphrase)
+	if err != nil {
+		return err
+	}
+
+	database, err := db.MakeDB(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+
+	result, importErr := bundle.Import(database, cfg, b, mode, dryRun)
+	if importErr != nil && !errors.Is(importErr, bundle.ErrConflicts) {
+		return importErr
+	}
+
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	if importErr != nil {
+		return fmt.Errorf("%w, use --conflicts=skip or --conflicts=reassign to import the rest", importErr)
+	}
+	if dryRun {
+		slog.Info("Dry run, nothing was imported", "tunnels", len(result.Imported), "conflicts", len(result.Conflicts))
+		return nil
+	}
+	slog.Info("Imported tunnels, restart mesh-manager to bring them up", "tunnels", len(result.Imported), "conflicts", len(result.Conflicts))
+	return nil
+}
+
+type rotatedTunnel struct {
+	ID            uint       `json:"id"`
+	Hostname      string     `json:"hostname"`
+	Network       string     `json:"network"`
+	Password      string     `json:"password"`
+	KeyGraceUntil *time.Time `json:"key_grace_until"`
+	Config        string     `json:"config,omitempty"`
+}
+
+// selectRotateTunnels finds the tunnels given by ID, and the WireGuard
+// server tunnels whose keys are at least olderThan old. A tunnel selected
+// more than once is only returned once, so it isn't rotated twice. Tunnels
+// given by ID that can't be rotated are an error, so nothing is rotated
+// before finding out.
+func selectRotateTunnels(database *gorm.DB, ids []string, olderThan time.Duration, now time.Time) ([]models.Tunnel, error) {
+	var tunnels []models.Tunnel
+	selected := make(map[uint]struct{})
+	selectTunnel := func(tunnel models.Tunnel) {
+		if _, ok := selected[tunnel.ID]; ok {
+			return
+		}
+		selected[tunnel.ID] = struct{}{}
+		tunnels = append(tunnels, tunnel)
+	}
+
+	for _, arg := range ids {
+		id, err := strconv.ParseUint(arg, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tunnel ID %q", arg)
+		}
+		tunnel, err := models.FindTunnelByID(database, uint(id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find tunnel %d: %w", id, err)
+		}
+		if err := wireguard.CanRotateKeys(tunnel); err != nil {
+			return nil, fmt.Errorf("can't rotate keys for tunnel %d: %w", id, err)
+		}
+		selectTunnel(tunnel)
+	}
+	if olderThan > 0 {
+		serverTunnels, err := models.ListServerTunnels(database)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tunnels: %w", err)
+		}
+		for _, tunnel := range serverTunnels {
+			if !tunnel.Wireguard || tunnel.KeyAge(now) < olderThan {
+				continue
+			}
+			if err := wireguard.CanRotateKeys(tunnel); err != nil {
+				slog.Warn("Skipping tunnel", "tunnel", tunnel.Hostname, "error", err)
+				continue
+			}
+			selectTunnel(tunnel)
+		}
+	}
+	return tunnels, nil
+}
+
+func runTunnelsRotateKeys(cmd *cobra.Command, args []string) error {
+	cfg, err := loadCommandConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	olderThanDays, _ := cmd.Flags().GetUint("older-than-days")
+	if len(args) == 0 && olderThanDays == 0 {
+		return fmt.Errorf("give tunnel IDs or --older-than-days")
+	}
+	grace := time.Duration(cfg.Wireguard.KeyRotationGrace) * time.Hour
+	if cmd.Flags().Changed("grace-hours") {
+		graceHours, _ := cmd.Flags().GetUint("grace-hours")
+		grace = time.Duration(graceHours) * time.Hour
+	}
+	rotateServerKey, _ := cmd.Flags().GetBool("server-key")
+	endpoint, _ := cmd.Flags().GetString("endpoint")
+	if endpoint != "" {
+		if err := wireguard.ValidateEndpointHost(endpoint); err != nil {
+			return err
+		}
+	}
+
+	database, err := db.MakeDB(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+
+	now := time.Now()
+	tunnels, err := selectRotateTunnels(database, args, time.Duration(olderThanDays)*24*time.Hour, now)
+	if err != nil {
+		return err
+	}
+
+	// Each tunnel is saved as it's rotated, so what was rotated is printed
+	// even if a later tunnel fails, or its new keys would be lost
+	rotated := make([]rotatedTunnel, 0, len(tunnels))
+	var rotateErr error
+	for _, tunnel := range tunnels {
+		tunnel, err = wireguard.RotateKeys(database, tunnel, now, grace, rotateServerKey)
+		if err != nil {
+			rotateErr = fmt.Errorf("failed to rotate keys for %s: %w", tunnel.Hostname, err)
+			break
+		}
+		result := rotatedTunnel{
+			ID:            tunnel.ID,
+			Hostname:      tunnel.Hostname,
+			Network:       tunnel.IP,
+			Password:      tunnel.Password,
+			KeyGraceUntil: tunnel.KeyGraceUntil,
+		}
+		result.Config, err = rotatedClientConfig(cfg, tunnel, endpoint)
+		if err != nil {
+			// The password is enough to rebuild the config
+			slog.Error("Failed to make client config", "tunnel", tunnel.Hostname, "error", err)
+		}
+		rotated = append(rotated, result)
+	}
+
+	out, err := json.MarshalIndent(rotated, "", "  ")
+	if err != nil {
+		return errors.Join(rotateErr, err)
+	}
+	fmt.Println(string(out))
+	slog.Info("Rotated tunnel keys", "tunnels", len(rotated))
+	return rotateErr
+}
+
+// rotatedClientConfig builds the client's config with its new keys, or
+// returns an empty config if there is no endpoint to give it
+func rotatedClientConfig(cfg *config.Config, tunnel models.Tunnel, endpoint string) (string, error) {
+	switch {
+	case endpoint != "":
+		config, err := wireguard.NewClientConfig(tunnel, endpoint)
+		if err != nil {
+			return "", err
+		}
+		return config.WGQuick(), nil
+	case len(wireguard.PublicEndpoints(cfg, tunnel)) > 0:
+		config, err := wireguard.NewPublicClientConfig(cfg, tunnel)
+		if err != nil {
+			return "", err
+		}
+		return config.WGQuick(), nil
+	}
+	return "", nil
+}
+
+func loadCommandConfig(cmd *cobra.Command) (*config.Config, error) {
+	err := runRoot(cmd, nil)
+	if err != nil {
+		slog.Error("Encountered an error.", "error", err.Error())
+	}
+
+	c, err := configulator.FromContext[config.Config](cmd.Context())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config from context")
+	}
+
+	cfg, err := c.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg, nil
+}
+
+func readPassphrase(cmd *cobra.Command) (string, error) {
+	path, _ := cmd.Flags().GetString("passphrase-file")
+	if path == "" {
+		passphrase := os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			return "", fmt.Errorf("a passphrase is required, set --passphrase-file or %s", passphraseEnv)
+		}
+		return passphrase, nil
+	}
+	//nolint:gosec // operator-supplied passphrase path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
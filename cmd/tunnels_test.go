@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
+)
+
+func TestSelectRotateTunnels(t *testing.T) {
+	os.Setenv("TEST", "1")
+	database, err := db.MakeDB(&config.Config{PasswordSalt: "salt", InitialAdminUserPassword: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	serverKey, password, err := wireguard.GenerateServerTunnelKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale := models.Tunnel{Hostname: "N0CALL-OLD", IP: "172.31.0.4", Wireguard: true, WireguardServerKey: serverKey, Password: password, CreatedAt: now.Add(-60 * 24 * time.Hour)}
+	fresh := models.Tunnel{Hostname: "N0CALL-NEW", IP: "172.31.0.8", Wireguard: true, WireguardServerKey: serverKey, Password: password, CreatedAt: now}
+	client := models.Tunnel{Hostname: "hub.example.com:51820", IP: "172.31.0.12", Wireguard: true, Client: true, Password: password, CreatedAt: now.Add(-60 * 24 * time.Hour)}
+	vtunTunnel := models.Tunnel{Hostname: "N0CALL-VTUN", IP: "172.31.0.16", Password: "secret", CreatedAt: now.Add(-60 * 24 * time.Hour)}
+	for _, tunnel := range []*models.Tunnel{&stale, &fresh, &client, &vtunTunnel} {
+		err = database.Create(tunnel).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	staleID := strconv.FormatUint(uint64(stale.ID), 10)
+	freshID := strconv.FormatUint(uint64(fresh.ID), 10)
+
+	// The stale tunnel is given twice by ID and matches by age
+	tunnels, err := selectRotateTunnels(database, []string{staleID, freshID, staleID}, 30*24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tunnels) != 2 || tunnels[0].ID != stale.ID || tunnels[1].ID != fresh.ID {
+		t.Errorf("selectRotateTunnels() = %v, want tunnels %d and %d once each", tunnels, stale.ID, fresh.ID)
+	}
+
+	tunnels, err = selectRotateTunnels(database, nil, 30*24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tunnels) != 1 || tunnels[0].ID != stale.ID {
+		t.Errorf("selectRotateTunnels() = %v, want only tunnel %d", tunnels, stale.ID)
+	}
+
+	// Nothing is selected, and so nothing rotated, if any ID can't be
+	for _, ids := range [][]string{
+		{"abc"},
+		{staleID, strconv.FormatUint(uint64(client.ID), 10)},
+		{staleID, strconv.FormatUint(uint64(vtunTunnel.ID), 10)},
+	} {
+		if tunnels, err := selectRotateTunnels(database, ids, 0, now); err == nil {
+			t.Errorf("selectRotateTunnels(%v) = %v, want an error", ids, tunnels)
+		}
+	}
+}
@@ -64,6 +64,14 @@ ip route add blackhole 0.0.0.0/0 table 99
 
 ip address add dev br-dtdlink $NODE_IP/8
 
+# The node's IPv6 address is the first of the first /64 in the ULA prefix
+WIREGUARD_ULA_PREFIX=${WIREGUARD_ULA_PREFIX:-}
+if [ -n "$WIREGUARD_ULA_PREFIX" ]; then
+    NODE_IPV6="${WIREGUARD_ULA_PREFIX%%/*}1"
+    ip -6 address add dev br-dtdlink "$NODE_IPV6/64"
+    ip -6 rule add pref 120 lookup 20
+fi
+
 ip rule add pref 10 iif br-dtdlink lookup 29
 ip rule add pref 20 iif br-dtdlink lookup 20
 ip rule add pref 30 iif br-dtdlink lookup 21
@@ -84,12 +92,8 @@ iptables -I INPUT 1 -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT
 iptables -t nat -A POSTROUTING -o wg+ ! -d 255.255.255.255 -m addrtype --src-type LOCAL -j SNAT --to-source $NODE_IP
 
 mkdir -p /etc/meshlink
-echo "${NODE_IP} ${SERVER_NAME}" >> /etc/meshlink/hosts
-if [ -n "$SUPERNODE" ]; then
-    echo "${NODE_IP} supernode.${SERVER_NAME}.local.mesh" >> /etc/meshlink/hosts
-fi
-echo "${NODE_IP} dtdlink.${SERVER_NAME}.local.mesh" >> /etc/meshlink/hosts
-echo "http://${SERVER_NAME}/|tcp|${SERVER_NAME}-console" >> /etc/meshlink/services
+# /etc/meshlink/hosts and /etc/meshlink/services are written by
+# `mesh-manager generate` below
 
 # Create the publish file (not directory) for mesh services v1 format.
 # meshlink reads this as a single file containing JSON.
@@ -148,6 +152,10 @@ if [ -n "$WALKER" ]; then
     fi
 fi
 
+# LAN hosts and their DHCP reservations, written by `mesh-manager generate`
+echo 'addn-hosts=/var/run/hosts_local' >> /etc/dnsmasq.conf
+echo 'dhcp-hostsfile=/var/run/dhcp_hosts_local' >> /etc/dnsmasq.conf
+
 # Use the dnsmasq that's about to run
 echo -e 'search local.mesh\nnameserver 127.0.0.1' > /etc/resolv.conf
 
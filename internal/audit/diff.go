@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+// Redacted replaces the value of secret fields in a diff
+const Redacted = "[REDACTED]"
+
+// Fields can be tagged with `audit:"-"` to leave them out of diffs entirely,
+// or `audit:"redact"` to record that they changed without their values.
+const (
+	tagName   = "audit"
+	tagIgnore = "-"
+	tagRedact = "redact"
+)
+
+// Change is the before and after value of a single field.
+// A missing side means the object didn't exist on that side of the change.
+type Change struct {
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
+//nolint:gochecknoglobals
+var naming = schema.NamingStrategy{}
+
+// Diff compares two structs of the same type field by field and returns the
+// changed fields keyed by column name. Either side may be nil to record a
+// create or a delete.
+func Diff(before, after any) map[string]Change {
+	bv := indirect(reflect.ValueOf(before))
+	av := indirect(reflect.ValueOf(after))
+
+	var typ reflect.Type
+	switch {
+	case bv.IsValid():
+		typ = bv.Type()
+	case av.IsValid():
+		typ = av.Type()
+	default:
+		return nil
+	}
+	if typ.Kind() != reflect.Struct || (bv.IsValid() && av.IsValid() && bv.Type() != av.Type()) {
+		return nil
+	}
+
+	changes := make(map[string]Change)
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get(tagName)
+		if !field.IsExported() || tag == tagIgnore {
+			continue
+		}
+
+		var change Change
+		var beforeVal, afterVal reflect.Value
+		if bv.IsValid() {
+			beforeVal = bv.Field(i)
+		}
+		if av.IsValid() {
+			afterVal = av.Field(i)
+		}
+
+		if beforeVal.IsValid() && afterVal.IsValid() && reflect.DeepEqual(beforeVal.Interface(), afterVal.Interface()) {
+			continue
+		}
+
+		change.Before = fieldValue(beforeVal, tag == tagRedact)
+		change.After = fieldValue(afterVal, tag == tagRedact)
+		if change.Before == nil && change.After == nil {
+			continue
+		}
+
+		changes[columnName(field)] = change
+	}
+
+	return changes
+}
+
+// columnName is the field's column, as named by its gorm tag if it has one
+func columnName(field reflect.StructField) string {
+	if column, ok := schema.ParseTagSetting(field.Tag.Get("gorm"), ";")["COLUMN"]; ok && column != "" {
+		return column
+	}
+	return naming.ColumnName("", field.Name)
+}
+
+func fieldValue(v reflect.Value, redact bool) any {
+	if !v.IsValid() {
+		return nil
+	}
+	if redact {
+		if v.IsZero() {
+			return nil
+		}
+		return Redacted
+	}
+	return v.Interface()
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,90 @@
+package audit_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/audit"
+)
+
+type thing struct {
+	Hostname  string
+	Password  string `audit:"redact"`
+	Active    bool   `audit:"-"`
+	Port      uint16
+	unexposed string
+}
+
+type columnThing struct {
+	IPv6 string `gorm:"column:ipv6"`
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		before any
+		after  any
+		want   map[string]audit.Change
+	}{
+		{
+			name:   "create",
+			before: nil,
+			after:  &thing{Hostname: "NODE", Password: "secret", Active: true, Port: 5527},
+			want: map[string]audit.Change{
+				"hostname": {After: "NODE"},
+				"password": {After: audit.Redacted},
+				"port":     {After: uint16(5527)},
+			},
+		},
+		{
+			name:   "delete",
+			before: thing{Hostname: "NODE"},
+			after:  nil,
+			want: map[string]audit.Change{
+				"hostname": {Before: "NODE"},
+				"port":     {Before: uint16(0)},
+			},
+		},
+		{
+			name:   "update",
+			before: thing{Hostname: "NODE", Password: "old", Active: false, Port: 1, unexposed: "a"},
+			after:  thing{Hostname: "NODE2", Password: "new", Active: true, Port: 1, unexposed: "b"},
+			want: map[string]audit.Change{
+				"hostname": {Before: "NODE", After: "NODE2"},
+				"password": {Before: audit.Redacted, After: audit.Redacted},
+			},
+		},
+		{
+			name:   "column tag",
+			before: columnThing{IPv6: "fd00::1"},
+			after:  columnThing{IPv6: "fd00::2"},
+			want: map[string]audit.Change{
+				"ipv6": {Before: "fd00::1", After: "fd00::2"},
+			},
+		},
+		{
+			name:   "no changes",
+			before: thing{Hostname: "NODE", Active: false},
+			after:  thing{Hostname: "NODE", Active: true},
+			want:   map[string]audit.Change{},
+		},
+		{
+			name:   "mismatched types",
+			before: thing{},
+			after:  struct{ Hostname string }{},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := audit.Diff(tt.before, tt.after)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package bandwidth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// HistoryFlushInterval is how often recorded traffic is written out
+	HistoryFlushInterval = time.Minute
+	// HistoryPruneInterval is how often buckets past their retention are deleted
+	HistoryPruneInterval = time.Hour
+
+	// NodeTrafficID is the tunnel ID the whole node's traffic is recorded under
+	NodeTrafficID = 0
+)
+
+type historyKey struct {
+	tunnelID uint
+	minute   time.Time
+}
+
+type historyTraffic struct {
+	rx uint64
+	tx uint64
+}
+
+// History rolls traffic up into minute, hour, and day buckets. Traffic is
+// held in memory and written out once a minute so that the database sees
+// one write per tunnel per resolution rather than one per sample.
+type History struct {
+	mu        sync.Mutex
+	db        *gorm.DB
+	clock     clock.Clock
+	pending   map[historyKey]historyTraffic
+	lastPrune time.Time
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewHistory(db *gorm.DB, clk clock.Clock) *History {
+	return &History{
+		db:      db,
+		clock:   clk,
+		pending: make(map[historyKey]historyTraffic),
+	}
+}
+
+// Record adds traffic to the tunnel's history and to the node's
+func (h *History) Record(tunnelID uint, rxBytes, txBytes uint64) {
+	if rxBytes == 0 && txBytes == 0 {
+		return
+	}
+	minute := h.clock.Now().UTC().Truncate(models.TrafficMinute)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, id := range []uint{tunnelID, NodeTrafficID} {
+		key := historyKey{tunnelID: id, minute: minute}
+		traffic := h.pending[key]
+		traffic.rx += rxBytes
+		traffic.tx += txBytes
+		h.pending[key] = traffic
+	}
+}
+
+func (h *History) Start() error {
+	if h.cancel != nil {
+		return fmt.Errorf("traffic history already running")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.done = make(chan struct{})
+
+	go func() {
+		defer close(h.done)
+		ticker := time.NewTicker(HistoryFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			err := h.Flush()
+			if err != nil {
+				slog.Error("Failed to write traffic history", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops the flush loop and writes out any traffic still in memory
+func (h *History) Stop() error {
+	if h.cancel == nil {
+		return nil
+	}
+	h.cancel()
+	<-h.done
+	h.cancel = nil
+	return h.Flush()
+}
+
+// Flush writes recorded traffic to the database and prunes old buckets.
+// Traffic that fails to write is kept for the next flush.
+func (h *History) Flush() error {
+	h.mu.Lock()
+	pending := h.pending
+	h.pending = make(map[historyKey]historyTraffic)
+	h.mu.Unlock()
+
+	var firstErr error
+	for key, traffic := range pending {
+		err := h.write(key, traffic)
+		if err == nil {
+			continue
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		h.mu.Lock()
+		retry := h.pending[key]
+		retry.rx += traffic.rx
+		retry.tx += traffic.tx
+		h.pending[key] = retry
+		h.mu.Unlock()
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	now := h.clock.Now()
+	if now.Sub(h.lastPrune) < HistoryPruneInterval {
+		return nil
+	}
+	for _, resolution := range models.TrafficResolutions {
+		err := models.DeleteTrafficBefore(h.db, resolution, now.Add(-models.TrafficRetention[resolution]))
+		if err != nil {
+			return fmt.Errorf("failed to prune traffic history: %w", err)
+		}
+	}
+	h.lastPrune = now
+	return nil
+}
+
+// write adds one minute of traffic to the bucket of each resolution it falls in
+func (h *History) write(key historyKey, traffic historyTraffic) error {
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		for _, resolution := range models.TrafficResolutions {
+			err := models.AddTraffic(tx, key.tunnelID, resolution, key.minute.Truncate(resolution), traffic.rx, traffic.tx)
+			if err != nil {
+				return fmt.Errorf("failed to add traffic: %w", err)
+			}
+		}
+		return nil
+	})
+}
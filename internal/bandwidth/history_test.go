@@ -0,0 +1,153 @@
+package bandwidth_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/bandwidth"
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"gorm.io/gorm"
+)
+
+func newHistory(t *testing.T, now time.Time) (*bandwidth.History, *gorm.DB, *clock.Fake) {
+	t.Helper()
+	os.Setenv("TEST", "1")
+	database, err := db.MakeDB(&config.Config{PasswordSalt: "salt", InitialAdminUserPassword: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := clock.NewFake(now)
+	return bandwidth.NewHistory(database, clk), database, clk
+}
+
+// bucket returns the traffic in one bucket, or zero if there is none
+func bucket(t *testing.T, database *gorm.DB, tunnelID uint, resolution time.Duration, start time.Time) (uint64, uint64) {
+	t.Helper()
+	var buckets []models.TrafficBucket
+	err := database.Where("tunnel_id = ? AND resolution = ? AND start = ?", tunnelID, resolution, start.UTC()).Find(&buckets).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) == 0 {
+		return 0, 0
+	}
+	return buckets[0].RXBytes, buckets[0].TXBytes
+}
+
+func TestHistoryBuckets(t *testing.T) {
+	t.Parallel()
+	history, database, clk := newHistory(t, time.Date(2024, time.June, 3, 12, 30, 10, 0, time.UTC))
+
+	history.Record(1, 100, 10)
+	clk.Advance(20 * time.Second)
+	history.Record(1, 50, 5)
+	history.Record(2, 1000, 0)
+	// Nothing passed, so nothing is written
+	history.Record(3, 0, 0)
+	clk.Advance(time.Minute)
+	history.Record(1, 7, 3)
+	err := history.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		tunnelID   uint
+		resolution time.Duration
+		start      time.Time
+		rx, tx     uint64
+	}{
+		{"first minute", 1, models.TrafficMinute, time.Date(2024, time.June, 3, 12, 30, 0, 0, time.UTC), 150, 15},
+		{"second minute", 1, models.TrafficMinute, time.Date(2024, time.June, 3, 12, 31, 0, 0, time.UTC), 7, 3},
+		{"hour", 1, models.TrafficHour, time.Date(2024, time.June, 3, 12, 0, 0, 0, time.UTC), 157, 18},
+		{"day", 1, models.TrafficDay, time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC), 157, 18},
+		{"other tunnel", 2, models.TrafficHour, time.Date(2024, time.June, 3, 12, 0, 0, 0, time.UTC), 1000, 0},
+		{"no traffic", 3, models.TrafficHour, time.Date(2024, time.June, 3, 12, 0, 0, 0, time.UTC), 0, 0},
+		{"node", bandwidth.NodeTrafficID, models.TrafficDay, time.Date(2024, time.June, 3, 0, 0, 0, 0, time.UTC), 1157, 18},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rx, tx := bucket(t, database, tt.tunnelID, tt.resolution, tt.start)
+			if rx != tt.rx || tx != tt.tx {
+				t.Errorf("bucket = %d/%d, want %d/%d", rx, tx, tt.rx, tt.tx)
+			}
+		})
+	}
+}
+
+func TestHistoryFlushAddsToBuckets(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, time.June, 3, 12, 30, 0, 0, time.UTC)
+	history, database, _ := newHistory(t, start)
+
+	// Traffic in the same minute across flushes lands in one bucket
+	for range 2 {
+		history.Record(1, 100, 10)
+		err := history.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rx, tx := bucket(t, database, 1, models.TrafficMinute, start)
+	if rx != 200 || tx != 20 {
+		t.Errorf("bucket = %d/%d, want 200/20", rx, tx)
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, time.June, 3, 12, 0, 0, 0, time.UTC)
+	history, database, clk := newHistory(t, now)
+
+	buckets := []struct {
+		resolution time.Duration
+		age        time.Duration
+		kept       bool
+	}{
+		{models.TrafficMinute, models.TrafficRetention[models.TrafficMinute] - time.Minute, true},
+		{models.TrafficMinute, models.TrafficRetention[models.TrafficMinute] + time.Minute, false},
+		{models.TrafficHour, models.TrafficRetention[models.TrafficHour] - time.Hour, true},
+		{models.TrafficHour, models.TrafficRetention[models.TrafficHour] + time.Hour, false},
+		{models.TrafficDay, models.TrafficRetention[models.TrafficDay] - models.TrafficDay, true},
+		{models.TrafficDay, models.TrafficRetention[models.TrafficDay] + models.TrafficDay, false},
+	}
+	add := func() {
+		for _, b := range buckets {
+			err := models.AddTraffic(database, 1, b.resolution, now.Add(-b.age), 1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	check := func(afterPrune bool) {
+		t.Helper()
+		for _, b := range buckets {
+			rx, _ := bucket(t, database, 1, b.resolution, now.Add(-b.age))
+			if kept := rx != 0; kept != (b.kept || !afterPrune) {
+				t.Errorf("%v bucket %v old kept = %v, want %v", b.resolution, b.age, kept, b.kept || !afterPrune)
+			}
+		}
+	}
+
+	add()
+	err := history.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(true)
+
+	// Pruning waits for the prune interval
+	add()
+	clk.Advance(bandwidth.HistoryPruneInterval - time.Minute)
+	err = history.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(false)
+}
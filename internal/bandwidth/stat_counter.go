@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
 	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
 	"github.com/USA-RedDragon/mesh-manager/internal/events"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
@@ -20,18 +21,21 @@ type StatCounter struct {
 	lastTXBytes    uint64
 	lastNewRXBytes uint64
 	lastNewTXBytes uint64
+	quotaBytes     uint64
 	running        bool
 	db             *gorm.DB
 	RXBandwidth    uint64
 	TXBandwidth    uint64
 	statsCallback  func(rxMb float64, txMb float64)
+	history        *History
 	eventsChannel  chan events.Event
 }
 
-func newStatCounter(iface string, db *gorm.DB, events chan events.Event, statsCallback func(rxMb float64, txMb float64)) *StatCounter {
+func newStatCounter(iface string, db *gorm.DB, events chan events.Event, history *History, statsCallback func(rxMb float64, txMb float64)) *StatCounter {
 	return &StatCounter{
-		iface: iface,
-		db:    db,
+		iface:   iface,
+		db:      db,
+		history: history,
 		statsCallback: func(rxMb float64, txMb float64) {
 			if statsCallback != nil {
 				statsCallback(rxMb, txMb)
@@ -75,6 +79,7 @@ func (s *StatCounter) Start() error {
 				continue
 			}
 			newBytes := rxBytes - s.lastRXBytes
+			s.quotaBytes += newBytes
 			tunnel.RXBytes += newBytes
 			tunnel.TotalRXMB += float64(newBytes) / 1024 / 1024
 			if count != 0 && count%2 == 0 {
@@ -90,6 +95,7 @@ func (s *StatCounter) Start() error {
 				continue
 			}
 			newBytes = txBytes - s.lastTXBytes
+			s.quotaBytes += newBytes
 			tunnel.TXBytes += newBytes
 			tunnel.TotalTXMB += float64(newBytes) / 1024 / 1024
 			if count != 0 && count%2 == 0 {
@@ -97,7 +103,7 @@ func (s *StatCounter) Start() error {
 					count = 2
 				}
 				tunnel.TXBytesPerSec = s.lastNewTXBytes + newBytes
-				if err = s.db.Save(tunnel).Error; err != nil {
+				if err = s.save(tunnel); err != nil {
 					slog.Error("Error saving tunnel", "error", err)
 					continue
 				}
@@ -121,6 +127,7 @@ func (s *StatCounter) Start() error {
 				Data: wsTunnel,
 			}
 
+			s.history.Record(tunnel.ID, s.lastNewRXBytes, s.lastNewTXBytes)
 			s.statsCallback(float64(s.lastNewRXBytes)/1024/1024, float64(s.lastNewTXBytes)/1024/1024)
 
 			count++
@@ -129,6 +136,27 @@ func (s *StatCounter) Start() error {
 	return nil
 }
 
+// save writes only the traffic counters, so that changes made elsewhere while
+// the tunnel was loaded aren't overwritten. Quota usage is incremented in the
+// database since the quota enforcer resets it.
+func (s *StatCounter) save(tunnel models.Tunnel) error {
+	err := s.db.Model(&tunnel).Updates(map[string]interface{}{
+		"rx_bytes":                 tunnel.RXBytes,
+		"tx_bytes":                 tunnel.TXBytes,
+		"total_rx_mb":              tunnel.TotalRXMB,
+		"total_tx_mb":              tunnel.TotalTXMB,
+		"rx_bytes_per_sec":         tunnel.RXBytesPerSec,
+		"tx_bytes_per_sec":         tunnel.TXBytesPerSec,
+		"daily_quota_used_bytes":   gorm.Expr("daily_quota_used_bytes + ?", s.quotaBytes),
+		"monthly_quota_used_bytes": gorm.Expr("monthly_quota_used_bytes + ?", s.quotaBytes),
+	}).Error
+	if err != nil {
+		return err
+	}
+	s.quotaBytes = 0
+	return nil
+}
+
 func (s *StatCounter) Stop() {
 	s.running = false
 }
@@ -141,18 +169,24 @@ type StatCounterManager struct {
 	TotalTXMB        float64
 	TotalRXBandwidth uint64
 	TotalTXBandwidth uint64
+	History          *History
 	eventsChannel    chan events.Event
 }
 
 func NewStatCounterManager(db *gorm.DB, events chan events.Event) *StatCounterManager {
 	return &StatCounterManager{
 		db:            db,
+		History:       NewHistory(db, clock.Real{}),
 		eventsChannel: events,
 	}
 }
 
 func (s *StatCounterManager) Start() {
 	s.running = true
+	err := s.History.Start()
+	if err != nil {
+		slog.Error("Error starting traffic history", "error", err)
+	}
 	go func() {
 		time.Sleep(2 * time.Second)
 		for s.running {
@@ -163,7 +197,7 @@ func (s *StatCounterManager) Start() {
 }
 
 func (s *StatCounterManager) Add(iface string) error {
-	statCounter := newStatCounter(iface, s.db, s.eventsChannel, s.totalStatsUpdate)
+	statCounter := newStatCounter(iface, s.db, s.eventsChannel, s.History, s.totalStatsUpdate)
 	_, loaded := s.counters.LoadOrStore(iface, statCounter)
 	if loaded {
 		return fmt.Errorf("stat counter already exists for interface %s", iface)
@@ -253,5 +287,7 @@ func (s *StatCounterManager) Stop() error {
 		return true
 	})
 
+	errGrp.Go(s.History.Stop)
+
 	return errGrp.Wait()
 }
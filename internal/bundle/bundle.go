@@ -0,0 +1,227 @@
+// Package bundle exports tunnels into an encrypted, versioned file that can
+// be imported on another node, such as when moving a supernode to new hardware.
+//
+// A bundle is the magic bytes, a format version byte, an argon2id salt, an
+// AES-GCM nonce, and the AES-256-GCM sealed JSON payload. The header is
+// authenticated as additional data, so it can't be altered either.
+package bundle
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"golang.org/x/crypto/argon2"
+	"gorm.io/gorm"
+)
+
+// Version is the bundle format version written by Seal
+const Version = 1
+
+// MinPassphraseLength is the shortest passphrase a bundle can be sealed with
+const MinPassphraseLength = 12
+
+const (
+	saltLength  = 16
+	keyLength   = 32
+	memory      = 64 * 1024
+	iterations  = 3
+	parallelism = 4
+)
+
+//nolint:gochecknoglobals
+var magic = []byte("MMTB")
+
+var (
+	ErrInvalidBundle      = errors.New("not a tunnel bundle")
+	ErrUnsupportedVersion = errors.New("unsupported tunnel bundle version")
+	ErrDecrypt            = errors.New("wrong passphrase or corrupted bundle")
+	ErrPassphraseTooShort = fmt.Errorf("passphrase must be at least %d characters", MinPassphraseLength)
+	ErrNoRandom           = errors.New("no random source available")
+)
+
+// Bundle is the decrypted contents of a bundle file
+type Bundle struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Tunnels    []Tunnel  `json:"tunnels"`
+}
+
+// Tunnel is the portable part of a models.Tunnel. Traffic counters, sessions,
+// and other state tied to the old node are left behind.
+type Tunnel struct {
+	Hostname           string                 `json:"hostname"`
+	IP                 string                 `json:"ip"`
+	IPv6               string                 `json:"ipv6,omitempty"`
+	Password           string                 `json:"password"`
+	Enabled            bool                   `json:"enabled"`
+	Client             bool                   `json:"client"`
+	Wireguard          bool                   `json:"wireguard"`
+	WireguardServerKey string                 `json:"wireguard_server_key"`
+	WireguardPort      uint16                 `json:"wireguard_port"`
+	PublicEndpoint     string                 `json:"public_endpoint,omitempty"`
+	ExpiresAt          *time.Time             `json:"expires_at,omitempty"`
+	Schedule           *models.TunnelSchedule `json:"schedule,omitempty"`
+	DailyQuotaMB       uint64                 `json:"daily_quota_mb,omitempty"`
+	MonthlyQuotaMB     uint64                 `json:"monthly_quota_mb,omitempty"`
+	QuotaResetDay      uint8                  `json:"quota_reset_day,omitempty"`
+	QuotaPolicy        models.QuotaPolicy     `json:"quota_policy,omitempty"`
+	QuotaThrottleKbps  uint32                 `json:"quota_throttle_kbps,omitempty"`
+	RateLimit          models.TunnelRateLimit `json:"rate_limit"`
+	KeyRotatedAt       *time.Time             `json:"key_rotated_at,omitempty"`
+}
+
+func fromModel(t models.Tunnel) Tunnel {
+	return Tunnel{
+		Hostname:           t.Hostname,
+		IP:                 t.IP,
+		IPv6:               t.IPv6,
+		Password:           t.Password,
+		Enabled:            t.Enabled,
+		Client:             t.Client,
+		Wireguard:          t.Wireguard,
+		WireguardServerKey: t.WireguardServerKey,
+		WireguardPort:      t.WireguardPort,
+		PublicEndpoint:     t.PublicEndpoint,
+		ExpiresAt:          t.ExpiresAt,
+		Schedule:           t.Schedule,
+		DailyQuotaMB:       t.DailyQuota.LimitMB,
+		MonthlyQuotaMB:     t.MonthlyQuota.LimitMB,
+		QuotaResetDay:      t.QuotaResetDay,
+		QuotaPolicy:        t.QuotaPolicy,
+		QuotaThrottleKbps:  t.QuotaThrottleKbps,
+		RateLimit:          t.RateLimit,
+		KeyRotatedAt:       t.KeyRotatedAt,
+	}
+}
+
+func (t Tunnel) model() models.Tunnel {
+	return models.Tunnel{
+		Hostname:           t.Hostname,
+		IP:                 t.IP,
+		IPv6:               t.IPv6,
+		Password:           t.Password,
+		Enabled:            t.Enabled,
+		Client:             t.Client,
+		Wireguard:          t.Wireguard,
+		WireguardServerKey: t.WireguardServerKey,
+		WireguardPort:      t.WireguardPort,
+		PublicEndpoint:     t.PublicEndpoint,
+		ExpiresAt:          t.ExpiresAt,
+		Schedule:           t.Schedule,
+		DailyQuota:         models.TunnelQuota{LimitMB: t.DailyQuotaMB},
+		MonthlyQuota:       models.TunnelQuota{LimitMB: t.MonthlyQuotaMB},
+		QuotaResetDay:      t.QuotaResetDay,
+		QuotaPolicy:        t.QuotaPolicy,
+		QuotaThrottleKbps:  t.QuotaThrottleKbps,
+		RateLimit:          t.RateLimit,
+		KeyRotatedAt:       t.KeyRotatedAt,
+	}
+}
+
+// Export collects every tunnel into a bundle
+func Export(db *gorm.DB, now time.Time) (Bundle, error) {
+	tunnels, err := models.ListAllTunnels(db)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("failed to list tunnels: %w", err)
+	}
+	bundle := Bundle{
+		Version:    Version,
+		ExportedAt: now.UTC(),
+		Tunnels:    make([]Tunnel, 0, len(tunnels)),
+	}
+	for _, tunnel := range tunnels {
+		bundle.Tunnels = append(bundle.Tunnels, fromModel(tunnel))
+	}
+	return bundle, nil
+}
+
+// Seal encrypts the bundle with a key derived from the passphrase
+func Seal(bundle Bundle, passphrase string) ([]byte, error) {
+	if len(passphrase) < MinPassphraseLength {
+		return nil, ErrPassphraseTooShort
+	}
+	bundle.Version = Version
+	payload, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bundle: %w", err)
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, ErrNoRandom
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, ErrNoRandom
+	}
+
+	header := make([]byte, 0, len(magic)+1+saltLength+len(nonce))
+	header = append(header, magic...)
+	header = append(header, Version)
+	header = append(header, salt...)
+	header = append(header, nonce...)
+	return aead.Seal(header, nonce, payload, header), nil
+}
+
+// Open decrypts a bundle sealed by Seal
+func Open(data []byte, passphrase string) (Bundle, error) {
+	if len(data) < len(magic)+1 || !bytes.Equal(data[:len(magic)], magic) {
+		return Bundle{}, ErrInvalidBundle
+	}
+	if data[len(magic)] != Version {
+		return Bundle{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[len(magic)])
+	}
+
+	offset := len(magic) + 1
+	if len(data) < offset+saltLength {
+		return Bundle{}, ErrInvalidBundle
+	}
+	salt := data[offset : offset+saltLength]
+	offset += saltLength
+
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return Bundle{}, err
+	}
+	if len(data) < offset+aead.NonceSize() {
+		return Bundle{}, ErrInvalidBundle
+	}
+	nonce := data[offset : offset+aead.NonceSize()]
+	offset += aead.NonceSize()
+
+	payload, err := aead.Open(nil, nonce, data[offset:], data[:offset])
+	if err != nil {
+		return Bundle{}, ErrDecrypt
+	}
+
+	var bundle Bundle
+	err = json.Unmarshal(payload, &bundle)
+	if err != nil {
+		return Bundle{}, fmt.Errorf("%w: %w", ErrInvalidBundle, err)
+	}
+	return bundle, nil
+}
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(passphrase), salt, iterations, memory, parallelism, keyLength)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
@@ -0,0 +1,84 @@
+package bundle_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/bundle"
+)
+
+const passphrase = "correct horse battery staple"
+
+func TestSealOpen(t *testing.T) {
+	t.Parallel()
+	want := bundle.Bundle{
+		ExportedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Tunnels: []bundle.Tunnel{
+			{Hostname: "KI5VMF-HOME", IP: "172.31.0.2", Password: "secret", Enabled: true, Wireguard: true, WireguardServerKey: "key", WireguardPort: 5527},
+		},
+	}
+
+	sealed, err := bundle.Seal(want, passphrase)
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+
+	got, err := bundle.Open(sealed, passphrase)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if got.Version != bundle.Version {
+		t.Errorf("Version = %d, want %d", got.Version, bundle.Version)
+	}
+	if !got.ExportedAt.Equal(want.ExportedAt) {
+		t.Errorf("ExportedAt = %v, want %v", got.ExportedAt, want.ExportedAt)
+	}
+	if len(got.Tunnels) != 1 || got.Tunnels[0] != want.Tunnels[0] {
+		t.Errorf("Tunnels = %+v, want %+v", got.Tunnels, want.Tunnels)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	t.Parallel()
+	sealed, err := bundle.Seal(bundle.Bundle{}, passphrase)
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	futureVersion := append([]byte{}, sealed...)
+	futureVersion[4] = bundle.Version + 1
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase string
+		want       error
+	}{
+		{"wrong passphrase", sealed, "incorrect horse battery", bundle.ErrDecrypt},
+		{"tampered", tampered, passphrase, bundle.ErrDecrypt},
+		{"future version", futureVersion, passphrase, bundle.ErrUnsupportedVersion},
+		{"not a bundle", []byte("{\"tunnels\":[]}"), passphrase, bundle.ErrInvalidBundle},
+		{"truncated", sealed[:10], passphrase, bundle.ErrInvalidBundle},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := bundle.Open(tt.data, tt.passphrase)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Open() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSealShortPassphrase(t *testing.T) {
+	t.Parallel()
+	_, err := bundle.Seal(bundle.Bundle{}, "short")
+	if !errors.Is(err, bundle.ErrPassphraseTooShort) {
+		t.Errorf("Seal() error = %v, want %v", err, bundle.ErrPassphraseTooShort)
+	}
+}
@@ -0,0 +1,293 @@
+package bundle
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/ipam"
+	"gorm.io/gorm"
+)
+
+// ConflictMode decides what happens to a bundled tunnel that clashes with an
+// existing one
+type ConflictMode string
+
+const (
+	// ConflictFail imports nothing if any tunnel conflicts
+	ConflictFail ConflictMode = "fail"
+	// ConflictSkip imports every tunnel that doesn't conflict
+	ConflictSkip ConflictMode = "skip"
+	// ConflictReassign gives hosted tunnels the next free IP and port, the
+	// same as a newly created tunnel. Their clients will need the new
+	// details. Conflicts that can't be reassigned are skipped.
+	ConflictReassign ConflictMode = "reassign"
+)
+
+var (
+	ErrConflicts           = errors.New("bundle conflicts with existing tunnels")
+	ErrInvalidConflictMode = errors.New("conflict mode must be fail, skip, or reassign")
+	errDryRun              = errors.New("dry run")
+)
+
+func (m ConflictMode) IsValid() bool {
+	switch m {
+	case ConflictFail, ConflictSkip, ConflictReassign:
+		return true
+	}
+	return false
+}
+
+// Conflict is a bundled tunnel field that clashes with an existing tunnel,
+// or with this node's address pool
+type Conflict struct {
+	Hostname string `json:"hostname"`
+	Field    string `json:"field"`
+	Value    string `json:"value"`
+	// ExistingID is zero if the conflict isn't with a tunnel
+	ExistingID uint   `json:"existing_id"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Imported is a tunnel created by an import
+type Imported struct {
+	ID            uint   `json:"id"`
+	Hostname      string `json:"hostname"`
+	IP            string `json:"ip"`
+	IPv6          string `json:"ipv6,omitempty"`
+	WireguardPort uint16 `json:"wireguard_port"`
+	Reassigned    bool   `json:"reassigned"`
+}
+
+type Result struct {
+	Imported  []Imported `json:"imported"`
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+// Import creates the bundle's tunnels in a single transaction. A dry run
+// reports what would happen without changing anything. If mode is
+// ConflictFail and anything conflicts, the conflicts are returned with
+// ErrConflicts.
+func Import(db *gorm.DB, cfg *config.Config, bundle Bundle, mode ConflictMode, dryRun bool) (Result, error) {
+	if !mode.IsValid() {
+		return Result{}, ErrInvalidConflictMode
+	}
+
+	var result Result
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, bundled := range bundle.Tunnels {
+			tunnel := bundled.model()
+			err := rehomeIPv6(tx, cfg, &tunnel)
+			if err != nil {
+				return err
+			}
+			conflicts, err := findConflicts(tx, cfg, tunnel)
+			if err != nil {
+				return err
+			}
+
+			reassigned := false
+			if len(conflicts) > 0 && mode == ConflictReassign && hostsTunnel(tunnel) && reassignable(conflicts) {
+				err = reassign(tx, cfg, &tunnel)
+				if err != nil {
+					return err
+				}
+				reassigned = true
+			} else if len(conflicts) > 0 {
+				result.Conflicts = append(result.Conflicts, conflicts...)
+				continue
+			}
+
+			err = createTunnel(tx, &tunnel)
+			if err != nil {
+				return err
+			}
+			result.Imported = append(result.Imported, Imported{
+				ID:            tunnel.ID,
+				Hostname:      tunnel.Hostname,
+				IP:            tunnel.IP,
+				IPv6:          tunnel.IPv6,
+				WireguardPort: tunnel.WireguardPort,
+				Reassigned:    reassigned,
+			})
+		}
+
+		if mode == ConflictFail && len(result.Conflicts) > 0 {
+			return ErrConflicts
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return result, nil
+	}
+	if errors.Is(err, ErrConflicts) {
+		result.Imported = nil
+	}
+	return result, err
+}
+
+// hostsTunnel returns true for tunnels this node listens for, whose IP and
+// port it assigned
+func hostsTunnel(tunnel models.Tunnel) bool {
+	return tunnel.Wireguard && !tunnel.Client
+}
+
+// reassignable returns true if new IP and port assignments would resolve
+// every conflict
+func reassignable(conflicts []Conflict) bool {
+	for _, conflict := range conflicts {
+		if conflict.Field == "hostname" {
+			return false
+		}
+	}
+	return true
+}
+
+func findConflicts(tx *gorm.DB, cfg *config.Config, tunnel models.Tunnel) ([]Conflict, error) {
+	var conflicts []Conflict
+
+	if hostsTunnel(tunnel) {
+		var existing models.Tunnel
+		err := tx.Where("hostname = ? AND wireguard = ? AND client = ?", tunnel.Hostname, true, false).Limit(1).Find(&existing).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to check hostname: %w", err)
+		}
+		if existing.ID != 0 {
+			conflicts = append(conflicts, Conflict{Hostname: tunnel.Hostname, Field: "hostname", Value: tunnel.Hostname, ExistingID: existing.ID})
+		}
+
+		conflict, err := checkPoolIP(tx, cfg, tunnel)
+		if err != nil {
+			return nil, err
+		}
+		if conflict != nil {
+			conflicts = append(conflicts, *conflict)
+		}
+	} else {
+		var existing models.Tunnel
+		err := tx.Where("ip = ?", tunnel.IP).Limit(1).Find(&existing).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to check IP: %w", err)
+		}
+		if existing.ID != 0 {
+			conflicts = append(conflicts, Conflict{Hostname: tunnel.Hostname, Field: "ip", Value: tunnel.IP, ExistingID: existing.ID})
+		}
+	}
+
+	if tunnel.IPv6 != "" {
+		var existing models.Tunnel
+		err := tx.Where("ipv6 = ?", tunnel.IPv6).Limit(1).Find(&existing).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to check IPv6 address: %w", err)
+		}
+		if existing.ID != 0 {
+			conflicts = append(conflicts, Conflict{Hostname: tunnel.Hostname, Field: "ipv6", Value: tunnel.IPv6, ExistingID: existing.ID})
+		}
+	}
+
+	// Zero lets the kernel pick a port, so any number of tunnels can share it
+	if tunnel.Wireguard && tunnel.WireguardPort != 0 {
+		var existing models.Tunnel
+		err := tx.Where("wireguard = ? AND wireguard_port = ?", true, tunnel.WireguardPort).Limit(1).Find(&existing).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to check port: %w", err)
+		}
+		if existing.ID != 0 {
+			conflicts = append(conflicts, Conflict{Hostname: tunnel.Hostname, Field: "port", Value: strconv.FormatUint(uint64(tunnel.WireguardPort), 10), ExistingID: existing.ID})
+		}
+	}
+
+	return conflicts, nil
+}
+
+// checkPoolIP returns a conflict if a hosted tunnel's IP isn't a free block
+// of this node's pool, the same as one pinned when creating a tunnel. The
+// bundle may be from a node with another pool, or a block may be reserved
+// here.
+func checkPoolIP(tx *gorm.DB, cfg *config.Config, tunnel models.Tunnel) (*Conflict, error) {
+	pool, err := ipam.PoolFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	state, err := ipam.Load(tx, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	conflict := &Conflict{Hostname: tunnel.Hostname, Field: "ip", Value: tunnel.IP}
+	addr, err := netip.ParseAddr(tunnel.IP)
+	if err != nil {
+		conflict.Reason = ipam.ErrInvalidAddress.Error()
+		return conflict, nil
+	}
+	addr = addr.Unmap()
+	err = state.Check(addr)
+	if err == nil {
+		return nil, nil
+	}
+	conflict.Reason = err.Error()
+	if errors.Is(err, ipam.ErrBlockInUse) {
+		for _, allocation := range state.Allocations {
+			if allocation.Block.Contains(addr) {
+				conflict.ExistingID = allocation.TunnelID
+				break
+			}
+		}
+	}
+	return conflict, nil
+}
+
+func reassign(tx *gorm.DB, cfg *config.Config, tunnel *models.Tunnel) error {
+	var err error
+	tunnel.IP, err = ipam.Allocate(tx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to get next IP: %w", err)
+	}
+	if tunnel.IPv6 != "" {
+		tunnel.IPv6, err = models.GetNextWireguardIPv6(tx, cfg)
+		if err != nil {
+			return fmt.Errorf("failed to get next IPv6 address: %w", err)
+		}
+	}
+	tunnel.WireguardPort, err = models.GetNextWireguardPort(tx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to get next port: %w", err)
+	}
+	return nil
+}
+
+// rehomeIPv6 gives a hosted tunnel an IPv6 address from this node's ULA
+// prefix if it doesn't already have one, since the address it was exported
+// with may be from another node's. Tunnels lose their address if IPv6 is
+// turned off here.
+func rehomeIPv6(tx *gorm.DB, cfg *config.Config, tunnel *models.Tunnel) error {
+	if !hostsTunnel(*tunnel) {
+		return nil
+	}
+	if prefix, ok := cfg.Wireguard.ULA(); ok && tunnel.IPv6 != "" {
+		addr, err := netip.ParseAddr(tunnel.IPv6)
+		if err == nil && prefix.Contains(addr) {
+			return nil
+		}
+	}
+	var err error
+	tunnel.IPv6, err = models.GetNextWireguardIPv6(tx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to get next IPv6 address: %w", err)
+	}
+	return nil
+}
+
+func createTunnel(tx *gorm.DB, tunnel *models.Tunnel) error {
+	err := models.CreateTunnel(tx, tunnel)
+	if err != nil {
+		return fmt.Errorf("failed to create tunnel %s: %w", tunnel.Hostname, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package bundle_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/bundle"
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/ipam"
+)
+
+func TestImportPoolConflicts(t *testing.T) {
+	t.Parallel()
+	os.Setenv("TEST", "1")
+	cfg := &config.Config{
+		PasswordSalt:             "salt",
+		InitialAdminUserPassword: "password",
+		Wireguard:                config.Wireguard{Pool: "172.30.0.0/24", StartingPort: 5527},
+	}
+	database, err := db.MakeDB(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := models.Tunnel{Hostname: "KI5VMF-A", IP: "172.30.0.0", Wireguard: true, WireguardPort: 5527}
+	err = database.Create(&existing).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = database.Create(&models.IPReservation{CIDR: "172.30.0.64/26"}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		ip         string
+		mode       bundle.ConflictMode
+		reason     error
+		existingID uint
+		// imported is the address the tunnel is imported with
+		imported string
+	}{
+		{name: "free block", ip: "172.30.0.8", mode: bundle.ConflictSkip, imported: "172.30.0.8"},
+		{name: "block in use", ip: "172.30.0.0", mode: bundle.ConflictSkip, reason: ipam.ErrBlockInUse, existingID: existing.ID},
+		{name: "not a block start", ip: "172.30.0.9", mode: bundle.ConflictSkip, reason: ipam.ErrNotBlockStart},
+		{name: "outside the pool", ip: "172.31.0.0", mode: bundle.ConflictSkip, reason: ipam.ErrNotInPool},
+		{name: "reserved", ip: "172.30.0.64", mode: bundle.ConflictSkip, reason: ipam.ErrBlockReserved},
+		{name: "reserved and reassigned", ip: "172.30.0.64", mode: bundle.ConflictReassign, imported: "172.30.0.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b := bundle.Bundle{Tunnels: []bundle.Tunnel{{Hostname: "KI5VMF-B", IP: tt.ip, Wireguard: true, WireguardPort: 5600}}}
+			result, err := bundle.Import(database, cfg, b, tt.mode, true)
+			if err != nil {
+				t.Fatalf("Import() error = %v", err)
+			}
+
+			if tt.reason == nil {
+				if len(result.Imported) != 1 || len(result.Conflicts) != 0 {
+					t.Fatalf("Import() = %+v, want one tunnel imported", result)
+				}
+				imported := result.Imported[0]
+				if imported.IP != tt.imported || imported.Reassigned != (tt.mode == bundle.ConflictReassign) {
+					t.Errorf("imported %+v, want IP %s", imported, tt.imported)
+				}
+				return
+			}
+			if len(result.Imported) != 0 || len(result.Conflicts) != 1 {
+				t.Fatalf("Import() = %+v, want one conflict", result)
+			}
+			conflict := result.Conflicts[0]
+			if conflict.Field != "ip" || conflict.Reason != tt.reason.Error() || conflict.ExistingID != tt.existingID {
+				t.Errorf("conflict = %+v, want ip conflict %q with tunnel %d", conflict, tt.reason, tt.existingID)
+			}
+		})
+	}
+}
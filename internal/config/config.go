@@ -3,6 +3,10 @@ package config
 import (
 	"errors"
 	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/utils"
 )
 
 type LogLevel string
@@ -38,8 +42,151 @@ type Metrics struct {
 }
 
 type Wireguard struct {
+	// Pool is the CIDR tunnel /30s are given from. If it isn't set, the pool
+	// is the rest of StartingAddress's /16 after the StartingAddress block.
+	Pool            string `name:"pool" description:"CIDR to give tunnel /30s from. Defaults to the rest of the starting address's /16"`
 	StartingAddress string `name:"starting-address" description:"Starting address for Wireguard"`
 	StartingPort    uint16 `name:"starting-port" description:"Starting port for Wireguard" default:"5527"`
+	// KeyRotationGrace is how long, in hours, a client may keep using its
+	// old key after a rotation
+	KeyRotationGrace uint `name:"key-rotation-grace" description:"Hours a tunnel client may keep using its old key after a key rotation" default:"72"`
+	// ULAPrefix turns on IPv6. Each tunnel is given a /64 from it, and the
+	// node itself takes the first address of the first /64.
+	ULAPrefix string `name:"ula-prefix" description:"IPv6 ULA prefix, /48 to /56, to give tunnels addresses from. Leave empty for IPv4 only"`
+	// Endpoints are the public addresses peers reach this node at, most
+	// preferred first, for nodes behind NAT or with more than one WAN. A
+	// port on an endpoint is where a NAT forwards the starting port from,
+	// with the tunnel ports after it following in order.
+	Endpoints []string `name:"endpoints" description:"Public endpoints WireGuard clients connect to, as host or host:port, most preferred first. A port is the public port forwarded to the starting port"`
+}
+
+// WireguardEndpoint is a public address WireGuard peers reach this node at.
+// A zero Port means tunnels are reached on their listen ports.
+type WireguardEndpoint struct {
+	Host string
+	Port uint16
+}
+
+// ParseWireguardEndpoint parses a host or host:port. An IPv6 address with a
+// port goes in brackets.
+func ParseWireguardEndpoint(endpoint string) (WireguardEndpoint, error) {
+	host, portStr, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		if !utils.IsEndpointHost(endpoint) {
+			return WireguardEndpoint{}, ErrWireguardEndpointInvalid
+		}
+		return WireguardEndpoint{Host: endpoint}, nil
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 || !utils.IsEndpointHost(host) {
+		return WireguardEndpoint{}, ErrWireguardEndpointInvalid
+	}
+	return WireguardEndpoint{Host: host, Port: uint16(port)}, nil
+}
+
+// Address is the host:port a tunnel listening on listenPort is reached at.
+// With a Port, startingPort is reached at Port and the ports after it
+// follow. It returns false if the port doesn't fit once remapped.
+func (e WireguardEndpoint) Address(listenPort, startingPort uint16) (string, bool) {
+	port := int(listenPort)
+	if e.Port != 0 {
+		port = int(e.Port) + int(listenPort) - int(startingPort)
+	}
+	if port < 1 || port > 65535 {
+		return "", false
+	}
+	return net.JoinHostPort(e.Host, strconv.Itoa(port)), true
+}
+
+func (e WireguardEndpoint) String() string {
+	if e.Port == 0 {
+		return e.Host
+	}
+	return net.JoinHostPort(e.Host, strconv.FormatUint(uint64(e.Port), 10))
+}
+
+// PublicEndpoints parses Endpoints, skipping any that Validate would reject
+func (w Wireguard) PublicEndpoints() []WireguardEndpoint {
+	endpoints := make([]WireguardEndpoint, 0, len(w.Endpoints))
+	for _, raw := range w.Endpoints {
+		endpoint, err := ParseWireguardEndpoint(raw)
+		if err != nil {
+			continue
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+// AddressPool returns the prefix tunnel addresses are given from, and the
+// first address in it that may be given out
+func (w Wireguard) AddressPool() (netip.Prefix, netip.Addr, bool) {
+	if w.Pool != "" {
+		prefix, err := netip.ParsePrefix(w.Pool)
+		if err != nil {
+			return netip.Prefix{}, netip.Addr{}, false
+		}
+		prefix = prefix.Masked()
+		return prefix, prefix.Addr(), true
+	}
+	start, err := netip.ParseAddr(w.StartingAddress)
+	if err != nil || !start.Unmap().Is4() {
+		return netip.Prefix{}, netip.Addr{}, false
+	}
+	start = start.Unmap()
+	prefix, err := start.Prefix(16)
+	if err != nil {
+		return netip.Prefix{}, netip.Addr{}, false
+	}
+	// Tunnels have always started at the block after the starting address
+	first, err := start.Prefix(30)
+	if err != nil {
+		return netip.Prefix{}, netip.Addr{}, false
+	}
+	next := first.Addr()
+	for range 4 {
+		// Next carries into the higher bytes, and is invalid past the end
+		next = next.Next()
+	}
+	if !prefix.Contains(next) {
+		return netip.Prefix{}, netip.Addr{}, false
+	}
+	return prefix, next, true
+}
+
+// ULA returns the prefix tunnel IPv6 addresses are given from, or false if
+// IPv6 is turned off
+func (w Wireguard) ULA() (netip.Prefix, bool) {
+	if w.ULAPrefix == "" {
+		return netip.Prefix{}, false
+	}
+	prefix, err := netip.ParsePrefix(w.ULAPrefix)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return prefix, true
+}
+
+// VTun runs legacy vtund tunnels next to WireGuard ones, for peers that
+// can't do WireGuard
+type VTun struct {
+	Enabled bool   `name:"enabled" description:"Enable legacy VTun tunnels" default:"false"`
+	Port    uint16 `name:"port" description:"Port the VTun server listens on" default:"5525"`
+}
+
+// Remediation recreates WireGuard tunnels that stay down while their peer
+// can still be reached over the rest of the mesh
+type Remediation struct {
+	Enabled bool `name:"enabled" description:"Recreate WireGuard tunnels that stay down while their peer is reachable over the mesh. Needs Babel" default:"false"`
+	// DownThreshold is how many minutes a tunnel must be down before the
+	// first attempt, and the first wait between attempts after it
+	DownThreshold uint `name:"down-threshold" description:"Minutes a tunnel must be down, with its peer reachable, before it is recreated" default:"5"`
+	// MaxBackoff caps the wait, in minutes, between attempts on a peer that
+	// keeps flapping
+	MaxBackoff uint `name:"max-backoff" description:"Most minutes to wait between attempts to recreate the same tunnel" default:"60"`
+	// MaxAttempts stops attempts on a tunnel until it comes back up, so a
+	// peer that can never connect isn't torn down forever
+	MaxAttempts uint `name:"max-attempts" description:"Attempts to recreate a tunnel before giving up until it comes back up. Zero never gives up" default:"10"`
 }
 
 type Config struct {
@@ -51,20 +198,25 @@ type Config struct {
 	InitialAdminUserPassword string    `name:"initial-admin-user-password" description:"Initial password for the admin user"`
 	Babel                    Babel     `name:"babel" description:"Babel routing settings"`
 	OLSR                     bool      `name:"olsr" description:"Enable OLSR routing" default:"true"`
+	OLSRTemplateDir          string    `name:"olsr-template-dir" description:"Directory of olsrd.conf templates that replace the built-in ones of the same name"`
 	CORSHosts                []string  `name:"cors-hosts" description:"CORS hosts for the API"`
 	TrustedProxies           []string  `name:"trusted-proxies" description:"Trusted proxies for the API"`
 	HIBPAPIKey               string    `name:"hibp-api-key" description:"Have I Been Pwned API key"`
 	ServerName               string    `name:"server-name" description:"Server name"`
 	Supernode                bool      `name:"supernode" description:"Enable supernode mode"`
 	NodeIP                   string    `name:"node-ip" description:"Node IP address"`
+	LANSubnet                string    `name:"lan-subnet" description:"CIDR of the LAN behind this node, which local hosts must be in"`
 	Latitude                 float64   `name:"latitude" description:"Server latitude"`
 	Longitude                float64   `name:"longitude" description:"Server longitude"`
 	Gridsquare               string    `name:"gridsquare" description:"Server gridsquare"`
 	Metrics                  Metrics   `name:"metrics" description:"Metrics settings"`
 	Wireguard                Wireguard `name:"wireguard" description:"Wireguard settings"`
+	VTun                     VTun      `name:"vtun" description:"Legacy VTun tunnel settings"`
 	SessionSecret            string    `name:"session-secret" description:"Session secret"`
 	LQM                      LQM       `name:"lqm" description:"Link Quality Monitoring settings"`
 	Walker                   bool      `name:"walker" description:"Enable periodic mesh walking to update meshmap" default:"false"`
+	// Remediation is off unless enabled, since it tears down interfaces
+	Remediation Remediation `name:"remediation" description:"Tunnel auto-remediation settings"`
 }
 
 type LQM struct {
@@ -77,17 +229,47 @@ var (
 	ErrNodeIPRequired                   = errors.New("node IP is required")
 	ErrNodeIPInvalid                    = errors.New("node IP is invalid")
 	ErrNodeIPNot10_8                    = errors.New("node IP is not in the 10.0.0.0/8 range")
+	ErrLANSubnetInvalid                 = errors.New("LAN subnet must be an IPv4 CIDR")
 	ErrPasswordSaltRequired             = errors.New("password salt is required")
 	ErrServerNameRequired               = errors.New("server name is required")
-	ErrWireguardStartingAddressRequired = errors.New("wireguard starting address is required")
+	ErrWireguardPoolInvalid             = errors.New("wireguard pool must be an IPv4 CIDR from /8 to /30")
+	ErrWireguardStartingAddressRequired = errors.New("wireguard starting address or pool is required")
 	ErrWireguardStartingAddressInvalid  = errors.New("wireguard starting address is invalid")
 	ErrWireguardStartingPortRequired    = errors.New("wireguard starting port is required")
 	ErrWireguardStartingPortInvalid     = errors.New("wireguard starting port is invalid")
+	ErrWireguardULAPrefixInvalid        = errors.New("wireguard ULA prefix must be a /48 to /56 in fc00::/7")
+	ErrWireguardEndpointInvalid         = errors.New("wireguard endpoint must be a host or host:port")
+	ErrVTunPortRequired                 = errors.New("vtun port is required when VTun is enabled")
+	ErrRemediationBabelRequired         = errors.New("babel is required when tunnel remediation is enabled")
+	ErrRemediationDownThresholdRequired = errors.New("remediation down threshold is required")
 	ErrMetricsPortRequired              = errors.New("metrics port is required")
 	ErrMetricsPortInvalid               = errors.New("metrics port is invalid")
 	ErrMetricsNodeExporterHostRequired  = errors.New("node exporter host is required")
 )
 
+// NodeIPv6 is this node's address in the ULA prefix, or empty if IPv6 is
+// turned off
+func (c Config) NodeIPv6() string {
+	prefix, ok := c.Wireguard.ULA()
+	if !ok {
+		return ""
+	}
+	return utils.ULAAddress(prefix, 0, 1).String()
+}
+
+// LAN returns the subnet behind this node that local hosts are on, or false
+// if it isn't set
+func (c Config) LAN() (netip.Prefix, bool) {
+	if c.LANSubnet == "" {
+		return netip.Prefix{}, false
+	}
+	prefix, err := netip.ParsePrefix(c.LANSubnet)
+	if err != nil || !prefix.Addr().Is4() {
+		return netip.Prefix{}, false
+	}
+	return prefix.Masked(), true
+}
+
 func (c Config) Validate() error {
 	if c.LogLevel != LogLevelDebug &&
 		c.LogLevel != LogLevelInfo &&
@@ -124,18 +306,31 @@ func (c Config) Validate() error {
 		return ErrNodeIPRequired
 	}
 
-	if c.Wireguard.StartingAddress == "" {
+	if c.Wireguard.Pool != "" {
+		prefix, err := netip.ParsePrefix(c.Wireguard.Pool)
+		if err != nil || !prefix.Addr().Is4() || prefix != prefix.Masked() ||
+			prefix.Bits() < 8 || prefix.Bits() > 30 {
+			return ErrWireguardPoolInvalid
+		}
+	} else if c.Wireguard.StartingAddress == "" {
 		return ErrWireguardStartingAddressRequired
 	}
 
-	ip := net.ParseIP(c.Wireguard.StartingAddress)
+	if c.Wireguard.StartingAddress != "" {
+		ip := net.ParseIP(c.Wireguard.StartingAddress)
 
-	if ip == nil {
-		return ErrWireguardStartingAddressInvalid
-	}
+		if ip == nil {
+			return ErrWireguardStartingAddressInvalid
+		}
 
-	if ip.To4() == nil {
-		return ErrWireguardStartingAddressInvalid
+		if ip.To4() == nil {
+			return ErrWireguardStartingAddressInvalid
+		}
+
+		// Without a pool, tunnels need room after the starting address
+		if _, _, ok := c.Wireguard.AddressPool(); !ok && c.Wireguard.Pool == "" {
+			return ErrWireguardStartingAddressInvalid
+		}
 	}
 
 	if c.Wireguard.StartingPort == 0 {
@@ -146,7 +341,41 @@ func (c Config) Validate() error {
 		return ErrWireguardStartingPortInvalid
 	}
 
-	ip = net.ParseIP(c.NodeIP)
+	if c.Wireguard.ULAPrefix != "" {
+		prefix, err := netip.ParsePrefix(c.Wireguard.ULAPrefix)
+		if err != nil || !prefix.Addr().Is6() || prefix != prefix.Masked() ||
+			prefix.Bits() < 48 || prefix.Bits() > 56 || !utils.IsULA(prefix.Addr()) {
+			return ErrWireguardULAPrefixInvalid
+		}
+	}
+
+	for _, endpoint := range c.Wireguard.Endpoints {
+		if _, err := ParseWireguardEndpoint(endpoint); err != nil {
+			return err
+		}
+	}
+
+	if c.LANSubnet != "" {
+		prefix, err := netip.ParsePrefix(c.LANSubnet)
+		if err != nil || !prefix.Addr().Is4() || prefix != prefix.Masked() {
+			return ErrLANSubnetInvalid
+		}
+	}
+
+	if c.VTun.Enabled && c.VTun.Port == 0 {
+		return ErrVTunPortRequired
+	}
+
+	if c.Remediation.Enabled {
+		if !c.Babel.Enabled {
+			return ErrRemediationBabelRequired
+		}
+		if c.Remediation.DownThreshold == 0 {
+			return ErrRemediationDownThresholdRequired
+		}
+	}
+
+	ip := net.ParseIP(c.NodeIP)
 
 	if ip == nil {
 		return ErrNodeIPInvalid
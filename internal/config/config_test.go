@@ -47,3 +47,206 @@ func TestLogLevelConstants(t *testing.T) {
 		})
 	}
 }
+
+func TestWireguardULAPrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		prefix string
+		valid  bool
+		nodeIP string
+	}{
+		{"", true, ""},
+		{"fd5e:1a2b:3c4d::/48", true, "fd5e:1a2b:3c4d::1"},
+		{"fd5e:1a2b:3c4d:ab00::/56", true, "fd5e:1a2b:3c4d:ab00::1"},
+		{"fd5e:1a2b:3c4d::/64", false, ""},
+		{"fd5e:1a2b::/32", false, ""},
+		{"fd5e:1a2b:3c4d::1/48", false, ""},
+		{"2001:db8::/48", false, ""},
+		{"10.0.0.0/8", false, ""},
+		{"fd5e::zz/48", false, ""},
+	}
+
+	defConfig, err := configulator.New[config.Config]().Default()
+	if err != nil {
+		t.Fatalf("failed to create default config: %v", err)
+	}
+	defConfig.PasswordSalt = "test-salt"
+	defConfig.ServerName = "test-server"
+	defConfig.NodeIP = "10.0.0.0"
+	defConfig.Wireguard.StartingAddress = "171.31.0.0"
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			t.Parallel()
+			cfg := defConfig
+			cfg.Wireguard.ULAPrefix = tt.prefix
+			err := cfg.Validate()
+			if tt.valid {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				if got := cfg.NodeIPv6(); got != tt.nodeIP {
+					t.Errorf("NodeIPv6() = %q, want %q", got, tt.nodeIP)
+				}
+			} else if !errors.Is(err, config.ErrWireguardULAPrefixInvalid) {
+				t.Errorf("Validate() error = %v, want %v", err, config.ErrWireguardULAPrefixInvalid)
+			}
+		})
+	}
+}
+
+func TestWireguardPool(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pool            string
+		startingAddress string
+		want            error
+	}{
+		{"", "172.31.0.0", nil},
+		{"172.30.0.0/16", "", nil},
+		{"172.30.8.0/22", "172.31.0.0", nil},
+		{"", "", config.ErrWireguardStartingAddressRequired},
+		{"", "172.31.255.252", config.ErrWireguardStartingAddressInvalid},
+		{"172.30.0.1/16", "", config.ErrWireguardPoolInvalid},
+		{"172.30.0.0/31", "", config.ErrWireguardPoolInvalid},
+		{"fd00::/48", "", config.ErrWireguardPoolInvalid},
+		{"172.30.0.0", "", config.ErrWireguardPoolInvalid},
+	}
+
+	defConfig, err := configulator.New[config.Config]().Default()
+	if err != nil {
+		t.Fatalf("failed to create default config: %v", err)
+	}
+	defConfig.PasswordSalt = "test-salt"
+	defConfig.ServerName = "test-server"
+	defConfig.NodeIP = "10.0.0.0"
+
+	for _, tt := range tests {
+		t.Run(tt.pool+" "+tt.startingAddress, func(t *testing.T) {
+			t.Parallel()
+			cfg := defConfig
+			cfg.Wireguard.Pool = tt.pool
+			cfg.Wireguard.StartingAddress = tt.startingAddress
+			if err := cfg.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWireguardAddressPool(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		pool            string
+		startingAddress string
+		prefix          string
+		first           string
+		ok              bool
+	}{
+		{"pool", "172.30.8.1/22", "", "172.30.8.0/22", "172.30.8.0", true},
+		{"starting address", "", "172.31.0.0", "172.31.0.0/16", "172.31.0.4", true},
+		{"mid block", "", "172.31.0.6", "172.31.0.0/16", "172.31.0.8", true},
+		{"end of third byte", "", "172.31.0.252", "172.31.0.0/16", "172.31.1.0", true},
+		{"carries into third byte", "", "172.31.1.253", "172.31.0.0/16", "172.31.2.0", true},
+		{"carries past third byte", "", "172.31.255.252", "", "", false},
+		{"end of the address space", "", "255.255.255.252", "", "", false},
+		{"invalid starting address", "", "172.31.0", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			w := config.Wireguard{Pool: tt.pool, StartingAddress: tt.startingAddress}
+			prefix, first, ok := w.AddressPool()
+			if ok != tt.ok {
+				t.Fatalf("AddressPool() ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if prefix.String() != tt.prefix || first.String() != tt.first {
+				t.Errorf("AddressPool() = %v, %v, want %v, %v", prefix, first, tt.prefix, tt.first)
+			}
+		})
+	}
+}
+
+func TestLANSubnet(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		subnet string
+		want   error
+	}{
+		{"", nil},
+		{"10.54.17.0/29", nil},
+		{"10.54.17.1/29", config.ErrLANSubnetInvalid},
+		{"fd00::/64", config.ErrLANSubnetInvalid},
+		{"10.54.17.0", config.ErrLANSubnetInvalid},
+	}
+
+	defConfig, err := configulator.New[config.Config]().Default()
+	if err != nil {
+		t.Fatalf("failed to create default config: %v", err)
+	}
+	defConfig.PasswordSalt = "test-salt"
+	defConfig.ServerName = "test-server"
+	defConfig.NodeIP = "10.0.0.0"
+	defConfig.Wireguard.StartingAddress = "172.31.0.0"
+
+	for _, tt := range tests {
+		t.Run(tt.subnet, func(t *testing.T) {
+			t.Parallel()
+			cfg := defConfig
+			cfg.LANSubnet = tt.subnet
+			if err := cfg.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+			if _, ok := cfg.LAN(); tt.want == nil && ok != (tt.subnet != "") {
+				t.Errorf("LAN() ok = %v", ok)
+			}
+		})
+	}
+}
+
+func TestWireguardEndpoint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		endpoint string
+		want     error
+		// address is where a tunnel listening on 5530 is reached, with
+		// tunnels starting at 5527
+		address string
+	}{
+		{"supernode.example.com", nil, "supernode.example.com:5530"},
+		{"203.0.113.7:6000", nil, "203.0.113.7:6003"},
+		{"2001:db8::1", nil, "[2001:db8::1]:5530"},
+		{"[2001:db8::1]:6000", nil, "[2001:db8::1]:6003"},
+		{"supernode.example.com:65534", nil, ""},
+		{"supernode.example.com:", config.ErrWireguardEndpointInvalid, ""},
+		{"supernode.example.com:0", config.ErrWireguardEndpointInvalid, ""},
+		{"https://supernode.example.com", config.ErrWireguardEndpointInvalid, ""},
+		{"supernode.example.com\nPostUp = rm -rf /", config.ErrWireguardEndpointInvalid, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			t.Parallel()
+			endpoint, err := config.ParseWireguardEndpoint(tt.endpoint)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("ParseWireguardEndpoint() error = %v, want %v", err, tt.want)
+			}
+			if err != nil {
+				return
+			}
+			address, ok := endpoint.Address(5530, 5527)
+			if address != tt.address || ok != (tt.address != "") {
+				t.Errorf("Address() = %q, %v, want %q", address, ok, tt.address)
+			}
+		})
+	}
+}
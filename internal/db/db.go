@@ -46,7 +46,7 @@ func MakeDB(config *config.Config) (*gorm.DB, error) {
 		slog.Info("Gorm database connection opened")
 	}
 
-	err = db.AutoMigrate(&models.AppSettings{}, &models.User{}, &models.Tunnel{})
+	err = migrate(db)
 	if err != nil {
 		return nil, fmt.Errorf("could not migrate database: %w", err)
 	}
@@ -97,3 +97,30 @@ func MakeDB(config *config.Config) (*gorm.DB, error) {
 
 	return db, nil
 }
+
+func migrate(db *gorm.DB) error {
+	// Checked before migrating, as adding the column fills it with the default
+	addingRoles := db.Migrator().HasTable(&models.User{}) && !db.Migrator().HasColumn(&models.User{}, "Role")
+
+	err := db.AutoMigrate(&models.AppSettings{}, &models.User{}, &models.Tunnel{}, &models.APIToken{}, &models.AuditEvent{}, &models.TrafficBucket{}, &models.TunnelSession{}, &models.IPReservation{}, &models.AdvertisedService{}, &models.LocalHost{})
+	if err != nil {
+		return err
+	}
+
+	return backfillUserRoles(db, addingRoles)
+}
+
+// backfillUserRoles makes users that existed before roles were introduced
+// admins, as they could do everything. If the role column was just added,
+// every existing user is one of them.
+func backfillUserRoles(db *gorm.DB, addingRoles bool) error {
+	query := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Model(&models.User{})
+	if !addingRoles {
+		query = query.Where("role IS NULL OR role = ?", "")
+	}
+	err := query.UpdateColumn("role", models.RoleAdmin).Error
+	if err != nil {
+		return fmt.Errorf("failed to backfill user roles: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMigrateBackfillsRoles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		// setup leaves the users table as an older release would have
+		setup func(t *testing.T, db *gorm.DB)
+	}{
+		{
+			name: "role column added",
+			setup: func(t *testing.T, db *gorm.DB) {
+				t.Helper()
+				type user struct {
+					ID       uint
+					Username string
+				}
+				if err := db.Table("users").AutoMigrate(&user{}); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Table("users").Create(&user{Username: "old"}).Error; err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "empty role",
+			setup: func(t *testing.T, db *gorm.DB) {
+				t.Helper()
+				type user struct {
+					ID       uint
+					Username string
+					Role     string
+				}
+				if err := db.Table("users").AutoMigrate(&user{}); err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Table("users").Create(&user{Username: "old"}).Error; err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.setup(t, db)
+
+			if err := migrate(db); err != nil {
+				t.Fatal(err)
+			}
+			var old models.User
+			if err := db.Where("username = ?", "old").First(&old).Error; err != nil {
+				t.Fatal(err)
+			}
+			if old.Role != models.RoleAdmin {
+				t.Errorf("existing user role = %q, want %q", old.Role, models.RoleAdmin)
+			}
+
+			// Migrating again leaves new users alone
+			created := models.User{Username: "new"}
+			if err := db.Create(&created).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := migrate(db); err != nil {
+				t.Fatal(err)
+			}
+			var fetched models.User
+			if err := db.First(&fetched, created.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if fetched.Role != models.RoleViewer {
+				t.Errorf("new user role = %q, want %q", fetched.Role, models.RoleViewer)
+			}
+		})
+	}
+}
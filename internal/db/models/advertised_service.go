@@ -0,0 +1,86 @@
+package models
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAdvertisedServiceNameInvalid     = errors.New("service name must be 1 to 64 characters without |, #, or quotes")
+	ErrAdvertisedServiceURLInvalid      = errors.New("service URL must be an absolute URL with a host, without |, #, quotes, or spaces")
+	ErrAdvertisedServiceProtocolInvalid = errors.New("service protocol must be tcp or udp")
+)
+
+// AdvertisedService is a service on this node, like a chat server or a
+// webcam, announced to the mesh through the OLSR nameservice plugin and
+// meshlink
+type AdvertisedService struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"uniqueIndex"`
+	// URL is where the service is reached. A port of 0 lists the service
+	// on the mesh without linking to it.
+	URL       string    `json:"url"`
+	Protocol  string    `json:"protocol"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at" audit:"-"`
+	UpdatedAt time.Time `json:"updated_at" audit:"-"`
+}
+
+// Validate checks that the service fits in a url|protocol|name line, which
+// is how both olsrd and meshlink carry services and how the services
+// parser reads them back
+func (s AdvertisedService) Validate() error {
+	if s.Name == "" || len(s.Name) > 64 || strings.ContainsAny(s.Name, "|#\"\n\r\t") {
+		return ErrAdvertisedServiceNameInvalid
+	}
+	if strings.ContainsAny(s.URL, "|#\"' \n\r\t") {
+		return ErrAdvertisedServiceURLInvalid
+	}
+	parsed, err := url.Parse(s.URL)
+	if err != nil || parsed.Scheme == "" || parsed.Hostname() == "" {
+		return ErrAdvertisedServiceURLInvalid
+	}
+	if s.Protocol != "tcp" && s.Protocol != "udp" {
+		return ErrAdvertisedServiceProtocolInvalid
+	}
+	return nil
+}
+
+// Line is the service as a url|protocol|name line
+func (s AdvertisedService) Line() string {
+	return s.URL + "|" + s.Protocol + "|" + s.Name
+}
+
+func FindAdvertisedServiceByID(db *gorm.DB, id uint) (AdvertisedService, error) {
+	var service AdvertisedService
+	err := db.First(&service, id).Error
+	return service, err
+}
+
+func ListAdvertisedServices(db *gorm.DB) ([]AdvertisedService, error) {
+	var services []AdvertisedService
+	err := db.Order("id asc").Find(&services).Error
+	return services, err
+}
+
+func ListEnabledAdvertisedServices(db *gorm.DB) ([]AdvertisedService, error) {
+	var services []AdvertisedService
+	err := db.Where("enabled = ?", true).Order("id asc").Find(&services).Error
+	return services, err
+}
+
+func DeleteAdvertisedService(db *gorm.DB, id uint) error {
+	return db.Delete(&AdvertisedService{}, id).Error
+}
+
+// AdvertisedServiceNameTaken is whether a service other than the one with
+// the given ID already has the name
+func AdvertisedServiceNameTaken(db *gorm.DB, name string, id uint) (bool, error) {
+	var count int64
+	err := db.Model(&AdvertisedService{}).Where("name = ? AND id != ?", name, id).Limit(1).Count(&count).Error
+	return count > 0, err
+}
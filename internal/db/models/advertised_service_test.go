@@ -0,0 +1,34 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+func TestAdvertisedServiceValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		service models.AdvertisedService
+		want    error
+	}{
+		{"valid", models.AdvertisedService{Name: "Chat", URL: "http://KI5VMF-HUB:8080/chat", Protocol: "tcp"}, nil},
+		{"unlinked", models.AdvertisedService{Name: "Weather Station", URL: "http://10.12.34.56:0/", Protocol: "udp"}, nil},
+		{"no name", models.AdvertisedService{URL: "http://KI5VMF-HUB/", Protocol: "tcp"}, models.ErrAdvertisedServiceNameInvalid},
+		{"separator in name", models.AdvertisedService{Name: "Chat|tcp", URL: "http://KI5VMF-HUB/", Protocol: "tcp"}, models.ErrAdvertisedServiceNameInvalid},
+		{"comment in name", models.AdvertisedService{Name: "Chat #1", URL: "http://KI5VMF-HUB/", Protocol: "tcp"}, models.ErrAdvertisedServiceNameInvalid},
+		{"relative url", models.AdvertisedService{Name: "Chat", URL: "/chat", Protocol: "tcp"}, models.ErrAdvertisedServiceURLInvalid},
+		{"fragment in url", models.AdvertisedService{Name: "Chat", URL: "http://KI5VMF-HUB/#chat", Protocol: "tcp"}, models.ErrAdvertisedServiceURLInvalid},
+		{"bad protocol", models.AdvertisedService{Name: "Chat", URL: "http://KI5VMF-HUB/", Protocol: "icmp"}, models.ErrAdvertisedServiceProtocolInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tt.service.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
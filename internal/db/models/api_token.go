@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Scope string
+
+const (
+	ScopeTunnelsRead  Scope = "tunnels:read"
+	ScopeTunnelsWrite Scope = "tunnels:write"
+	ScopeUsersRead    Scope = "users:read"
+	ScopeUsersWrite   Scope = "users:write"
+	ScopeAuditRead    Scope = "audit:read"
+	// Services are the daemons the server supervises, like olsrd and babeld
+	ScopeServicesRead  Scope = "services:read"
+	ScopeServicesWrite Scope = "services:write"
+)
+
+// AllScopes lists every scope an API token can be granted
+//
+//nolint:gochecknoglobals
+var AllScopes = []Scope{
+	ScopeTunnelsRead,
+	ScopeTunnelsWrite,
+	ScopeUsersRead,
+	ScopeUsersWrite,
+	ScopeAuditRead,
+	ScopeServicesRead,
+	ScopeServicesWrite,
+}
+
+func (s Scope) IsValid() bool {
+	for _, scope := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken authenticates automation against the API on behalf of its owner.
+// A token can never do more than its owner's role allows, and is further
+// limited to its scopes.
+type APIToken struct {
+	ID         uint           `json:"id" gorm:"primaryKey"`
+	Name       string         `json:"name"`
+	TokenHash  string         `json:"-" gorm:"uniqueIndex" audit:"redact"`
+	Prefix     string         `json:"prefix"`
+	UserID     uint           `json:"user_id" gorm:"index"`
+	User       User           `json:"-" audit:"-"`
+	Scopes     []Scope        `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt  *time.Time     `json:"expires_at"`
+	LastUsedAt *time.Time     `json:"last_used_at" audit:"-"`
+	CreatedAt  time.Time      `json:"created_at" audit:"-"`
+	UpdatedAt  time.Time      `json:"-" audit:"-"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index" audit:"-"`
+}
+
+func (t APIToken) HasScope(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (t APIToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && now.After(*t.ExpiresAt)
+}
+
+func FindAPITokenByHash(db *gorm.DB, hash string) (APIToken, error) {
+	var token APIToken
+	err := db.Preload("User").Where("token_hash = ?", hash).First(&token).Error
+	return token, err
+}
+
+func FindAPITokenByID(db *gorm.DB, id uint) (APIToken, error) {
+	var token APIToken
+	err := db.First(&token, id).Error
+	return token, err
+}
+
+func ListAPITokensForUser(db *gorm.DB, userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+	err := db.Where("user_id = ?", userID).Order("id asc").Find(&tokens).Error
+	return tokens, err
+}
+
+func CountAPITokensForUser(db *gorm.DB, userID uint) (int, error) {
+	var count int64
+	err := db.Model(&APIToken{}).Where("user_id = ?", userID).Count(&count).Error
+	return int(count), err
+}
+
+func TouchAPIToken(db *gorm.DB, id uint, now time.Time) error {
+	return db.Model(&APIToken{}).Where("id = ?", id).UpdateColumn("last_used_at", now).Error
+}
+
+func DeleteAPIToken(db *gorm.DB, id uint) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return tx.Unscoped().Delete(&APIToken{ID: id}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting api token: %w", err)
+	}
+	return nil
+}
+
+// DeleteAPITokensForUser revokes every token owned by a user
+func DeleteAPITokensForUser(db *gorm.DB, userID uint) error {
+	return db.Unscoped().Where("user_id = ?", userID).Delete(&APIToken{}).Error
+}
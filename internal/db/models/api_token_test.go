@@ -0,0 +1,42 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+func TestDeleteUserRevokesTokens(t *testing.T) {
+	t.Parallel()
+	database := newTestDB(t)
+
+	users := []models.User{{Username: "bob"}, {Username: "carol"}}
+	for i := range users {
+		err := database.Create(&users[i]).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = database.Create(&models.APIToken{Name: "ci", TokenHash: users[i].Username, UserID: users[i].ID}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := models.DeleteUser(database, users[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		user models.User
+		want int
+	}{{users[0], 0}, {users[1], 1}} {
+		var count int64
+		err = database.Unscoped().Model(&models.APIToken{}).Where("user_id = ?", tt.user.ID).Count(&count).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(count) != tt.want {
+			t.Errorf("%s has %d tokens, want %d", tt.user.Username, count, tt.want)
+		}
+	}
+}
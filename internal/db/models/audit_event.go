@@ -0,0 +1,104 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/audit"
+	"gorm.io/gorm"
+)
+
+// AuditAction is "<target type>.<verb>"
+type AuditAction string
+
+const (
+	AuditActionTunnelCreate     AuditAction = "tunnel.create"
+	AuditActionTunnelUpdate     AuditAction = "tunnel.update"
+	AuditActionTunnelDelete     AuditAction = "tunnel.delete"
+	AuditActionTunnelRotateKeys AuditAction = "tunnel.rotate_keys"
+	// AuditActionTunnelExport isn't a configuration change, but an export
+	// carries every tunnel's keys
+	AuditActionTunnelExport AuditAction = "tunnel.export"
+	AuditActionUserCreate   AuditAction = "user.create"
+	AuditActionUserUpdate   AuditAction = "user.update"
+	AuditActionUserDelete   AuditAction = "user.delete"
+	AuditActionUserUnlock   AuditAction = "user.unlock"
+	// AuditActionUserLoginFailed isn't a configuration change, but failed
+	// logins are kept alongside them so brute-force attempts can be traced
+	AuditActionUserLoginFailed AuditAction = "user.login_failed"
+	AuditActionAPITokenCreate  AuditAction = "api_token.create"
+	AuditActionAPITokenDelete  AuditAction = "api_token.delete"
+
+	AuditActionIPReservationCreate AuditAction = "ip_reservation.create"
+	AuditActionIPReservationDelete AuditAction = "ip_reservation.delete"
+
+	AuditActionAdvertisedServiceCreate AuditAction = "advertised_service.create"
+	AuditActionAdvertisedServiceUpdate AuditAction = "advertised_service.update"
+	AuditActionAdvertisedServiceDelete AuditAction = "advertised_service.delete"
+
+	AuditActionLocalHostCreate AuditAction = "local_host.create"
+	AuditActionLocalHostUpdate AuditAction = "local_host.update"
+	AuditActionLocalHostDelete AuditAction = "local_host.delete"
+
+	// Service actions change what is running rather than configuration,
+	// but an outage can be traced back to them
+	AuditActionServiceStart  AuditAction = "service.start"
+	AuditActionServiceStop   AuditAction = "service.stop"
+	AuditActionServiceReload AuditAction = "service.reload"
+)
+
+func (a AuditAction) TargetType() string {
+	targetType, _, _ := strings.Cut(string(a), ".")
+	return targetType
+}
+
+// AuditEvent is a persistent record of a configuration change.
+// Audit events are append-only, so they are never soft deleted.
+type AuditEvent struct {
+	ID         uint                    `json:"id" gorm:"primaryKey"`
+	ActorID    uint                    `json:"actor_id" gorm:"index"`
+	Actor      string                  `json:"actor"`
+	APITokenID *uint                   `json:"api_token_id"`
+	ClientIP   string                  `json:"client_ip"`
+	Action     AuditAction             `json:"action" gorm:"index"`
+	TargetType string                  `json:"target_type" gorm:"index"`
+	TargetID   uint                    `json:"target_id"`
+	Target     string                  `json:"target"`
+	Changes    map[string]audit.Change `json:"changes" gorm:"serializer:json"`
+	CreatedAt  time.Time               `json:"created_at" gorm:"index"`
+}
+
+type AuditEventFilter struct {
+	Action     string
+	TargetType string
+	TargetID   uint
+	ActorID    uint
+}
+
+func (f AuditEventFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.Action != "" {
+		db = db.Where("action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		db = db.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != 0 {
+		db = db.Where("target_id = ?", f.TargetID)
+	}
+	if f.ActorID != 0 {
+		db = db.Where("actor_id = ?", f.ActorID)
+	}
+	return db
+}
+
+func ListAuditEvents(db *gorm.DB, filter AuditEventFilter) ([]AuditEvent, error) {
+	var auditEvents []AuditEvent
+	err := filter.apply(db).Order("id desc").Find(&auditEvents).Error
+	return auditEvents, err
+}
+
+func CountAuditEvents(db *gorm.DB, filter AuditEventFilter) (int, error) {
+	var count int64
+	err := filter.apply(db.Model(&AuditEvent{})).Count(&count).Error
+	return int(count), err
+}
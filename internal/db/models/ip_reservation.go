@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// IPReservation keeps part of the tunnel address pool from being given to
+// tunnels
+type IPReservation struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	CIDR      string    `json:"cidr" gorm:"column:cidr;uniqueIndex"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at" audit:"-"`
+}
+
+func FindIPReservationByID(db *gorm.DB, id uint) (IPReservation, error) {
+	var reservation IPReservation
+	err := db.First(&reservation, id).Error
+	return reservation, err
+}
+
+func ListIPReservations(db *gorm.DB) ([]IPReservation, error) {
+	var reservations []IPReservation
+	err := db.Order("id asc").Find(&reservations).Error
+	return reservations, err
+}
+
+func DeleteIPReservation(db *gorm.DB, id uint) error {
+	return db.Delete(&IPReservation{}, id).Error
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLocalHostNameInvalid = errors.New("host name must be 1 to 63 letters, digits, or -, and not start or end with -")
+	ErrLocalHostIPInvalid   = errors.New("host IP must be an IPv4 address")
+	ErrLocalHostMACInvalid  = errors.New("host MAC must be a 48-bit MAC address")
+	ErrLocalHostNotInLAN    = errors.New("host IP must be a host address in the node's LAN subnet")
+	ErrLocalHostNameTaken   = errors.New("host name is already taken")
+	ErrLocalHostIPTaken     = errors.New("host IP is already taken")
+	ErrLocalHostMACTaken    = errors.New("host MAC is already taken")
+)
+
+//nolint:gochecknoglobals
+var localHostNameRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// LocalHost is a device on the LAN behind this node. dnsmasq resolves it
+// and, with a MAC, gives it a fixed DHCP lease. Advertised hosts are also
+// published to the mesh through OLSR and meshlink.
+type LocalHost struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"uniqueIndex"`
+	IP   string `json:"ip" gorm:"uniqueIndex"`
+	// MAC is optional, and only needed for a DHCP reservation
+	MAC       string    `json:"mac"`
+	Advertise bool      `json:"advertise"`
+	CreatedAt time.Time `json:"created_at" audit:"-"`
+	UpdatedAt time.Time `json:"updated_at" audit:"-"`
+}
+
+// Validate checks the host's fields, and that its IP is in lan but isn't
+// the subnet's network or broadcast address
+func (h LocalHost) Validate(lan netip.Prefix) error {
+	if !localHostNameRegex.MatchString(h.Name) {
+		return ErrLocalHostNameInvalid
+	}
+	ip, err := netip.ParseAddr(h.IP)
+	if err != nil || !ip.Is4() {
+		return ErrLocalHostIPInvalid
+	}
+	lan = lan.Masked()
+	if !lan.Contains(ip) || (lan.Bits() < 31 && (ip == lan.Addr() || !lan.Contains(ip.Next()))) {
+		return ErrLocalHostNotInLAN
+	}
+	if h.MAC != "" {
+		mac, err := net.ParseMAC(h.MAC)
+		if err != nil || len(mac) != 6 {
+			return ErrLocalHostMACInvalid
+		}
+	}
+	return nil
+}
+
+func FindLocalHostByID(db *gorm.DB, id uint) (LocalHost, error) {
+	var host LocalHost
+	err := db.First(&host, id).Error
+	return host, err
+}
+
+func ListLocalHosts(db *gorm.DB) ([]LocalHost, error) {
+	var hosts []LocalHost
+	err := db.Order("id asc").Find(&hosts).Error
+	return hosts, err
+}
+
+func ListAdvertisedLocalHosts(db *gorm.DB) ([]LocalHost, error) {
+	var hosts []LocalHost
+	err := db.Where("advertise = ?", true).Order("id asc").Find(&hosts).Error
+	return hosts, err
+}
+
+func DeleteLocalHost(db *gorm.DB, id uint) error {
+	return db.Delete(&LocalHost{}, id).Error
+}
+
+// CheckLocalHostTaken returns an error if another host already has the
+// host's name, in any case, its IP, or its MAC
+func CheckLocalHostTaken(db *gorm.DB, host LocalHost) error {
+	var others []LocalHost
+	query := db.Where("LOWER(name) = LOWER(?) OR ip = ?", host.Name, host.IP)
+	if host.MAC != "" {
+		query = query.Or("LOWER(mac) = LOWER(?)", host.MAC)
+	}
+	err := db.Where("id != ?", host.ID).Where(query).Order("id asc").Find(&others).Error
+	if err != nil {
+		return err
+	}
+	for _, other := range others {
+		switch {
+		case strings.EqualFold(other.Name, host.Name):
+			return ErrLocalHostNameTaken
+		case other.IP == host.IP:
+			return ErrLocalHostIPTaken
+		default:
+			return ErrLocalHostMACTaken
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package models_test
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+func TestLocalHostValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		host models.LocalHost
+		want error
+	}{
+		{"valid", models.LocalHost{Name: "KI5VMF-CAMERA", IP: "10.12.34.60"}, nil},
+		{"with mac", models.LocalHost{Name: "KI5VMF-PI", IP: "10.12.34.61", MAC: "B8:27:EB:00:00:01"}, nil},
+		{"no name", models.LocalHost{IP: "10.12.34.60"}, models.ErrLocalHostNameInvalid},
+		{"dotted name", models.LocalHost{Name: "camera.local.mesh", IP: "10.12.34.60"}, models.ErrLocalHostNameInvalid},
+		{"leading hyphen", models.LocalHost{Name: "-camera", IP: "10.12.34.60"}, models.ErrLocalHostNameInvalid},
+		{"ipv6", models.LocalHost{Name: "camera", IP: "fd00::60"}, models.ErrLocalHostIPInvalid},
+		{"bad ip", models.LocalHost{Name: "camera", IP: "10.12.34"}, models.ErrLocalHostIPInvalid},
+		{"long mac", models.LocalHost{Name: "camera", IP: "10.12.34.60", MAC: "00:00:00:00:fe:80:00:00"}, models.ErrLocalHostMACInvalid},
+		{"bad mac", models.LocalHost{Name: "camera", IP: "10.12.34.60", MAC: "camera"}, models.ErrLocalHostMACInvalid},
+		{"outside the lan", models.LocalHost{Name: "camera", IP: "10.12.35.60"}, models.ErrLocalHostNotInLAN},
+		{"network address", models.LocalHost{Name: "camera", IP: "10.12.34.56"}, models.ErrLocalHostNotInLAN},
+		{"broadcast address", models.LocalHost{Name: "camera", IP: "10.12.34.63"}, models.ErrLocalHostNotInLAN},
+	}
+	lan := netip.MustParsePrefix("10.12.34.56/29")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tt.host.Validate(lan); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckLocalHostTaken(t *testing.T) {
+	t.Parallel()
+	database := newTestDB(t)
+	existing := models.LocalHost{Name: "KI5VMF-PI", IP: "10.12.34.61", MAC: "b8:27:eb:00:00:01"}
+	err := database.Create(&existing).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		host models.LocalHost
+		want error
+	}{
+		{"free", models.LocalHost{Name: "KI5VMF-CAMERA", IP: "10.12.34.60", MAC: "b8:27:eb:00:00:02"}, nil},
+		{"no mac", models.LocalHost{Name: "KI5VMF-CAMERA", IP: "10.12.34.60"}, nil},
+		{"itself", models.LocalHost{ID: existing.ID, Name: "KI5VMF-PI", IP: "10.12.34.61", MAC: "b8:27:eb:00:00:01"}, nil},
+		{"name in another case", models.LocalHost{Name: "ki5vmf-pi", IP: "10.12.34.60"}, models.ErrLocalHostNameTaken},
+		{"ip", models.LocalHost{Name: "KI5VMF-CAMERA", IP: "10.12.34.61"}, models.ErrLocalHostIPTaken},
+		{"mac", models.LocalHost{Name: "KI5VMF-CAMERA", IP: "10.12.34.60", MAC: "B8:27:EB:00:00:01"}, models.ErrLocalHostMACTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := models.CheckLocalHostTaken(database, tt.host); !errors.Is(err, tt.want) {
+				t.Errorf("CheckLocalHostTaken() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Traffic is kept at three resolutions, each for its own retention
+const (
+	TrafficMinute = time.Minute
+	TrafficHour   = time.Hour
+	TrafficDay    = 24 * time.Hour
+
+	// MaxTrafficPoints caps the length of a series
+	MaxTrafficPoints = 10000
+)
+
+//nolint:gochecknoglobals
+var (
+	// TrafficResolutions are ordered from finest to coarsest
+	TrafficResolutions = []time.Duration{TrafficMinute, TrafficHour, TrafficDay}
+	// TrafficRetention is how long buckets of each resolution are kept
+	TrafficRetention = map[time.Duration]time.Duration{
+		TrafficMinute: 2 * 24 * time.Hour,
+		TrafficHour:   90 * 24 * time.Hour,
+		TrafficDay:    5 * 365 * 24 * time.Hour,
+	}
+)
+
+var (
+	ErrTrafficInvalidStep   = errors.New("step must be a whole number of minutes")
+	ErrTrafficInvalidRange  = errors.New("from must be before to")
+	ErrTrafficTooManyPoints = errors.New("too many points, use a larger step or a shorter range")
+	ErrTrafficStepExpired   = errors.New("step is finer than the traffic kept that far back, use a larger step")
+)
+
+// TrafficBucket is the traffic a tunnel passed in the Resolution long
+// period beginning at Start. TunnelID zero is the whole node.
+type TrafficBucket struct {
+	ID         uint          `json:"-" gorm:"primaryKey"`
+	TunnelID   uint          `json:"-" gorm:"uniqueIndex:idx_traffic_bucket"`
+	Resolution time.Duration `json:"-" gorm:"uniqueIndex:idx_traffic_bucket"`
+	Start      time.Time     `json:"-" gorm:"uniqueIndex:idx_traffic_bucket"`
+	RXBytes    uint64        `json:"-"`
+	TXBytes    uint64        `json:"-"`
+}
+
+// TrafficPoint is one step of a traffic series
+type TrafficPoint struct {
+	Time    time.Time `json:"time"`
+	RXBytes uint64    `json:"rx_bytes"`
+	TXBytes uint64    `json:"tx_bytes"`
+}
+
+// AddTraffic adds to the bucket starting at start, creating it if needed
+func AddTraffic(db *gorm.DB, tunnelID uint, resolution time.Duration, start time.Time, rxBytes, txBytes uint64) error {
+	bucket := TrafficBucket{
+		TunnelID:   tunnelID,
+		Resolution: resolution,
+		Start:      start.UTC(),
+		RXBytes:    rxBytes,
+		TXBytes:    txBytes,
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "tunnel_id"}, {Name: "resolution"}, {Name: "start"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"rx_bytes": gorm.Expr("traffic_buckets.rx_bytes + excluded.rx_bytes"),
+			"tx_bytes": gorm.Expr("traffic_buckets.tx_bytes + excluded.tx_bytes"),
+		}),
+	}).Create(&bucket).Error
+}
+
+func DeleteTrafficBefore(db *gorm.DB, resolution time.Duration, before time.Time) error {
+	return db.Where("resolution = ? AND start < ?", resolution, before.UTC()).Delete(&TrafficBucket{}).Error
+}
+
+func DeleteTunnelTraffic(db *gorm.DB, tunnelID uint) error {
+	return db.Where("tunnel_id = ?", tunnelID).Delete(&TrafficBucket{}).Error
+}
+
+// DefaultTrafficStep picks a step that keeps a range to a chartable number
+// of points, and that is no finer than the traffic kept at from
+func DefaultTrafficStep(from, to, now time.Time) time.Duration {
+	const targetPoints = 500
+	resolution := TrafficResolutionAt(from, now)
+	steps := []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour, 6 * time.Hour, TrafficDay}
+	for _, step := range steps {
+		if step%resolution == 0 && to.Sub(from)/step <= targetPoints {
+			return step
+		}
+	}
+	return 7 * TrafficDay
+}
+
+// TrafficResolutionAt returns the finest resolution whose buckets are still
+// kept for traffic at t
+func TrafficResolutionAt(t, now time.Time) time.Duration {
+	for _, resolution := range TrafficResolutions {
+		if !t.Before(now.Add(-TrafficRetention[resolution])) {
+			return resolution
+		}
+	}
+	return TrafficResolutions[len(TrafficResolutions)-1]
+}
+
+// TrafficSeries returns the tunnel's traffic from from until to in steps of
+// step, including steps with no traffic. Steps are aligned to multiples of
+// step since the zero time, so daily steps start at midnight UTC. The step
+// can't be finer than the traffic kept at from, since the points it would
+// read have been deleted.
+func TrafficSeries(db *gorm.DB, tunnelID uint, from, to, now time.Time, step time.Duration) ([]TrafficPoint, error) {
+	if step < TrafficMinute || step%TrafficMinute != 0 {
+		return nil, ErrTrafficInvalidStep
+	}
+	if !from.Before(to) {
+		return nil, ErrTrafficInvalidRange
+	}
+	from = from.UTC().Truncate(step)
+	to = to.UTC()
+	count := int((to.Sub(from) + step - 1) / step)
+	if count > MaxTrafficPoints {
+		return nil, ErrTrafficTooManyPoints
+	}
+	resolution := trafficResolutionFor(step)
+	if resolution < TrafficResolutionAt(from, now) {
+		return nil, ErrTrafficStepExpired
+	}
+
+	var buckets []TrafficBucket
+	err := db.Where("tunnel_id = ? AND resolution = ? AND start >= ? AND start < ?", tunnelID, resolution, from, to).
+		Order("start asc").
+		Find(&buckets).Error
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]TrafficPoint, count)
+	for i := range points {
+		points[i].Time = from.Add(time.Duration(i) * step)
+	}
+	for _, bucket := range buckets {
+		i := int(bucket.Start.Sub(from) / step)
+		if i < 0 || i >= count {
+			continue
+		}
+		points[i].RXBytes += bucket.RXBytes
+		points[i].TXBytes += bucket.TXBytes
+	}
+	return points, nil
+}
+
+// trafficResolutionFor returns the coarsest resolution that evenly divides step
+func trafficResolutionFor(step time.Duration) time.Duration {
+	for i := len(TrafficResolutions) - 1; i > 0; i-- {
+		if step%TrafficResolutions[i] == 0 {
+			return TrafficResolutions[i]
+		}
+	}
+	return TrafficMinute
+}
@@ -0,0 +1,165 @@
+package models_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// newTestDB returns a private in-memory database
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	os.Setenv("TEST", "1")
+	database, err := db.MakeDB(&config.Config{PasswordSalt: "salt", InitialAdminUserPassword: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func TestTrafficSeries(t *testing.T) {
+	t.Parallel()
+	database := newTestDB(t)
+
+	buckets := []struct {
+		tunnelID   uint
+		resolution time.Duration
+		start      time.Time
+		rx, tx     uint64
+	}{
+		{1, models.TrafficMinute, at(3, 12, 0), 100, 10},
+		{1, models.TrafficMinute, at(3, 12, 0), 50, 5},
+		{1, models.TrafficMinute, at(3, 12, 4), 200, 20},
+		{1, models.TrafficMinute, at(3, 12, 5), 400, 40},
+		{1, models.TrafficHour, at(3, 12, 0), 1000, 100},
+		{1, models.TrafficDay, at(3, 0, 0), 9000, 900},
+		// Another tunnel's traffic stays out of the series
+		{2, models.TrafficMinute, at(3, 12, 0), 7, 7},
+	}
+	for _, b := range buckets {
+		err := models.AddTraffic(database, b.tunnelID, b.resolution, b.start, b.rx, b.tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		step     time.Duration
+		want     []models.TrafficPoint
+	}{
+		{
+			name: "minutes add up and gaps are zero",
+			from: at(3, 12, 0), to: at(3, 12, 3), step: time.Minute,
+			want: []models.TrafficPoint{
+				{Time: at(3, 12, 0), RXBytes: 150, TXBytes: 15},
+				{Time: at(3, 12, 1)},
+				{Time: at(3, 12, 2)},
+			},
+		},
+		{
+			name: "steps align to multiples of the step",
+			from: at(3, 12, 2), to: at(3, 12, 10), step: 5 * time.Minute,
+			want: []models.TrafficPoint{
+				{Time: at(3, 12, 0), RXBytes: 350, TXBytes: 35},
+				{Time: at(3, 12, 5), RXBytes: 400, TXBytes: 40},
+			},
+		},
+		{
+			name: "hourly steps read hour buckets",
+			from: at(3, 12, 0), to: at(3, 13, 0), step: time.Hour,
+			want: []models.TrafficPoint{{Time: at(3, 12, 0), RXBytes: 1000, TXBytes: 100}},
+		},
+		{
+			name: "daily steps start at midnight",
+			from: at(3, 6, 0), to: at(3, 18, 0), step: models.TrafficDay,
+			want: []models.TrafficPoint{{Time: at(3, 0, 0), RXBytes: 9000, TXBytes: 900}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := models.TrafficSeries(database, 1, tt.from, tt.to, at(3, 18, 0), tt.step)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d points, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if !got[i].Time.Equal(tt.want[i].Time) || got[i].RXBytes != tt.want[i].RXBytes || got[i].TXBytes != tt.want[i].TXBytes {
+					t.Errorf("point %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTrafficSeriesErrors(t *testing.T) {
+	t.Parallel()
+	database := newTestDB(t)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		step     time.Duration
+		want     error
+	}{
+		{"step under a minute", at(3, 0, 0), at(4, 0, 0), time.Second, models.ErrTrafficInvalidStep},
+		{"step not whole minutes", at(3, 0, 0), at(4, 0, 0), 90 * time.Second, models.ErrTrafficInvalidStep},
+		{"empty range", at(3, 0, 0), at(3, 0, 0), time.Minute, models.ErrTrafficInvalidRange},
+		{"backwards range", at(4, 0, 0), at(3, 0, 0), time.Minute, models.ErrTrafficInvalidRange},
+		{"too many points", at(3, 0, 0), at(13, 0, 0), time.Minute, models.ErrTrafficTooManyPoints},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := models.TrafficSeries(database, 1, tt.from, tt.to, at(3, 18, 0), tt.step)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("TrafficSeries() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrafficSeriesRetention(t *testing.T) {
+	t.Parallel()
+	database := newTestDB(t)
+	err := models.AddTraffic(database, 1, models.TrafficHour, at(3, 12, 0), 1000, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Minute buckets before the 4th at midnight have been deleted
+	now := at(6, 0, 0)
+	from := at(3, 12, 0)
+
+	if step := models.DefaultTrafficStep(at(4, 12, 0), now, now); step != 5*time.Minute {
+		t.Errorf("DefaultTrafficStep() within minute retention = %s, want 5m", step)
+	}
+	step := models.DefaultTrafficStep(from, now, now)
+	if step != time.Hour {
+		t.Errorf("DefaultTrafficStep() past minute retention = %s, want 1h", step)
+	}
+	points, err := models.TrafficSeries(database, 1, from, now, now, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) == 0 || points[0].RXBytes != 1000 {
+		t.Errorf("TrafficSeries() = %+v, want the hour bucket first", points)
+	}
+
+	for _, step := range []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute} {
+		_, err := models.TrafficSeries(database, 1, from, now, now, step)
+		if !errors.Is(err, models.ErrTrafficStepExpired) {
+			t.Errorf("TrafficSeries() with step %s error = %v, want %v", step, err, models.ErrTrafficStepExpired)
+		}
+	}
+}
@@ -3,34 +3,136 @@ package models
 import (
 	"fmt"
 	"net"
+	"net/netip"
 	"time"
 
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/utils"
 	"gorm.io/gorm"
 )
 
 type Tunnel struct {
-	ID                 uint           `json:"id" gorm:"primaryKey"`
-	Hostname           string         `json:"hostname" binding:"required"`
-	IP                 string         `json:"ip" binding:"required"`
-	Password           string         `json:"-" binding:"required"`
-	Enabled            bool           `json:"enabled" gorm:"default:true"`
-	Active             bool           `json:"active"`
-	Client             bool           `json:"client"`
-	TunnelInterface    string         `json:"-"`
-	RXBytes            uint64         `json:"rx_bytes"`
-	TXBytes            uint64         `json:"tx_bytes"`
-	TotalRXMB          float64        `json:"total_rx_mb"`
-	TotalTXMB          float64        `json:"total_tx_mb"`
-	RXBytesPerSec      uint64         `json:"rx_bytes_per_sec"`
-	TXBytesPerSec      uint64         `json:"tx_bytes_per_sec"`
-	Wireguard          bool           `json:"wireguard" gorm:"default:false"`
-	WireguardServerKey string         `json:"-"`
-	WireguardPort      uint16         `json:"-"`
-	ConnectionTime     time.Time      `json:"connection_time"`
-	CreatedAt          time.Time      `json:"created_at"`
-	UpdatedAt          time.Time      `json:"-"`
-	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	Hostname string `json:"hostname" binding:"required"`
+	// Each server tunnel has its own block of the pool. Client tunnels
+	// are addressed by the other end, so theirs aren't unique.
+	IP                 string    `json:"ip" binding:"required" gorm:"uniqueIndex:idx_tunnels_server_ip,where:client IS NOT TRUE"`
+	IPv6               string    `json:"ipv6" gorm:"column:ipv6"`
+	Password           string    `json:"-" binding:"required" audit:"redact"`
+	Enabled            bool      `json:"enabled" gorm:"default:true"`
+	Active             bool      `json:"active" audit:"-"`
+	Client             bool      `json:"client"`
+	TunnelInterface    string    `json:"-" audit:"-"`
+	RXBytes            uint64    `json:"rx_bytes" audit:"-"`
+	TXBytes            uint64    `json:"tx_bytes" audit:"-"`
+	TotalRXMB          float64   `json:"total_rx_mb" audit:"-"`
+	TotalTXMB          float64   `json:"total_tx_mb" audit:"-"`
+	RXBytesPerSec      uint64    `json:"rx_bytes_per_sec" audit:"-"`
+	TXBytesPerSec      uint64    `json:"tx_bytes_per_sec" audit:"-"`
+	Wireguard          bool      `json:"wireguard" gorm:"default:false"`
+	WireguardServerKey string    `json:"-" audit:"redact"`
+	WireguardPort      uint16    `json:"-"`
+	PublicEndpoint     string    `json:"public_endpoint"`
+	ConnectionTime     time.Time `json:"connection_time" audit:"-"`
+	// ExpiresAt and Schedule are enforced by the tunnel scheduler, which
+	// manages Enabled for any tunnel that has either set
+	ExpiresAt      *time.Time        `json:"expires_at"`
+	Schedule       *TunnelSchedule   `json:"schedule" gorm:"serializer:json"`
+	NextTransition *TunnelTransition `json:"next_transition,omitempty" gorm:"-" audit:"-"`
+	// Quotas are enforced by the quota enforcer. An empty policy warns
+	// and a zero reset day resets monthly quotas on the first.
+	DailyQuota        TunnelQuota `json:"daily_quota" gorm:"embedded;embeddedPrefix:daily_quota_"`
+	MonthlyQuota      TunnelQuota `json:"monthly_quota" gorm:"embedded;embeddedPrefix:monthly_quota_"`
+	QuotaResetDay     uint8       `json:"quota_reset_day"`
+	QuotaPolicy       QuotaPolicy `json:"quota_policy"`
+	QuotaThrottleKbps uint32      `json:"quota_throttle_kbps"`
+	// QuotaAction is the policy currently applied for an exceeded quota
+	QuotaAction QuotaPolicy `json:"quota_action" audit:"-"`
+	// RateLimit is applied to the interface whenever it comes up. Shaping
+	// is what the interface actually has, only filled in for active tunnels.
+	RateLimit TunnelRateLimit `json:"rate_limit" gorm:"embedded;embeddedPrefix:rate_limit_"`
+	Shaping   *TunnelShaping  `json:"shaping,omitempty" gorm:"-" audit:"-"`
+	// The telemetry poller keeps the WireGuard peer's handshake, endpoint
+	// and keepalive up to date while the tunnel is active, and leaves the
+	// last values in place once it goes down. Endpoints are only shown to
+	// tunnel managers.
+	LastHandshakeAt     *time.Time `json:"last_handshake_at" audit:"-"`
+	HandshakeAgeSeconds *int64     `json:"handshake_age_seconds,omitempty" gorm:"-" audit:"-"`
+	KeepaliveSeconds    uint16     `json:"keepalive_seconds" audit:"-"`
+	Endpoint            string     `json:"-" audit:"-"`
+	PreviousEndpoint    string     `json:"-" audit:"-"`
+	EndpointChangedAt   *time.Time `json:"endpoint_changed_at" audit:"-"`
+	// EndpointChanges counts the times the peer roamed to a new endpoint
+	EndpointChanges uint32 `json:"endpoint_changes" audit:"-"`
+	// LQM fills in where the peer node says it is. The coordinates are zero
+	// until it has been reached, and PeerDistance, in meters, needs this
+	// node's location too.
+	PeerLatitude   float64    `json:"peer_latitude" audit:"-"`
+	PeerLongitude  float64    `json:"peer_longitude" audit:"-"`
+	PeerGridsquare string     `json:"peer_gridsquare" audit:"-"`
+	PeerDistance   float64    `json:"peer_distance" audit:"-"`
+	PeerLocatedAt  *time.Time `json:"peer_located_at" audit:"-"`
+	// KeyRotatedAt is when the keys were last rotated, nil if they are the
+	// keys the tunnel was created with. Until KeyGraceUntil, the client may
+	// still connect with PreviousClientPublicKey.
+	KeyRotatedAt            *time.Time     `json:"key_rotated_at"`
+	KeyGraceUntil           *time.Time     `json:"key_grace_until" audit:"-"`
+	PreviousClientPublicKey string         `json:"-" audit:"-"`
+	CreatedAt               time.Time      `json:"created_at" audit:"-"`
+	UpdatedAt               time.Time      `json:"-" audit:"-"`
+	DeletedAt               gorm.DeletedAt `json:"-" gorm:"index" audit:"-"`
+}
+
+// HandshakeAge returns how long ago the last handshake was, or nil if
+// there hasn't been one
+func (t Tunnel) HandshakeAge(now time.Time) *int64 {
+	if t.LastHandshakeAt == nil {
+		return nil
+	}
+	age := int64(now.Sub(*t.LastHandshakeAt) / time.Second)
+	return &age
+}
+
+// HasPeerLocation returns true if LQM has learned where the peer is
+func (t Tunnel) HasPeerLocation() bool {
+	return t.PeerLatitude != 0 || t.PeerLongitude != 0
+}
+
+// IsScheduled returns true if the tunnel has an expiry or a schedule
+func (t Tunnel) IsScheduled() bool {
+	return t.ExpiresAt != nil || t.Schedule != nil
+}
+
+// ScheduledEnabled returns whether the tunnel's expiry and schedule allow
+// it to be enabled at now
+func (t Tunnel) ScheduledEnabled(now time.Time) bool {
+	if t.ExpiresAt != nil && !now.Before(*t.ExpiresAt) {
+		return false
+	}
+	if t.Schedule != nil {
+		return t.Schedule.Active(now)
+	}
+	return true
+}
+
+// NextScheduledTransition returns the next time ScheduledEnabled changes,
+// or nil if it never will
+func (t Tunnel) NextScheduledTransition(now time.Time) *TunnelTransition {
+	if t.ExpiresAt != nil && !now.Before(*t.ExpiresAt) {
+		return nil
+	}
+	var next *TunnelTransition
+	if t.Schedule != nil {
+		at, ok := t.Schedule.Next(now)
+		if ok && (t.ExpiresAt == nil || at.Before(*t.ExpiresAt)) {
+			next = &TunnelTransition{At: at, Enabled: t.Schedule.Active(at)}
+		}
+	}
+	// Expiring only changes anything if the tunnel is enabled until then
+	if next == nil && t.ExpiresAt != nil && t.ScheduledEnabled(now) {
+		next = &TunnelTransition{At: *t.ExpiresAt, Enabled: false}
+	}
+	return next
 }
 
 func TunnelIDExists(db *gorm.DB, id uint) (bool, error) {
@@ -69,6 +171,12 @@ func ListWireguardTunnels(db *gorm.DB) ([]Tunnel, error) {
 	return tunnels, err
 }
 
+func ListVTunTunnels(db *gorm.DB) ([]Tunnel, error) {
+	var tunnels []Tunnel
+	err := db.Where("wireguard = ?", false).Order("id asc").Find(&tunnels).Error
+	return tunnels, err
+}
+
 func ListClientTunnels(db *gorm.DB) ([]Tunnel, error) {
 	var tunnels []Tunnel
 	err := db.Where("client = ?", true).Order("id asc").Find(&tunnels).Error
@@ -129,10 +237,32 @@ func CountWireguardActiveServerTunnels(db *gorm.DB) (int, error) {
 	return int(count), err
 }
 
+// CreateTunnel saves a new tunnel. Every tunnel should be created through
+// it, since Enabled defaults to true and gorm doesn't write false on create.
+// gorm also reads the default back into the tunnel, so Enabled has to be
+// checked before creating it.
+func CreateTunnel(db *gorm.DB, tunnel *Tunnel) error {
+	enabled := tunnel.Enabled
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(tunnel).Error
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			return tx.Model(tunnel).Update("enabled", false).Error
+		}
+		return nil
+	})
+}
+
 func DeleteTunnel(db *gorm.DB, id uint) error {
 	err := db.Transaction(func(tx *gorm.DB) error {
 		tx.Unscoped().Delete(&Tunnel{ID: id})
-		return nil
+		err := DeleteTunnelSessions(tx, id)
+		if err != nil {
+			return err
+		}
+		return DeleteTunnelTraffic(tx, id)
 	})
 	if err != nil {
 		return fmt.Errorf("error deleting tunnel: %w", err)
@@ -140,44 +270,79 @@ func DeleteTunnel(db *gorm.DB, id uint) error {
 	return nil
 }
 
+// UpdateTunnelPeerLocation saves where the peer on the tunnel with the
+// given interface is. It does nothing if no tunnel has the interface.
+func UpdateTunnelPeerLocation(db *gorm.DB, iface string, lat, lon float64, gridsquare string, distance float64, at time.Time) error {
+	return db.Model(&Tunnel{}).Where("tunnel_interface = ?", iface).UpdateColumns(map[string]interface{}{
+		"peer_latitude":   lat,
+		"peer_longitude":  lon,
+		"peer_gridsquare": gridsquare,
+		"peer_distance":   distance,
+		"peer_located_at": at,
+	}).Error
+}
+
 func ClearActiveFromAllTunnels(db *gorm.DB) error {
 	return db.Model(&Tunnel{}).Where("active = ?", true).Update("active", false).Error
 }
 
-func GetNextWireguardIP(db *gorm.DB, config *config.Config) (string, error) {
-	// Each tunnel is added with an ip starting from config.WireguardStartingAddress and incrementing by 4 for each tunnel
-	// We need to find the next available ip.
-	var tunnels []Tunnel
-	err := db.Where("wireguard = ?", true).Where("client = ?", false).Find(&tunnels).Error
+// GetNextWireguardIPv6 returns the server address of the lowest free /64 in
+// the ULA prefix, or an empty string if IPv6 is turned off. The first /64 is
+// the node's own.
+func GetNextWireguardIPv6(db *gorm.DB, config *config.Config) (string, error) {
+	prefix, ok := config.Wireguard.ULA()
+	if !ok {
+		return "", nil
+	}
+
+	var addresses []string
+	err := db.Model(&Tunnel{}).Where("ipv6 <> ?", "").Pluck("ipv6", &addresses).Error
 	if err != nil {
 		return "", err
 	}
-	// We need to find the next available ip.
-	// We can do this by finding the highest ip, and adding 4 to it.
-	var highestIP = net.ParseIP(config.Wireguard.StartingAddress).To4() // Use 12 so the +4 later starts at 16
-	for _, tunnel := range tunnels {
-		ip := net.ParseIP(tunnel.IP)
-		ip = ip.To4()
-		if ip[2] > highestIP[2] {
-			highestIP = ip
-		} else if ip[2] == highestIP[2] {
-			if ip[3] > highestIP[3] {
-				highestIP = ip
-			}
+	used := make(map[uint64]struct{}, len(addresses))
+	for _, address := range addresses {
+		addr, err := netip.ParseAddr(address)
+		if err != nil {
+			continue
+		}
+		if subnet, ok := utils.ULASubnet(prefix, addr); ok {
+			used[subnet] = struct{}{}
 		}
 	}
-	// If the highest ip is 252, we need to start at highestIP[2]++ and set highestIP[3] to 0.
-	if highestIP[3] == 252 {
-		highestIP[2]++
-		if highestIP[2] >= 254 {
-			return "", fmt.Errorf("no more IPs available")
+
+	subnets := uint64(1) << (64 - prefix.Bits())
+	for subnet := uint64(1); subnet < subnets; subnet++ {
+		if _, ok := used[subnet]; !ok {
+			return utils.ULAAddress(prefix, subnet, 1).String(), nil
 		}
-		highestIP[3] = 0
-	} else {
-		highestIP[3] += 4
+	}
+	return "", fmt.Errorf("no more IPv6 subnets available")
+}
+
+// AssignMissingWireguardIPv6 gives server tunnels created before IPv6 was
+// turned on an address
+func AssignMissingWireguardIPv6(db *gorm.DB, config *config.Config) error {
+	if _, ok := config.Wireguard.ULA(); !ok {
+		return nil
 	}
 
-	return highestIP.String(), nil
+	var tunnels []Tunnel
+	err := db.Where("wireguard = ? AND client = ? AND (ipv6 = ? OR ipv6 IS NULL)", true, false, "").Order("id asc").Find(&tunnels).Error
+	if err != nil {
+		return err
+	}
+	for _, tunnel := range tunnels {
+		ipv6, err := GetNextWireguardIPv6(db, config)
+		if err != nil {
+			return err
+		}
+		err = db.Model(&tunnel).Update("ipv6", ipv6).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func GetNextWireguardPort(db *gorm.DB, config *config.Config) (uint16, error) {
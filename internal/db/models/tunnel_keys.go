@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// KeyAge is how long the tunnel has had its current keys
+func (t Tunnel) KeyAge(now time.Time) time.Duration {
+	since := t.CreatedAt
+	if t.KeyRotatedAt != nil {
+		since = *t.KeyRotatedAt
+	}
+	return now.Sub(since)
+}
+
+// InKeyGrace returns true if the client may still connect with the keys it
+// had before the last rotation
+func (t Tunnel) InKeyGrace(now time.Time) bool {
+	return t.PreviousClientPublicKey != "" && t.KeyGraceUntil != nil && now.Before(*t.KeyGraceUntil)
+}
+
+// EndTunnelKeyGrace stops accepting the tunnel's previous client key
+func EndTunnelKeyGrace(db *gorm.DB, id uint) error {
+	return db.Model(&Tunnel{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"key_grace_until":            nil,
+		"previous_client_public_key": "",
+	}).Error
+}
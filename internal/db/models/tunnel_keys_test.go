@@ -0,0 +1,51 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+func TestTunnelKeyGrace(t *testing.T) {
+	t.Parallel()
+	rotatedAt := at(3, 0, 0)
+	graceUntil := at(4, 0, 0)
+	tunnel := models.Tunnel{
+		CreatedAt:               at(1, 0, 0),
+		KeyRotatedAt:            &rotatedAt,
+		KeyGraceUntil:           &graceUntil,
+		PreviousClientPublicKey: "previous",
+	}
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		age     time.Duration
+		inGrace bool
+	}{
+		{"just rotated", at(3, 0, 0), 0, true},
+		{"during grace", at(3, 12, 0), 12 * time.Hour, true},
+		{"grace over", at(4, 0, 0), 24 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tunnel.KeyAge(tt.now); got != tt.age {
+				t.Errorf("KeyAge() = %v, want %v", got, tt.age)
+			}
+			if got := tunnel.InKeyGrace(tt.now); got != tt.inGrace {
+				t.Errorf("InKeyGrace() = %v, want %v", got, tt.inGrace)
+			}
+		})
+	}
+
+	// Keys that were never rotated are as old as the tunnel
+	unrotated := models.Tunnel{CreatedAt: at(1, 0, 0)}
+	if got, want := unrotated.KeyAge(at(3, 0, 0)), 48*time.Hour; got != want {
+		t.Errorf("KeyAge() of unrotated keys = %v, want %v", got, want)
+	}
+	if unrotated.InKeyGrace(at(1, 0, 0)) {
+		t.Error("InKeyGrace() of unrotated keys = true, want false")
+	}
+}
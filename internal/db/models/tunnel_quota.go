@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type QuotaPolicy string
+
+const (
+	// QuotaPolicyWarn only sends events. It is also the policy when none is set.
+	QuotaPolicyWarn     QuotaPolicy = "warn"
+	QuotaPolicyDisable  QuotaPolicy = "disable"
+	QuotaPolicyThrottle QuotaPolicy = "throttle"
+)
+
+type QuotaPeriod string
+
+const (
+	QuotaPeriodDaily   QuotaPeriod = "daily"
+	QuotaPeriodMonthly QuotaPeriod = "monthly"
+)
+
+const (
+	// QuotaWarnPercent is the usage at which a quota warning is sent
+	QuotaWarnPercent = 80
+	// QuotaExceededPercent is the usage at which the quota policy applies
+	QuotaExceededPercent = 100
+
+	maxQuotaResetDay = 31
+	bytesPerMB       = 1024 * 1024
+)
+
+var (
+	ErrQuotaInvalidPolicy   = errors.New("quota policy must be warn, disable, or throttle")
+	ErrQuotaInvalidResetDay = errors.New("quota reset day must be between 1 and 31")
+	ErrQuotaThrottleRate    = errors.New("quota throttle rate is required for the throttle policy")
+	ErrQuotaThrottleTooHigh = errors.New("quota throttle rate must be at most 10000000 kbps")
+)
+
+// TunnelQuota limits the traffic a tunnel may pass, in both directions
+// combined, within a period. A zero limit is unlimited.
+type TunnelQuota struct {
+	LimitMB     uint64    `json:"limit_mb"`
+	UsedBytes   uint64    `json:"used_bytes"`
+	PeriodStart time.Time `json:"period_start"`
+	// Notified is the highest threshold, in percent, already sent this period
+	Notified uint8 `json:"-"`
+}
+
+func (q TunnelQuota) LimitBytes() uint64 {
+	return q.LimitMB * bytesPerMB
+}
+
+// Threshold returns the highest threshold, in percent, that usage has crossed
+func (q TunnelQuota) Threshold() uint8 {
+	if q.LimitMB == 0 {
+		return 0
+	}
+	switch {
+	case q.UsedBytes >= q.LimitBytes():
+		return QuotaExceededPercent
+	// Compare without dividing so small limits don't round down
+	case q.UsedBytes*100 >= q.LimitBytes()*QuotaWarnPercent:
+		return QuotaWarnPercent
+	}
+	return 0
+}
+
+func (q TunnelQuota) Exceeded() bool {
+	return q.Threshold() == QuotaExceededPercent
+}
+
+// Roll starts a new period if the quota's period began before start
+func (q *TunnelQuota) Roll(start time.Time) bool {
+	if !q.PeriodStart.Before(start) {
+		return false
+	}
+	q.UsedBytes = 0
+	q.PeriodStart = start
+	q.Notified = 0
+	return true
+}
+
+// Notify records the current threshold and returns true if it has changed.
+// Lowering the threshold, such as by raising the limit, lets it be sent again.
+func (q *TunnelQuota) Notify() (uint8, bool) {
+	threshold := q.Threshold()
+	if threshold == q.Notified {
+		return threshold, false
+	}
+	q.Notified = threshold
+	return threshold, true
+}
+
+// DailyPeriodStart returns the start of the daily quota period containing now
+func DailyPeriodStart(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// MonthlyPeriodStart returns the start of the monthly quota period containing
+// now. Reset days past the end of a short month reset on its last day.
+func MonthlyPeriodStart(now time.Time, resetDay uint8) time.Time {
+	start := monthlyReset(now.Year(), now.Month(), resetDay, now.Location())
+	if now.Before(start) {
+		start = monthlyReset(now.Year(), now.Month()-1, resetDay, now.Location())
+	}
+	return start
+}
+
+func monthlyReset(year int, month time.Month, resetDay uint8, loc *time.Location) time.Time {
+	// Day zero of the next month is the last day of this one
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, loc).Day()
+	day := min(max(int(resetDay), 1), lastDay)
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// HasQuota returns true if the tunnel has a daily or monthly quota
+func (t Tunnel) HasQuota() bool {
+	return t.DailyQuota.LimitMB > 0 || t.MonthlyQuota.LimitMB > 0
+}
+
+// QuotaExceeded returns true if the tunnel is over its daily or monthly quota
+func (t Tunnel) QuotaExceeded() bool {
+	return t.DailyQuota.Exceeded() || t.MonthlyQuota.Exceeded()
+}
+
+// QuotaDisabled returns true if the tunnel was disabled for exceeding a quota
+func (t Tunnel) QuotaDisabled() bool {
+	return t.QuotaAction == QuotaPolicyDisable
+}
+
+// ValidateQuota checks the tunnel's quota settings
+func (t Tunnel) ValidateQuota() error {
+	switch t.QuotaPolicy {
+	case "", QuotaPolicyWarn, QuotaPolicyDisable:
+	case QuotaPolicyThrottle:
+		if t.QuotaThrottleKbps == 0 {
+			return ErrQuotaThrottleRate
+		}
+	default:
+		return ErrQuotaInvalidPolicy
+	}
+	if t.QuotaThrottleKbps > MaxRateKbps {
+		return ErrQuotaThrottleTooHigh
+	}
+	if t.QuotaResetDay > maxQuotaResetDay {
+		return ErrQuotaInvalidResetDay
+	}
+	return nil
+}
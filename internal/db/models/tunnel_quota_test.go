@@ -0,0 +1,73 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+func TestMonthlyPeriodStart(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		now      time.Time
+		resetDay uint8
+		want     time.Time
+	}{
+		{"after reset", time.Date(2024, time.June, 20, 12, 0, 0, 0, time.UTC), 15, time.Date(2024, time.June, 15, 0, 0, 0, 0, time.UTC)},
+		{"before reset", time.Date(2024, time.June, 10, 12, 0, 0, 0, time.UTC), 15, time.Date(2024, time.May, 15, 0, 0, 0, 0, time.UTC)},
+		{"on reset", time.Date(2024, time.June, 15, 0, 0, 0, 0, time.UTC), 15, time.Date(2024, time.June, 15, 0, 0, 0, 0, time.UTC)},
+		{"unset day", time.Date(2024, time.June, 10, 12, 0, 0, 0, time.UTC), 0, time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{"short month", time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC), 31, time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"after short month", time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC), 31, time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"across year", time.Date(2024, time.January, 5, 12, 0, 0, 0, time.UTC), 20, time.Date(2023, time.December, 20, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := models.MonthlyPeriodStart(tt.now, tt.resetDay); !got.Equal(tt.want) {
+				t.Errorf("MonthlyPeriodStart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTunnelQuotaNotify(t *testing.T) {
+	t.Parallel()
+	const mb = 1024 * 1024
+	quota := models.TunnelQuota{LimitMB: 100}
+
+	steps := []struct {
+		usedBytes uint64
+		want      uint8
+		wantOK    bool
+	}{
+		{50 * mb, 0, false},
+		{80 * mb, models.QuotaWarnPercent, true},
+		{90 * mb, models.QuotaWarnPercent, false},
+		{100 * mb, models.QuotaExceededPercent, true},
+		{150 * mb, models.QuotaExceededPercent, false},
+	}
+	for _, step := range steps {
+		quota.UsedBytes = step.usedBytes
+		got, ok := quota.Notify()
+		if got != step.want || ok != step.wantOK {
+			t.Fatalf("Notify() at %d bytes = %d, %v, want %d, %v", step.usedBytes, got, ok, step.want, step.wantOK)
+		}
+	}
+
+	// Raising the limit lets the threshold be sent again
+	quota.LimitMB = 1000
+	if got, ok := quota.Notify(); got != 0 || !ok {
+		t.Fatalf("Notify() after raising limit = %d, %v, want 0, true", got, ok)
+	}
+
+	start := time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)
+	if !quota.Roll(start) || quota.UsedBytes != 0 || quota.Notified != 0 {
+		t.Fatalf("Roll() didn't reset the quota: %+v", quota)
+	}
+	if quota.Roll(start) {
+		t.Fatal("Roll() reset the quota twice in one period")
+	}
+}
@@ -0,0 +1,51 @@
+package models
+
+import "errors"
+
+const (
+	// MaxRateKbps is 10 Gbit/s, which keeps rates within what tc takes
+	MaxRateKbps = 10_000_000
+	// MaxBurstKB is 1 GiB
+	MaxBurstKB = 1 << 20
+)
+
+var (
+	ErrRateLimitBurst        = errors.New("rate limit burst needs an ingress or egress rate")
+	ErrRateLimitRateTooHigh  = errors.New("rate limit rates must be at most 10000000 kbps")
+	ErrRateLimitBurstTooHigh = errors.New("rate limit burst must be at most 1048576 KB")
+)
+
+// TunnelRateLimit caps the rate of a tunnel's traffic, in kilobits per
+// second. A zero rate is unlimited, and a zero burst picks a default from
+// the rate.
+type TunnelRateLimit struct {
+	EgressKbps  uint32 `json:"egress_kbps"`
+	IngressKbps uint32 `json:"ingress_kbps"`
+	BurstKB     uint32 `json:"burst_kb"`
+}
+
+func (r TunnelRateLimit) IsZero() bool {
+	return r.EgressKbps == 0 && r.IngressKbps == 0
+}
+
+// TunnelShaping is the shaping in effect on an active tunnel's interface
+type TunnelShaping struct {
+	EgressKbps   uint32 `json:"egress_kbps"`
+	IngressKbps  uint32 `json:"ingress_kbps"`
+	EgressDrops  uint64 `json:"egress_drops"`
+	IngressDrops uint64 `json:"ingress_drops"`
+}
+
+// ValidateRateLimit checks the tunnel's rate limit settings
+func (t Tunnel) ValidateRateLimit() error {
+	if t.RateLimit.BurstKB > 0 && t.RateLimit.IsZero() {
+		return ErrRateLimitBurst
+	}
+	if t.RateLimit.EgressKbps > MaxRateKbps || t.RateLimit.IngressKbps > MaxRateKbps {
+		return ErrRateLimitRateTooHigh
+	}
+	if t.RateLimit.BurstKB > MaxBurstKB {
+		return ErrRateLimitBurstTooHigh
+	}
+	return nil
+}
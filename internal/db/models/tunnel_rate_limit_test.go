@@ -0,0 +1,37 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+func TestValidateRateLimit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		rateLimit models.TunnelRateLimit
+		want      error
+	}{
+		{"unlimited", models.TunnelRateLimit{}, nil},
+		{"rates and burst", models.TunnelRateLimit{EgressKbps: 5000, IngressKbps: 1000, BurstKB: 64}, nil},
+		{"fastest rate", models.TunnelRateLimit{EgressKbps: models.MaxRateKbps, IngressKbps: models.MaxRateKbps}, nil},
+		{"largest burst", models.TunnelRateLimit{EgressKbps: 5000, BurstKB: models.MaxBurstKB}, nil},
+		{"burst without a rate", models.TunnelRateLimit{BurstKB: 64}, models.ErrRateLimitBurst},
+		{"egress too fast", models.TunnelRateLimit{EgressKbps: models.MaxRateKbps + 1}, models.ErrRateLimitRateTooHigh},
+		{"ingress too fast", models.TunnelRateLimit{IngressKbps: models.MaxRateKbps + 1}, models.ErrRateLimitRateTooHigh},
+		// 4194304 KB is 2^32 bytes, which tc can't take
+		{"burst too large", models.TunnelRateLimit{EgressKbps: 5000, BurstKB: 4194304}, models.ErrRateLimitBurstTooHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tunnel := models.Tunnel{RateLimit: tt.rateLimit}
+			if err := tunnel.ValidateRateLimit(); !errors.Is(err, tt.want) {
+				t.Errorf("ValidateRateLimit() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
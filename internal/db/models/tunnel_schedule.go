@@ -0,0 +1,127 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const scheduleTimeFormat = "15:04"
+
+var (
+	ErrScheduleInvalidTime     = errors.New("schedule start and end must be in HH:MM format")
+	ErrScheduleEmptyWindow     = errors.New("schedule start and end must differ")
+	ErrScheduleInvalidDay      = errors.New("schedule days must be between 0 (Sunday) and 6 (Saturday)")
+	ErrScheduleInvalidTimezone = errors.New("schedule timezone is invalid")
+)
+
+// TunnelSchedule is a recurring window during which a tunnel is enabled.
+// If End is before Start, the window runs past midnight into the next day.
+type TunnelSchedule struct {
+	// Days the window opens on. Empty means every day.
+	Days  []time.Weekday `json:"days"`
+	Start string         `json:"start"`
+	End   string         `json:"end"`
+	// Timezone is an IANA name such as America/Chicago. Empty means the system timezone.
+	Timezone string `json:"timezone"`
+}
+
+// TunnelTransition is the next scheduled change to a tunnel's Enabled flag
+type TunnelTransition struct {
+	At      time.Time `json:"at"`
+	Enabled bool      `json:"enabled"`
+}
+
+func (s TunnelSchedule) Validate() error {
+	start, err := time.Parse(scheduleTimeFormat, s.Start)
+	if err != nil {
+		return ErrScheduleInvalidTime
+	}
+	end, err := time.Parse(scheduleTimeFormat, s.End)
+	if err != nil {
+		return ErrScheduleInvalidTime
+	}
+	if start.Equal(end) {
+		return ErrScheduleEmptyWindow
+	}
+	for _, day := range s.Days {
+		if day < time.Sunday || day > time.Saturday {
+			return ErrScheduleInvalidDay
+		}
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return ErrScheduleInvalidTimezone
+	}
+	return nil
+}
+
+// Active returns true if t falls inside one of the schedule's windows
+func (s TunnelSchedule) Active(t time.Time) bool {
+	// A window that crosses midnight may have opened yesterday
+	for offset := -1; offset <= 0; offset++ {
+		open, closeAt, ok := s.window(t, offset)
+		if ok && !t.Before(open) && t.Before(closeAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the first time after t that the schedule opens or closes
+func (s TunnelSchedule) Next(t time.Time) (time.Time, bool) {
+	var next time.Time
+	// A week and a day covers every window that could be relevant
+	const daysToSearch = 8
+	for offset := -1; offset <= daysToSearch; offset++ {
+		open, closeAt, ok := s.window(t, offset)
+		if !ok {
+			continue
+		}
+		for _, boundary := range []time.Time{open, closeAt} {
+			if boundary.After(t) && (next.IsZero() || boundary.Before(next)) {
+				next = boundary
+			}
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// window returns the window opening offset days from t, if there is one
+func (s TunnelSchedule) window(t time.Time, offset int) (time.Time, time.Time, bool) {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	start, err := time.Parse(scheduleTimeFormat, s.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	end, err := time.Parse(scheduleTimeFormat, s.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, loc)
+	if !s.opensOn(day.Weekday()) {
+		return time.Time{}, time.Time{}, false
+	}
+
+	open := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+	closeAt := time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+	if !closeAt.After(open) {
+		closeAt = closeAt.AddDate(0, 0, 1)
+	}
+	return open, closeAt, true
+}
+
+func (s TunnelSchedule) opensOn(day time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, d := range s.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+// 2024-06-03 is a Monday
+func at(day, hour, minute int) time.Time {
+	return time.Date(2024, time.June, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestTunnelScheduleValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		schedule models.TunnelSchedule
+		wantErr  error
+	}{
+		{"valid", models.TunnelSchedule{Start: "08:00", End: "17:00", Timezone: "UTC"}, nil},
+		{"overnight", models.TunnelSchedule{Start: "22:00", End: "06:00"}, nil},
+		{"bad time", models.TunnelSchedule{Start: "8am", End: "17:00"}, models.ErrScheduleInvalidTime},
+		{"empty window", models.TunnelSchedule{Start: "08:00", End: "08:00"}, models.ErrScheduleEmptyWindow},
+		{"bad day", models.TunnelSchedule{Days: []time.Weekday{7}, Start: "08:00", End: "17:00"}, models.ErrScheduleInvalidDay},
+		{"bad timezone", models.TunnelSchedule{Start: "08:00", End: "17:00", Timezone: "Mars/Olympus"}, models.ErrScheduleInvalidTimezone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tt.schedule.Validate(); err != tt.wantErr {
+				t.Errorf("Validate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTunnelScheduleActive(t *testing.T) {
+	t.Parallel()
+	weekdays := models.TunnelSchedule{
+		Days:     []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		Start:    "08:00",
+		End:      "17:00",
+		Timezone: "UTC",
+	}
+	overnight := models.TunnelSchedule{Days: []time.Weekday{time.Friday}, Start: "22:00", End: "02:00", Timezone: "UTC"}
+
+	tests := []struct {
+		name     string
+		schedule models.TunnelSchedule
+		t        time.Time
+		want     bool
+	}{
+		{"before open", weekdays, at(3, 7, 59), false},
+		{"at open", weekdays, at(3, 8, 0), true},
+		{"at close", weekdays, at(3, 17, 0), false},
+		{"weekend", weekdays, at(8, 12, 0), false},
+		{"overnight before midnight", overnight, at(7, 23, 0), true},
+		{"overnight after midnight", overnight, at(8, 1, 0), true},
+		{"overnight closed", overnight, at(8, 3, 0), false},
+		{"overnight wrong day", overnight, at(6, 23, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := tt.schedule.Active(tt.t); got != tt.want {
+				t.Errorf("Active(%v) = %v, want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTunnelNextScheduledTransition(t *testing.T) {
+	t.Parallel()
+	schedule := &models.TunnelSchedule{Days: []time.Weekday{time.Friday}, Start: "18:00", End: "23:00", Timezone: "UTC"}
+	expiry := at(8, 0, 0)
+	earlyExpiry := at(7, 20, 0)
+
+	tests := []struct {
+		name   string
+		tunnel models.Tunnel
+		now    time.Time
+		want   *models.TunnelTransition
+	}{
+		{"unscheduled", models.Tunnel{}, at(3, 0, 0), nil},
+		{"expiry", models.Tunnel{ExpiresAt: &expiry}, at(3, 0, 0), &models.TunnelTransition{At: expiry, Enabled: false}},
+		{"expired", models.Tunnel{ExpiresAt: &expiry}, at(9, 0, 0), nil},
+		{"schedule opens", models.Tunnel{Schedule: schedule}, at(3, 0, 0), &models.TunnelTransition{At: at(7, 18, 0), Enabled: true}},
+		{"schedule closes", models.Tunnel{Schedule: schedule}, at(7, 19, 0), &models.TunnelTransition{At: at(7, 23, 0), Enabled: false}},
+		{"expires mid window", models.Tunnel{Schedule: schedule, ExpiresAt: &earlyExpiry}, at(7, 19, 0), &models.TunnelTransition{At: earlyExpiry, Enabled: false}},
+		{"expires while closed", models.Tunnel{Schedule: schedule, ExpiresAt: &expiry}, at(7, 23, 30), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := tt.tunnel.NextScheduledTransition(tt.now)
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("NextScheduledTransition() = %v, want %v", got, tt.want)
+			}
+			if got != nil && (!got.At.Equal(tt.want.At) || got.Enabled != tt.want.Enabled) {
+				t.Errorf("NextScheduledTransition() = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
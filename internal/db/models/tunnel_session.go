@@ -0,0 +1,198 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TunnelSessionEndReason string
+
+const (
+	// TunnelSessionEndInterfaceDown is a tunnel whose interface went away
+	TunnelSessionEndInterfaceDown TunnelSessionEndReason = "interface_down"
+	// TunnelSessionEndHandshakeTimeout is a WireGuard tunnel whose peer
+	// stopped completing handshakes
+	TunnelSessionEndHandshakeTimeout TunnelSessionEndReason = "handshake_timeout"
+	// TunnelSessionEndShutdown is a session ended by the server stopping
+	TunnelSessionEndShutdown TunnelSessionEndReason = "shutdown"
+	// TunnelSessionEndUnknown is a session left open by a server that didn't
+	// shut down cleanly. It ends when its tunnel's stats were last saved.
+	TunnelSessionEndUnknown TunnelSessionEndReason = "unknown"
+)
+
+// TunnelSession is one period during which a tunnel was connected
+type TunnelSession struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TunnelID  uint       `json:"tunnel_id" gorm:"index"`
+	Interface string     `json:"interface"`
+	StartedAt time.Time  `json:"started_at" gorm:"index"`
+	EndedAt   *time.Time `json:"ended_at"`
+	RXBytes   uint64     `json:"rx_bytes"`
+	TXBytes   uint64     `json:"tx_bytes"`
+	// EndReason is empty while the session is open
+	EndReason TunnelSessionEndReason `json:"end_reason"`
+}
+
+// TunnelUptime summarizes a tunnel's sessions over a window
+type TunnelUptime struct {
+	TunnelID uint      `json:"tunnel_id"`
+	Hostname string    `json:"hostname,omitempty"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	// UptimePercent is the share of the window the tunnel was connected.
+	// Time before the tunnel was created doesn't count against it.
+	UptimePercent float64 `json:"uptime_percent"`
+	Sessions      int     `json:"sessions"`
+	// Flaps counts sessions that dropped during the window,
+	// not counting those ended by the server shutting down
+	Flaps              int     `json:"flaps"`
+	MeanSessionSeconds float64 `json:"mean_session_seconds"`
+	Connected          bool    `json:"connected"`
+}
+
+// Duration returns how long the session lasted, or has lasted so far
+func (s TunnelSession) Duration(now time.Time) time.Duration {
+	if s.EndedAt != nil {
+		return s.EndedAt.Sub(s.StartedAt)
+	}
+	return now.Sub(s.StartedAt)
+}
+
+func StartTunnelSession(db *gorm.DB, tunnelID uint, iface string, startedAt time.Time) error {
+	return db.Create(&TunnelSession{
+		TunnelID:  tunnelID,
+		Interface: iface,
+		StartedAt: startedAt,
+	}).Error
+}
+
+// EndTunnelSession ends the tunnel's open session, if it has one
+func EndTunnelSession(db *gorm.DB, tunnelID uint, endedAt time.Time, reason TunnelSessionEndReason, rxBytes, txBytes uint64) error {
+	var session TunnelSession
+	err := db.Where("tunnel_id = ? AND ended_at IS NULL", tunnelID).Order("started_at desc").First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return db.Model(&session).Updates(map[string]interface{}{
+		"ended_at":   endedAt,
+		"end_reason": reason,
+		"rx_bytes":   rxBytes,
+		"tx_bytes":   txBytes,
+	}).Error
+}
+
+// EndOpenTunnelSessions ends every open session. Each ends when its tunnel's
+// stats were last saved, which is within a second of now for a connected
+// tunnel, and at the latest now. Call it before clearing Active on tunnels,
+// since that moves their UpdatedAt.
+func EndOpenTunnelSessions(db *gorm.DB, now time.Time, reason TunnelSessionEndReason) error {
+	var sessions []TunnelSession
+	err := db.Where("ended_at IS NULL").Find(&sessions).Error
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		end := now
+		var rxBytes, txBytes uint64
+		tunnel, err := FindTunnelByID(db, session.TunnelID)
+		if err == nil {
+			rxBytes = tunnel.RXBytes
+			txBytes = tunnel.TXBytes
+			if tunnel.UpdatedAt.Before(end) {
+				end = tunnel.UpdatedAt
+			}
+		}
+		if end.Before(session.StartedAt) {
+			end = session.StartedAt
+		}
+		err = EndTunnelSession(db, session.TunnelID, end, reason, rxBytes, txBytes)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ListTunnelSessions(db *gorm.DB, tunnelID uint) ([]TunnelSession, error) {
+	var sessions []TunnelSession
+	err := db.Where("tunnel_id = ?", tunnelID).Order("started_at desc").Find(&sessions).Error
+	return sessions, err
+}
+
+func CountTunnelSessions(db *gorm.DB, tunnelID uint) (int, error) {
+	var count int64
+	err := db.Model(&TunnelSession{}).Where("tunnel_id = ?", tunnelID).Count(&count).Error
+	return int(count), err
+}
+
+// ListTunnelSessionsBetween returns the tunnel's sessions that overlap from until to
+func ListTunnelSessionsBetween(db *gorm.DB, tunnelID uint, from, to time.Time) ([]TunnelSession, error) {
+	var sessions []TunnelSession
+	err := db.Where("tunnel_id = ? AND started_at < ? AND (ended_at IS NULL OR ended_at > ?)", tunnelID, to, from).
+		Order("started_at asc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func DeleteTunnelSessions(db *gorm.DB, tunnelID uint) error {
+	return db.Where("tunnel_id = ?", tunnelID).Delete(&TunnelSession{}).Error
+}
+
+// ComputeTunnelUptime summarizes the tunnel's sessions from from until to.
+// now ends any session that is still open.
+func ComputeTunnelUptime(tunnel Tunnel, sessions []TunnelSession, from, to, now time.Time) TunnelUptime {
+	uptime := TunnelUptime{
+		TunnelID: tunnel.ID,
+		Hostname: tunnel.Hostname,
+		From:     from,
+		To:       to,
+	}
+
+	start := from
+	if tunnel.CreatedAt.After(start) {
+		start = tunnel.CreatedAt
+	}
+	end := to
+	if now.Before(end) {
+		end = now
+	}
+
+	var connected, total time.Duration
+	for _, session := range sessions {
+		sessionEnd := now
+		if session.EndedAt != nil {
+			sessionEnd = *session.EndedAt
+		} else {
+			uptime.Connected = true
+		}
+		if sessionEnd.After(end) {
+			sessionEnd = end
+		}
+		sessionStart := session.StartedAt
+		if sessionStart.Before(start) {
+			sessionStart = start
+		}
+		if sessionEnd.After(sessionStart) {
+			connected += sessionEnd.Sub(sessionStart)
+		}
+
+		uptime.Sessions++
+		total += session.Duration(now)
+		if session.EndedAt != nil && session.EndedAt.Before(to) && session.EndReason != TunnelSessionEndShutdown {
+			uptime.Flaps++
+		}
+	}
+
+	if end.After(start) {
+		uptime.UptimePercent = 100 * float64(connected) / float64(end.Sub(start))
+	}
+	if uptime.Sessions > 0 {
+		uptime.MeanSessionSeconds = total.Seconds() / float64(uptime.Sessions)
+	}
+	return uptime
+}
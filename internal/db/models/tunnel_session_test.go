@@ -0,0 +1,51 @@
+package models_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+func TestComputeTunnelUptime(t *testing.T) {
+	t.Parallel()
+	from := at(3, 0, 0)
+	to := at(4, 0, 0)
+	ended := func(tm time.Time) *time.Time { return &tm }
+
+	sessions := []models.TunnelSession{
+		// Started before the window, so only the part inside it counts
+		{StartedAt: at(2, 22, 0), EndedAt: ended(at(3, 6, 0)), EndReason: models.TunnelSessionEndHandshakeTimeout},
+		{StartedAt: at(3, 6, 30), EndedAt: ended(at(3, 12, 0)), EndReason: models.TunnelSessionEndShutdown},
+		// Still open
+		{StartedAt: at(3, 18, 0)},
+	}
+	tunnel := models.Tunnel{ID: 1, CreatedAt: at(1, 0, 0)}
+
+	got := models.ComputeTunnelUptime(tunnel, sessions, from, to, at(4, 0, 0))
+	// 6h + 5.5h + 6h of 24h
+	if want := 100 * 17.5 / 24; math.Abs(got.UptimePercent-want) > 0.001 {
+		t.Errorf("UptimePercent = %v, want %v", got.UptimePercent, want)
+	}
+	if got.Sessions != 3 {
+		t.Errorf("Sessions = %d, want 3", got.Sessions)
+	}
+	if got.Flaps != 1 {
+		t.Errorf("Flaps = %d, want 1", got.Flaps)
+	}
+	// 8h + 5.5h + 6h over 3 sessions
+	if want := (19.5 * 3600) / 3; math.Abs(got.MeanSessionSeconds-want) > 0.001 {
+		t.Errorf("MeanSessionSeconds = %v, want %v", got.MeanSessionSeconds, want)
+	}
+	if !got.Connected {
+		t.Error("Connected = false, want true")
+	}
+
+	// Time before the tunnel existed doesn't count as downtime
+	tunnel.CreatedAt = at(3, 12, 0)
+	got = models.ComputeTunnelUptime(tunnel, sessions[2:], from, to, at(4, 0, 0))
+	if want := 50.0; math.Abs(got.UptimePercent-want) > 0.001 {
+		t.Errorf("UptimePercent for a new tunnel = %v, want %v", got.UptimePercent, want)
+	}
+}
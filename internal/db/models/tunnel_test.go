@@ -0,0 +1,48 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+func TestCreateTunnelDisabled(t *testing.T) {
+	t.Parallel()
+	database := newTestDB(t)
+
+	for _, enabled := range []bool{true, false} {
+		tunnel := models.Tunnel{Hostname: "N0CALL", IP: "172.31.0.4", Enabled: enabled}
+		if !enabled {
+			tunnel.IP = "172.31.0.8"
+		}
+		err := models.CreateTunnel(database, &tunnel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved, err := models.FindTunnelByID(database, tunnel.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Enabled != enabled {
+			t.Errorf("Enabled = %t, want %t", saved.Enabled, enabled)
+		}
+	}
+}
+
+func TestServerTunnelIPUnique(t *testing.T) {
+	t.Parallel()
+	database := newTestDB(t)
+
+	err := models.CreateTunnel(database, &models.Tunnel{Hostname: "N0CALL-A", IP: "172.31.0.4", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = models.CreateTunnel(database, &models.Tunnel{Hostname: "N0CALL-B", IP: "172.31.0.4", Enabled: true})
+	if err == nil {
+		t.Error("CreateTunnel() gave two server tunnels the same address")
+	}
+	err = models.CreateTunnel(database, &models.Tunnel{Hostname: "hub.example.com", IP: "172.31.0.4", Enabled: true, Client: true})
+	if err != nil {
+		t.Errorf("CreateTunnel() of a client tunnel error = %v", err)
+	}
+}
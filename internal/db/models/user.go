@@ -1,8 +1,10 @@
 package models
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
@@ -11,13 +13,84 @@ import (
 	"gorm.io/gorm"
 )
 
+// Role is the access tier granted to a user. Roles are ordered, so a role
+// is allowed to do anything the roles below it can do.
+type Role string
+
+const (
+	// RoleViewer can read dashboards but cannot change anything
+	RoleViewer Role = "viewer"
+	// RoleOperator can additionally create, edit, and delete tunnels
+	RoleOperator Role = "operator"
+	// RoleAdmin can additionally manage users
+	RoleAdmin Role = "admin"
+)
+
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// IsValid returns true if the role is one of the known roles
+func (r Role) IsValid() bool {
+	return r.rank() > 0
+}
+
+// AtLeast returns true if r grants at least the permissions of other
+func (r Role) AtLeast(other Role) bool {
+	return r.IsValid() && r.rank() >= other.rank()
+}
+
+// A user created without a role gets the least privileged one. Users that
+// existed before roles were introduced are backfilled to admin by MakeDB.
 type User struct {
-	ID        uint           `json:"id" gorm:"primaryKey" binding:"required"`
-	Username  string         `json:"username" gorm:"uniqueIndex" binding:"required"`
-	Password  string         `json:"-"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"-"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID       uint   `json:"id" gorm:"primaryKey" binding:"required"`
+	Username string `json:"username" gorm:"uniqueIndex" binding:"required"`
+	Password string `json:"-" audit:"redact"`
+	Role     Role   `json:"role" gorm:"default:viewer"`
+	// TOTPSecret is set when enrollment starts, but is only required at
+	// login once the user has confirmed it with a code and TOTPEnabled is set
+	TOTPSecret  string `json:"-" audit:"redact"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// TOTPLastStep is the last accepted time step, so that codes can't be replayed
+	TOTPLastStep int64 `json:"-" audit:"-"`
+	// RecoveryCodes are hashed with utils.HashToken and removed once used
+	RecoveryCodes []string `json:"-" gorm:"serializer:json" audit:"redact"`
+	// Locked is filled in from the login lockout tracker, it isn't stored
+	Locked    bool           `json:"locked" gorm:"-" audit:"-"`
+	CreatedAt time.Time      `json:"created_at" audit:"-"`
+	UpdatedAt time.Time      `json:"-" audit:"-"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index" audit:"-"`
+}
+
+// ConsumeRecoveryCode removes the given recovery code from the user,
+// returning false if it doesn't match one. The caller must save the user.
+func (u *User) ConsumeRecoveryCode(code string) bool {
+	hash := utils.HashToken(code)
+	for i, c := range u.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(c), []byte(hash)) == 1 {
+			u.RecoveryCodes = slices.Delete(u.RecoveryCodes, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// ResetTOTP disables two-factor authentication for the user.
+// The caller must save the user.
+func (u *User) ResetTOTP() {
+	u.TOTPSecret = ""
+	u.TOTPEnabled = false
+	u.TOTPLastStep = 0
+	u.RecoveryCodes = nil
 }
 
 func (u User) TableName() string {
@@ -54,6 +127,12 @@ func CountUsers(db *gorm.DB) (int, error) {
 	return int(count), err
 }
 
+func CountAdminUsers(db *gorm.DB) (int, error) {
+	var count int64
+	err := db.Model(&User{}).Where("role = ?", RoleAdmin).Count(&count).Error
+	return int(count), err
+}
+
 type UsersSeeder struct {
 	gorm_seeder.SeederAbstract
 	config *config.Config
@@ -83,6 +162,7 @@ func (s *UsersSeeder) Seed(db *gorm.DB) error {
 			ID:       0,
 			Username: "admin",
 			Password: utils.HashPassword(pass, s.config.PasswordSalt),
+			Role:     RoleAdmin,
 		},
 	}
 	slog.Error("!#!#!#!#!# Initial admin user password #!#!#!#!#!", "password", pass)
@@ -95,8 +175,12 @@ func (s *UsersSeeder) Clear(db *gorm.DB) error {
 
 func DeleteUser(db *gorm.DB, id uint) error {
 	err := db.Transaction(func(tx *gorm.DB) error {
-		tx.Unscoped().Delete(&User{ID: id})
-		return nil
+		// A user's tokens go with them
+		err := DeleteAPITokensForUser(tx, id)
+		if err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&User{ID: id}).Error
 	})
 	if err != nil {
 		return fmt.Errorf("error deleting user: %w", err)
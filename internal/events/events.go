@@ -8,6 +8,9 @@ const (
 	EventTypeTunnelStats         EventType = "tunnel_stats"
 	EventTypeTotalBandwidth      EventType = "total_bandwidth"
 	EventTypeTotalTraffic        EventType = "total_traffic"
+	EventTypeAudit               EventType = "audit"
+	EventTypeTunnelQuota         EventType = "tunnel_quota"
+	EventTypeTunnelRoam          EventType = "tunnel_roam"
 )
 
 type Event struct {
@@ -0,0 +1,105 @@
+package geojson
+
+import (
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+const (
+	TypeFeatureCollection = "FeatureCollection"
+	TypeFeature           = "Feature"
+	TypePoint             = "Point"
+	TypeLineString        = "LineString"
+)
+
+// Kinds of feature on the tunnel map, in each feature's "kind" property
+const (
+	KindNode = "node"
+	KindPeer = "peer"
+	KindLink = "link"
+)
+
+// FeatureCollection is an RFC 7946 feature collection
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+type Feature struct {
+	Type       string         `json:"type"`
+	Geometry   Geometry       `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+// Geometry holds a position for a Point, or a list of them for a
+// LineString. Positions are longitude first.
+type Geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+func point(lat, lon float64) Geometry {
+	return Geometry{Type: TypePoint, Coordinates: []float64{lon, lat}}
+}
+
+func line(lat1, lon1, lat2, lon2 float64) Geometry {
+	return Geometry{Type: TypeLineString, Coordinates: [][]float64{{lon1, lat1}, {lon2, lat2}}}
+}
+
+// TunnelMap plots this node and each tunnel peer whose location LQM has
+// learned. If this node's location is configured, each peer also gets a
+// link line back to it.
+func TunnelMap(cfg *config.Config, tunnels []models.Tunnel) FeatureCollection {
+	collection := FeatureCollection{
+		Type:     TypeFeatureCollection,
+		Features: []Feature{},
+	}
+
+	located := cfg.Latitude != 0 || cfg.Longitude != 0
+	if located {
+		collection.Features = append(collection.Features, Feature{
+			Type:     TypeFeature,
+			Geometry: point(cfg.Latitude, cfg.Longitude),
+			Properties: map[string]any{
+				"kind":       KindNode,
+				"hostname":   cfg.ServerName,
+				"gridsquare": cfg.Gridsquare,
+			},
+		})
+	}
+
+	for _, tunnel := range tunnels {
+		if !tunnel.HasPeerLocation() {
+			continue
+		}
+		collection.Features = append(collection.Features, Feature{
+			Type:     TypeFeature,
+			Geometry: point(tunnel.PeerLatitude, tunnel.PeerLongitude),
+			Properties: map[string]any{
+				"kind":       KindPeer,
+				"tunnel_id":  tunnel.ID,
+				"hostname":   tunnel.Hostname,
+				"gridsquare": tunnel.PeerGridsquare,
+				"active":     tunnel.Active,
+				"client":     tunnel.Client,
+				"wireguard":  tunnel.Wireguard,
+			},
+		})
+		if !located {
+			continue
+		}
+		collection.Features = append(collection.Features, Feature{
+			Type:     TypeFeature,
+			Geometry: line(cfg.Latitude, cfg.Longitude, tunnel.PeerLatitude, tunnel.PeerLongitude),
+			Properties: map[string]any{
+				"kind":      KindLink,
+				"tunnel_id": tunnel.ID,
+				"hostname":  tunnel.Hostname,
+				"active":    tunnel.Active,
+				"distance":  tunnel.PeerDistance,
+			},
+		})
+	}
+
+	return collection
+}
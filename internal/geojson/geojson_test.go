@@ -0,0 +1,57 @@
+package geojson_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/geojson"
+)
+
+func TestTunnelMap(t *testing.T) {
+	t.Parallel()
+
+	tunnels := []models.Tunnel{
+		{ID: 1, Hostname: "KI5VMF-HUB", PeerLatitude: 32.9, PeerLongitude: -97.1, PeerDistance: 1200, Active: true},
+		{ID: 2, Hostname: "N0CALL"},
+	}
+
+	tests := []struct {
+		name  string
+		cfg   *config.Config
+		kinds []string
+		link  [][]float64
+	}{
+		{
+			name:  "node location unknown",
+			cfg:   &config.Config{},
+			kinds: []string{geojson.KindPeer},
+		},
+		{
+			name:  "node location known",
+			cfg:   &config.Config{Latitude: 33.0, Longitude: -96.5},
+			kinds: []string{geojson.KindNode, geojson.KindPeer, geojson.KindLink},
+			link:  [][]float64{{-96.5, 33.0}, {-97.1, 32.9}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := geojson.TunnelMap(tt.cfg, tunnels)
+			if got.Type != geojson.TypeFeatureCollection {
+				t.Fatalf("Type = %q, want %q", got.Type, geojson.TypeFeatureCollection)
+			}
+			var kinds []string
+			for _, feature := range got.Features {
+				kinds = append(kinds, feature.Properties["kind"].(string))
+				if feature.Properties["kind"] == geojson.KindLink && !reflect.DeepEqual(feature.Geometry.Coordinates, tt.link) {
+					t.Errorf("link coordinates = %v, want %v", feature.Geometry.Coordinates, tt.link)
+				}
+			}
+			if !reflect.DeepEqual(kinds, tt.kinds) {
+				t.Errorf("feature kinds = %v, want %v", kinds, tt.kinds)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
 	"github.com/USA-RedDragon/mesh-manager/internal/events"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/shaping"
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"gorm.io/gorm"
 )
@@ -20,6 +21,8 @@ const WG0 = "wg0"
 type _iface struct {
 	net.Interface
 	AssociatedTunnel *models.Tunnel
+	// DisconnectReason is why the interface is being marked inactive
+	DisconnectReason models.TunnelSessionEndReason
 }
 
 type Watcher struct {
@@ -111,6 +114,19 @@ func (w *Watcher) wgInterfaceActive(iface _iface) bool {
 	return false
 }
 
+// applyRateLimit shapes a tunnel interface that just came up, since any
+// shaping it had went away with the last one
+func applyRateLimit(iface string, tunnel *models.Tunnel) {
+	limits := shaping.ForTunnel(*tunnel, tunnel.QuotaAction)
+	if limits.IsZero() {
+		return
+	}
+	err := shaping.Apply(iface, limits)
+	if err != nil {
+		slog.Error("Error applying tunnel rate limit", "interface", iface, "error", err)
+	}
+}
+
 func (w *Watcher) watch() {
 	w.interfacesToMarkInactive = []_iface{}
 	interfaces, err := net.Interfaces()
@@ -133,6 +149,10 @@ func (w *Watcher) watch() {
 					continue
 				}
 				w.interfaces = remove(w.interfaces, iface)
+				iface.DisconnectReason = models.TunnelSessionEndHandshakeTimeout
+				if !netInterfaceContainsIface(interfaces, iface) {
+					iface.DisconnectReason = models.TunnelSessionEndInterfaceDown
+				}
 				w.interfacesToMarkInactive = append(w.interfacesToMarkInactive, iface)
 			} else if strings.HasPrefix(iface.Name, "tun") && !netInterfaceContainsIface(interfaces, iface) {
 				w.eventChannel <- events.Event{
@@ -148,13 +168,14 @@ func (w *Watcher) watch() {
 					continue
 				}
 				w.interfaces = remove(w.interfaces, iface)
+				iface.DisconnectReason = models.TunnelSessionEndInterfaceDown
 				w.interfacesToMarkInactive = append(w.interfacesToMarkInactive, iface)
 			}
 		}
 
 		// Loop through net.Interfaces() and check if any are missing from w.interfaces
 		for _, iface := range interfaces {
-			if strings.HasPrefix(iface.Name, "wg") && iface.Name != WG0 && w.wgInterfaceActive(_iface{iface, nil}) && !ifaceContainsNetInterface(w.interfaces, iface) {
+			if strings.HasPrefix(iface.Name, "wg") && iface.Name != WG0 && w.wgInterfaceActive(_iface{Interface: iface}) && !ifaceContainsNetInterface(w.interfaces, iface) {
 				tunnel := w.findTunnel(iface)
 				if tunnel == nil {
 					slog.Error("No tunnel found for interface", "interface", iface.Name)
@@ -165,9 +186,10 @@ func (w *Watcher) watch() {
 					slog.Error("Error adding interface to stats", "error", err)
 					continue
 				}
+				applyRateLimit(iface.Name, tunnel)
 				w.interfaces = append(w.interfaces, _iface{
-					iface,
-					tunnel,
+					Interface:        iface,
+					AssociatedTunnel: tunnel,
 				})
 			} else if strings.HasPrefix(iface.Name, "tun") && !ifaceContainsNetInterface(w.interfaces, iface) {
 				tunnel := w.findTunnel(iface)
@@ -180,9 +202,10 @@ func (w *Watcher) watch() {
 					slog.Error("Error adding interface to stats", "error", err)
 					continue
 				}
+				applyRateLimit(iface.Name, tunnel)
 				w.interfaces = append(w.interfaces, _iface{
-					iface,
-					tunnel,
+					Interface:        iface,
+					AssociatedTunnel: tunnel,
 				})
 			}
 		}
@@ -244,14 +267,27 @@ func (w *Watcher) reconcileDB() {
 	for _, iface := range w.interfacesToMarkInactive {
 		if iface.AssociatedTunnel != nil {
 			slog.Info("Marking tunnel as inactive", "tunnel", iface.AssociatedTunnel.Hostname)
-			iface.AssociatedTunnel.Active = false
-			iface.AssociatedTunnel.TunnelInterface = ""
-			iface.AssociatedTunnel.RXBytesPerSec = 0
-			iface.AssociatedTunnel.TXBytesPerSec = 0
-			iface.AssociatedTunnel.TotalRXMB += float64(iface.AssociatedTunnel.RXBytes) / 1024 / 1024
-			iface.AssociatedTunnel.TotalTXMB += float64(iface.AssociatedTunnel.TXBytes) / 1024 / 1024
-			iface.AssociatedTunnel.RXBytes = 0
-			iface.AssociatedTunnel.TXBytes = 0
+			w.endSession(iface)
+			// The tunnel was loaded when it connected and the stat counter has
+			// saved its traffic since, so clear the session's counters in the
+			// database and read the totals back rather than writing them
+			err := w.db.Model(iface.AssociatedTunnel).Updates(map[string]interface{}{
+				"active":           false,
+				"tunnel_interface": "",
+				"rx_bytes_per_sec": 0,
+				"tx_bytes_per_sec": 0,
+				"rx_bytes":         0,
+				"tx_bytes":         0,
+			}).Error
+			if err != nil {
+				slog.Error("Error marking tunnel as inactive", "tunnel", iface.AssociatedTunnel.Hostname, "error", err)
+			}
+			tunnel, err := models.FindTunnelByID(w.db, iface.AssociatedTunnel.ID)
+			if err != nil {
+				slog.Error("Error finding tunnel by ID", "tunnel", iface.AssociatedTunnel.Hostname, "error", err)
+			} else {
+				iface.AssociatedTunnel = &tunnel
+			}
 			w.eventChannel <- events.Event{
 				Type: events.EventTypeTunnelDisconnection,
 				Data: apimodels.WebsocketTunnelDisconnect{
@@ -273,7 +309,6 @@ func (w *Watcher) reconcileDB() {
 				Type: events.EventTypeTunnelStats,
 				Data: wsTunnel,
 			}
-			w.db.Save(iface.AssociatedTunnel)
 		}
 	}
 
@@ -293,12 +328,40 @@ func (w *Watcher) reconcileDB() {
 						ConnectionTime: iface.AssociatedTunnel.ConnectionTime,
 					},
 				}
-				w.db.Save(iface.AssociatedTunnel)
+				err := w.db.Model(iface.AssociatedTunnel).
+					Select("active", "tunnel_interface", "connection_time").
+					Updates(iface.AssociatedTunnel).Error
+				if err != nil {
+					slog.Error("Error marking tunnel as active", "tunnel", iface.AssociatedTunnel.Hostname, "error", err)
+				}
+
+				err = models.StartTunnelSession(w.db, iface.AssociatedTunnel.ID, iface.Name, iface.AssociatedTunnel.ConnectionTime)
+				if err != nil {
+					slog.Error("Error starting tunnel session", "tunnel", iface.AssociatedTunnel.Hostname, "error", err)
+				}
 			}
 		}
 	}
 }
 
+// endSession records the end of the interface's tunnel session. The session's
+// traffic is read from the database, since the StatCounter has been saving it
+// there rather than to AssociatedTunnel.
+func (w *Watcher) endSession(iface _iface) {
+	var rxBytes, txBytes uint64
+	tunnel, err := models.FindTunnelByID(w.db, iface.AssociatedTunnel.ID)
+	if err != nil {
+		slog.Error("Error finding tunnel", "tunnel", iface.AssociatedTunnel.Hostname, "error", err)
+	} else {
+		rxBytes = tunnel.RXBytes
+		txBytes = tunnel.TXBytes
+	}
+	err = models.EndTunnelSession(w.db, iface.AssociatedTunnel.ID, time.Now(), iface.DisconnectReason, rxBytes, txBytes)
+	if err != nil {
+		slog.Error("Error ending tunnel session", "tunnel", iface.AssociatedTunnel.Hostname, "error", err)
+	}
+}
+
 func (w *Watcher) Stop() error {
 	w.stopped = true
 	return w.Stats.Stop()
@@ -0,0 +1,321 @@
+// Package ipam gives WireGuard server tunnels their addresses. Each tunnel
+// gets a /30 from the configured pool. The server end takes the first
+// address, and the client end the next.
+package ipam
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// BlockBits is the prefix length of the block each tunnel is given
+const BlockBits = 30
+
+const blockSize = 1 << (32 - BlockBits)
+
+var (
+	ErrPoolInvalid         = errors.New("tunnel address pool is not configured")
+	ErrPoolExhausted       = errors.New("no more tunnel addresses available")
+	ErrInvalidAddress      = errors.New("address must be an IPv4 address")
+	ErrNotInPool           = errors.New("address is not in the tunnel address pool")
+	ErrNotBlockStart       = errors.New("address must be the first address of a /30")
+	ErrBlockInUse          = errors.New("address block is already in use")
+	ErrBlockReserved       = errors.New("address block is reserved")
+	ErrInvalidReservation  = errors.New("reservation must be an IPv4 CIDR in the tunnel address pool")
+	ErrReservationOverlaps = errors.New("reservation overlaps a block in use or another reservation")
+)
+
+// Pool is the blocks of Prefix from First on
+type Pool struct {
+	Prefix netip.Prefix
+	First  netip.Addr
+}
+
+func PoolFromConfig(cfg *config.Config) (Pool, error) {
+	prefix, first, ok := cfg.Wireguard.AddressPool()
+	if !ok || !prefix.Addr().Is4() || prefix.Bits() > BlockBits {
+		return Pool{}, ErrPoolInvalid
+	}
+	return Pool{Prefix: prefix, First: blockOf(first)}, nil
+}
+
+// Contains returns true if block is one the pool may give out
+func (p Pool) Contains(block netip.Addr) bool {
+	return p.Prefix.Contains(block) && !block.Less(p.First)
+}
+
+// Blocks is the number of blocks in the pool
+func (p Pool) Blocks() uint64 {
+	return (uint64(toUint(lastAddr(p.Prefix))) - uint64(toUint(p.First)) + 1) / blockSize
+}
+
+// Allocation is a block in the pool that a tunnel has
+type Allocation struct {
+	Block    netip.Prefix
+	TunnelID uint
+	Hostname string
+	Client   bool
+}
+
+// State is what a pool's blocks are used for
+type State struct {
+	Pool         Pool
+	Allocations  []Allocation
+	Reservations []models.IPReservation
+
+	used     map[netip.Addr]struct{}
+	reserved []netip.Prefix
+}
+
+// Load reads which blocks of the pool are taken. Client tunnels are given
+// their addresses by the other end, but any in the pool still take a block.
+func Load(db *gorm.DB, pool Pool) (*State, error) {
+	var tunnels []models.Tunnel
+	err := db.Where("ip <> ?", "").Order("id asc").Find(&tunnels).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tunnels: %w", err)
+	}
+	reservations, err := models.ListIPReservations(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reservations: %w", err)
+	}
+
+	return NewState(pool, tunnels, reservations), nil
+}
+
+// NewState works out which blocks of the pool the given tunnels and
+// reservations take
+func NewState(pool Pool, tunnels []models.Tunnel, reservations []models.IPReservation) *State {
+	state := &State{
+		Pool:         pool,
+		Reservations: reservations,
+		used:         make(map[netip.Addr]struct{}, len(tunnels)),
+	}
+	for _, tunnel := range tunnels {
+		addr, err := netip.ParseAddr(tunnel.IP)
+		if err != nil || !addr.Unmap().Is4() {
+			continue
+		}
+		block := blockOf(addr.Unmap())
+		if !pool.Prefix.Contains(block) {
+			continue
+		}
+		state.used[block] = struct{}{}
+		state.Allocations = append(state.Allocations, Allocation{
+			Block:    netip.PrefixFrom(block, BlockBits),
+			TunnelID: tunnel.ID,
+			Hostname: tunnel.Hostname,
+			Client:   tunnel.Client,
+		})
+	}
+	for _, reservation := range reservations {
+		prefix, err := netip.ParsePrefix(reservation.CIDR)
+		if err != nil {
+			continue
+		}
+		state.reserved = append(state.reserved, prefix.Masked())
+	}
+	return state
+}
+
+// Next returns the lowest free block
+func (s *State) Next() (netip.Addr, error) {
+	var found netip.Addr
+	s.eachBlock(func(block netip.Addr) bool {
+		if s.free(block) {
+			found = block
+			return false
+		}
+		return true
+	})
+	if !found.IsValid() {
+		return netip.Addr{}, ErrPoolExhausted
+	}
+	return found, nil
+}
+
+// Check returns nil if block can be given to a tunnel
+func (s *State) Check(block netip.Addr) error {
+	if !block.Is4() {
+		return ErrInvalidAddress
+	}
+	if !s.Pool.Contains(block) {
+		return ErrNotInPool
+	}
+	if block != blockOf(block) {
+		return ErrNotBlockStart
+	}
+	if _, ok := s.used[block]; ok {
+		return ErrBlockInUse
+	}
+	if s.isReserved(block) {
+		return ErrBlockReserved
+	}
+	return nil
+}
+
+// CheckReservation returns nil if prefix can be reserved
+func (s *State) CheckReservation(prefix netip.Prefix) error {
+	if !prefix.Addr().Is4() || prefix != prefix.Masked() || !s.Pool.Prefix.Overlaps(prefix) {
+		return ErrInvalidReservation
+	}
+	for _, reserved := range s.reserved {
+		if reserved.Overlaps(prefix) {
+			return ErrReservationOverlaps
+		}
+	}
+	for block := range s.used {
+		if prefix.Overlaps(netip.PrefixFrom(block, BlockBits)) {
+			return ErrReservationOverlaps
+		}
+	}
+	return nil
+}
+
+// Usage counts the pool's blocks. A block that is reserved and also in use
+// counts as used.
+type Usage struct {
+	Total    uint64
+	Used     uint64
+	Reserved uint64
+	Free     uint64
+}
+
+// Usage is counted from the allocations and reservations rather than by
+// walking the pool, which can have millions of blocks
+func (s *State) Usage() Usage {
+	usage := Usage{Total: s.Pool.Blocks(), Reserved: s.reservedBlocks()}
+	for block := range s.used {
+		if !s.Pool.Contains(block) {
+			continue
+		}
+		usage.Used++
+		if s.isReserved(block) {
+			usage.Reserved--
+		}
+	}
+	usage.Free = usage.Total - usage.Used - usage.Reserved
+	return usage
+}
+
+// reservedBlocks counts the blocks of the pool that overlap a reservation
+func (s *State) reservedBlocks() uint64 {
+	type blockRange struct{ first, last uint64 }
+	poolFirst := uint64(toUint(s.Pool.First)) / blockSize
+	poolLast := uint64(toUint(lastAddr(s.Pool.Prefix))) / blockSize
+
+	ranges := make([]blockRange, 0, len(s.reserved))
+	for _, reserved := range s.reserved {
+		first := max(uint64(toUint(reserved.Addr()))/blockSize, poolFirst)
+		last := min(uint64(toUint(lastAddr(reserved)))/blockSize, poolLast)
+		if first <= last {
+			ranges = append(ranges, blockRange{first, last})
+		}
+	}
+	slices.SortFunc(ranges, func(a, b blockRange) int {
+		return cmp.Compare(a.first, b.first)
+	})
+
+	// Reservations smaller than a block can share one
+	var count, next uint64
+	for _, r := range ranges {
+		first := max(r.first, next)
+		if first <= r.last {
+			count += r.last - first + 1
+			next = r.last + 1
+		}
+	}
+	return count
+}
+
+func (s *State) free(block netip.Addr) bool {
+	_, used := s.used[block]
+	return !used && !s.isReserved(block)
+}
+
+func (s *State) isReserved(block netip.Addr) bool {
+	prefix := netip.PrefixFrom(block, BlockBits)
+	for _, reserved := range s.reserved {
+		if reserved.Overlaps(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// eachBlock calls fn with each block of the pool in order, until it returns
+// false
+func (s *State) eachBlock(fn func(netip.Addr) bool) {
+	last := toUint(lastAddr(s.Pool.Prefix))
+	for n := uint64(toUint(s.Pool.First)); n <= uint64(last); n += blockSize {
+		if !fn(fromUint(uint32(n))) {
+			return
+		}
+	}
+}
+
+// Allocate returns the lowest free block in the configured pool
+func Allocate(db *gorm.DB, cfg *config.Config) (string, error) {
+	pool, err := PoolFromConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	state, err := Load(db, pool)
+	if err != nil {
+		return "", err
+	}
+	block, err := state.Next()
+	if err != nil {
+		return "", err
+	}
+	return block.String(), nil
+}
+
+// Pin returns address if it is the start of a free block in the configured
+// pool
+func Pin(db *gorm.DB, cfg *config.Config, address string) (string, error) {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return "", ErrInvalidAddress
+	}
+	pool, err := PoolFromConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	state, err := Load(db, pool)
+	if err != nil {
+		return "", err
+	}
+	err = state.Check(addr.Unmap())
+	if err != nil {
+		return "", err
+	}
+	return addr.Unmap().String(), nil
+}
+
+func blockOf(addr netip.Addr) netip.Addr {
+	return netip.PrefixFrom(addr, BlockBits).Masked().Addr()
+}
+
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	return fromUint(toUint(prefix.Masked().Addr()) | (1<<(32-prefix.Bits()) - 1))
+}
+
+func toUint(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func fromUint(n uint32) netip.Addr {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], n)
+	return netip.AddrFrom4(b)
+}
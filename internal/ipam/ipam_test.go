@@ -0,0 +1,151 @@
+package ipam_test
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/ipam"
+)
+
+func TestPoolFromConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		wireguard config.Wireguard
+		prefix    string
+		first     string
+		blocks    uint64
+	}{
+		{"starting address", config.Wireguard{StartingAddress: "172.31.0.0"}, "172.31.0.0/16", "172.31.0.4", 16383},
+		{"starting address at end of /24", config.Wireguard{StartingAddress: "172.31.0.252"}, "172.31.0.0/16", "172.31.1.0", 16320},
+		{"pool", config.Wireguard{Pool: "172.30.8.0/22", StartingAddress: "172.31.0.0"}, "172.30.8.0/22", "172.30.8.0", 256},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			pool, err := ipam.PoolFromConfig(&config.Config{Wireguard: tt.wireguard})
+			if err != nil {
+				t.Fatalf("PoolFromConfig() error = %v", err)
+			}
+			if pool.Prefix.String() != tt.prefix || pool.First.String() != tt.first {
+				t.Errorf("PoolFromConfig() = %v from %v, want %v from %v", pool.Prefix, pool.First, tt.prefix, tt.first)
+			}
+			if pool.Blocks() != tt.blocks {
+				t.Errorf("Blocks() = %d, want %d", pool.Blocks(), tt.blocks)
+			}
+		})
+	}
+
+	if _, err := ipam.PoolFromConfig(&config.Config{}); !errors.Is(err, ipam.ErrPoolInvalid) {
+		t.Errorf("PoolFromConfig() with nothing configured error = %v, want %v", err, ipam.ErrPoolInvalid)
+	}
+}
+
+func TestState(t *testing.T) {
+	t.Parallel()
+
+	pool := ipam.Pool{Prefix: netip.MustParsePrefix("172.30.0.0/27"), First: netip.MustParseAddr("172.30.0.0")}
+	tunnels := []models.Tunnel{
+		{ID: 1, Hostname: "A", IP: "172.30.0.0"},
+		{ID: 3, Hostname: "C", IP: "172.30.0.8"},
+		// A client tunnel the other end put in our pool
+		{ID: 4, Hostname: "D", IP: "172.30.0.17", Client: true},
+		{ID: 5, Hostname: "E", IP: "172.31.0.4"},
+	}
+	reservations := []models.IPReservation{{ID: 1, CIDR: "172.30.0.24/30"}}
+	state := ipam.NewState(pool, tunnels, reservations)
+
+	if len(state.Allocations) != 3 {
+		t.Errorf("Allocations = %v, want the 3 tunnels in the pool", state.Allocations)
+	}
+
+	// The gap left by a deleted tunnel is reused first
+	next, err := state.Next()
+	if err != nil || next.String() != "172.30.0.4" {
+		t.Errorf("Next() = %v, %v, want 172.30.0.4", next, err)
+	}
+
+	usage := state.Usage()
+	want := ipam.Usage{Total: 8, Used: 3, Reserved: 1, Free: 4}
+	if usage != want {
+		t.Errorf("Usage() = %+v, want %+v", usage, want)
+	}
+
+	checks := []struct {
+		block string
+		want  error
+	}{
+		{"172.30.0.12", nil},
+		{"172.30.0.13", ipam.ErrNotBlockStart},
+		{"172.30.0.8", ipam.ErrBlockInUse},
+		{"172.30.0.16", ipam.ErrBlockInUse},
+		{"172.30.0.24", ipam.ErrBlockReserved},
+		{"172.30.0.32", ipam.ErrNotInPool},
+	}
+	for _, check := range checks {
+		if err := state.Check(netip.MustParseAddr(check.block)); !errors.Is(err, check.want) {
+			t.Errorf("Check(%s) error = %v, want %v", check.block, err, check.want)
+		}
+	}
+
+	reservationChecks := []struct {
+		prefix string
+		want   error
+	}{
+		{"172.30.0.28/30", nil},
+		{"172.30.0.8/29", ipam.ErrReservationOverlaps},
+		{"172.30.0.24/29", ipam.ErrReservationOverlaps},
+		{"172.30.0.1/30", ipam.ErrInvalidReservation},
+		{"10.0.0.0/30", ipam.ErrInvalidReservation},
+	}
+	for _, check := range reservationChecks {
+		if err := state.CheckReservation(netip.MustParsePrefix(check.prefix)); !errors.Is(err, check.want) {
+			t.Errorf("CheckReservation(%s) error = %v, want %v", check.prefix, err, check.want)
+		}
+	}
+}
+
+func TestStateExhausted(t *testing.T) {
+	t.Parallel()
+
+	pool := ipam.Pool{Prefix: netip.MustParsePrefix("172.30.0.0/29"), First: netip.MustParseAddr("172.30.0.0")}
+	state := ipam.NewState(pool, []models.Tunnel{{IP: "172.30.0.0"}}, []models.IPReservation{{CIDR: "172.30.0.4/30"}})
+	if _, err := state.Next(); !errors.Is(err, ipam.ErrPoolExhausted) {
+		t.Errorf("Next() error = %v, want %v", err, ipam.ErrPoolExhausted)
+	}
+}
+
+func TestStateUsageLargePool(t *testing.T) {
+	t.Parallel()
+
+	pool := ipam.Pool{Prefix: netip.MustParsePrefix("10.0.0.0/8"), First: netip.MustParseAddr("10.0.0.64")}
+	tunnels := []models.Tunnel{
+		// Used and reserved counts as used
+		{IP: "10.0.0.64"},
+		{IP: "10.1.0.1"},
+		// Below the first block
+		{IP: "10.0.0.8"},
+	}
+	reservations := []models.IPReservation{
+		// Only the half from the first block on is in the pool
+		{CIDR: "10.0.0.0/25"},
+		{CIDR: "10.1.0.0/16"},
+		// Two reservations sharing a block count it once
+		{CIDR: "10.2.0.1/32"},
+		{CIDR: "10.2.0.2/32"},
+		// Already inside 10.1.0.0/16
+		{CIDR: "10.1.2.0/24"},
+	}
+	state := ipam.NewState(pool, tunnels, reservations)
+
+	usage := state.Usage()
+	want := ipam.Usage{Total: 1<<22 - 16, Used: 2, Reserved: 16 - 1 + 1<<14 - 1 + 1}
+	want.Free = want.Total - want.Used - want.Reserved
+	if usage != want {
+		t.Errorf("Usage() = %+v, want %+v", usage, want)
+	}
+}
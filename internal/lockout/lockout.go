@@ -0,0 +1,122 @@
+// Package lockout tracks failed login attempts and locks out keys, such as
+// usernames and client IPs, with exponential backoff.
+package lockout
+
+import (
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
+)
+
+const (
+	// DefaultThreshold is the number of failures allowed before locking out
+	DefaultThreshold = 5
+	// DefaultBaseLockout is the lockout after the first failure over the threshold.
+	// It doubles with every further failure.
+	DefaultBaseLockout = 30 * time.Second
+	// DefaultMaxLockout caps the exponential backoff
+	DefaultMaxLockout = time.Hour
+	// DefaultForgetAfter is how long after the last failure a key is forgotten
+	DefaultForgetAfter = 24 * time.Hour
+)
+
+type entry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Tracker counts failed attempts per key. It is safe for concurrent use.
+type Tracker struct {
+	mu      sync.Mutex
+	clock   clock.Clock
+	entries map[string]*entry
+
+	Threshold   int
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	ForgetAfter time.Duration
+}
+
+func NewTracker(clk clock.Clock) *Tracker {
+	return &Tracker{
+		clock:       clk,
+		entries:     make(map[string]*entry),
+		Threshold:   DefaultThreshold,
+		BaseLockout: DefaultBaseLockout,
+		MaxLockout:  DefaultMaxLockout,
+		ForgetAfter: DefaultForgetAfter,
+	}
+}
+
+// LockedFor returns how much longer the key is locked out for,
+// or zero if it isn't locked
+func (t *Tracker) LockedFor(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[key]
+	if !ok {
+		return 0
+	}
+	remaining := e.lockedUntil.Sub(t.clock.Now())
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Locked returns true if the key is currently locked out
+func (t *Tracker) Locked(key string) bool {
+	return t.LockedFor(key) > 0
+}
+
+// Fail records a failed attempt for the key and returns the resulting
+// lockout, or zero if the key is still under the threshold
+func (t *Tracker) Fail(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.clock.Now()
+	t.prune(now)
+
+	e, ok := t.entries[key]
+	if !ok {
+		e = &entry{}
+		t.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = now
+
+	over := e.failures - t.Threshold
+	if over <= 0 {
+		return 0
+	}
+
+	lockout := t.MaxLockout
+	// Past 32 doublings the lockout overflows, but it has long since hit the cap
+	const maxShift = 32
+	if over <= maxShift {
+		lockout = min(t.BaseLockout<<(over-1), t.MaxLockout)
+	}
+	e.lockedUntil = now.Add(lockout)
+	return lockout
+}
+
+// Reset forgets all failures for the key, unlocking it
+func (t *Tracker) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+// prune drops keys that are unlocked and haven't failed recently, so that
+// attempts from many addresses can't grow the map without bound
+func (t *Tracker) prune(now time.Time) {
+	for key, e := range t.entries {
+		if now.After(e.lockedUntil) && now.Sub(e.lastFailure) > t.ForgetAfter {
+			delete(t.entries, key)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package lockout_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
+	"github.com/USA-RedDragon/mesh-manager/internal/lockout"
+)
+
+func TestTrackerBackoff(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	tracker := lockout.NewTracker(clk)
+
+	for i := range lockout.DefaultThreshold {
+		if got := tracker.Fail("user:admin"); got != 0 {
+			t.Fatalf("failure %d locked out for %v, want no lockout", i+1, got)
+		}
+	}
+	if tracker.Locked("user:admin") {
+		t.Fatal("expected key to be unlocked at the threshold")
+	}
+
+	want := lockout.DefaultBaseLockout
+	for range 3 {
+		if got := tracker.Fail("user:admin"); got != want {
+			t.Fatalf("lockout = %v, want %v", got, want)
+		}
+		want *= 2
+	}
+	if !tracker.Locked("user:admin") {
+		t.Fatal("expected key to be locked")
+	}
+	if tracker.Locked("ip:192.0.2.1") {
+		t.Fatal("expected other keys to be unaffected")
+	}
+
+	clk.Advance(4*lockout.DefaultBaseLockout + time.Second)
+	if tracker.Locked("user:admin") {
+		t.Fatal("expected lockout to expire")
+	}
+}
+
+func TestTrackerMaxLockout(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	tracker := lockout.NewTracker(clk)
+
+	var got time.Duration
+	for range lockout.DefaultThreshold + 100 {
+		got = tracker.Fail("ip:192.0.2.1")
+	}
+	if got != lockout.DefaultMaxLockout {
+		t.Fatalf("lockout = %v, want %v", got, lockout.DefaultMaxLockout)
+	}
+}
+
+func TestTrackerReset(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	tracker := lockout.NewTracker(clk)
+
+	for range lockout.DefaultThreshold + 1 {
+		tracker.Fail("user:admin")
+	}
+	tracker.Reset("user:admin")
+	if tracker.Locked("user:admin") {
+		t.Fatal("expected reset to unlock")
+	}
+	if got := tracker.Fail("user:admin"); got != 0 {
+		t.Fatalf("expected reset to clear the failure count, locked out for %v", got)
+	}
+}
+
+func TestTrackerForget(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	tracker := lockout.NewTracker(clk)
+
+	for range lockout.DefaultThreshold {
+		tracker.Fail("user:admin")
+	}
+	clk.Advance(lockout.DefaultForgetAfter + time.Second)
+	if got := tracker.Fail("user:admin"); got != 0 {
+		t.Fatalf("expected old failures to be forgotten, locked out for %v", got)
+	}
+}
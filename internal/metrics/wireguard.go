@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+//nolint:gochecknoglobals
+var (
+	WireguardPeerHandshakeAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "node_wireguard_peer_handshake_age_seconds",
+		Help: "Seconds since the WireGuard peer's last handshake",
+	}, []string{"device", "hostname"})
+	WireguardPeerKeepalive = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "node_wireguard_peer_keepalive_seconds",
+		Help: "WireGuard peer persistent keepalive interval, 0 if off",
+	}, []string{"device", "hostname"})
+	WireguardPeerEndpointChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "node_wireguard_peer_endpoint_changes_total",
+		Help: "Times the WireGuard peer roamed to a new endpoint",
+	}, []string{"device", "hostname"})
+)
@@ -1,41 +1,25 @@
 package runner
 
 import (
-	"context"
-	"fmt"
-	"log/slog"
 	"os/exec"
 	"syscall"
 	"time"
 )
 
-func cancelAndWaitForExit(signal syscall.Signal, processResults chan error) error {
-	newCtx, cancel := context.WithTimeout(context.TODO(), 5*time.Second)
-	defer cancel()
-
-	select {
-	case <-newCtx.Done():
-		return fmt.Errorf("failed to send %s to process", signal.String())
-	case <-processResults:
-		return nil
-	}
-}
+// killDelay is how long a process has to exit after SIGTERM before it is
+// sent SIGKILL
+const killDelay = 5 * time.Second
 
+// Run starts cmd and returns a channel that gets the result of waiting on
+// it. If cmd was made with exec.CommandContext, canceling the context sends
+// the process SIGTERM, then SIGKILL if it hasn't exited in time.
 func Run(cmd *exec.Cmd) (chan error, error) {
-	processResults := make(chan error)
+	processResults := make(chan error, 1)
 
 	cmd.Cancel = func() error {
-		err := cancelAndWaitForExit(syscall.SIGTERM, processResults)
-		if err != nil {
-			// SIGTERM didn't work, log it and try SIGKILL
-			slog.Error("Failed to send SIGTERM to process, trying SIGKILL", "error", err)
-			err = cancelAndWaitForExit(syscall.SIGKILL, processResults)
-			if err != nil {
-				return fmt.Errorf("failed to kill process: %w", err)
-			}
-		}
-		return nil
+		return cmd.Process.Signal(syscall.SIGTERM)
 	}
+	cmd.WaitDelay = killDelay
 
 	err := cmd.Start()
 	if err != nil {
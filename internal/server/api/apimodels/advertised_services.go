@@ -0,0 +1,10 @@
+package apimodels
+
+// EditAdvertisedService is an advertised service in full, used both to
+// create one and to replace one
+type EditAdvertisedService struct {
+	Name     string `json:"name" binding:"required"`
+	URL      string `json:"url" binding:"required"`
+	Protocol string `json:"protocol" binding:"required"`
+	Enabled  *bool  `json:"enabled" binding:"required"`
+}
@@ -568,6 +568,7 @@ type Interface struct {
 type Host struct {
 	Name string `json:"name"`
 	IP   string `json:"ip"`
+	IPv6 string `json:"ipv6,omitempty"`
 }
 
 type ServiceCommon struct {
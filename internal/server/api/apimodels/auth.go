@@ -4,3 +4,8 @@ type AuthLogin struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
+
+type AuthTOTP struct {
+	// Code is either a TOTP code or one of the user's recovery codes
+	Code string `json:"code" binding:"required"`
+}
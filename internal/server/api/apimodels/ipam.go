@@ -0,0 +1,31 @@
+package apimodels
+
+import "github.com/USA-RedDragon/mesh-manager/internal/db/models"
+
+// IPAM is the tunnel address pool and what its /30 blocks are used for.
+// Utilization is the percentage of blocks used or reserved.
+type IPAM struct {
+	Pool           string                 `json:"pool"`
+	First          string                 `json:"first"`
+	BlockBits      int                    `json:"block_bits"`
+	TotalBlocks    uint64                 `json:"total_blocks"`
+	UsedBlocks     uint64                 `json:"used_blocks"`
+	ReservedBlocks uint64                 `json:"reserved_blocks"`
+	FreeBlocks     uint64                 `json:"free_blocks"`
+	Utilization    float64                `json:"utilization"`
+	NextFree       string                 `json:"next_free,omitempty"`
+	Allocations    []IPAMAllocation       `json:"allocations"`
+	Reservations   []models.IPReservation `json:"reservations"`
+}
+
+type IPAMAllocation struct {
+	Block    string `json:"block"`
+	TunnelID uint   `json:"tunnel_id"`
+	Hostname string `json:"hostname"`
+	Client   bool   `json:"client"`
+}
+
+type CreateIPReservation struct {
+	CIDR string `json:"cidr" binding:"required"`
+	Note string `json:"note"`
+}
@@ -0,0 +1,10 @@
+package apimodels
+
+// EditLocalHost is a local host in full, used both to create one and to
+// replace one
+type EditLocalHost struct {
+	Name      string `json:"name" binding:"required"`
+	IP        string `json:"ip" binding:"required"`
+	MAC       string `json:"mac"`
+	Advertise *bool  `json:"advertise" binding:"required"`
+}
@@ -3,44 +3,74 @@ package apimodels
 import (
 	"regexp"
 	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
 )
 
 const minHostnameLength = 3
 const maxHostnameLength = 63
 
 type CreateTunnel struct {
-	Wireguard bool   `json:"wireguard"`
-	Hostname  string `json:"hostname" binding:"required"`
-	Password  string `json:"password"`
-	IP        string `json:"ip"`
-	Client    bool   `json:"client"`
+	Wireguard bool                   `json:"wireguard"`
+	Hostname  string                 `json:"hostname" binding:"required"`
+	Password  string                 `json:"password"`
+	IP        string                 `json:"ip"`
+	IPv6      string                 `json:"ipv6"`
+	Client    bool                   `json:"client"`
+	ExpiresAt *time.Time             `json:"expires_at"`
+	Schedule  *models.TunnelSchedule `json:"schedule"`
 }
 
 func (r *CreateTunnel) IsValidHostname() (bool, string) {
-	if len(r.Hostname) < minHostnameLength {
+	return isValidTunnelHostname(r.Hostname)
+}
+
+// isValidTunnelHostname checks the node name of a server tunnel
+func isValidTunnelHostname(hostname string) (bool, string) {
+	if len(hostname) < minHostnameLength {
 		return false, "Hostname must be at least 3 characters"
 	}
-	if len(r.Hostname) > maxHostnameLength {
+	if len(hostname) > maxHostnameLength {
 		return false, "Hostname must be less than 64 characters"
 	}
-	if !regexp.MustCompile(`^[A-Za-z0-9\-]+$`).MatchString(r.Hostname) {
+	if !regexp.MustCompile(`^[A-Za-z0-9\-]+$`).MatchString(hostname) {
 		return false, "Hostname must be alphanumeric or -"
 	}
 	return true, ""
 }
 
 type TunnelWithPass struct {
-	ID             uint      `json:"id"`
-	Enabled        bool      `json:"enabled"`
-	Wireguard      bool      `json:"wireguard"`
-	WireguardPort  uint16    `json:"wireguard_port"`
-	Client         bool      `json:"client"`
-	Hostname       string    `json:"hostname"`
-	IP             string    `json:"ip"`
-	Password       string    `json:"password"`
-	Active         bool      `json:"active"`
-	ConnectionTime time.Time `json:"connection_time"`
-	CreatedAt      time.Time `json:"created_at"`
+	ID                  uint                     `json:"id"`
+	Enabled             bool                     `json:"enabled"`
+	Wireguard           bool                     `json:"wireguard"`
+	WireguardPort       uint16                   `json:"wireguard_port"`
+	Client              bool                     `json:"client"`
+	Hostname            string                   `json:"hostname"`
+	IP                  string                   `json:"ip"`
+	IPv6                string                   `json:"ipv6"`
+	Password            string                   `json:"password"`
+	Active              bool                     `json:"active"`
+	ConnectionTime      time.Time                `json:"connection_time"`
+	CreatedAt           time.Time                `json:"created_at"`
+	ExpiresAt           *time.Time               `json:"expires_at"`
+	Schedule            *models.TunnelSchedule   `json:"schedule"`
+	NextTransition      *models.TunnelTransition `json:"next_transition,omitempty"`
+	DailyQuota          models.TunnelQuota       `json:"daily_quota"`
+	MonthlyQuota        models.TunnelQuota       `json:"monthly_quota"`
+	QuotaResetDay       uint8                    `json:"quota_reset_day"`
+	QuotaPolicy         models.QuotaPolicy       `json:"quota_policy"`
+	QuotaThrottleKbps   uint32                   `json:"quota_throttle_kbps"`
+	QuotaAction         models.QuotaPolicy       `json:"quota_action"`
+	RateLimit           models.TunnelRateLimit   `json:"rate_limit"`
+	Shaping             *models.TunnelShaping    `json:"shaping,omitempty"`
+	PublicEndpoint      string                   `json:"public_endpoint"`
+	LastHandshakeAt     *time.Time               `json:"last_handshake_at"`
+	HandshakeAgeSeconds *int64                   `json:"handshake_age_seconds,omitempty"`
+	KeepaliveSeconds    uint16                   `json:"keepalive_seconds"`
+	Endpoint            string                   `json:"endpoint"`
+	PreviousEndpoint    string                   `json:"previous_endpoint"`
+	EndpointChangedAt   *time.Time               `json:"endpoint_changed_at"`
+	EndpointChanges     uint32                   `json:"endpoint_changes"`
 }
 
 type TunnelLQMResponse struct {
@@ -61,3 +91,84 @@ type EditTunnel struct {
 	Password  string `json:"password"`
 	IP        string `json:"ip" binding:"required"`
 }
+
+func (r *EditTunnel) IsValidHostname() (bool, string) {
+	return isValidTunnelHostname(r.Hostname)
+}
+
+// EditTunnelSchedule replaces a tunnel's expiry and schedule. Leaving either
+// out clears it.
+type EditTunnelSchedule struct {
+	ExpiresAt *time.Time             `json:"expires_at"`
+	Schedule  *models.TunnelSchedule `json:"schedule"`
+}
+
+// EditTunnelQuota replaces a tunnel's quota settings. A zero limit removes
+// that quota.
+type EditTunnelQuota struct {
+	DailyMB      uint64             `json:"daily_mb"`
+	MonthlyMB    uint64             `json:"monthly_mb"`
+	ResetDay     uint8              `json:"reset_day"`
+	Policy       models.QuotaPolicy `json:"policy"`
+	ThrottleKbps uint32             `json:"throttle_kbps"`
+}
+
+// EditTunnelEndpoint sets the public endpoint a server tunnel's client is
+// given, as host or host:port, in place of the configured endpoints. An
+// empty endpoint goes back to the configured ones.
+type EditTunnelEndpoint struct {
+	Endpoint string `json:"endpoint"`
+}
+
+// EditTunnelRateLimit replaces a tunnel's rate limit. A zero rate removes
+// that limit.
+type EditTunnelRateLimit struct {
+	EgressKbps  uint32 `json:"egress_kbps"`
+	IngressKbps uint32 `json:"ingress_kbps"`
+	BurstKB     uint32 `json:"burst_kb"`
+}
+
+// ExportTunnels is the passphrase to encrypt a tunnel bundle with
+type ExportTunnels struct {
+	Passphrase string `json:"passphrase" binding:"required"`
+}
+
+// TunnelClientConfig is what the client end of a server tunnel needs to
+// connect. Config is a wg-quick config, and Endpoint, Network, and Password
+// are the fields of AREDN's WireGuard client form.
+type TunnelClientConfig struct {
+	Config             string   `json:"config"`
+	Endpoint           string   `json:"endpoint"`
+	AlternateEndpoints []string `json:"alternate_endpoints,omitempty"`
+	Network            string   `json:"network"`
+	NetworkIPv6        string   `json:"network_ipv6,omitempty"`
+	Password           string   `json:"password"`
+}
+
+// RotateTunnelKeys rotates a server tunnel's keys. GraceHours defaults to the
+// configured grace period. Endpoint is the host the returned client config
+// points at, defaulting to the host of the request.
+type RotateTunnelKeys struct {
+	GraceHours *uint  `json:"grace_hours"`
+	ServerKey  bool   `json:"server_key"`
+	Endpoint   string `json:"endpoint"`
+}
+
+// TunnelKeyAge is how long a tunnel has had its keys
+type TunnelKeyAge struct {
+	ID           uint       `json:"id"`
+	Hostname     string     `json:"hostname"`
+	KeyRotatedAt *time.Time `json:"key_rotated_at"`
+	// KeyAge is in seconds
+	KeyAge        int64      `json:"key_age"`
+	KeyGraceUntil *time.Time `json:"key_grace_until"`
+}
+
+// TrafficSeries is traffic history in evenly spaced steps
+type TrafficSeries struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Step is the length of each point in seconds
+	Step   int64                 `json:"step"`
+	Points []models.TrafficPoint `json:"points"`
+}
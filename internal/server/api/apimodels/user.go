@@ -8,6 +8,7 @@ const maxUsernameLength = 20
 type UserRegistration struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	Role     string `json:"role"`
 }
 
 func (r *UserRegistration) IsValidUsername() (bool, string) {
@@ -26,4 +27,14 @@ func (r *UserRegistration) IsValidUsername() (bool, string) {
 type UserPatch struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TOTPRecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
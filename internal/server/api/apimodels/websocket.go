@@ -1,6 +1,10 @@
 package apimodels
 
-import "time"
+import (
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
 
 type WebsocketTunnelStats struct {
 	ID               uint    `json:"id"`
@@ -12,6 +16,27 @@ type WebsocketTunnelStats struct {
 	TotalTXMB        float64 `json:"total_tx_mb"`
 }
 
+// WebsocketTunnelQuota is sent when a tunnel crosses a quota threshold
+type WebsocketTunnelQuota struct {
+	ID         uint               `json:"id"`
+	Hostname   string             `json:"hostname"`
+	Period     models.QuotaPeriod `json:"period"`
+	Threshold  uint8              `json:"threshold"`
+	UsedBytes  uint64             `json:"used_bytes"`
+	LimitBytes uint64             `json:"limit_bytes"`
+	Policy     models.QuotaPolicy `json:"policy"`
+}
+
+// WebsocketTunnelRoam is sent when a WireGuard peer moves to a new
+// endpoint. The endpoints themselves are left out since anyone can listen.
+type WebsocketTunnelRoam struct {
+	ID              uint      `json:"id"`
+	Hostname        string    `json:"hostname"`
+	Client          bool      `json:"client"`
+	EndpointChanges uint32    `json:"endpoint_changes"`
+	ChangedAt       time.Time `json:"changed_at"`
+}
+
 type WebsocketTunnelConnect struct {
 	ID             uint      `json:"id"`
 	Client         bool      `json:"client"`
@@ -0,0 +1,257 @@
+package v1
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/USA-RedDragon/mesh-manager/internal/services"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/dnsmasq"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/meshlink"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/olsr"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GETAdvertisedServices(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	advertised, err := models.ListAdvertisedServices(di.DB)
+	if err != nil {
+		slog.Error("GETAdvertisedServices: Error getting advertised services", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting advertised services"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(advertised), "services": advertised})
+}
+
+func POSTAdvertisedService(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	var json apimodels.EditAdvertisedService
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("POSTAdvertisedService: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	service := models.AdvertisedService{
+		Name:     json.Name,
+		URL:      json.URL,
+		Protocol: json.Protocol,
+		Enabled:  *json.Enabled,
+	}
+	if !checkAdvertisedService(c, di, service) {
+		return
+	}
+
+	err = di.DB.Create(&service).Error
+	if err != nil {
+		slog.Error("POSTAdvertisedService: Error creating advertised service", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating advertised service"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionAdvertisedServiceCreate, service.ID, service.Name, nil, service)
+
+	if !regenerateAdvertisements(c, di) {
+		return
+	}
+	c.JSON(http.StatusOK, service)
+}
+
+func PUTAdvertisedService(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	before, ok := findAdvertisedService(c, di)
+	if !ok {
+		return
+	}
+
+	var json apimodels.EditAdvertisedService
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("PUTAdvertisedService: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	service := before
+	service.Name = json.Name
+	service.URL = json.URL
+	service.Protocol = json.Protocol
+	service.Enabled = *json.Enabled
+	if !checkAdvertisedService(c, di, service) {
+		return
+	}
+
+	err = di.DB.Save(&service).Error
+	if err != nil {
+		slog.Error("PUTAdvertisedService: Error updating advertised service", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating advertised service"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionAdvertisedServiceUpdate, service.ID, service.Name, before, service)
+
+	if !regenerateAdvertisements(c, di) {
+		return
+	}
+	c.JSON(http.StatusOK, service)
+}
+
+func DELETEAdvertisedService(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	service, ok := findAdvertisedService(c, di)
+	if !ok {
+		return
+	}
+
+	err := models.DeleteAdvertisedService(di.DB, service.ID)
+	if err != nil {
+		slog.Error("DELETEAdvertisedService: Error deleting advertised service", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting advertised service"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionAdvertisedServiceDelete, service.ID, service.Name, service, nil)
+
+	if !regenerateAdvertisements(c, di) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Advertised service deleted"})
+}
+
+// findAdvertisedService loads the service named by the id parameter,
+// writing an error response if it can't
+func findAdvertisedService(c *gin.Context, di *middleware.DepInjection) (models.AdvertisedService, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid advertised service ID"})
+		return models.AdvertisedService{}, false
+	}
+
+	service, err := models.FindAdvertisedServiceByID(di.DB, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Advertised service not found"})
+			return models.AdvertisedService{}, false
+		}
+		slog.Error("Error getting advertised service", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting advertised service"})
+		return models.AdvertisedService{}, false
+	}
+	return service, true
+}
+
+// checkAdvertisedService validates the service and that its name is free,
+// writing an error response if not
+func checkAdvertisedService(c *gin.Context, di *middleware.DepInjection, service models.AdvertisedService) bool {
+	err := service.Validate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	taken, err := models.AdvertisedServiceNameTaken(di.DB, service.Name, service.ID)
+	if err != nil {
+		slog.Error("Error getting advertised service", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting advertised service"})
+		return false
+	} else if taken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Service name is already taken"})
+		return false
+	}
+	return true
+}
+
+// regenerateAdvertisements rewrites everything that carries this node's
+// services and local hosts, the olsrd config, the meshlink files and the
+// dnsmasq hosts, and reloads them, writing an error response if it can't
+func regenerateAdvertisements(c *gin.Context, di *middleware.DepInjection) bool {
+	if di.Config.OLSR {
+		err := olsr.GenerateAndSave(di.Config, di.DB)
+		if err != nil {
+			slog.Error("Error generating olsrd config", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating olsrd config"})
+			return false
+		}
+
+		olsrService, ok := di.ServiceRegistry.Get(services.OLSRServiceName)
+		if !ok {
+			slog.Error("Error getting OLSR service")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+			return false
+		}
+
+		err = olsrService.Reload()
+		if err != nil {
+			slog.Error("Error reloading olsrd", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reloading olsrd"})
+			return false
+		}
+	}
+
+	err := meshlink.GenerateAndSave(di.Config, di.DB)
+	if err != nil {
+		slog.Error("Error generating meshlink hosts and services", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating meshlink hosts and services"})
+		return false
+	}
+
+	// meshlink is only supervised here alongside babel
+	meshlinkService, ok := di.ServiceRegistry.Get(services.MeshLinkServiceName)
+	if ok {
+		err = meshlinkService.Reload()
+		if err != nil {
+			slog.Error("Error reloading meshlink", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reloading meshlink"})
+			return false
+		}
+	}
+
+	err = dnsmasq.GenerateAndSave(di.DB)
+	if err != nil {
+		slog.Error("Error generating dnsmasq hosts", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating dnsmasq hosts"})
+		return false
+	}
+
+	dnsmasqService, ok := di.ServiceRegistry.Get(services.DNSMasqServiceName)
+	if !ok {
+		slog.Error("Error getting DNSMasq service")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return false
+	}
+
+	err = dnsmasqService.Reload()
+	if err != nil {
+		slog.Error("Error reloading dnsmasq", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reloading dnsmasq"})
+		return false
+	}
+	return true
+}
@@ -408,6 +408,13 @@ func GETSysinfo(c *gin.Context) {
 
 	if doHosts {
 		sysinfo.Hosts = getHosts(di.OLSRHostsParser, di.MeshLinkParser, modeHosts)
+		if nodeIPv6 := di.Config.NodeIPv6(); nodeIPv6 != "" {
+			for i := range sysinfo.Hosts {
+				if sysinfo.Hosts[i].Name == di.Config.ServerName {
+					sysinfo.Hosts[i].IPv6 = nodeIPv6
+				}
+			}
+		}
 	}
 
 	if doServices {
@@ -508,6 +515,9 @@ func getHosts(olsrParser *olsr.HostsParser, meshlinkParser *meshlink.Parser, mod
 	}
 
 	result := make(map[string]apimodels.Host)
+	// IPv6 addresses are given alongside the IPv4 address of the host with
+	// the same name, since AREDN clients expect ip to be IPv4
+	ipv6 := make(map[string]string)
 
 	process := func(hostname string, ip net.IP) {
 		if regexMid.MatchString(hostname) {
@@ -516,6 +526,12 @@ func getHosts(olsrParser *olsr.HostsParser, meshlinkParser *meshlink.Parser, mod
 		if regexDtd.MatchString(hostname) {
 			return
 		}
+		if ip.To4() == nil {
+			if _, exists := ipv6[hostname]; !exists {
+				ipv6[hostname] = ip.String()
+			}
+			return
+		}
 
 		var key string
 		switch mode {
@@ -542,10 +558,16 @@ func getHosts(olsrParser *olsr.HostsParser, meshlinkParser *meshlink.Parser, mod
 	}
 	for _, h := range meshlinkHosts {
 		process(h.Hostname, h.IP)
+		for _, child := range h.Children {
+			if child.Hostname == h.Hostname && child.IP.To4() == nil {
+				process(child.Hostname, child.IP)
+			}
+		}
 	}
 
 	ret := make([]apimodels.Host, 0, len(result))
 	for _, e := range result {
+		e.IPv6 = ipv6[e.Name]
 		ret = append(ret, e)
 	}
 
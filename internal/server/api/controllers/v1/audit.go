@@ -0,0 +1,107 @@
+package v1
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/audit"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/events"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func GETAuditEvents(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	filter := models.AuditEventFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+	}
+	if targetID, exists := c.GetQuery("target_id"); exists {
+		id, err := strconv.ParseUint(targetID, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target_id"})
+			return
+		}
+		filter.TargetID = uint(id)
+	}
+	if actorID, exists := c.GetQuery("actor_id"); exists {
+		id, err := strconv.ParseUint(actorID, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid actor_id"})
+			return
+		}
+		filter.ActorID = uint(id)
+	}
+
+	auditEvents, err := models.ListAuditEvents(di.PaginatedDB, filter)
+	if err != nil {
+		slog.Error("GETAuditEvents: Error getting audit events", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting audit events"})
+		return
+	}
+
+	total, err := models.CountAuditEvents(di.DB, filter)
+	if err != nil {
+		slog.Error("GETAuditEvents: Error getting audit event count", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting audit event count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": total, "events": auditEvents})
+}
+
+// recordAuditEvent persists a configuration change made by the current
+// request and broadcasts it to websocket listeners. before or after may be nil
+// for creates and deletes. Failures are logged rather than failing the
+// request, since the change itself has already been made.
+func recordAuditEvent(c *gin.Context, di *middleware.DepInjection, action models.AuditAction, targetID uint, target string, before, after any) {
+	auditEvent := models.AuditEvent{
+		ClientIP:   c.ClientIP(),
+		Action:     action,
+		TargetType: action.TargetType(),
+		TargetID:   targetID,
+		Target:     target,
+		Changes:    audit.Diff(before, after),
+	}
+
+	if user, ok := middleware.CurrentUser(c); ok {
+		auditEvent.ActorID = user.ID
+		auditEvent.Actor = user.Username
+	}
+	if val, exists := c.Get(middleware.APITokenKey); exists {
+		if token, ok := val.(models.APIToken); ok {
+			auditEvent.APITokenID = &token.ID
+			auditEvent.Actor = fmt.Sprintf("%s (token %s)", auditEvent.Actor, token.Name)
+		}
+	}
+
+	err := di.DB.Create(&auditEvent).Error
+	if err != nil {
+		slog.Error("Error recording audit event", "action", action, "target", target, "error", err)
+		return
+	}
+
+	slog.Info("Audit", "action", action, "actor", auditEvent.Actor, "ip", auditEvent.ClientIP, "target", target)
+
+	if di.EventsChannel != nil {
+		// The event is already stored, so rather than hold up the request
+		// while the channel is full, websocket listeners miss it
+		select {
+		case di.EventsChannel <- events.Event{
+			Type: events.EventTypeAudit,
+			Data: auditEvent,
+		}:
+		default:
+			slog.Warn("Events channel is full, not broadcasting audit event", "action", action, "target", target)
+		}
+	}
+}
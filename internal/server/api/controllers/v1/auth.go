@@ -3,8 +3,11 @@ package v1
 import (
 	"errors"
 	"log/slog"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
@@ -16,6 +19,15 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	pendingUserIDKey   = "pending_user_id"
+	pendingExpiresKey  = "pending_expires"
+	pendingAttemptsKey = "pending_attempts"
+
+	pendingLoginTimeout = 5 * time.Minute
+	maxTOTPAttempts     = 5
+)
+
 func POSTLogin(c *gin.Context) {
 	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
 	if !ok {
@@ -49,6 +61,9 @@ func POSTLogin(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Password cannot be blank"})
 			return
 		}
+		if loginLocked(c, di, json.Username) {
+			return
+		}
 		var user models.User
 		di.DB.Find(&user, "username = ?", json.Username)
 		if di.DB.Error != nil {
@@ -60,7 +75,26 @@ func POSTLogin(c *gin.Context) {
 		slog.Debug("POSTLogin: User found", "user", user)
 
 		verified, err := utils.VerifyPassword(json.Password, user.Password, di.Config.PasswordSalt)
+		if verified && err == nil && user.TOTPEnabled {
+			// Hold the session as half-authenticated until POSTLoginTOTP
+			// verifies the second factor. Nothing else reads these keys.
+			// The lockout isn't reset until then, or resending the password
+			// would clear the failed codes.
+			session.Delete("user_id")
+			session.Set(pendingUserIDKey, user.ID)
+			session.Set(pendingExpiresKey, di.Now().Add(pendingLoginTimeout).Unix())
+			session.Set(pendingAttemptsKey, 0)
+			err = session.Save()
+			if err != nil {
+				slog.Error("POSTLogin: Error saving session", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving session"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication required", "totp_required": true})
+			return
+		}
 		if verified && err == nil {
+			di.LoginTracker.Reset(userLockoutKey(user.Username))
 			session.Set("user_id", user.ID)
 			err = session.Save()
 			if err != nil {
@@ -72,11 +106,137 @@ func POSTLogin(c *gin.Context) {
 			return
 		}
 		slog.Error("POSTLogin: Invalid username or password", "username", json.Username)
+		recordLoginFailure(c, di, user.ID, json.Username)
 	}
 
 	c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
 }
 
+func POSTLoginTOTP(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	session := sessions.Default(c)
+
+	uid, ok := session.Get(pendingUserIDKey).(uint)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No login in progress"})
+		return
+	}
+	expires, ok := session.Get(pendingExpiresKey).(int64)
+	if !ok || di.Now().Unix() > expires {
+		clearPendingLogin(session)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please log in again"})
+		return
+	}
+
+	var json apimodels.AuthTOTP
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("POSTLoginTOTP: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	user, err := models.FindUserByID(di.DB, uid)
+	if err != nil || !user.TOTPEnabled {
+		// The user was deleted or had 2FA reset since the password step
+		clearPendingLogin(session)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please log in again"})
+		return
+	}
+
+	if loginLocked(c, di, user.Username) {
+		return
+	}
+
+	verified, err := verifySecondFactor(di, &user, json.Code)
+	if err != nil {
+		slog.Error("POSTLoginTOTP: Error verifying code", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	if !verified {
+		slog.Error("POSTLoginTOTP: Invalid code", "username", user.Username)
+		recordLoginFailure(c, di, user.ID, user.Username)
+		attempts, _ := session.Get(pendingAttemptsKey).(int)
+		attempts++
+		if attempts >= maxTOTPAttempts {
+			clearPendingLogin(session)
+		} else {
+			session.Set(pendingAttemptsKey, attempts)
+			err = session.Save()
+			if err != nil {
+				slog.Error("POSTLoginTOTP: Error saving session", "error", err)
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	di.LoginTracker.Reset(userLockoutKey(user.Username))
+	session.Delete(pendingUserIDKey)
+	session.Delete(pendingExpiresKey)
+	session.Delete(pendingAttemptsKey)
+	session.Set("user_id", user.ID)
+	err = session.Save()
+	if err != nil {
+		slog.Error("POSTLoginTOTP: Error saving session", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving session"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged in"})
+}
+
+func userLockoutKey(username string) string {
+	return "user:" + username
+}
+
+func ipLockoutKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginLocked writes an error response and returns true if either the
+// username or the client IP is locked out from too many failed logins
+func loginLocked(c *gin.Context, di *middleware.DepInjection, username string) bool {
+	lockedFor := max(
+		di.LoginTracker.LockedFor(userLockoutKey(username)),
+		di.LoginTracker.LockedFor(ipLockoutKey(c.ClientIP())),
+	)
+	if lockedFor == 0 {
+		return false
+	}
+	slog.Warn("Login attempt while locked out", "username", username, "ip", c.ClientIP(), "remaining", lockedFor)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedFor.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+	return true
+}
+
+// recordLoginFailure counts a failed password or second factor against
+// both the username and the client IP. userID is zero for unknown users.
+func recordLoginFailure(c *gin.Context, di *middleware.DepInjection, userID uint, username string) {
+	userLockout := di.LoginTracker.Fail(userLockoutKey(username))
+	ipLockout := di.LoginTracker.Fail(ipLockoutKey(c.ClientIP()))
+	if userLockout > 0 || ipLockout > 0 {
+		slog.Warn("Locking out login", "username", username, "ip", c.ClientIP(), "user_lockout", userLockout, "ip_lockout", ipLockout)
+	}
+	recordAuditEvent(c, di, models.AuditActionUserLoginFailed, userID, username, nil, nil)
+}
+
+func clearPendingLogin(session sessions.Session) {
+	session.Delete(pendingUserIDKey)
+	session.Delete(pendingExpiresKey)
+	session.Delete(pendingAttemptsKey)
+	err := session.Save()
+	if err != nil {
+		slog.Error("Error saving session", "error", err)
+	}
+}
+
 func GETLogout(c *gin.Context) {
 	session := sessions.Default(c)
 	session.Clear()
@@ -0,0 +1,219 @@
+package v1_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/lockout"
+	"github.com/USA-RedDragon/mesh-manager/internal/totp"
+	"github.com/gin-gonic/gin"
+)
+
+// enableTOTP turns on two-factor authentication for the user, returning
+// the secret
+func (s *testServer) enableTOTP(user models.User) string {
+	s.t.Helper()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	err = s.db.Model(&user).Updates(map[string]any{"totp_secret": secret, "totp_enabled": true}).Error
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return secret
+}
+
+// codes returns the current code for the secret and one that is wrong
+func (s *testServer) codes(secret string) (string, string) {
+	s.t.Helper()
+	good, err := totp.Code(secret, s.clock.Now())
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	bad := "000000"
+	if good == bad {
+		bad = "111111"
+	}
+	return good, bad
+}
+
+func (s *testServer) loginTOTP(code string) int {
+	s.t.Helper()
+	return s.request(http.MethodPost, "/api/v1/auth/login/totp", gin.H{"code": code}, nil).Code
+}
+
+func TestLoginLockoutCoversTOTP(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	user := s.createUser("bob", "bob-password", models.RoleViewer)
+	secret := s.enableTOTP(user)
+	_, bad := s.codes(secret)
+
+	// Use up a pending login's attempts, then send the password again for
+	// a fresh one. The failed codes must still count.
+	if code := s.login("bob", "bob-password"); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+	for range lockout.DefaultThreshold {
+		if code := s.loginTOTP(bad); code != http.StatusUnauthorized {
+			t.Fatalf("wrong code = %d, want %d", code, http.StatusUnauthorized)
+		}
+	}
+	// From another address, so only the per-user count can lock bob out
+	s.ip = "9.9.9.9"
+	if code := s.login("bob", "bob-password"); code != http.StatusOK {
+		t.Fatalf("second login = %d, want %d", code, http.StatusOK)
+	}
+	if code := s.loginTOTP(bad); code != http.StatusUnauthorized {
+		t.Fatalf("wrong code over the threshold = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	good, _ := s.codes(secret)
+	if code := s.loginTOTP(good); code != http.StatusTooManyRequests {
+		t.Errorf("right code while locked out = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := s.login("bob", "bob-password"); code != http.StatusTooManyRequests {
+		t.Errorf("password while locked out = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestLoginLockoutResetsAfterTOTP(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	user := s.createUser("bob", "bob-password", models.RoleViewer)
+	secret := s.enableTOTP(user)
+	_, bad := s.codes(secret)
+
+	if code := s.login("bob", "bob-password"); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+	for range lockout.DefaultThreshold - 1 {
+		s.loginTOTP(bad)
+	}
+	good, _ := s.codes(secret)
+	if code := s.loginTOTP(good); code != http.StatusOK {
+		t.Fatalf("right code = %d, want %d", code, http.StatusOK)
+	}
+
+	// Having logged in, bob starts over with the whole threshold. The
+	// failures from this address aren't forgotten, so try from another.
+	s.request(http.MethodGet, "/api/v1/auth/logout", nil, nil)
+	s.ip = "9.9.9.9"
+	for range lockout.DefaultThreshold {
+		if code := s.login("bob", "wrong-password"); code != http.StatusUnauthorized {
+			t.Fatalf("wrong password = %d, want %d", code, http.StatusUnauthorized)
+		}
+	}
+	if code := s.login("bob", "bob-password"); code != http.StatusOK {
+		t.Errorf("password = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestLoginTOTP(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	user := s.createUser("bob", "bob-password", models.RoleViewer)
+	secret := s.enableTOTP(user)
+
+	var resp struct {
+		TOTPRequired bool `json:"totp_required"`
+	}
+	if code := s.request(http.MethodPost, "/api/v1/auth/login", gin.H{"username": "bob", "password": "bob-password"}, &resp).Code; code != http.StatusOK || !resp.TOTPRequired {
+		t.Fatalf("login = %d %+v, want %d asking for a code", code, resp, http.StatusOK)
+	}
+	// The password alone doesn't log bob in
+	if code := s.request(http.MethodGet, "/api/v1/users/me", nil, nil).Code; code != http.StatusUnauthorized {
+		t.Fatalf("users/me before the code = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	good, _ := s.codes(secret)
+	if code := s.loginTOTP(good); code != http.StatusOK {
+		t.Fatalf("right code = %d, want %d", code, http.StatusOK)
+	}
+	if code := s.request(http.MethodGet, "/api/v1/users/me", nil, nil).Code; code != http.StatusOK {
+		t.Errorf("users/me after the code = %d, want %d", code, http.StatusOK)
+	}
+	// The pending login is used up
+	if code := s.loginTOTP(good); code != http.StatusUnauthorized {
+		t.Errorf("code again = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestLoginTOTPExpires(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	user := s.createUser("bob", "bob-password", models.RoleViewer)
+	secret := s.enableTOTP(user)
+
+	if code := s.login("bob", "bob-password"); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+	s.clock.Advance(6 * time.Minute)
+	good, _ := s.codes(secret)
+	if code := s.loginTOTP(good); code != http.StatusUnauthorized {
+		t.Fatalf("right code after expiry = %d, want %d", code, http.StatusUnauthorized)
+	}
+	// The expired login is cleared rather than left to retry
+	if code := s.loginTOTP(good); code != http.StatusUnauthorized {
+		t.Fatalf("right code again = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := s.request(http.MethodGet, "/api/v1/users/me", nil, nil).Code; code != http.StatusUnauthorized {
+		t.Errorf("users/me = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	// Starting over works
+	if code := s.login("bob", "bob-password"); code != http.StatusOK {
+		t.Fatalf("second login = %d, want %d", code, http.StatusOK)
+	}
+	if code := s.loginTOTP(good); code != http.StatusOK {
+		t.Errorf("right code on a fresh login = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestResetTOTPAdmin(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	user := s.createUser("bob", "bob-password", models.RoleViewer)
+	s.enableTOTP(user)
+	s.createUser("carol", "carol-password", models.RoleViewer)
+	path := fmt.Sprintf("/api/v1/users/%d/totp", user.ID)
+
+	if code := s.login("carol", "carol-password"); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+	if code := s.request(http.MethodDelete, path, nil, nil).Code; code != http.StatusForbidden {
+		t.Errorf("reset as a viewer = %d, want %d", code, http.StatusForbidden)
+	}
+
+	if code := s.login("admin", testAdminPassword); code != http.StatusOK {
+		t.Fatalf("admin login = %d, want %d", code, http.StatusOK)
+	}
+	if code := s.request(http.MethodDelete, "/api/v1/users/999/totp", nil, nil).Code; code != http.StatusNotFound {
+		t.Errorf("reset of a missing user = %d, want %d", code, http.StatusNotFound)
+	}
+	if code := s.request(http.MethodDelete, path, nil, nil).Code; code != http.StatusOK {
+		t.Fatalf("reset = %d, want %d", code, http.StatusOK)
+	}
+	reset, err := models.FindUserByID(s.db, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reset.TOTPEnabled || reset.TOTPSecret != "" {
+		t.Errorf("user after reset = %+v, want two-factor authentication off", reset)
+	}
+
+	// bob logs in with only a password now
+	var resp struct {
+		TOTPRequired bool `json:"totp_required"`
+	}
+	if code := s.request(http.MethodPost, "/api/v1/auth/login", gin.H{"username": "bob", "password": "bob-password"}, &resp).Code; code != http.StatusOK || resp.TOTPRequired {
+		t.Fatalf("login after reset = %d %+v, want %d without a code", code, resp, http.StatusOK)
+	}
+	if code := s.request(http.MethodGet, "/api/v1/users/me", nil, nil).Code; code != http.StatusOK {
+		t.Errorf("users/me = %d, want %d", code, http.StatusOK)
+	}
+}
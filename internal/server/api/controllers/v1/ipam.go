@@ -0,0 +1,166 @@
+package v1
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/ipam"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GETIPAM shows how much of the tunnel address pool is in use, and by what
+func GETIPAM(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	state, ok := loadIPAM(c, di)
+	if !ok {
+		return
+	}
+
+	usage := state.Usage()
+	response := apimodels.IPAM{
+		Pool:           state.Pool.Prefix.String(),
+		First:          state.Pool.First.String(),
+		BlockBits:      ipam.BlockBits,
+		TotalBlocks:    usage.Total,
+		UsedBlocks:     usage.Used,
+		ReservedBlocks: usage.Reserved,
+		FreeBlocks:     usage.Free,
+		Allocations:    make([]apimodels.IPAMAllocation, 0, len(state.Allocations)),
+		Reservations:   state.Reservations,
+	}
+	if usage.Total > 0 {
+		response.Utilization = float64(usage.Used+usage.Reserved) / float64(usage.Total) * 100
+	}
+	if next, err := state.Next(); err == nil {
+		response.NextFree = next.String()
+	}
+	for _, allocation := range state.Allocations {
+		response.Allocations = append(response.Allocations, apimodels.IPAMAllocation{
+			Block:    allocation.Block.String(),
+			TunnelID: allocation.TunnelID,
+			Hostname: allocation.Hostname,
+			Client:   allocation.Client,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// POSTIPReservation keeps a range of the pool from being given to tunnels
+func POSTIPReservation(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	var json apimodels.CreateIPReservation
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("POSTIPReservation: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	prefix, err := netip.ParsePrefix(json.CIDR)
+	if err != nil {
+		// A bare address reserves its /30
+		addr, addrErr := netip.ParseAddr(json.CIDR)
+		if addrErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ipam.ErrInvalidReservation.Error()})
+			return
+		}
+		prefix = netip.PrefixFrom(addr, ipam.BlockBits).Masked()
+	}
+
+	state, ok := loadIPAM(c, di)
+	if !ok {
+		return
+	}
+	err = state.CheckReservation(prefix)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reservation := models.IPReservation{
+		CIDR: prefix.String(),
+		Note: json.Note,
+	}
+	err = di.DB.Create(&reservation).Error
+	if err != nil {
+		slog.Error("POSTIPReservation: Error creating reservation", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating reservation"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionIPReservationCreate, reservation.ID, reservation.CIDR, nil, reservation)
+
+	c.JSON(http.StatusOK, reservation)
+}
+
+func DELETEIPReservation(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reservation ID"})
+		return
+	}
+
+	reservation, err := models.FindIPReservationByID(di.DB, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Reservation not found"})
+			return
+		}
+		slog.Error("DELETEIPReservation: Error getting reservation", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting reservation"})
+		return
+	}
+
+	err = models.DeleteIPReservation(di.DB, reservation.ID)
+	if err != nil {
+		slog.Error("DELETEIPReservation: Error deleting reservation", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting reservation"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionIPReservationDelete, reservation.ID, reservation.CIDR, reservation, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reservation deleted"})
+}
+
+// loadIPAM loads the configured pool, writing an error response if it can't
+func loadIPAM(c *gin.Context, di *middleware.DepInjection) (*ipam.State, bool) {
+	pool, err := ipam.PoolFromConfig(di.Config)
+	if err != nil {
+		slog.Error("Error getting address pool", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting address pool"})
+		return nil, false
+	}
+	state, err := ipam.Load(di.DB, pool)
+	if err != nil {
+		slog.Error("Error loading address pool", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading address pool"})
+		return nil, false
+	}
+	return state, true
+}
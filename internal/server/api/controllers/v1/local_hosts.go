@@ -0,0 +1,247 @@
+package v1
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func GETLocalHosts(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	hosts, err := models.ListLocalHosts(di.DB)
+	if err != nil {
+		slog.Error("GETLocalHosts: Error getting local hosts", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting local hosts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(hosts), "hosts": hosts})
+}
+
+func POSTLocalHost(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	var json apimodels.EditLocalHost
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("POSTLocalHost: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	host := models.LocalHost{
+		Name:      json.Name,
+		IP:        json.IP,
+		MAC:       json.MAC,
+		Advertise: *json.Advertise,
+	}
+	host, ok = checkLocalHost(c, di, host)
+	if !ok {
+		return
+	}
+
+	err = di.DB.Create(&host).Error
+	if err != nil {
+		slog.Error("POSTLocalHost: Error creating local host", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating local host"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionLocalHostCreate, host.ID, host.Name, nil, host)
+
+	if !regenerateAdvertisements(c, di) {
+		return
+	}
+	c.JSON(http.StatusOK, host)
+}
+
+func PUTLocalHost(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	before, ok := findLocalHost(c, di)
+	if !ok {
+		return
+	}
+
+	var json apimodels.EditLocalHost
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("PUTLocalHost: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	host := before
+	host.Name = json.Name
+	host.IP = json.IP
+	host.MAC = json.MAC
+	host.Advertise = *json.Advertise
+	host, ok = checkLocalHost(c, di, host)
+	if !ok {
+		return
+	}
+
+	err = di.DB.Save(&host).Error
+	if err != nil {
+		slog.Error("PUTLocalHost: Error updating local host", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating local host"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionLocalHostUpdate, host.ID, host.Name, before, host)
+
+	if !regenerateAdvertisements(c, di) {
+		return
+	}
+	c.JSON(http.StatusOK, host)
+}
+
+func DELETELocalHost(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	host, ok := findLocalHost(c, di)
+	if !ok {
+		return
+	}
+
+	err := models.DeleteLocalHost(di.DB, host.ID)
+	if err != nil {
+		slog.Error("DELETELocalHost: Error deleting local host", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting local host"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionLocalHostDelete, host.ID, host.Name, host, nil)
+
+	if !regenerateAdvertisements(c, di) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Local host deleted"})
+}
+
+// findLocalHost loads the host named by the id parameter, writing an error
+// response if it can't
+func findLocalHost(c *gin.Context, di *middleware.DepInjection) (models.LocalHost, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid local host ID"})
+		return models.LocalHost{}, false
+	}
+
+	host, err := models.FindLocalHostByID(di.DB, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Local host not found"})
+			return models.LocalHost{}, false
+		}
+		slog.Error("Error getting local host", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting local host"})
+		return models.LocalHost{}, false
+	}
+	return host, true
+}
+
+// checkLocalHost validates the host and that its name and IP are free here
+// and its name on the mesh, writing an error response if not. The host is
+// returned with its MAC in the form dnsmasq expects.
+func checkLocalHost(c *gin.Context, di *middleware.DepInjection, host models.LocalHost) (models.LocalHost, bool) {
+	lan, ok := di.Config.LAN()
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The node's LAN subnet must be configured to add local hosts"})
+		return host, false
+	}
+	err := host.Validate(lan)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return host, false
+	}
+	if host.MAC != "" {
+		mac, _ := net.ParseMAC(host.MAC)
+		host.MAC = mac.String()
+	}
+
+	if strings.EqualFold(host.Name, di.Config.ServerName) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Host name is already taken"})
+		return host, false
+	}
+	err = models.CheckLocalHostTaken(di.DB, host)
+	switch {
+	case errors.Is(err, models.ErrLocalHostNameTaken), errors.Is(err, models.ErrLocalHostIPTaken),
+		errors.Is(err, models.ErrLocalHostMACTaken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return host, false
+	case err != nil:
+		slog.Error("Error getting local host", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting local host"})
+		return host, false
+	}
+	if meshHostTaken(di, host.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Host name is already taken on the mesh"})
+		return host, false
+	}
+	return host, true
+}
+
+// meshHostTaken is whether another node, or a host behind one, has the
+// name. This node's own hosts are left to the database to check, since the
+// mesh may still list them under names they no longer have.
+func meshHostTaken(di *middleware.DepInjection, name string) bool {
+	nodeIP := net.ParseIP(di.Config.NodeIP)
+	if di.OLSRHostsParser != nil {
+		for _, host := range di.OLSRHostsParser.GetHosts() {
+			if host.IP.Equal(nodeIP) {
+				continue
+			}
+			if strings.EqualFold(host.Hostname, name) {
+				return true
+			}
+			for _, child := range host.Children {
+				if strings.EqualFold(child.Hostname, name) {
+					return true
+				}
+			}
+		}
+	}
+	if di.MeshLinkParser != nil {
+		for _, host := range di.MeshLinkParser.GetHosts() {
+			if host.IP.Equal(nodeIP) {
+				continue
+			}
+			if strings.EqualFold(host.Hostname, name) {
+				return true
+			}
+			for _, child := range host.Children {
+				if strings.EqualFold(child.Hostname, name) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
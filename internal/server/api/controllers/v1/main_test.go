@@ -0,0 +1,170 @@
+package v1_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/events"
+	"github.com/USA-RedDragon/mesh-manager/internal/lockout"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/USA-RedDragon/mesh-manager/internal/utils"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	testSalt          = "salt"
+	testAdminPassword = "admin-password"
+	// testClientIP is public, since logins from private addresses are refused
+	testClientIP = "8.8.8.8"
+)
+
+func TestMain(m *testing.M) {
+	// Every database is in memory, and each one is private to its server
+	os.Setenv("TEST", "1")
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// testServer is the API on an in-memory database, seeded with an admin
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+	db     *gorm.DB
+	config *config.Config
+	clock  *clock.Fake
+	// cookie is the session cookie, kept between requests like a browser
+	cookie string
+	// ip is the address requests come from
+	ip string
+	// token is sent as a bearer API token when set
+	token string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	cfg := &config.Config{
+		PasswordSalt:             testSalt,
+		InitialAdminUserPassword: testAdminPassword,
+		ServerName:               "KI5VMF-HUB",
+		NodeIP:                   "10.12.34.56",
+	}
+	database, err := db.MakeDB(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clk := clock.NewFake(time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC))
+
+	router := gin.New()
+	// Like the real server, a panic is a 500. There is no WireGuard manager
+	// or service registry, so handlers that reach them end there.
+	router.Use(gin.Recovery())
+	router.Use(middleware.Inject(&middleware.DepInjection{
+		Config:        cfg,
+		DB:            database,
+		PaginatedDB:   database,
+		EventsChannel: make(chan events.Event, 100),
+		Clock:         clk,
+		LoginTracker:  lockout.NewTracker(clk),
+	}))
+	router.Use(sessions.Sessions("sessions", cookie.NewStore([]byte("secret"))))
+	api.ApplyRoutes(router, database, make(chan events.Event, 100), cfg)
+
+	return &testServer{t: t, router: router, db: database, config: cfg, clock: clk, ip: testClientIP}
+}
+
+// createUser adds a user with the given password and role
+func (s *testServer) createUser(username, password string, role models.Role) models.User {
+	s.t.Helper()
+	user := models.User{
+		Username: username,
+		Password: utils.HashPassword(password, testSalt),
+		Role:     role,
+	}
+	err := s.db.Create(&user).Error
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return user
+}
+
+// createToken adds an API token for the user, returning its plaintext
+func (s *testServer) createToken(user models.User, expiresAt *time.Time, scopes ...models.Scope) string {
+	s.t.Helper()
+	plaintext, err := utils.GenerateToken("mmt_")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	token := models.APIToken{
+		Name:      "test",
+		TokenHash: utils.HashToken(plaintext),
+		UserID:    user.ID,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	err = s.db.Create(&token).Error
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return plaintext
+}
+
+// request sends a JSON request, returning the response and decoding its
+// body into out when out isn't nil
+func (s *testServer) request(method, path string, body any, out any) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var reader *bytes.Reader
+	if body == nil {
+		reader = bytes.NewReader(nil)
+	} else {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = s.ip + ":1234"
+	if s.cookie != "" {
+		req.Header.Set("Cookie", s.cookie)
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "sessions" {
+			s.cookie = c.Name + "=" + c.Value
+		}
+	}
+	if out != nil {
+		err := json.Unmarshal(w.Body.Bytes(), out)
+		if err != nil {
+			s.t.Fatalf("%s %s: decoding %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w
+}
+
+// login logs in with a password, returning the response status
+func (s *testServer) login(username, password string) int {
+	s.t.Helper()
+	return s.request(http.MethodPost, "/api/v1/auth/login", gin.H{"username": username, "password": password}, nil).Code
+}
@@ -0,0 +1,92 @@
+package v1
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/USA-RedDragon/mesh-manager/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+func GETServices(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	statuses := di.ServiceRegistry.Statuses()
+	c.JSON(http.StatusOK, gin.H{"total": len(statuses), "services": statuses})
+}
+
+func GETService(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	supervisor, ok := findSupervisor(c, di)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, supervisor.Status())
+}
+
+func POSTServiceStart(c *gin.Context) {
+	serviceAction(c, models.AuditActionServiceStart, (*services.Supervisor).Start)
+}
+
+func POSTServiceStop(c *gin.Context) {
+	serviceAction(c, models.AuditActionServiceStop, (*services.Supervisor).Stop)
+}
+
+func POSTServiceReload(c *gin.Context) {
+	serviceAction(c, models.AuditActionServiceReload, (*services.Supervisor).Reload)
+}
+
+// serviceAction runs a start, stop or reload on the service named in the path
+// and responds with its status afterwards
+func serviceAction(c *gin.Context, action models.AuditAction, fn func(*services.Supervisor) error) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	supervisor, ok := findSupervisor(c, di)
+	if !ok {
+		return
+	}
+
+	err := fn(supervisor)
+	if errors.Is(err, services.ErrServiceDisabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Service is disabled"})
+		return
+	}
+	// The attempt is recorded even if it failed, since it may still have
+	// stopped or signalled the service
+	recordAuditEvent(c, di, action, 0, c.Param("name"), nil, nil)
+	if err != nil {
+		slog.Error("serviceAction: Error running service action", "action", action, "service", c.Param("name"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, supervisor.Status())
+}
+
+func findSupervisor(c *gin.Context, di *middleware.DepInjection) (*services.Supervisor, bool) {
+	supervisor, ok := di.ServiceRegistry.Supervisor(services.ServiceName(c.Param("name")))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service not found"})
+		return nil, false
+	}
+	return supervisor, true
+}
@@ -0,0 +1,208 @@
+package v1
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/USA-RedDragon/mesh-manager/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	apiTokenPrefix       = "mmt_"
+	apiTokenPrefixLength = 8
+	maxAPITokenName      = 64
+)
+
+func GETAPITokens(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	tokens, err := models.ListAPITokensForUser(di.PaginatedDB, user.ID)
+	if err != nil {
+		slog.Error("GETAPITokens: Error getting tokens", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tokens"})
+		return
+	}
+
+	total, err := models.CountAPITokensForUser(di.DB, user.ID)
+	if err != nil {
+		slog.Error("GETAPITokens: Error getting token count", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting token count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": total, "tokens": tokens})
+}
+
+func POSTAPIToken(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	var json apimodels.CreateAPIToken
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("POSTAPIToken: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	if json.Name == "" || len(json.Name) > maxAPITokenName {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name must be between 1 and 64 characters"})
+		return
+	}
+
+	if len(json.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required"})
+		return
+	}
+
+	scopes := make([]models.Scope, 0, len(json.Scopes))
+	for _, s := range json.Scopes {
+		scope := models.Scope(s)
+		if !scope.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope " + s})
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	if json.ExpiresAt != nil && !json.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
+		return
+	}
+
+	plaintext, err := utils.GenerateToken(apiTokenPrefix)
+	if err != nil {
+		slog.Error("POSTAPIToken: Error generating token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+		return
+	}
+
+	token := models.APIToken{
+		Name:      json.Name,
+		TokenHash: utils.HashToken(plaintext),
+		Prefix:    plaintext[:len(apiTokenPrefix)+apiTokenPrefixLength],
+		UserID:    user.ID,
+		Scopes:    scopes,
+		ExpiresAt: json.ExpiresAt,
+	}
+	err = di.DB.Create(&token).Error
+	if err != nil {
+		slog.Error("POSTAPIToken: Error creating token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating token"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionAPITokenCreate, token.ID, token.Name, nil, token)
+
+	// This is the only time the plaintext token is ever returned
+	c.JSON(http.StatusOK, apimodels.CreatedAPIToken{
+		ID:        token.ID,
+		Name:      token.Name,
+		Token:     plaintext,
+		Scopes:    json.Scopes,
+		ExpiresAt: token.ExpiresAt,
+	})
+}
+
+func GETAPIToken(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	token, ok := findOwnedAPIToken(c, di)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, token)
+}
+
+func DELETEAPIToken(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	token, ok := findOwnedAPIToken(c, di)
+	if !ok {
+		return
+	}
+
+	err := models.DeleteAPIToken(di.DB, token.ID)
+	if err != nil {
+		slog.Error("DELETEAPIToken: Error deleting token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting token"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionAPITokenDelete, token.ID, token.Name, token, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token deleted"})
+}
+
+// findOwnedAPIToken looks up the token in the id param, writing an error
+// response if it doesn't exist or belongs to another user. Admins may
+// access any user's tokens so that they can revoke them.
+func findOwnedAPIToken(c *gin.Context, di *middleware.DepInjection) (models.APIToken, bool) {
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return models.APIToken{}, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return models.APIToken{}, false
+	}
+
+	token, err := models.FindAPITokenByID(di.DB, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+			return models.APIToken{}, false
+		}
+		slog.Error("Error finding token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding token"})
+		return models.APIToken{}, false
+	}
+
+	if token.UserID != user.ID && !user.Role.AtLeast(models.RoleAdmin) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return models.APIToken{}, false
+	}
+
+	return token, true
+}
@@ -0,0 +1,107 @@
+package v1_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/utils"
+)
+
+func TestAPITokenAuth(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	var admin models.User
+	err := s.db.First(&admin, "username = ?", "admin").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	revoked := s.createToken(admin, nil, models.ScopeUsersRead)
+	err = s.db.Where("token_hash = ?", utils.HashToken(revoked)).Delete(&models.APIToken{}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"scoped token", s.createToken(admin, nil, models.ScopeUsersRead), http.MethodGet, "/api/v1/users", http.StatusOK},
+		{"unexpired token", s.createToken(admin, &future, models.ScopeUsersRead), http.MethodGet, "/api/v1/users", http.StatusOK},
+		{"token missing scope", s.createToken(admin, nil, models.ScopeTunnelsRead), http.MethodGet, "/api/v1/users", http.StatusForbidden},
+		{"expired token", s.createToken(admin, &expired, models.ScopeUsersRead), http.MethodGet, "/api/v1/users", http.StatusUnauthorized},
+		{"revoked token", revoked, http.MethodGet, "/api/v1/users", http.StatusUnauthorized},
+		{"unknown token", "mmt_unknown", http.MethodGet, "/api/v1/users", http.StatusUnauthorized},
+		// API tokens can't manage tokens or two-factor enrollment
+		{"token on tokens", s.createToken(admin, nil, models.AllScopes...), http.MethodGet, "/api/v1/tokens", http.StatusForbidden},
+		{"token on totp", s.createToken(admin, nil, models.AllScopes...), http.MethodPost, "/api/v1/users/me/totp", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		s.token = tt.token
+		if code := s.request(tt.method, tt.path, nil, nil).Code; code != tt.want {
+			t.Errorf("%s: %s %s = %d, want %d", tt.name, tt.method, tt.path, code, tt.want)
+		}
+	}
+}
+
+func TestAPITokenMalformedHeader(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	if code := s.login("admin", testAdminPassword); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+
+	// An Authorization header that isn't a bearer token isn't ignored in
+	// favor of the session
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/users", nil)
+	req.RemoteAddr = s.ip + ":1234"
+	req.Header.Set("Cookie", s.cookie)
+	req.Header.Set("Authorization", "Basic YWRtaW46YWRtaW4=")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("users = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPITokenSessionSkipsScopes(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	if code := s.login("admin", testAdminPassword); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+
+	// Scopes only limit API tokens, and a session may manage tokens
+	for _, path := range []string{"/api/v1/users", "/api/v1/audit", "/api/v1/tokens"} {
+		if code := s.request(http.MethodGet, path, nil, nil).Code; code != http.StatusOK {
+			t.Errorf("%s = %d, want %d", path, code, http.StatusOK)
+		}
+	}
+}
+
+func TestAPITokenDeletedUser(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	user := s.createUser("automation", "automation-password", models.RoleAdmin)
+	s.token = s.createToken(user, nil, models.ScopeUsersRead)
+
+	if code := s.request(http.MethodGet, "/api/v1/users", nil, nil).Code; code != http.StatusOK {
+		t.Fatalf("users = %d, want %d", code, http.StatusOK)
+	}
+
+	// Soft-delete the user directly, leaving the token behind
+	err := s.db.Delete(&user).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := s.request(http.MethodGet, "/api/v1/users", nil, nil).Code; code != http.StatusUnauthorized {
+		t.Errorf("users after delete = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
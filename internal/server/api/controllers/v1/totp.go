@@ -0,0 +1,232 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/USA-RedDragon/mesh-manager/internal/totp"
+	"github.com/USA-RedDragon/mesh-manager/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+// POSTUserTOTP starts enrollment by generating a new secret for the current
+// user. It isn't required at login until confirmed with POSTUserTOTPVerify.
+func POSTUserTOTP(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		slog.Error("POSTUserTOTP: Error generating secret", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating secret"})
+		return
+	}
+
+	err = di.DB.Model(&user).Update("totp_secret", secret).Error
+	if err != nil {
+		slog.Error("POSTUserTOTP: Error saving secret", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving secret"})
+		return
+	}
+
+	issuer := "mesh-manager"
+	if di.Config.ServerName != "" {
+		issuer = fmt.Sprintf("mesh-manager (%s)", di.Config.ServerName)
+	}
+	c.JSON(http.StatusOK, apimodels.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(issuer, user.Username, secret),
+	})
+}
+
+// POSTUserTOTPVerify confirms enrollment with a code from the authenticator,
+// enabling two-factor authentication and returning the recovery codes
+func POSTUserTOTPVerify(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	var json apimodels.AuthTOTP
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("POSTUserTOTPVerify: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor enrollment has not been started"})
+		return
+	}
+
+	step, valid := totp.Validate(user.TOTPSecret, json.Code, di.Now(), user.TOTPLastStep)
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		slog.Error("POSTUserTOTPVerify: Error generating recovery codes", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating recovery codes"})
+		return
+	}
+
+	before := user
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	user.RecoveryCodes = make([]string, 0, len(codes))
+	for _, code := range codes {
+		user.RecoveryCodes = append(user.RecoveryCodes, utils.HashToken(code))
+	}
+	err = di.DB.Save(&user).Error
+	if err != nil {
+		slog.Error("POSTUserTOTPVerify: Error saving user", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving user"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionUserUpdate, user.ID, user.Username, before, user)
+
+	// This is the only time the recovery codes are ever returned
+	c.JSON(http.StatusOK, apimodels.TOTPRecoveryCodes{RecoveryCodes: codes})
+}
+
+// DELETEUserTOTP lets the current user turn off two-factor authentication,
+// which requires a current code or a recovery code
+func DELETEUserTOTP(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	user, ok := middleware.CurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+		return
+	}
+
+	var json apimodels.AuthTOTP
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("DELETEUserTOTP: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	before := user
+	verified, err := verifySecondFactor(di, &user, json.Code)
+	if err != nil {
+		slog.Error("DELETEUserTOTP: Error verifying code", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	if !verified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	resetTOTP(c, di, before, user)
+}
+
+// DELETEUserTOTPAdmin lets an admin turn off two-factor authentication for a
+// user who has lost both their device and their recovery codes
+func DELETEUserTOTPAdmin(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		return
+	}
+
+	user, err := models.FindUserByID(di.DB, uint(idUint64))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User does not exist"})
+			return
+		}
+		slog.Error("DELETEUserTOTPAdmin: Error finding user", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding user"})
+		return
+	}
+
+	resetTOTP(c, di, user, user)
+}
+
+func resetTOTP(c *gin.Context, di *middleware.DepInjection, before, user models.User) {
+	user.ResetTOTP()
+	err := di.DB.Save(&user).Error
+	if err != nil {
+		slog.Error("Error resetting two-factor authentication", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving user"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionUserUpdate, user.ID, user.Username, before, user)
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// verifySecondFactor checks a TOTP code or recovery code for a user with
+// two-factor authentication enabled, saving the user if the code is used up
+func verifySecondFactor(di *middleware.DepInjection, user *models.User, code string) (bool, error) {
+	step, valid := totp.Validate(user.TOTPSecret, code, di.Now(), user.TOTPLastStep)
+	if valid {
+		user.TOTPLastStep = step
+		return true, di.DB.Model(user).Update("totp_last_step", step).Error
+	}
+
+	if user.ConsumeRecoveryCode(totp.NormalizeRecoveryCode(code)) {
+		slog.Warn("Recovery code used", "username", user.Username, "remaining", len(user.RecoveryCodes))
+		return true, di.DB.Model(user).Select("recovery_codes").Updates(user).Error
+	}
+
+	return false, nil
+}
@@ -0,0 +1,125 @@
+package v1
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/bandwidth"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+const defaultTrafficRange = 24 * time.Hour
+
+// GETTraffic returns the whole node's traffic history
+func GETTraffic(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	trafficSeries(c, di, bandwidth.NodeTrafficID)
+}
+
+func GETTunnelTraffic(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	tunnelID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tunnel ID"})
+		return
+	}
+
+	exists, err := models.TunnelIDExists(di.DB, uint(tunnelID))
+	if err != nil {
+		slog.Error("GETTunnelTraffic: Error checking if tunnel exists", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if tunnel exists"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tunnel not found"})
+		return
+	}
+
+	trafficSeries(c, di, uint(tunnelID))
+}
+
+// trafficSeries responds with the traffic series selected by the from, to,
+// and step query parameters. Times are RFC 3339 and the step is a duration
+// such as 5m or 1h.
+func trafficSeries(c *gin.Context, di *middleware.DepInjection, tunnelID uint) {
+	now := di.Now()
+	from, to, ok := parseTimeRange(c, now, defaultTrafficRange)
+	if !ok {
+		return
+	}
+	step := models.DefaultTrafficStep(from, to, now)
+	if raw, exists := c.GetQuery("step"); exists {
+		var err error
+		step, err = time.ParseDuration(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid step"})
+			return
+		}
+	}
+
+	points, err := models.TrafficSeries(di.DB, tunnelID, from, to, now, step)
+	if err != nil {
+		if errors.Is(err, models.ErrTrafficInvalidStep) || errors.Is(err, models.ErrTrafficInvalidRange) ||
+			errors.Is(err, models.ErrTrafficTooManyPoints) || errors.Is(err, models.ErrTrafficStepExpired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		slog.Error("Error getting traffic series", "tunnel", tunnelID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting traffic"})
+		return
+	}
+
+	c.JSON(http.StatusOK, apimodels.TrafficSeries{
+		From:   points[0].Time,
+		To:     to,
+		Step:   int64(step / time.Second),
+		Points: points,
+	})
+}
+
+// parseTimeRange reads the from and to query parameters as RFC 3339 times.
+// to defaults to now and from to defaultRange before to, and from must be
+// before to. On failure it has already responded.
+func parseTimeRange(c *gin.Context, now time.Time, defaultRange time.Duration) (time.Time, time.Time, bool) {
+	to := now
+	if raw, exists := c.GetQuery("to"); exists {
+		var err error
+		to, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to time"})
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	from := to.Add(-defaultRange)
+	if raw, exists := c.GetQuery("from"); exists {
+		var err error
+		from, err = time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from time"})
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": models.ErrTrafficInvalidRange.Error()})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/bundle"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+// POSTTunnelsExport returns every tunnel as an encrypted bundle for
+// `mesh-manager tunnels import`
+func POSTTunnelsExport(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	var json apimodels.ExportTunnels
+	err := c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("POSTTunnelsExport: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	now := di.Now()
+	b, err := bundle.Export(di.DB, now)
+	if err != nil {
+		slog.Error("POSTTunnelsExport: Error exporting tunnels", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting tunnels"})
+		return
+	}
+
+	sealed, err := bundle.Seal(b, json.Passphrase)
+	if err != nil {
+		if errors.Is(err, bundle.ErrPassphraseTooShort) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		slog.Error("POSTTunnelsExport: Error sealing bundle", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error exporting tunnels"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionTunnelExport, 0, fmt.Sprintf("%d tunnels", len(b.Tunnels)), nil, nil)
+
+	filename := fmt.Sprintf("tunnels-%s.mmtb", now.UTC().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/octet-stream", sealed)
+}
@@ -0,0 +1,167 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+)
+
+const qrCodeSize = 512
+
+// GETTunnelClientConfig returns the client side of a server tunnel. The
+// format query parameter picks json (the default), conf for a wg-quick file,
+// or png or svg for a QR code of the wg-quick file. The endpoint query
+// parameter overrides the host clients connect to, which otherwise is the
+// tunnel's public endpoint, then the host this request was made to.
+func GETTunnelClientConfig(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	tunnelID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tunnel ID"})
+		return
+	}
+
+	tunnel, err := models.FindTunnelByID(di.DB, uint(tunnelID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tunnel not found"})
+			return
+		}
+		slog.Error("GETTunnelClientConfig: Error getting tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel"})
+		return
+	}
+
+	config, err := buildClientConfig(c, di.Config, tunnel, c.Query("endpoint"))
+	if err != nil {
+		switch {
+		case errors.Is(err, wireguard.ErrNotServerTunnel), errors.Is(err, wireguard.ErrInvalidEndpoint):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			slog.Error("GETTunnelClientConfig: Error building client config", "tunnel", tunnel.Hostname, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error building client config"})
+		}
+		return
+	}
+	wgQuick := config.WGQuick()
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.JSON(http.StatusOK, clientConfigResponse(config))
+	case "conf":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", clientConfigFilename(tunnel)))
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(wgQuick))
+	case "png":
+		png, err := qrcode.Encode(wgQuick, qrcode.Medium, qrCodeSize)
+		if err != nil {
+			slog.Error("GETTunnelClientConfig: Error generating QR code", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating QR code"})
+			return
+		}
+		c.Data(http.StatusOK, "image/png", png)
+	case "svg":
+		qr, err := qrcode.New(wgQuick, qrcode.Medium)
+		if err != nil {
+			slog.Error("GETTunnelClientConfig: Error generating QR code", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating QR code"})
+			return
+		}
+		c.Data(http.StatusOK, "image/svg+xml", qrSVG(qr.Bitmap()))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json, conf, png, or svg"})
+	}
+}
+
+// buildClientConfig points the client at host if it is given, otherwise at
+// the tunnel's public endpoints, or failing those the host the request was
+// made to
+func buildClientConfig(c *gin.Context, cfg *config.Config, tunnel models.Tunnel, host string) (wireguard.ClientConfig, error) {
+	if host == "" && len(wireguard.PublicEndpoints(cfg, tunnel)) > 0 {
+		return wireguard.NewPublicClientConfig(cfg, tunnel)
+	}
+	if host == "" {
+		host = requestHost(c)
+	}
+	return wireguard.NewClientConfig(tunnel, host)
+}
+
+func clientConfigResponse(config wireguard.ClientConfig) apimodels.TunnelClientConfig {
+	return apimodels.TunnelClientConfig{
+		Config:             config.WGQuick(),
+		Endpoint:           config.Endpoint,
+		AlternateEndpoints: config.AlternateEndpoints,
+		Network:            config.Network,
+		NetworkIPv6:        config.NetworkIPv6,
+		Password:           config.Password,
+	}
+}
+
+// requestHost is the host the request was made to, without the port
+func requestHost(c *gin.Context) string {
+	host := c.Request.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// clientConfigFilename names the wg-quick file after the tunnel. wg-quick
+// takes the interface name from the file name, which is limited to 15
+// characters.
+func clientConfigFilename(tunnel models.Tunnel) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return -1
+	}, strings.ToLower(tunnel.Hostname))
+	if len(name) > 15 {
+		name = name[:15]
+	}
+	if name == "" {
+		name = "wg" + strconv.FormatUint(uint64(tunnel.ID), 10)
+	}
+	return name + ".conf"
+}
+
+// qrSVG draws a QR code bitmap as an SVG with one unit per module
+func qrSVG(bitmap [][]bool) []byte {
+	size := len(bitmap)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, size, size)
+	fmt.Fprintf(&sb, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, size, size)
+	for y, row := range bitmap {
+		// Draw each horizontal run of dark modules as one rectangle
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&sb, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	sb.WriteString(`"/></svg>`)
+	return []byte(sb.String())
+}
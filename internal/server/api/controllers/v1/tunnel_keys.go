@@ -0,0 +1,154 @@
+package v1
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// POSTTunnelRotateKeys gives a server tunnel new keys and returns the new
+// client config
+func POSTTunnelRotateKeys(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	tunnelID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tunnel ID"})
+		return
+	}
+
+	// Every field is optional, so a request with no body is fine
+	var json apimodels.RotateTunnelKeys
+	err = c.ShouldBindJSON(&json)
+	if err != nil && !errors.Is(err, io.EOF) {
+		slog.Error("POSTTunnelRotateKeys: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	graceHours := di.Config.Wireguard.KeyRotationGrace
+	if json.GraceHours != nil {
+		graceHours = *json.GraceHours
+	}
+	if json.Endpoint != "" {
+		if err := wireguard.ValidateEndpointHost(json.Endpoint); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tunnel, err := models.FindTunnelByID(di.DB, uint(tunnelID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tunnel not found"})
+			return
+		}
+		slog.Error("POSTTunnelRotateKeys: Error getting tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel"})
+		return
+	}
+
+	before := tunnel
+	tunnel, err = wireguard.RotateKeys(di.DB, tunnel, di.Now(), time.Duration(graceHours)*time.Hour, json.ServerKey)
+	if err != nil {
+		if errors.Is(err, wireguard.ErrNotServerTunnel) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		slog.Error("POSTTunnelRotateKeys: Error rotating keys", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error rotating keys"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionTunnelRotateKeys, tunnel.ID, tunnel.Hostname, before, tunnel)
+
+	if di.WireguardManager != nil {
+		err = di.WireguardManager.Reconfigure(tunnel)
+		if err != nil {
+			slog.Error("POSTTunnelRotateKeys: Error reconfiguring wireguard peer", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reconfiguring wireguard peer"})
+			return
+		}
+	}
+
+	response := gin.H{
+		"message":         "Tunnel keys rotated",
+		"key_rotated_at":  tunnel.KeyRotatedAt,
+		"key_grace_until": tunnel.KeyGraceUntil,
+	}
+	config, err := buildClientConfig(c, di.Config, tunnel, json.Endpoint)
+	if err != nil {
+		// The keys are rotated either way, and the config can be fetched
+		// from client-config with an endpoint if the default won't do
+		slog.Warn("POSTTunnelRotateKeys: Error building client config", "tunnel", tunnel.Hostname, "error", err)
+	} else {
+		response["client_config"] = clientConfigResponse(config)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GETTunnelKeyAges lists server tunnels by how long they've had their keys,
+// oldest first. older_than_days limits it to tunnels due for rotation.
+func GETTunnelKeyAges(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	var olderThan time.Duration
+	if days := c.Query("older_than_days"); days != "" {
+		n, err := strconv.ParseUint(days, 10, 16)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "older_than_days must be a number of days"})
+			return
+		}
+		olderThan = time.Duration(n) * 24 * time.Hour
+	}
+
+	tunnels, err := models.ListServerTunnels(di.DB)
+	if err != nil {
+		slog.Error("GETTunnelKeyAges: Error getting tunnels", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnels"})
+		return
+	}
+
+	now := di.Now()
+	ages := make([]apimodels.TunnelKeyAge, 0, len(tunnels))
+	for _, tunnel := range tunnels {
+		if !tunnel.Wireguard || tunnel.KeyAge(now) < olderThan {
+			continue
+		}
+		age := apimodels.TunnelKeyAge{
+			ID:           tunnel.ID,
+			Hostname:     tunnel.Hostname,
+			KeyRotatedAt: tunnel.KeyRotatedAt,
+			KeyAge:       int64(tunnel.KeyAge(now).Seconds()),
+		}
+		if tunnel.InKeyGrace(now) {
+			age.KeyGraceUntil = tunnel.KeyGraceUntil
+		}
+		ages = append(ages, age)
+	}
+	sort.SliceStable(ages, func(i, j int) bool {
+		return ages[i].KeyAge > ages[j].KeyAge
+	})
+
+	c.JSON(http.StatusOK, gin.H{"total": len(ages), "tunnels": ages})
+}
@@ -0,0 +1,61 @@
+package v1_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRotateKeysBody(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	if code := s.login("admin", testAdminPassword); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+
+	tests := []struct {
+		name string
+		body any
+		want int
+	}{
+		// Gets as far as looking up the tunnel
+		{"no body", nil, http.StatusNotFound},
+		{"empty object", gin.H{}, http.StatusNotFound},
+		{"invalid", gin.H{"grace_hours": "soon"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if code := s.request(http.MethodPost, "/api/v1/tunnels/999/rotate-keys", tt.body, nil).Code; code != tt.want {
+			t.Errorf("%s: rotate keys = %d, want %d", tt.name, code, tt.want)
+		}
+	}
+}
+
+func TestTunnelKeyAgesAccess(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	s.createUser("viewer", "viewer-password", models.RoleViewer)
+	s.createUser("operator", "operator-password", models.RoleOperator)
+
+	if code := s.request(http.MethodGet, "/api/v1/tunnels/keys", nil, nil).Code; code != http.StatusUnauthorized {
+		t.Errorf("logged out: key ages = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	tests := []struct {
+		username string
+		password string
+		want     int
+	}{
+		{"viewer", "viewer-password", http.StatusForbidden},
+		{"operator", "operator-password", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := s.login(tt.username, tt.password); code != http.StatusOK {
+			t.Fatalf("%s: login = %d, want %d", tt.username, code, http.StatusOK)
+		}
+		if code := s.request(http.MethodGet, "/api/v1/tunnels/keys", nil, nil).Code; code != tt.want {
+			t.Errorf("%s: key ages = %d, want %d", tt.username, code, tt.want)
+		}
+	}
+}
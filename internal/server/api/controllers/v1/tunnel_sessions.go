@@ -0,0 +1,143 @@
+package v1
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultUptimeRange = 7 * 24 * time.Hour
+
+func GETTunnelSessions(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	tunnelID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tunnel ID"})
+		return
+	}
+
+	exists, err := models.TunnelIDExists(di.DB, uint(tunnelID))
+	if err != nil {
+		slog.Error("GETTunnelSessions: Error checking if tunnel exists", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking if tunnel exists"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tunnel not found"})
+		return
+	}
+
+	sessions, err := models.ListTunnelSessions(di.PaginatedDB, uint(tunnelID))
+	if err != nil {
+		slog.Error("GETTunnelSessions: Error getting tunnel sessions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel sessions"})
+		return
+	}
+
+	total, err := models.CountTunnelSessions(di.DB, uint(tunnelID))
+	if err != nil {
+		slog.Error("GETTunnelSessions: Error getting tunnel session count", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel session count"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": total, "sessions": sessions})
+}
+
+func GETTunnelUptime(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	tunnelID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tunnel ID"})
+		return
+	}
+
+	now := di.Now()
+	from, to, ok := parseTimeRange(c, now, defaultUptimeRange)
+	if !ok {
+		return
+	}
+
+	tunnel, err := models.FindTunnelByID(di.DB, uint(tunnelID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tunnel not found"})
+			return
+		}
+		slog.Error("GETTunnelUptime: Error getting tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel"})
+		return
+	}
+
+	sessions, err := models.ListTunnelSessionsBetween(di.DB, tunnel.ID, from, to)
+	if err != nil {
+		slog.Error("GETTunnelUptime: Error getting tunnel sessions", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ComputeTunnelUptime(tunnel, sessions, from, to, now))
+}
+
+// GETTunnelsUptime reports every tunnel's uptime, least stable first
+func GETTunnelsUptime(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	now := di.Now()
+	from, to, ok := parseTimeRange(c, now, defaultUptimeRange)
+	if !ok {
+		return
+	}
+
+	tunnels, err := models.ListAllTunnels(di.DB)
+	if err != nil {
+		slog.Error("GETTunnelsUptime: Error getting tunnels", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnels"})
+		return
+	}
+
+	uptimes := make([]models.TunnelUptime, 0, len(tunnels))
+	for _, tunnel := range tunnels {
+		sessions, err := models.ListTunnelSessionsBetween(di.DB, tunnel.ID, from, to)
+		if err != nil {
+			slog.Error("GETTunnelsUptime: Error getting tunnel sessions", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel sessions"})
+			return
+		}
+		uptimes = append(uptimes, models.ComputeTunnelUptime(tunnel, sessions, from, to, now))
+	}
+
+	sort.SliceStable(uptimes, func(i, j int) bool {
+		if uptimes[i].Flaps != uptimes[j].Flaps {
+			return uptimes[i].Flaps > uptimes[j].Flaps
+		}
+		return uptimes[i].UptimePercent < uptimes[j].UptimePercent
+	})
+
+	c.JSON(http.StatusOK, gin.H{"total": len(uptimes), "tunnels": uptimes})
+}
@@ -0,0 +1,69 @@
+package v1_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+func TestTunnelSessions(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	if code := s.login("admin", testAdminPassword); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+	tunnel := models.Tunnel{Hostname: "KI5VMF-A", IP: "172.16.0.2"}
+	err := s.db.Create(&tunnel).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"tunnel with no sessions", fmt.Sprintf("/api/v1/tunnels/%d/sessions", tunnel.ID), http.StatusOK},
+		{"missing tunnel", "/api/v1/tunnels/999/sessions", http.StatusNotFound},
+		{"invalid ID", "/api/v1/tunnels/abc/sessions", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if code := s.request(http.MethodGet, tt.path, nil, nil).Code; code != tt.want {
+			t.Errorf("%s: sessions = %d, want %d", tt.name, code, tt.want)
+		}
+	}
+}
+
+func TestTunnelUptimeRange(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	tunnel := models.Tunnel{Hostname: "KI5VMF-A", IP: "172.16.0.2"}
+	err := s.db.Create(&tunnel).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		earlier = "2024-05-31T12:00:00Z"
+		later   = "2024-06-01T12:00:00Z"
+	)
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"default range", "", http.StatusOK},
+		{"range", fmt.Sprintf("?from=%s&to=%s", earlier, later), http.StatusOK},
+		{"reversed range", fmt.Sprintf("?from=%s&to=%s", later, earlier), http.StatusBadRequest},
+		{"empty range", fmt.Sprintf("?from=%s&to=%s", later, later), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		for _, path := range []string{fmt.Sprintf("/api/v1/tunnels/%d/uptime", tunnel.ID), "/api/v1/tunnels/uptime"} {
+			if code := s.request(http.MethodGet, path+tt.query, nil, nil).Code; code != tt.want {
+				t.Errorf("%s: %s = %d, want %d", tt.name, path, code, tt.want)
+			}
+		}
+	}
+}
@@ -7,19 +7,26 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"strconv"
 	"strings"
 
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
 	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/geojson"
+	"github.com/USA-RedDragon/mesh-manager/internal/ipam"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
 	"github.com/USA-RedDragon/mesh-manager/internal/services"
 	"github.com/USA-RedDragon/mesh-manager/internal/services/babel"
 	"github.com/USA-RedDragon/mesh-manager/internal/services/lqm"
 	"github.com/USA-RedDragon/mesh-manager/internal/services/olsr"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/vtun"
+	"github.com/USA-RedDragon/mesh-manager/internal/shaping"
+	"github.com/USA-RedDragon/mesh-manager/internal/tunnels"
+	"github.com/USA-RedDragon/mesh-manager/internal/utils"
 	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 	"gorm.io/gorm"
@@ -70,8 +77,12 @@ func GETTunnels(c *gin.Context) {
 	var tunnels []models.Tunnel
 	var total int64
 	switch typeStr {
-	case "wireguard":
-		dbQuery := di.DB.Model(&models.Tunnel{}).Where("wireguard = ?", true)
+	case "wireguard", "vtun":
+		if typeStr == "vtun" && !di.Config.VTun.Enabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "VTun is disabled"})
+			return
+		}
+		dbQuery := di.DB.Model(&models.Tunnel{}).Where("wireguard = ?", typeStr == "wireguard")
 		if filter != "" {
 			dbQuery = dbQuery.Where("upper(hostname) LIKE ?", fmt.Sprintf("%%%s%%", strings.ToUpper(filter)))
 		}
@@ -93,6 +104,15 @@ func GETTunnels(c *gin.Context) {
 		return
 	}
 
+	now := di.Now()
+	for i := range tunnels {
+		tunnels[i].NextTransition = tunnels[i].NextScheduledTransition(now)
+		tunnels[i].HandshakeAgeSeconds = tunnels[i].HandshakeAge(now)
+		if tunnels[i].Active {
+			tunnels[i].Shaping = tunnelShaping(tunnels[i])
+		}
+	}
+
 	adminStr, exists := c.GetQuery("admin")
 	if !exists {
 		adminStr = "false"
@@ -106,33 +126,61 @@ func GETTunnels(c *gin.Context) {
 
 	if admin {
 		// Check for an active session
-		session := sessions.Default(c)
-		user := session.Get("user_id")
-		if user == nil {
+		user, ok := middleware.CurrentUser(c)
+		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			return
 		}
+		// Tunnel passwords are only for those that can manage tunnels
+		if !user.Role.AtLeast(models.RoleOperator) || !middleware.HasScope(c, models.ScopeTunnelsRead) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+
+		// Server tunnel passwords hold the client's private key, so like
+		// the client config they are only shown to interactive admins
+		showPasswords := user.Role.AtLeast(models.RoleAdmin) && !middleware.UsingAPIToken(c)
 
 		// Change the json response to include the password
 		var tunnelsWithPass []apimodels.TunnelWithPass
 
 		for _, tunnel := range tunnels {
 			maybePassword := ""
-			if !tunnel.Client {
+			if !tunnel.Client && showPasswords {
 				maybePassword = tunnel.Password
 			}
 			tunnelsWithPass = append(tunnelsWithPass, apimodels.TunnelWithPass{
-				Enabled:        tunnel.Enabled,
-				Wireguard:      tunnel.Wireguard,
-				WireguardPort:  tunnel.WireguardPort,
-				ID:             tunnel.ID,
-				Hostname:       tunnel.Hostname,
-				IP:             tunnel.IP,
-				Password:       maybePassword,
-				Client:         tunnel.Client,
-				Active:         tunnel.Active,
-				ConnectionTime: tunnel.ConnectionTime,
-				CreatedAt:      tunnel.CreatedAt,
+				Enabled:             tunnel.Enabled,
+				Wireguard:           tunnel.Wireguard,
+				WireguardPort:       tunnel.WireguardPort,
+				ID:                  tunnel.ID,
+				Hostname:            tunnel.Hostname,
+				IP:                  tunnel.IP,
+				IPv6:                tunnel.IPv6,
+				Password:            maybePassword,
+				Client:              tunnel.Client,
+				Active:              tunnel.Active,
+				ConnectionTime:      tunnel.ConnectionTime,
+				CreatedAt:           tunnel.CreatedAt,
+				ExpiresAt:           tunnel.ExpiresAt,
+				Schedule:            tunnel.Schedule,
+				NextTransition:      tunnel.NextTransition,
+				DailyQuota:          tunnel.DailyQuota,
+				MonthlyQuota:        tunnel.MonthlyQuota,
+				QuotaResetDay:       tunnel.QuotaResetDay,
+				QuotaPolicy:         tunnel.QuotaPolicy,
+				QuotaThrottleKbps:   tunnel.QuotaThrottleKbps,
+				QuotaAction:         tunnel.QuotaAction,
+				RateLimit:           tunnel.RateLimit,
+				Shaping:             tunnel.Shaping,
+				PublicEndpoint:      tunnel.PublicEndpoint,
+				LastHandshakeAt:     tunnel.LastHandshakeAt,
+				HandshakeAgeSeconds: tunnel.HandshakeAgeSeconds,
+				KeepaliveSeconds:    tunnel.KeepaliveSeconds,
+				Endpoint:            tunnel.Endpoint,
+				PreviousEndpoint:    tunnel.PreviousEndpoint,
+				EndpointChangedAt:   tunnel.EndpointChangedAt,
+				EndpointChanges:     tunnel.EndpointChanges,
 			})
 		}
 		c.JSON(http.StatusOK, gin.H{"total": total, "tunnels": tunnelsWithPass})
@@ -185,7 +233,7 @@ func GETTunnelLQM(c *gin.Context) {
 		return
 	}
 
-	tracker := findTrackerForTunnel(tunnel, trackers)
+	tracker := lqm.TrackerForTunnel(tunnel, trackers)
 	if tracker == nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "No LQM data for tunnel"})
 		return
@@ -224,6 +272,27 @@ func GETTunnelLQM(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// GETTunnelsGeoJSON plots this node and the tunnel peers LQM has located,
+// for the supernode map
+func GETTunnelsGeoJSON(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	tunnels, err := models.ListAllTunnels(di.DB)
+	if err != nil {
+		slog.Error("GETTunnelsGeoJSON: Error getting tunnels", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnels"})
+		return
+	}
+
+	c.Header("Content-Type", "application/geo+json")
+	c.JSON(http.StatusOK, geojson.TunnelMap(di.Config, tunnels))
+}
+
 func GETWireguardTunnelsCount(c *gin.Context) {
 	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
 	if !ok {
@@ -354,7 +423,24 @@ func POSTTunnel(c *gin.Context) {
 		}
 
 		if !json.Wireguard {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "VTun is disabled"})
+			if !di.Config.VTun.Enabled {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "VTun is disabled"})
+				return
+			}
+			if err := vtun.ValidatePassword(json.Password); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if json.Schedule != nil {
+			if err := json.Schedule.Validate(); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if json.ExpiresAt != nil && !json.ExpiresAt.After(di.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry must be in the future"})
 			return
 		}
 
@@ -378,56 +464,83 @@ func POSTTunnel(c *gin.Context) {
 			}
 
 			tunnel = models.Tunnel{
-				Enabled:   true,
 				Hostname:  json.Hostname,
 				Password:  json.Password,
 				Client:    json.Client,
 				Wireguard: json.Wireguard,
+				ExpiresAt: json.ExpiresAt,
+				Schedule:  json.Schedule,
 			}
+			tunnel.Enabled = tunnel.ScheduledEnabled(di.Now())
 
-			tunnel.IP, err = models.GetNextWireguardIP(di.DB, di.Config)
-			if err != nil {
-				slog.Error("POSTTunnel: Error getting next IP", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting next IP"})
-				return
+			// vtun tunnels keep the password they were given and share
+			// vtund's port
+			if tunnel.Wireguard {
+				tunnel.WireguardServerKey, tunnel.Password, err = wireguard.GenerateServerTunnelKeys()
+				if err != nil {
+					slog.Error("POSTTunnel: Error generating keys", "error", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating keys"})
+					return
+				}
 			}
 
-			tunnel.WireguardPort, err = models.GetNextWireguardPort(di.DB, di.Config)
-			if err != nil {
-				slog.Error("POSTTunnel: Error getting next port", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting next port"})
-				return
-			}
+			// The addresses are allocated in the same transaction the tunnel
+			// is created in, so concurrent requests can't be given the same
+			// block
+			err = di.DB.Transaction(func(tx *gorm.DB) error {
+				var err error
+				if json.IP != "" {
+					// Pin the tunnel to a block of the pool
+					tunnel.IP, err = ipam.Pin(tx, di.Config, json.IP)
+				} else {
+					tunnel.IP, err = ipam.Allocate(tx, di.Config)
+				}
+				if err != nil {
+					return err
+				}
 
-			// Generate a server and client key pair
-			serverKey, err := wgtypes.GeneratePrivateKey()
-			if err != nil {
-				slog.Error("POSTTunnel: Error generating server key", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating server key"})
-				return
-			}
-			clientKey, err := wgtypes.GeneratePrivateKey()
-			if err != nil {
-				slog.Error("POSTTunnel: Error generating client key", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating client key"})
-				return
-			}
+				if tunnel.Wireguard {
+					tunnel.IPv6, err = models.GetNextWireguardIPv6(tx, di.Config)
+					if err != nil {
+						return fmt.Errorf("failed to get next IPv6 address: %w", err)
+					}
 
-			tunnel.Password = serverKey.PublicKey().String() + clientKey.String() + clientKey.PublicKey().String()
-			tunnel.WireguardServerKey = serverKey.String()
+					tunnel.WireguardPort, err = models.GetNextWireguardPort(tx, di.Config)
+					if err != nil {
+						return fmt.Errorf("failed to get next port: %w", err)
+					}
+				}
 
-			err = di.DB.Create(&tunnel).Error
+				return models.CreateTunnel(tx, &tunnel)
+			})
 			if err != nil {
-				slog.Error("POSTTunnel: Error creating tunnel", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating tunnel"})
+				switch {
+				case errors.Is(err, ipam.ErrPoolExhausted), errors.Is(err, ipam.ErrInvalidAddress),
+					errors.Is(err, ipam.ErrNotInPool), errors.Is(err, ipam.ErrNotBlockStart),
+					errors.Is(err, ipam.ErrBlockInUse), errors.Is(err, ipam.ErrBlockReserved):
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				default:
+					slog.Error("POSTTunnel: Error creating tunnel", "error", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating tunnel"})
+				}
 				return
 			}
+			recordAuditEvent(c, di, models.AuditActionTunnelCreate, tunnel.ID, tunnel.Hostname, nil, tunnel)
 
-			err = di.WireguardManager.AddPeer(tunnel)
-			if err != nil {
-				slog.Error("POSTTunnel: Error adding wireguard peer", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding wireguard peer"})
-				return
+			if !tunnel.Wireguard {
+				err = reloadVTun(di)
+				if err != nil {
+					slog.Error("POSTTunnel: Error reloading vtund", "error", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reloading vtund"})
+					return
+				}
+			} else {
+				err = di.WireguardManager.AddPeer(tunnel)
+				if err != nil {
+					slog.Error("POSTTunnel: Error adding wireguard peer", "error", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding wireguard peer"})
+					return
+				}
 			}
 		} else {
 			if json.IP == "" {
@@ -531,6 +644,16 @@ func POSTTunnel(c *gin.Context) {
 				Wireguard: json.Wireguard,
 			}
 
+			if json.IPv6 != "" {
+				// The server's address in its ULA prefix, from its client config
+				ipv6, err := netip.ParseAddr(json.IPv6)
+				if err != nil || !json.Wireguard || !utils.IsULA(ipv6) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "IPv6 must be a unique local address on a WireGuard tunnel"})
+					return
+				}
+				tunnel.IPv6 = ipv6.String()
+			}
+
 			if tunnel.Wireguard {
 				// The password will be 3 wireguard keys concatenated together
 				// <server_pubkey><client_privkey><client_pubkey>
@@ -558,18 +681,32 @@ func POSTTunnel(c *gin.Context) {
 				}
 			}
 
-			err = di.DB.Create(&tunnel).Error
+			tunnel.ExpiresAt = json.ExpiresAt
+			tunnel.Schedule = json.Schedule
+			tunnel.Enabled = tunnel.ScheduledEnabled(di.Now())
+
+			err = models.CreateTunnel(di.DB, &tunnel)
 			if err != nil {
 				slog.Error("POSTTunnel: Error creating tunnel", "error", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating tunnel"})
 				return
 			}
+			recordAuditEvent(c, di, models.AuditActionTunnelCreate, tunnel.ID, tunnel.Hostname, nil, tunnel)
 
-			err = di.WireguardManager.AddPeer(tunnel)
-			if err != nil {
-				slog.Error("POSTTunnel: Error adding wireguard peer", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding wireguard peer"})
-				return
+			if !tunnel.Wireguard {
+				err = reloadVTun(di)
+				if err != nil {
+					slog.Error("POSTTunnel: Error reloading vtund", "error", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reloading vtund"})
+					return
+				}
+			} else {
+				err = di.WireguardManager.AddPeer(tunnel)
+				if err != nil {
+					slog.Error("POSTTunnel: Error adding wireguard peer", "error", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding wireguard peer"})
+					return
+				}
 			}
 		}
 
@@ -611,7 +748,7 @@ func POSTTunnel(c *gin.Context) {
 				return
 			}
 
-			err = babelService.AddTunnel(c.Request.Context(), wireguard.GenerateWireguardInterfaceName(tunnel))
+			err = babelService.AddTunnel(c.Request.Context(), tunnels.InterfaceName(tunnel))
 			if err != nil {
 				slog.Error("POSTTunnel: Error adding Babel tunnel", "error", err)
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding Babel tunnel"})
@@ -662,27 +799,14 @@ func PATCHTunnel(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Tunnel does not exist"})
 			return
 		}
-		if json.IP == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "IP cannot be empty"})
-			return
-		}
-
-		// Check to ensure the IP is valid
-		if net.ParseIP(json.IP) == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "IP is not a valid IP address"})
-			return
-		}
-
-		// Check to ensure the IP is in the correct range: 172.16.0.0/12
-		ip := net.ParseIP(json.IP)
-		_, cidr, err := net.ParseCIDR("172.16.0.0/12")
+		auditBefore, err := models.FindTunnelByID(di.DB, json.ID)
 		if err != nil {
-			slog.Error("Error parsing CIDR", "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing CIDR"})
+			slog.Error("Error getting tunnel", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel"})
 			return
 		}
-		if !cidr.Contains(ip) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "IP is not in the correct range"})
+		if json.IP == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "IP cannot be empty"})
 			return
 		}
 
@@ -695,6 +819,16 @@ func PATCHTunnel(c *gin.Context) {
 
 		json.Hostname = strings.ToUpper(json.Hostname)
 
+		// Server tunnels are named for the client node, and vtun writes
+		// that name into its config
+		if !auditBefore.Client {
+			isValid, errString := json.IsValidHostname()
+			if !isValid {
+				c.JSON(http.StatusBadRequest, gin.H{"error": errString})
+				return
+			}
+		}
+
 		split := strings.Split(json.Hostname, ":")
 		if len(split) > 2 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Server address is invalid"})
@@ -731,58 +865,74 @@ func PATCHTunnel(c *gin.Context) {
 			}
 		}
 
-		// Check if the IP is already taken
-		var tunnel models.Tunnel
-		err = di.DB.Find(&tunnel, "ip = ?", json.IP).Error
-		if err != nil {
-			slog.Error("Error getting tunnel", "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel"})
-			return
-		} else if tunnel.ID != 0 && tunnel.ID != json.ID {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "IP address is already taken"})
+		if auditBefore.Wireguard != *json.Wireguard {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Changing tunnel type not allowed"})
 			return
 		}
 
-		origTunnel := tunnel
+		if json.IP != auditBefore.IP {
+			json.IP, ok = checkTunnelIP(c, di, auditBefore, json.IP)
+			if !ok {
+				return
+			}
+		}
 
+		origTunnel := auditBefore
+		tunnel := auditBefore
 		tunnel.Hostname = json.Hostname
-		tunnel.Password = json.Password
 		tunnel.IP = json.IP
-
-		if tunnel.Enabled != *json.Enabled {
-			tunnel.Enabled = *json.Enabled
-			err = di.DB.Model(&tunnel).Updates(models.Tunnel{Enabled: *json.Enabled}).Error
-			if err != nil {
-				slog.Error("Error updating tunnel", "error", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating tunnel"})
+		tunnel.Enabled = *json.Enabled
+
+		// Passwords are only shown to admins, so a tunnel sent back without
+		// one keeps its own. A WireGuard server tunnel's password is its
+		// keys, which only change by rotating them.
+		if tunnel.Wireguard && !tunnel.Client {
+			if json.Password != "" && json.Password != tunnel.Password {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Keys can only be changed by rotating them"})
 				return
 			}
+		} else if json.Password != "" {
+			tunnel.Password = json.Password
 		}
 
-		if tunnel.Wireguard != *json.Wireguard {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Changing tunnel type not allowed"})
-			return
+		if !tunnel.Wireguard {
+			if err := vtun.ValidatePassword(tunnel.Password); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
 		}
 
-		err = di.DB.Save(&tunnel).Error
+		// Only write the columns being edited, so this doesn't put back stats
+		// or quota usage saved since the tunnel was read
+		err = di.DB.Model(&tunnel).Select("hostname", "password", "ip", "enabled").Updates(&tunnel).Error
 		if err != nil {
 			slog.Error("Error saving tunnel", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving tunnel"})
 			return
 		}
+		recordAuditEvent(c, di, models.AuditActionTunnelUpdate, tunnel.ID, tunnel.Hostname, auditBefore, tunnel)
 
-		err = di.WireguardManager.RemovePeer(origTunnel)
-		if err != nil {
-			slog.Error("Error removing wireguard peer", "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding wireguard peer"})
-			return
-		}
+		if !tunnel.Wireguard {
+			err = reloadVTun(di)
+			if err != nil {
+				slog.Error("Error reloading vtund", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reloading vtund"})
+				return
+			}
+		} else {
+			err = di.WireguardManager.RemovePeer(origTunnel)
+			if err != nil {
+				slog.Error("Error removing wireguard peer", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding wireguard peer"})
+				return
+			}
 
-		err = di.WireguardManager.AddPeer(tunnel)
-		if err != nil {
-			slog.Error("Error adding wireguard peer", "error", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding wireguard peer"})
-			return
+			err = di.WireguardManager.AddPeer(tunnel)
+			if err != nil {
+				slog.Error("Error adding wireguard peer", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding wireguard peer"})
+				return
+			}
 		}
 
 		if di.Config.OLSR {
@@ -826,6 +976,353 @@ func PATCHTunnel(c *gin.Context) {
 	}
 }
 
+// checkTunnelIP validates a tunnel's new address, writing an error response
+// if it's unusable. A server tunnel must move to a free block of the pool.
+// A client tunnel's address is given by the other end, so it only has to be
+// in 172.16.0.0/12 and not used by another tunnel.
+func checkTunnelIP(c *gin.Context, di *middleware.DepInjection, tunnel models.Tunnel, address string) (string, bool) {
+	if !tunnel.Client {
+		ip, err := ipam.Pin(di.DB, di.Config, address)
+		if err != nil {
+			switch {
+			case errors.Is(err, ipam.ErrInvalidAddress), errors.Is(err, ipam.ErrNotInPool),
+				errors.Is(err, ipam.ErrNotBlockStart), errors.Is(err, ipam.ErrBlockInUse),
+				errors.Is(err, ipam.ErrBlockReserved):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				slog.Error("PATCHTunnel: Error checking IP", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking IP"})
+			}
+			return "", false
+		}
+		return ip, true
+	}
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "IP is not a valid IP address"})
+		return "", false
+	}
+	_, cidr, err := net.ParseCIDR("172.16.0.0/12")
+	if err != nil {
+		slog.Error("Error parsing CIDR", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing CIDR"})
+		return "", false
+	}
+	if !cidr.Contains(ip) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "IP is not in the correct range"})
+		return "", false
+	}
+
+	var existing models.Tunnel
+	err = di.DB.Find(&existing, "ip = ?", address).Error
+	if err != nil {
+		slog.Error("Error getting tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel"})
+		return "", false
+	} else if existing.ID != 0 && existing.ID != tunnel.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "IP address is already taken"})
+		return "", false
+	}
+	return address, true
+}
+
+func PUTTunnelSchedule(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tunnel ID"})
+		return
+	}
+
+	var json apimodels.EditTunnelSchedule
+	err = c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("PUTTunnelSchedule: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	if json.Schedule != nil {
+		if err := json.Schedule.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tunnel, err := models.FindTunnelByID(di.DB, uint(idUint64))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tunnel not found"})
+			return
+		}
+		slog.Error("PUTTunnelSchedule: Error getting tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel"})
+		return
+	}
+
+	before := tunnel
+	tunnel.ExpiresAt = json.ExpiresAt
+	tunnel.Schedule = json.Schedule
+	err = di.DB.Model(&tunnel).Select("expires_at", "schedule").Updates(&tunnel).Error
+	if err != nil {
+		slog.Error("PUTTunnelSchedule: Error saving tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving tunnel"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionTunnelUpdate, tunnel.ID, tunnel.Hostname, before, tunnel)
+
+	// Apply the new schedule now rather than at the scheduler's next tick
+	if di.TunnelScheduler != nil {
+		err = di.TunnelScheduler.Reconcile(c.Request.Context())
+		if err != nil {
+			slog.Error("PUTTunnelSchedule: Error applying schedule", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error applying schedule"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tunnel schedule updated"})
+}
+
+func PUTTunnelQuota(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tunnel ID"})
+		return
+	}
+
+	var json apimodels.EditTunnelQuota
+	err = c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("PUTTunnelQuota: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	tunnel, err := models.FindTunnelByID(di.DB, uint(idUint64))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tunnel not found"})
+			return
+		}
+		slog.Error("PUTTunnelQuota: Error getting tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel"})
+		return
+	}
+
+	before := tunnel
+	tunnel.DailyQuota.LimitMB = json.DailyMB
+	tunnel.MonthlyQuota.LimitMB = json.MonthlyMB
+	tunnel.QuotaResetDay = json.ResetDay
+	tunnel.QuotaPolicy = json.Policy
+	tunnel.QuotaThrottleKbps = json.ThrottleKbps
+	if err := tunnel.ValidateQuota(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = di.DB.Model(&tunnel).Updates(map[string]interface{}{
+		"daily_quota_limit_mb":   tunnel.DailyQuota.LimitMB,
+		"monthly_quota_limit_mb": tunnel.MonthlyQuota.LimitMB,
+		"quota_reset_day":        tunnel.QuotaResetDay,
+		"quota_policy":           tunnel.QuotaPolicy,
+		"quota_throttle_kbps":    tunnel.QuotaThrottleKbps,
+	}).Error
+	if err != nil {
+		slog.Error("PUTTunnelQuota: Error saving tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving tunnel"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionTunnelUpdate, tunnel.ID, tunnel.Hostname, before, tunnel)
+
+	// Apply or lift the policy now rather than at the enforcer's next tick
+	if di.QuotaEnforcer != nil {
+		err = di.QuotaEnforcer.Enforce(c.Request.Context())
+		if err != nil {
+			slog.Error("PUTTunnelQuota: Error enforcing quota", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error enforcing quota"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tunnel quota updated"})
+}
+
+func PUTTunnelRateLimit(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tunnel ID"})
+		return
+	}
+
+	var json apimodels.EditTunnelRateLimit
+	err = c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("PUTTunnelRateLimit: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	tunnel, err := models.FindTunnelByID(di.DB, uint(idUint64))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tunnel not found"})
+			return
+		}
+		slog.Error("PUTTunnelRateLimit: Error getting tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel"})
+		return
+	}
+
+	before := tunnel
+	tunnel.RateLimit = models.TunnelRateLimit{
+		EgressKbps:  json.EgressKbps,
+		IngressKbps: json.IngressKbps,
+		BurstKB:     json.BurstKB,
+	}
+	if err := tunnel.ValidateRateLimit(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = di.DB.Model(&tunnel).Updates(map[string]interface{}{
+		"rate_limit_egress_kbps":  tunnel.RateLimit.EgressKbps,
+		"rate_limit_ingress_kbps": tunnel.RateLimit.IngressKbps,
+		"rate_limit_burst_kb":     tunnel.RateLimit.BurstKB,
+	}).Error
+	if err != nil {
+		slog.Error("PUTTunnelRateLimit: Error saving tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving tunnel"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionTunnelUpdate, tunnel.ID, tunnel.Hostname, before, tunnel)
+
+	// An inactive tunnel gets its limits when its interface comes up
+	if tunnel.Active {
+		iface := tunnels.InterfaceName(tunnel)
+		limits := shaping.ForTunnel(tunnel, tunnel.QuotaAction)
+		if limits.IsZero() {
+			err = shaping.Clear(iface)
+		} else {
+			err = shaping.Apply(iface, limits)
+		}
+		if err != nil {
+			slog.Error("PUTTunnelRateLimit: Error applying rate limit", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error applying rate limit"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tunnel rate limit updated"})
+}
+
+// PUTTunnelEndpoint sets the public endpoint a server tunnel's client
+// config points at
+func PUTTunnelEndpoint(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	idUint64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tunnel ID"})
+		return
+	}
+
+	var json apimodels.EditTunnelEndpoint
+	err = c.ShouldBindJSON(&json)
+	if err != nil {
+		slog.Error("PUTTunnelEndpoint: JSON data is invalid", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
+		return
+	}
+
+	if json.Endpoint != "" {
+		if _, err := config.ParseWireguardEndpoint(json.Endpoint); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tunnel, err := models.FindTunnelByID(di.DB, uint(idUint64))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tunnel not found"})
+			return
+		}
+		slog.Error("PUTTunnelEndpoint: Error getting tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnel"})
+		return
+	}
+
+	// A client tunnel's endpoint is its hostname
+	if !tunnel.Wireguard || tunnel.Client {
+		c.JSON(http.StatusBadRequest, gin.H{"error": wireguard.ErrNotServerTunnel.Error()})
+		return
+	}
+
+	before := tunnel
+	tunnel.PublicEndpoint = json.Endpoint
+	err = di.DB.Model(&tunnel).Update("public_endpoint", tunnel.PublicEndpoint).Error
+	if err != nil {
+		slog.Error("PUTTunnelEndpoint: Error saving tunnel", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving tunnel"})
+		return
+	}
+	recordAuditEvent(c, di, models.AuditActionTunnelUpdate, tunnel.ID, tunnel.Hostname, before, tunnel)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tunnel endpoint updated", "endpoints": wireguard.PublicEndpoints(di.Config, tunnel)})
+}
+
+// tunnelShaping reads the shaping on an active tunnel's interface. Errors
+// are logged rather than failing the list, since the interface may have
+// just gone down.
+func tunnelShaping(tunnel models.Tunnel) *models.TunnelShaping {
+	status, err := shaping.Status(tunnels.InterfaceName(tunnel))
+	if err != nil {
+		slog.Debug("GETTunnels: Error reading tunnel shaping", "tunnel", tunnel.Hostname, "error", err)
+		return nil
+	}
+	return &status
+}
+
+// reloadVTun rewrites the vtund configs and has vtund pick up the changes
+func reloadVTun(di *middleware.DepInjection) error {
+	err := vtun.GenerateAndSave(di.Config, di.DB)
+	if err != nil {
+		return err
+	}
+	vtunService, ok := di.ServiceRegistry.Get(services.VTunServiceName)
+	if !ok {
+		return errors.New("vtun service is not registered")
+	}
+	return vtunService.Reload()
+}
+
 func DELETETunnel(c *gin.Context) {
 	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
 	if !ok {
@@ -864,12 +1361,22 @@ func DELETETunnel(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting tunnel"})
 		return
 	}
+	recordAuditEvent(c, di, models.AuditActionTunnelDelete, tunnel.ID, tunnel.Hostname, tunnel, nil)
 
-	err = di.WireguardManager.RemovePeer(tunnel)
-	if err != nil {
-		slog.Error("Error removing wireguard peer", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing wireguard peer"})
-		return
+	if !tunnel.Wireguard {
+		err = reloadVTun(di)
+		if err != nil {
+			slog.Error("Error reloading vtund", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reloading vtund"})
+			return
+		}
+	} else {
+		err = di.WireguardManager.RemovePeer(tunnel)
+		if err != nil {
+			slog.Error("Error removing wireguard peer", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing wireguard peer"})
+			return
+		}
 	}
 
 	if di.Config.OLSR {
@@ -910,7 +1417,7 @@ func DELETETunnel(c *gin.Context) {
 			return
 		}
 
-		err = babelService.RemoveTunnel(c.Request.Context(), wireguard.GenerateWireguardInterfaceName(tunnel))
+		err = babelService.RemoveTunnel(c.Request.Context(), tunnels.InterfaceName(tunnel))
 		if err != nil {
 			slog.Error("DELETETunnel: Error removing Babel tunnel", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing Babel tunnel"})
@@ -973,36 +1480,6 @@ func normalizeLQMTrackers(info *lqm.LQMInfo) map[string]lqm.Tracker {
 	return normalized
 }
 
-func findTrackerForTunnel(tunnel models.Tunnel, trackers map[string]lqm.Tracker) *lqm.Tracker {
-	tunnelIP := strings.TrimSpace(tunnel.IP)
-	canonicalHost := canonicalizeHostname(tunnel.Hostname)
-
-	for _, tracker := range trackers {
-		trackerCopy := tracker
-		if tunnelIP != "" {
-			if strings.TrimSpace(trackerCopy.IP) == tunnelIP {
-				return &trackerCopy
-			}
-			if strings.TrimSpace(trackerCopy.CanonicalIP) == tunnelIP {
-				return &trackerCopy
-			}
-		}
-
-		if canonicalHost != "" && canonicalizeHostname(trackerCopy.Hostname) == canonicalHost {
-			return &trackerCopy
-		}
-	}
-
-	return nil
-}
-
-func canonicalizeHostname(hostname string) string {
-	h := strings.ToLower(hostname)
-	h = strings.TrimSuffix(h, ".local.mesh")
-	h = strings.TrimPrefix(h, "dtdlink.")
-	return h
-}
-
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		trimmed := strings.TrimSpace(v)
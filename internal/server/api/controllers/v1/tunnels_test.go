@@ -0,0 +1,113 @@
+package v1_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTunnelPasswords(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	tunnel := models.Tunnel{Hostname: "KI5VMF-A", IP: "172.16.0.2", Wireguard: true, Password: "server-key,client-key"}
+	err := s.db.Create(&tunnel).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.createUser("operator", "operator-password", models.RoleOperator)
+
+	tests := []struct {
+		username string
+		password string
+		want     string
+	}{
+		{"admin", testAdminPassword, tunnel.Password},
+		// Operators manage tunnels, but can't see their private keys
+		{"operator", "operator-password", ""},
+	}
+	for _, tt := range tests {
+		if code := s.login(tt.username, tt.password); code != http.StatusOK {
+			t.Fatalf("%s: login = %d, want %d", tt.username, code, http.StatusOK)
+		}
+		var resp struct {
+			Tunnels []apimodels.TunnelWithPass `json:"tunnels"`
+		}
+		if code := s.request(http.MethodGet, "/api/v1/tunnels?admin=true", nil, &resp).Code; code != http.StatusOK {
+			t.Fatalf("%s: tunnels = %d, want %d", tt.username, code, http.StatusOK)
+		}
+		if len(resp.Tunnels) != 1 {
+			t.Fatalf("%s: got %d tunnels, want 1", tt.username, len(resp.Tunnels))
+		}
+		if resp.Tunnels[0].Password != tt.want {
+			t.Errorf("%s: password = %q, want %q", tt.username, resp.Tunnels[0].Password, tt.want)
+		}
+	}
+}
+
+func TestPATCHTunnelHostname(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	if code := s.login("admin", testAdminPassword); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+	tunnel := models.Tunnel{Hostname: "N0CALL-A", IP: "172.31.0.4", Password: "secret"}
+	err := s.db.Create(&tunnel).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hostname := range []string{"N0CALL;X", `N0CALL"`, "N0", "n0call.example.com"} {
+		body := gin.H{"id": tunnel.ID, "enabled": true, "wireguard": false, "hostname": hostname, "ip": tunnel.IP, "password": tunnel.Password}
+		if code := s.request(http.MethodPatch, "/api/v1/tunnels", body, nil).Code; code != http.StatusBadRequest {
+			t.Errorf("PATCH hostname %q = %d, want %d", hostname, code, http.StatusBadRequest)
+		}
+	}
+	saved, err := models.FindTunnelByID(s.db, tunnel.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Hostname != tunnel.Hostname {
+		t.Errorf("hostname = %q, want %q", saved.Hostname, tunnel.Hostname)
+	}
+}
+
+func TestPATCHTunnelKeepsKeys(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	s.createUser("operator", "operator-password", models.RoleOperator)
+	if code := s.login("operator", "operator-password"); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+	tunnel := models.Tunnel{Hostname: "N0CALL-A", IP: "172.31.0.4", Wireguard: true, Enabled: true, Password: strings.Repeat("k", 132)}
+	err := s.db.Create(&tunnel).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys can't be edited, only rotated
+	body := gin.H{"id": tunnel.ID, "enabled": true, "wireguard": true, "hostname": "N0CALL-B", "ip": tunnel.IP, "password": strings.Repeat("x", 132)}
+	if code := s.request(http.MethodPatch, "/api/v1/tunnels", body, nil).Code; code != http.StatusBadRequest {
+		t.Errorf("PATCH with new keys = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	// The operator was sent the tunnel without its password, and sends it
+	// back that way. Saving it then needs the WireGuard manager, which
+	// the test server doesn't have.
+	body["password"] = ""
+	s.request(http.MethodPatch, "/api/v1/tunnels", body, nil)
+
+	saved, err := models.FindTunnelByID(s.db, tunnel.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Hostname != "N0CALL-B" {
+		t.Errorf("hostname = %q, want %q", saved.Hostname, "N0CALL-B")
+	}
+	if saved.Password != tunnel.Password {
+		t.Errorf("password = %q, want the tunnel's keys", saved.Password)
+	}
+}
@@ -13,7 +13,6 @@ import (
 	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
 	"github.com/USA-RedDragon/mesh-manager/internal/utils"
-	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	gopwned "github.com/mavjs/goPwned"
 )
@@ -38,6 +37,9 @@ func GETUsers(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting user count"})
 		return
 	}
+	for i := range users {
+		users[i].Locked = di.LoginTracker.Locked(userLockoutKey(users[i].Username))
+	}
 	c.JSON(http.StatusOK, gin.H{"total": total, "users": users})
 }
 
@@ -67,6 +69,16 @@ func POSTUser(c *gin.Context) {
 			return
 		}
 
+		// New users get the least privileges unless asked otherwise
+		role := models.RoleViewer
+		if json.Role != "" {
+			role = models.Role(json.Role)
+			if !role.IsValid() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be one of admin, operator, or viewer"})
+				return
+			}
+		}
+
 		// Check if the username is already taken
 		var user models.User
 		err := di.DB.Find(&user, "username = ?", json.Username).Error
@@ -127,6 +139,7 @@ func POSTUser(c *gin.Context) {
 		user = models.User{
 			Username: json.Username,
 			Password: hashedPassword,
+			Role:     role,
 		}
 		err = di.DB.Create(&user).Error
 		if err != nil {
@@ -134,6 +147,7 @@ func POSTUser(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
 			return
 		}
+		recordAuditEvent(c, di, models.AuditActionUserCreate, user.ID, user.Username, nil, user)
 		c.JSON(http.StatusOK, gin.H{"message": "User created"})
 	}
 }
@@ -157,9 +171,36 @@ func GETUser(c *gin.Context) {
 		slog.Error("Error finding user", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
 	}
+	user.Locked = di.LoginTracker.Locked(userLockoutKey(user.Username))
 	c.JSON(http.StatusOK, user)
 }
 
+// POSTUserUnlock clears a user's failed login attempts, ending any lockout.
+// Lockouts of the IPs the attempts came from are left to expire.
+func POSTUserUnlock(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid User ID"})
+		return
+	}
+	user, err := models.FindUserByID(di.DB, uint(userID))
+	if err != nil {
+		slog.Error("Error finding user", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
+		return
+	}
+
+	di.LoginTracker.Reset(userLockoutKey(user.Username))
+	recordAuditEvent(c, di, models.AuditActionUserUnlock, user.ID, user.Username, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
 func PATCHUser(c *gin.Context) {
 	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
 	if !ok {
@@ -180,12 +221,51 @@ func PATCHUser(c *gin.Context) {
 		slog.Error("PATCHUser: JSON data is invalid", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "JSON data is invalid"})
 	} else {
+		currentUser, ok := middleware.CurrentUser(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			return
+		}
+		isAdmin := currentUser.Role.AtLeast(models.RoleAdmin)
+
+		// Non-admins may only edit themselves
+		if !isAdmin && currentUser.ID != uint(idInt) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+
 		user, err := models.FindUserByID(di.DB, uint(idInt))
 		if err != nil {
 			slog.Error("Error finding user", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
 			return
 		}
+		auditBefore := user
+
+		if json.Role != "" && models.Role(json.Role) != user.Role {
+			if !isAdmin {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change roles"})
+				return
+			}
+			role := models.Role(json.Role)
+			if !role.IsValid() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be one of admin, operator, or viewer"})
+				return
+			}
+			if user.Role == models.RoleAdmin {
+				adminCount, err := models.CountAdminUsers(di.DB)
+				if err != nil {
+					slog.Error("Error counting admin users", "error", err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting admin users"})
+					return
+				}
+				if adminCount <= 1 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot remove the last admin"})
+					return
+				}
+			}
+			user.Role = role
+		}
 
 		if json.Username != "" {
 			// Check if the username is already taken
@@ -212,6 +292,7 @@ func PATCHUser(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
 			return
 		}
+		recordAuditEvent(c, di, models.AuditActionUserUpdate, user.ID, user.Username, auditBefore, user)
 		c.JSON(http.StatusOK, gin.H{"message": "User updated"})
 	}
 }
@@ -240,43 +321,42 @@ func DELETEUser(c *gin.Context) {
 		return
 	}
 
+	user, err := models.FindUserByID(di.DB, uint(idUint64))
+	if err != nil {
+		slog.Error("Error finding user", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding user"})
+		return
+	}
+
+	if user.Role == models.RoleAdmin {
+		adminCount, err := models.CountAdminUsers(di.DB)
+		if err != nil {
+			slog.Error("Error counting admin users", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting admin users"})
+			return
+		}
+		if adminCount <= 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete the last admin"})
+			return
+		}
+	}
+
 	err = models.DeleteUser(di.DB, uint(idUint64))
 	if err != nil {
 		slog.Error("Error deleting user", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting user"})
 		return
 	}
+	recordAuditEvent(c, di, models.AuditActionUserDelete, user.ID, user.Username, user, nil)
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
 }
 
 func GETUserSelf(c *gin.Context) {
-	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	user, ok := middleware.CurrentUser(c)
 	if !ok {
-		slog.Error("Unable to get dependencies from context")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
-		return
-	}
-	session := sessions.Default(c)
-
-	userID := session.Get("user_id")
-	if userID == nil {
-		slog.Debug("GETUserSelf: user_id is nil")
+		slog.Debug("GETUserSelf: no authenticated user")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
 		return
 	}
-
-	uid, ok := userID.(uint)
-	if !ok {
-		slog.Error("GETUserSelf: Unable to convert user_id to uint", "user_id", userID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
-		return
-	}
-
-	user, err := models.FindUserByID(di.DB, uid)
-	if err != nil {
-		slog.Error("GETUserSelf: Error finding user", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error finding user"})
-		return
-	}
 	c.JSON(http.StatusOK, user)
 }
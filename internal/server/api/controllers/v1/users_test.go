@@ -0,0 +1,88 @@
+package v1_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoleAccess(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	s.createUser("viewer", "viewer-password", models.RoleViewer)
+	s.createUser("operator", "operator-password", models.RoleOperator)
+
+	// A representative route for each role
+	routes := []struct {
+		path string
+		role models.Role
+	}{
+		{"/api/v1/users/me", models.RoleViewer},
+		{"/api/v1/local-hosts", models.RoleOperator},
+		{"/api/v1/services/advertised", models.RoleOperator},
+		{"/api/v1/users", models.RoleAdmin},
+		{"/api/v1/audit", models.RoleAdmin},
+	}
+	users := []struct {
+		username string
+		password string
+		role     models.Role
+	}{
+		{"viewer", "viewer-password", models.RoleViewer},
+		{"operator", "operator-password", models.RoleOperator},
+		{"admin", testAdminPassword, models.RoleAdmin},
+	}
+	for _, user := range users {
+		if code := s.login(user.username, user.password); code != http.StatusOK {
+			t.Fatalf("%s: login = %d, want %d", user.username, code, http.StatusOK)
+		}
+		for _, route := range routes {
+			want := http.StatusOK
+			if !user.role.AtLeast(route.role) {
+				want = http.StatusForbidden
+			}
+			if code := s.request(http.MethodGet, route.path, nil, nil).Code; code != want {
+				t.Errorf("%s: %s = %d, want %d", user.username, route.path, code, want)
+			}
+		}
+	}
+}
+
+func TestLastAdmin(t *testing.T) {
+	t.Parallel()
+	s := newTestServer(t)
+	if code := s.login("admin", testAdminPassword); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+	var admin models.User
+	err := s.db.First(&admin, "username = ?", "admin").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/api/v1/users/%d", admin.ID)
+
+	if code := s.request(http.MethodPatch, path, gin.H{"role": models.RoleOperator}, nil).Code; code != http.StatusBadRequest {
+		t.Errorf("demote last admin = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := s.request(http.MethodDelete, path, nil, nil).Code; code != http.StatusBadRequest {
+		t.Errorf("delete last admin = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	// With another admin, the first is no longer the last
+	other := s.createUser("other", "other-password", models.RoleAdmin)
+	if code := s.request(http.MethodPatch, path, gin.H{"role": models.RoleOperator}, nil).Code; code != http.StatusOK {
+		t.Errorf("demote admin = %d, want %d", code, http.StatusOK)
+	}
+	if code := s.login("other", "other-password"); code != http.StatusOK {
+		t.Fatalf("login = %d, want %d", code, http.StatusOK)
+	}
+	if code := s.request(http.MethodDelete, fmt.Sprintf("/api/v1/users/%d", other.ID), nil, nil).Code; code != http.StatusBadRequest {
+		t.Errorf("delete remaining admin = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := s.request(http.MethodDelete, path, nil, nil).Code; code != http.StatusOK {
+		t.Errorf("delete demoted admin = %d, want %d", code, http.StatusOK)
+	}
+}
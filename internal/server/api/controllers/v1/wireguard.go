@@ -1,10 +1,16 @@
 package v1
 
 import (
+	"context"
 	"log/slog"
+	"net"
 	"net/http"
+	"time"
 
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
+	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
 	"github.com/gin-gonic/gin"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
@@ -37,3 +43,28 @@ func POSTWireguardPubkey(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"key": private.PublicKey().String()})
 }
+
+// endpointCheckTimeout bounds the DNS lookups of an endpoint self-check
+const endpointCheckTimeout = 10 * time.Second
+
+// GETWireguardEndpoints self-checks the public endpoints clients are given
+func GETWireguardEndpoints(c *gin.Context) {
+	di, ok := c.MustGet(middleware.DepInjectionKey).(*middleware.DepInjection)
+	if !ok {
+		slog.Error("Unable to get dependencies from context")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		return
+	}
+
+	tunnels, err := models.ListWireguardTunnels(di.DB)
+	if err != nil {
+		slog.Error("GETWireguardEndpoints: Error getting tunnels", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting tunnels"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), endpointCheckTimeout)
+	defer cancel()
+	checks := wireguard.CheckEndpoints(ctx, di.Config, tunnels, net.DefaultResolver)
+	c.JSON(http.StatusOK, gin.H{"total": len(checks), "endpoints": checks})
+}
@@ -1,21 +1,43 @@
 package middleware
 
 import (
+	"errors"
 	"log/slog"
 	"math"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/utils"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	UserKey     = "User"
+	APITokenKey = "APIToken"
+
+	bearerPrefix = "Bearer "
+)
+
+var (
+	errNotAuthenticated = errors.New("not authenticated")
+	errInvalidToken     = errors.New("invalid API token")
+)
+
+// RequireLogin allows any authenticated user, regardless of role
 func RequireLogin() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		session := sessions.Default(c)
+	return RequireRole(models.RoleViewer)
+}
 
+// RequireRole allows authenticated users whose role is at least the given role.
+// Requests may authenticate with either a session cookie or an
+// `Authorization: Bearer` API token.
+func RequireRole(role models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
 		defer func() {
 			if recover() != nil {
 				slog.Error("RequireLogin: Recovered from panic", "error", recover())
@@ -24,49 +46,157 @@ func RequireLogin() gin.HandlerFunc {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
 			}
 		}()
-		userID := session.Get("user_id")
 
-		if userID == nil {
-			slog.Debug("RequireLogin: user_id is nil")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
-			return
-		}
-		uid, ok := userID.(uint)
+		di, ok := c.MustGet(DepInjectionKey).(*DepInjection)
 		if !ok {
-			slog.Error("RequireLogin: Unable to convert user_id to uint", "user_id", userID)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+			slog.Error("Unable to get dependencies from context")
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
 			return
 		}
-		if uid > math.MaxInt32 {
-			slog.Error("RequireLogin: user_id is out of range", "user_id", uid)
+
+		user, err := authenticate(c, di)
+		if err != nil {
+			slog.Debug("RequireLogin: Authentication failed", "error", err)
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
 			return
 		}
+
 		ctx := c.Request.Context()
 		span := trace.SpanFromContext(ctx)
 		if span.IsRecording() {
 			span.SetAttributes(
 				attribute.String("http.auth", "RequireLogin"),
-				attribute.Int("user.id", int(uid)),
+				attribute.Int("user.id", int(user.ID)),
 			)
 		}
 
-		valid := true
-		// Open up the DB and check if the user exists
-		di, ok := c.MustGet(DepInjectionKey).(*DepInjection)
-		if !ok {
-			slog.Error("Unable to get dependencies from context")
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Try again later"})
+		if !user.Role.AtLeast(role) {
+			slog.Warn("RequireRole: Insufficient role", "user", user.Username, "role", user.Role, "required", role)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
 			return
 		}
-		var user models.User
-		di.DB.Find(&user, "id = ?", uid)
-		if user.CreatedAt.IsZero() {
-			valid = false
+	}
+}
+
+// RequireScope limits requests authenticated by an API token to tokens
+// holding the given scope. Session-authenticated requests are unaffected.
+// It must be placed after RequireRole.
+func RequireScope(scope models.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasScope(c, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API token is missing the " + string(scope) + " scope"})
+			return
 		}
+	}
+}
 
-		if !valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication failed"})
+// DenyAPITokens rejects requests authenticated by an API token.
+// It must be placed after RequireRole.
+func DenyAPITokens() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if UsingAPIToken(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API tokens cannot be used for this endpoint"})
+			return
 		}
 	}
 }
+
+// UsingAPIToken returns true if the request was authenticated by an API token
+func UsingAPIToken(c *gin.Context) bool {
+	_, exists := c.Get(APITokenKey)
+	return exists
+}
+
+// HasScope returns true if the request was not authenticated by an API token,
+// or if the token holds the given scope
+func HasScope(c *gin.Context, scope models.Scope) bool {
+	val, exists := c.Get(APITokenKey)
+	if !exists {
+		return true
+	}
+	token, ok := val.(models.APIToken)
+	return ok && token.HasScope(scope)
+}
+
+// CurrentUser returns the user authenticated by RequireRole. On routes that are
+// not protected it attempts to authenticate the request itself.
+func CurrentUser(c *gin.Context) (models.User, bool) {
+	if val, exists := c.Get(UserKey); exists {
+		user, ok := val.(models.User)
+		return user, ok
+	}
+
+	di, ok := c.MustGet(DepInjectionKey).(*DepInjection)
+	if !ok {
+		return models.User{}, false
+	}
+
+	user, err := authenticate(c, di)
+	if err != nil {
+		return models.User{}, false
+	}
+	return user, true
+}
+
+// authenticate resolves the user behind a request, preferring an API token
+// over the session cookie, and stores it in the context
+func authenticate(c *gin.Context, di *DepInjection) (models.User, error) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		if !strings.HasPrefix(header, bearerPrefix) {
+			return models.User{}, errInvalidToken
+		}
+		return authenticateToken(c, di, strings.TrimSpace(strings.TrimPrefix(header, bearerPrefix)))
+	}
+
+	session := sessions.Default(c)
+	userID := session.Get("user_id")
+	if userID == nil {
+		return models.User{}, errNotAuthenticated
+	}
+	uid, ok := userID.(uint)
+	if !ok {
+		slog.Error("RequireLogin: Unable to convert user_id to uint", "user_id", userID)
+		return models.User{}, errNotAuthenticated
+	}
+	if uid > math.MaxInt32 {
+		slog.Error("RequireLogin: user_id is out of range", "user_id", uid)
+		return models.User{}, errNotAuthenticated
+	}
+
+	var user models.User
+	di.DB.Find(&user, "id = ?", uid)
+	if user.CreatedAt.IsZero() {
+		return models.User{}, errNotAuthenticated
+	}
+
+	c.Set(UserKey, user)
+	return user, nil
+}
+
+func authenticateToken(c *gin.Context, di *DepInjection, plaintext string) (models.User, error) {
+	if plaintext == "" {
+		return models.User{}, errInvalidToken
+	}
+
+	token, err := models.FindAPITokenByHash(di.DB, utils.HashToken(plaintext))
+	if err != nil {
+		return models.User{}, errInvalidToken
+	}
+
+	now := time.Now()
+	if token.IsExpired(now) {
+		return models.User{}, errInvalidToken
+	}
+	if token.User.CreatedAt.IsZero() {
+		return models.User{}, errInvalidToken
+	}
+
+	err = models.TouchAPIToken(di.DB, token.ID, now)
+	if err != nil {
+		slog.Warn("RequireLogin: Unable to update API token last use", "token", token.ID, "error", err)
+	}
+
+	c.Set(APITokenKey, token)
+	c.Set(UserKey, token.User)
+	return token.User, nil
+}
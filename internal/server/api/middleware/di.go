@@ -1,31 +1,51 @@
 package middleware
 
 import (
+	"time"
+
 	"github.com/USA-RedDragon/mesh-manager/internal/bandwidth"
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/events"
+	"github.com/USA-RedDragon/mesh-manager/internal/lockout"
 	"github.com/USA-RedDragon/mesh-manager/internal/services"
 	"github.com/USA-RedDragon/mesh-manager/internal/services/meshlink"
 	"github.com/USA-RedDragon/mesh-manager/internal/services/olsr"
+	"github.com/USA-RedDragon/mesh-manager/internal/tunnels"
 	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type DepInjection struct {
+	Clock              clock.Clock
 	MeshLinkParser     *meshlink.Parser
 	Config             *config.Config
 	DB                 *gorm.DB
+	EventsChannel      chan events.Event
+	LoginTracker       *lockout.Tracker
 	PaginatedDB        *gorm.DB
 	NetworkStats       *bandwidth.StatCounterManager
 	OLSRHostsParser    *olsr.HostsParser
 	OLSRServicesParser *olsr.ServicesParser
+	QuotaEnforcer      *tunnels.QuotaEnforcer
 	ServiceRegistry    *services.Registry
+	TunnelScheduler    *tunnels.Scheduler
 	Version            string
 	WireguardManager   *wireguard.Manager
 }
 
 const DepInjectionKey = "DepInjection"
 
+// Now returns the current time from the injected clock, falling back to
+// the system time if none was provided
+func (d *DepInjection) Now() time.Time {
+	if d.Clock == nil {
+		return time.Now()
+	}
+	return d.Clock.Now()
+}
+
 func Inject(inj *DepInjection) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		inj.DB = inj.DB.WithContext(c.Request.Context())
@@ -6,19 +6,21 @@ import (
 
 	ratelimit "github.com/JGLTechnologies/gin-rate-limit"
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
 	"github.com/USA-RedDragon/mesh-manager/internal/events"
 	v1Controllers "github.com/USA-RedDragon/mesh-manager/internal/server/api/controllers/v1"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
 	websocketControllers "github.com/USA-RedDragon/mesh-manager/internal/server/api/websocket"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/websocket"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 const rateLimitRate = 5 * time.Second
 const rateLimitLimit = 300
 
 // ApplyRoutes to the HTTP Mux.
-func ApplyRoutes(router *gin.Engine, eventsChannel chan events.Event, config *config.Config) {
+func ApplyRoutes(router *gin.Engine, db *gorm.DB, eventsChannel chan events.Event, config *config.Config) {
 	ratelimitStore := ratelimit.InMemoryStore(&ratelimit.InMemoryOptions{
 		Rate:  rateLimitRate,
 		Limit: rateLimitLimit,
@@ -45,7 +47,7 @@ func ApplyRoutes(router *gin.Engine, eventsChannel chan events.Event, config *co
 	meshCompat(router, ratelimitMW)
 
 	ws := router.Group("/ws")
-	ws.GET("/events", websocket.CreateHandler(websocketControllers.CreateEventsWebsocket(eventsChannel), config))
+	ws.GET("/events", websocket.CreateHandler(websocketControllers.CreateEventsWebsocket(db, eventsChannel), config))
 }
 
 func meshCompat(router *gin.Engine, ratelimitMW gin.HandlerFunc) {
@@ -62,6 +64,7 @@ func v1(group *gin.RouterGroup, config *config.Config) {
 	group.GET("/ping", v1Controllers.GETPing)
 
 	group.GET("/stats", v1Controllers.GETStats)
+	group.GET("/traffic", v1Controllers.GETTraffic)
 	group.GET("/loadavg", v1Controllers.GETLoadAvg)
 	group.GET("/uptime", v1Controllers.GETUptime)
 	group.GET("/node-ip", v1Controllers.GETNodeIP)
@@ -70,16 +73,54 @@ func v1(group *gin.RouterGroup, config *config.Config) {
 
 	v1Auth := group.Group("/auth")
 	v1Auth.POST("/login", v1Controllers.POSTLogin)
+	v1Auth.POST("/login/totp", v1Controllers.POSTLoginTOTP)
 	v1Auth.GET("/logout", v1Controllers.GETLogout)
 
 	v1Users := group.Group("/users")
 	// Paginated
-	v1Users.GET("", middleware.RequireLogin(), v1Controllers.GETUsers)
-	v1Users.POST("", middleware.RequireLogin(), v1Controllers.POSTUser)
+	v1Users.GET("", middleware.RequireRole(models.RoleAdmin), middleware.RequireScope(models.ScopeUsersRead), v1Controllers.GETUsers)
+	v1Users.POST("", middleware.RequireRole(models.RoleAdmin), middleware.RequireScope(models.ScopeUsersWrite), v1Controllers.POSTUser)
 	v1Users.GET("/me", middleware.RequireLogin(), v1Controllers.GETUserSelf)
-	v1Users.GET("/:id", middleware.RequireLogin(), v1Controllers.GETUser)
-	v1Users.PATCH("/:id", middleware.RequireLogin(), v1Controllers.PATCHUser)
-	v1Users.DELETE("/:id", middleware.RequireLogin(), v1Controllers.DELETEUser)
+	v1Users.GET("/:id", middleware.RequireRole(models.RoleAdmin), middleware.RequireScope(models.ScopeUsersRead), v1Controllers.GETUser)
+	// Users may edit themselves, PATCHUser enforces the rest
+	v1Users.PATCH("/:id", middleware.RequireLogin(), middleware.RequireScope(models.ScopeUsersWrite), v1Controllers.PATCHUser)
+	v1Users.DELETE("/:id", middleware.RequireRole(models.RoleAdmin), middleware.RequireScope(models.ScopeUsersWrite), v1Controllers.DELETEUser)
+	v1Users.POST("/:id/unlock", middleware.RequireRole(models.RoleAdmin), middleware.RequireScope(models.ScopeUsersWrite), v1Controllers.POSTUserUnlock)
+	// Two-factor enrollment can only be managed from a logged in session
+	v1Users.POST("/me/totp", middleware.RequireLogin(), middleware.DenyAPITokens(), v1Controllers.POSTUserTOTP)
+	v1Users.POST("/me/totp/verify", middleware.RequireLogin(), middleware.DenyAPITokens(), v1Controllers.POSTUserTOTPVerify)
+	v1Users.DELETE("/me/totp", middleware.RequireLogin(), middleware.DenyAPITokens(), v1Controllers.DELETEUserTOTP)
+	v1Users.DELETE("/:id/totp", middleware.RequireRole(models.RoleAdmin), middleware.RequireScope(models.ScopeUsersWrite), v1Controllers.DELETEUserTOTPAdmin)
+
+	// API tokens can only be managed from a logged in session
+	v1Tokens := group.Group("/tokens")
+	v1Tokens.Use(middleware.RequireLogin(), middleware.DenyAPITokens())
+	// Paginated
+	v1Tokens.GET("", v1Controllers.GETAPITokens)
+	v1Tokens.POST("", v1Controllers.POSTAPIToken)
+	v1Tokens.GET("/:id", v1Controllers.GETAPIToken)
+	v1Tokens.DELETE("/:id", v1Controllers.DELETEAPIToken)
+
+	v1Audit := group.Group("/audit")
+	// Paginated
+	v1Audit.GET("", middleware.RequireRole(models.RoleAdmin), middleware.RequireScope(models.ScopeAuditRead), v1Controllers.GETAuditEvents)
+
+	v1Services := group.Group("/services")
+	v1Services.GET("", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeServicesRead), v1Controllers.GETServices)
+	v1Services.GET("/:name", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeServicesRead), v1Controllers.GETService)
+	v1Services.POST("/:name/start", middleware.RequireRole(models.RoleAdmin), middleware.RequireScope(models.ScopeServicesWrite), v1Controllers.POSTServiceStart)
+	v1Services.POST("/:name/stop", middleware.RequireRole(models.RoleAdmin), middleware.RequireScope(models.ScopeServicesWrite), v1Controllers.POSTServiceStop)
+	v1Services.POST("/:name/reload", middleware.RequireRole(models.RoleAdmin), middleware.RequireScope(models.ScopeServicesWrite), v1Controllers.POSTServiceReload)
+	v1Services.GET("/advertised", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeServicesRead), v1Controllers.GETAdvertisedServices)
+	v1Services.POST("/advertised", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeServicesWrite), v1Controllers.POSTAdvertisedService)
+	v1Services.PUT("/advertised/:id", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeServicesWrite), v1Controllers.PUTAdvertisedService)
+	v1Services.DELETE("/advertised/:id", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeServicesWrite), v1Controllers.DELETEAdvertisedService)
+
+	v1LocalHosts := group.Group("/local-hosts")
+	v1LocalHosts.GET("", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeServicesRead), v1Controllers.GETLocalHosts)
+	v1LocalHosts.POST("", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeServicesWrite), v1Controllers.POSTLocalHost)
+	v1LocalHosts.PUT("/:id", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeServicesWrite), v1Controllers.PUTLocalHost)
+	v1LocalHosts.DELETE("/:id", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeServicesWrite), v1Controllers.DELETELocalHost)
 
 	v1OLSR := group.Group("/olsr")
 	v1OLSR.GET("/hosts", v1Controllers.GETOLSRHosts)
@@ -97,6 +138,7 @@ func v1(group *gin.RouterGroup, config *config.Config) {
 	v1Wireguard := group.Group("/wireguard")
 	v1Wireguard.GET("/genkey", v1Controllers.GETWireguardGenkey)
 	v1Wireguard.POST("/pubkey", v1Controllers.POSTWireguardPubkey)
+	v1Wireguard.GET("/endpoints", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsRead), v1Controllers.GETWireguardEndpoints)
 
 	v1DNS := group.Group("/dns")
 	v1DNS.GET("/running", v1Controllers.GETDNSRunning)
@@ -104,10 +146,20 @@ func v1(group *gin.RouterGroup, config *config.Config) {
 	v1MeshLink := group.Group("/meshlink")
 	v1MeshLink.GET("/running", v1Controllers.GETMeshLinkRunning)
 
+	v1IPAM := group.Group("/ipam")
+	v1IPAM.GET("", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsRead), v1Controllers.GETIPAM)
+	v1IPAM.POST("/reservations", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsWrite), v1Controllers.POSTIPReservation)
+	v1IPAM.DELETE("/reservations/:id", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsWrite), v1Controllers.DELETEIPReservation)
+
 	v1Tunnels := group.Group("/tunnels")
 	// Paginated
 	v1Tunnels.GET("", v1Controllers.GETTunnels)
-	v1Tunnels.POST("", middleware.RequireLogin(), v1Controllers.POSTTunnel)
+	v1Tunnels.POST("", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsWrite), v1Controllers.POSTTunnel)
+	v1Tunnels.GET("/uptime", v1Controllers.GETTunnelsUptime)
+	v1Tunnels.GET("/keys", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsRead), v1Controllers.GETTunnelKeyAges)
+	v1Tunnels.GET("/geojson", v1Controllers.GETTunnelsGeoJSON)
+	// The bundle holds every tunnel's keys, so this needs an interactive admin
+	v1Tunnels.POST("/export", middleware.RequireRole(models.RoleAdmin), middleware.DenyAPITokens(), v1Controllers.POSTTunnelsExport)
 	v1Tunnels.GET("/wireguard/count", v1Controllers.GETWireguardTunnelsCount)
 	v1Tunnels.GET("/wireguard/count/connected", v1Controllers.GETWireguardTunnelsCountConnected)
 	v1Tunnels.GET("/wireguard/client/count", v1Controllers.GETWireguardClientTunnelsCount)
@@ -115,7 +167,17 @@ func v1(group *gin.RouterGroup, config *config.Config) {
 	v1Tunnels.GET("/wireguard/client/count/connected", v1Controllers.GETWireguardClientTunnelsCountConnected)
 	v1Tunnels.GET("/wireguard/server/count/connected", v1Controllers.GETWireguardServerTunnelsCountConnected)
 	v1Tunnels.GET("/:id/lqm", v1Controllers.GETTunnelLQM)
+	v1Tunnels.GET("/:id/client-config", middleware.RequireRole(models.RoleAdmin), middleware.DenyAPITokens(), v1Controllers.GETTunnelClientConfig)
+	v1Tunnels.GET("/:id/traffic", v1Controllers.GETTunnelTraffic)
+	// Paginated
+	v1Tunnels.GET("/:id/sessions", v1Controllers.GETTunnelSessions)
+	v1Tunnels.GET("/:id/uptime", v1Controllers.GETTunnelUptime)
 	// v1Tunnels.GET("/:id", v1Controllers.GETTunnel)
-	v1Tunnels.PATCH("", middleware.RequireLogin(), v1Controllers.PATCHTunnel)
-	v1Tunnels.DELETE("/:id", middleware.RequireLogin(), v1Controllers.DELETETunnel)
+	v1Tunnels.PATCH("", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsWrite), v1Controllers.PATCHTunnel)
+	v1Tunnels.DELETE("/:id", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsWrite), v1Controllers.DELETETunnel)
+	v1Tunnels.PUT("/:id/schedule", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsWrite), v1Controllers.PUTTunnelSchedule)
+	v1Tunnels.POST("/:id/rotate-keys", middleware.RequireRole(models.RoleAdmin), middleware.DenyAPITokens(), v1Controllers.POSTTunnelRotateKeys)
+	v1Tunnels.PUT("/:id/quota", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsWrite), v1Controllers.PUTTunnelQuota)
+	v1Tunnels.PUT("/:id/rate-limit", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsWrite), v1Controllers.PUTTunnelRateLimit)
+	v1Tunnels.PUT("/:id/endpoint", middleware.RequireRole(models.RoleOperator), middleware.RequireScope(models.ScopeTunnelsWrite), v1Controllers.PUTTunnelEndpoint)
 }
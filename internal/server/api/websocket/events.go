@@ -5,25 +5,42 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"sync"
 
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
 	"github.com/USA-RedDragon/mesh-manager/internal/events"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/websocket"
 	"github.com/gin-contrib/sessions"
 	gorillaWebsocket "github.com/gorilla/websocket"
+	"gorm.io/gorm"
 )
 
+// subscriberBuffer is how many events a slow client may fall behind by
+// before it misses some
+const subscriberBuffer = 100
+
+// subscriber is a connected client
+type subscriber struct {
+	events chan events.Event
+	// audit is whether the client may see audit events, which carry the
+	// before and after of every change and are limited to admins
+	audit bool
+}
+
 type EventsWebsocket struct {
 	websocket.Websocket
-	cancel           context.CancelFunc
-	websocketChannel chan events.Event
-	eventsChannel    chan events.Event
-	connectedCount   uint
+	db            *gorm.DB
+	eventsChannel chan events.Event
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
 }
 
-func CreateEventsWebsocket(eventsChannel chan events.Event) *EventsWebsocket {
+func CreateEventsWebsocket(db *gorm.DB, eventsChannel chan events.Event) *EventsWebsocket {
 	ew := &EventsWebsocket{
-		websocketChannel: make(chan events.Event),
-		eventsChannel:    eventsChannel,
+		db:            db,
+		eventsChannel: eventsChannel,
+		subscribers:   make(map[*subscriber]struct{}),
 	}
 
 	go ew.start()
@@ -31,34 +48,48 @@ func CreateEventsWebsocket(eventsChannel chan events.Event) *EventsWebsocket {
 	return ew
 }
 
+// start sends each event to every client allowed to see it. A client too far
+// behind misses the event rather than holding up the others.
 func (c *EventsWebsocket) start() {
-	for {
-		event := <-c.eventsChannel
-		// If the websocket is closed, we just want to drop the event
-		if c.connectedCount > 0 {
-			c.websocketChannel <- event
+	for event := range c.eventsChannel {
+		c.mu.Lock()
+		for sub := range c.subscribers {
+			if event.Type == events.EventTypeAudit && !sub.audit {
+				continue
+			}
+			select {
+			case sub.events <- event:
+			default:
+				slog.Warn("Dropping event for slow websocket client", "type", event.Type)
+			}
 		}
+		c.mu.Unlock()
 	}
 }
 
 func (c *EventsWebsocket) OnMessage(_ context.Context, _ *http.Request, _ websocket.Writer, _ sessions.Session, _ []byte, _ int) {
 }
 
-func (c *EventsWebsocket) OnConnect(ctx context.Context, _ *http.Request, w websocket.Writer, _ sessions.Session) {
-	newCtx, cancel := context.WithCancel(ctx)
-	c.cancel = cancel
-
-	c.connectedCount++
+func (c *EventsWebsocket) OnConnect(ctx context.Context, _ *http.Request, w websocket.Writer, session sessions.Session) {
+	sub := &subscriber{
+		events: make(chan events.Event, subscriberBuffer),
+		audit:  c.isAdmin(session),
+	}
+	c.mu.Lock()
+	c.subscribers[sub] = struct{}{}
+	c.mu.Unlock()
 
 	go func() {
-		channel := make(chan websocket.Message)
+		defer func() {
+			c.mu.Lock()
+			delete(c.subscribers, sub)
+			c.mu.Unlock()
+		}()
 		for {
 			select {
 			case <-ctx.Done():
 				return
-			case <-newCtx.Done():
-				return
-			case event := <-c.websocketChannel:
+			case event := <-sub.events:
 				eventDataJSON, err := json.Marshal(event)
 				if err != nil {
 					slog.Error("Error marshalling event data", "error", err)
@@ -68,15 +99,25 @@ func (c *EventsWebsocket) OnConnect(ctx context.Context, _ *http.Request, w webs
 					Type: gorillaWebsocket.TextMessage,
 					Data: eventDataJSON,
 				})
-			case <-channel:
-				// We don't actually want to receive messages from the client
-				continue
 			}
 		}
 	}()
 }
 
+// OnDisconnect does nothing, the client's goroutine unsubscribes it once the
+// connection's context is done
 func (c *EventsWebsocket) OnDisconnect(_ context.Context, _ *http.Request, _ sessions.Session) {
-	c.connectedCount--
-	c.cancel()
+}
+
+// isAdmin is whether the session is logged in as an admin
+func (c *EventsWebsocket) isAdmin(session sessions.Session) bool {
+	uid, ok := session.Get("user_id").(uint)
+	if !ok {
+		return false
+	}
+	user, err := models.FindUserByID(c.db, uid)
+	if err != nil {
+		return false
+	}
+	return user.Role.AtLeast(models.RoleAdmin)
 }
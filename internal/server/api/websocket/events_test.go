@@ -0,0 +1,93 @@
+package websocket_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/events"
+	eventsWebsocket "github.com/USA-RedDragon/mesh-manager/internal/server/api/websocket"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/websocket"
+	"github.com/gin-contrib/sessions"
+)
+
+// session is a sessions.Session holding only a user ID
+type session struct {
+	sessions.Session
+	userID any
+}
+
+func (s session) Get(key any) any {
+	if key == "user_id" {
+		return s.userID
+	}
+	return nil
+}
+
+// writer collects the event types written to it
+type writer chan events.EventType
+
+func (w writer) WriteMessage(message websocket.Message) {
+	var event events.Event
+	_ = json.Unmarshal(message.Data, &event)
+	w <- event.Type
+}
+
+func (w writer) Error(_ string) {}
+
+func TestEventsWebsocket(t *testing.T) {
+	os.Setenv("TEST", "1")
+	database, err := db.MakeDB(&config.Config{PasswordSalt: "salt", InitialAdminUserPassword: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewer := models.User{Username: "viewer", Role: models.RoleViewer}
+	err = database.Create(&viewer).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var admin models.User
+	err = database.First(&admin, "username = ?", "admin").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventsChannel := make(chan events.Event)
+	ws := eventsWebsocket.CreateEventsWebsocket(database, eventsChannel)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clients := map[string]struct {
+		session session
+		writer  writer
+		want    []events.EventType
+	}{
+		"anonymous": {session{}, make(writer, 10), []events.EventType{events.EventTypeTunnelStats}},
+		"viewer":    {session{userID: viewer.ID}, make(writer, 10), []events.EventType{events.EventTypeTunnelStats}},
+		"admin":     {session{userID: admin.ID}, make(writer, 10), []events.EventType{events.EventTypeAudit, events.EventTypeTunnelStats}},
+	}
+	for _, client := range clients {
+		ws.OnConnect(ctx, nil, client.writer, client.session)
+	}
+
+	eventsChannel <- events.Event{Type: events.EventTypeAudit}
+	eventsChannel <- events.Event{Type: events.EventTypeTunnelStats}
+
+	for name, client := range clients {
+		for _, want := range client.want {
+			select {
+			case got := <-client.writer:
+				if got != want {
+					t.Errorf("%s got a %s event, want %s", name, got, want)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s never got a %s event", name, want)
+			}
+		}
+	}
+}
@@ -10,13 +10,16 @@ import (
 	"time"
 
 	"github.com/USA-RedDragon/mesh-manager/internal/bandwidth"
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
 	"github.com/USA-RedDragon/mesh-manager/internal/events"
+	"github.com/USA-RedDragon/mesh-manager/internal/lockout"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/api"
 	"github.com/USA-RedDragon/mesh-manager/internal/server/api/middleware"
 	"github.com/USA-RedDragon/mesh-manager/internal/services"
 	"github.com/USA-RedDragon/mesh-manager/internal/services/meshlink"
 	"github.com/USA-RedDragon/mesh-manager/internal/services/olsr"
+	"github.com/USA-RedDragon/mesh-manager/internal/tunnels"
 	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/pprof"
@@ -37,9 +40,11 @@ type Server struct {
 	stats            *bandwidth.StatCounterManager
 	eventsChannel    chan events.Event
 	wireguardManager *wireguard.Manager
+	tunnelScheduler  *tunnels.Scheduler
+	quotaEnforcer    *tunnels.QuotaEnforcer
 }
 
-func NewServer(config *config.Config, db *gorm.DB, stats *bandwidth.StatCounterManager, eventsChannel chan events.Event, wireguardManager *wireguard.Manager) *Server {
+func NewServer(config *config.Config, db *gorm.DB, stats *bandwidth.StatCounterManager, eventsChannel chan events.Event, wireguardManager *wireguard.Manager, tunnelScheduler *tunnels.Scheduler, quotaEnforcer *tunnels.QuotaEnforcer) *Server {
 	return &Server{
 		config:           config,
 		db:               db,
@@ -47,6 +52,8 @@ func NewServer(config *config.Config, db *gorm.DB, stats *bandwidth.StatCounterM
 		stats:            stats,
 		eventsChannel:    eventsChannel,
 		wireguardManager: wireguardManager,
+		tunnelScheduler:  tunnelScheduler,
+		quotaEnforcer:    quotaEnforcer,
 	}
 }
 
@@ -57,7 +64,7 @@ func (s *Server) Run(version string, registry *services.Registry) error {
 
 	s.addMiddleware(r, version, registry)
 
-	api.ApplyRoutes(r, s.eventsChannel, s.config)
+	api.ApplyRoutes(r, s.db, s.eventsChannel, s.config)
 
 	err := r.SetTrustedProxies(s.config.TrustedProxies)
 	if err != nil {
@@ -112,10 +119,15 @@ func (s *Server) addMiddleware(r *gin.Engine, version string, registry *services
 	}
 
 	var di = &middleware.DepInjection{
+		Clock:            clock.Real{},
 		Config:           s.config,
 		DB:               s.db,
+		EventsChannel:    s.eventsChannel,
+		LoginTracker:     lockout.NewTracker(clock.Real{}),
 		NetworkStats:     s.stats,
+		QuotaEnforcer:    s.quotaEnforcer,
 		ServiceRegistry:  registry,
+		TunnelScheduler:  s.tunnelScheduler,
 		Version:          version,
 		WireguardManager: s.wireguardManager,
 	}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
 	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/vtun"
 	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
 	"gorm.io/gorm"
 )
@@ -36,13 +37,24 @@ func Generate(config *config.Config, db *gorm.DB) string {
 	if err != nil {
 		panic(err)
 	}
+	if config.VTun.Enabled {
+		vtunTunnels, err := models.ListVTunTunnels(db)
+		if err != nil {
+			panic(err)
+		}
+		tunnels = append(tunnels, vtunTunnels...)
+	}
 
 	if len(tunnels) > 0 {
 		for _, tunnel := range tunnels {
 			if !tunnel.Enabled {
 				continue
 			}
-			tunnelInterfaces = append(tunnelInterfaces, wireguard.GenerateWireguardInterfaceName(tunnel))
+			iface := wireguard.GenerateWireguardInterfaceName(tunnel)
+			if !tunnel.Wireguard {
+				iface = vtun.InterfaceName(tunnel)
+			}
+			tunnelInterfaces = append(tunnelInterfaces, iface)
 		}
 	}
 
@@ -68,6 +80,12 @@ func Generate(config *config.Config, db *gorm.DB) string {
 		ret += "redistribute anyproto ip 44.0.0.0/8 ge 24 allow\n"
 		ret += "redistribute anyproto ip 172.31.0.0/16 eq 32 deny\n"
 	}
+	ula, ipv6 := config.Wireguard.ULA()
+	if ipv6 {
+		// babeld handles IPv6 natively, so the ULA prefix needs no more
+		// than the same filters as the IPv4 mesh ranges
+		ret += "redistribute anyproto ip " + ula.String() + " ge 64 allow\n"
+	}
 	ret += "redistribute anyproto if br0 deny\n"
 	ret += "redistribute deny\n"
 
@@ -81,7 +99,13 @@ func Generate(config *config.Config, db *gorm.DB) string {
 	ret += "install ip 0.0.0.0/0 eq 0 allow table 22\n"
 	ret += "install ip 10.0.0.0/8 ge 24 allow table 20\n"
 	ret += "install ip 44.0.0.0/8 ge 24 allow table 20\n"
+	if ipv6 {
+		ret += "install ip " + ula.String() + " ge 64 allow table 20\n"
+	}
 	ret += "install ip 0.0.0.0/0 ge 0 deny\n"
+	if ipv6 {
+		ret += "install ip ::/0 ge 0 deny\n"
+	}
 
 	return ret
 }
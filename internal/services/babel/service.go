@@ -1,10 +1,13 @@
 package babel
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"syscall"
-	"time"
 
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/services"
 	"github.com/USA-RedDragon/mesh-manager/internal/utils"
 )
 
@@ -14,6 +17,7 @@ const (
 
 type Service struct {
 	config *config.Config
+	idle   services.Idle
 }
 
 func NewService(config *config.Config) *Service {
@@ -22,13 +26,14 @@ func NewService(config *config.Config) *Service {
 	}
 }
 
+// Start blocks until Stop, since mesh-manager doesn't run the daemon itself
 func (s *Service) Start() error {
-	for {
-		time.Sleep(50 * time.Millisecond)
-	}
+	s.idle.Wait()
+	return nil
 }
 
 func (s *Service) Stop() error {
+	s.idle.Release()
 	return nil
 }
 
@@ -47,3 +52,14 @@ func (s *Service) IsRunning() bool {
 func (s *Service) IsEnabled() bool {
 	return s.config.Babel.Enabled
 }
+
+// Ready checks that babeld is taking commands on its socket, which LQM and
+// tunnel changes talk to it over
+func (s *Service) Ready(ctx context.Context) error {
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to connect to socket: %w", err)
+	}
+	return conn.Close()
+}
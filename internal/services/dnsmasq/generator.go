@@ -0,0 +1,56 @@
+package dnsmasq
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// dnsmasq rereads both of these on SIGHUP, so a reload picks up changes
+const (
+	// HostsPath is the addn-hosts file of the LAN hosts behind this node
+	HostsPath = "/var/run/hosts_local"
+	// DHCPHostsPath is the dhcp-hostsfile of their DHCP reservations
+	DHCPHostsPath = "/var/run/dhcp_hosts_local"
+)
+
+func GenerateAndSave(db *gorm.DB) error {
+	hosts, err := models.ListLocalHosts(db)
+	if err != nil {
+		return fmt.Errorf("failed to list local hosts: %w", err)
+	}
+
+	//nolint:gosec
+	err = os.WriteFile(HostsPath, []byte(GenerateHosts(hosts)), 0644)
+	if err != nil {
+		return err
+	}
+	//nolint:gosec
+	return os.WriteFile(DHCPHostsPath, []byte(GenerateDHCPHosts(hosts)), 0644)
+}
+
+// GenerateHosts resolves every local host, advertised or not, by its bare
+// name and in local.mesh
+func GenerateHosts(hosts []models.LocalHost) string {
+	var ret strings.Builder
+	for _, host := range hosts {
+		ret.WriteString(host.IP + " " + host.Name + " " + host.Name + ".local.mesh\n")
+	}
+	return ret.String()
+}
+
+// GenerateDHCPHosts reserves each local host's IP for its MAC. Hosts
+// without a MAC have no reservation.
+func GenerateDHCPHosts(hosts []models.LocalHost) string {
+	var ret strings.Builder
+	for _, host := range hosts {
+		if host.MAC == "" {
+			continue
+		}
+		ret.WriteString(host.MAC + "," + host.IP + "," + host.Name + "\n")
+	}
+	return ret.String()
+}
@@ -1,10 +1,11 @@
 package dnsmasq
 
 import (
+	"context"
 	"syscall"
-	"time"
 
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/services"
 	"github.com/USA-RedDragon/mesh-manager/internal/utils"
 )
 
@@ -14,6 +15,7 @@ const (
 
 type Service struct {
 	config *config.Config
+	idle   services.Idle
 }
 
 func NewService(config *config.Config) *Service {
@@ -22,13 +24,14 @@ func NewService(config *config.Config) *Service {
 	}
 }
 
+// Start blocks until Stop, since mesh-manager doesn't run the daemon itself
 func (s *Service) Start() error {
-	for {
-		time.Sleep(50 * time.Millisecond)
-	}
+	s.idle.Wait()
+	return nil
 }
 
 func (s *Service) Stop() error {
+	s.idle.Release()
 	return nil
 }
 
@@ -47,3 +50,12 @@ func (s *Service) IsRunning() bool {
 func (s *Service) IsEnabled() bool {
 	return true
 }
+
+// Dependencies are the services that write the hosts files dnsmasq serves
+func (s *Service) Dependencies() []services.ServiceName {
+	return []services.ServiceName{services.OLSRServiceName, services.MeshLinkServiceName}
+}
+
+func (s *Service) Ready(_ context.Context) error {
+	return utils.CheckPIDFile(pidFile)
+}
@@ -0,0 +1,38 @@
+package services
+
+import "sync"
+
+// Idle blocks a service's Start until its Stop, for services whose daemon
+// is run outside of mesh-manager. The zero value is ready to use.
+type Idle struct {
+	mu   sync.Mutex
+	stop chan struct{}
+	// released is a Release that came before the Wait it was meant for
+	released bool
+}
+
+// Wait blocks until Release is called
+func (i *Idle) Wait() {
+	i.mu.Lock()
+	if i.released {
+		i.released = false
+		i.mu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	i.stop = stop
+	i.mu.Unlock()
+	<-stop
+}
+
+// Release ends the current Wait, or the next one if none is waiting
+func (i *Idle) Release() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.stop == nil {
+		i.released = true
+		return
+	}
+	close(i.stop)
+	i.stop = nil
+}
@@ -0,0 +1,43 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/services"
+)
+
+func TestIdle(t *testing.T) {
+	t.Parallel()
+
+	var idle services.Idle
+	waited := make(chan struct{})
+	go func() {
+		idle.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("Wait() returned before Release()")
+	case <-time.After(50 * time.Millisecond):
+	}
+	idle.Release()
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait() did not return after Release()")
+	}
+
+	// A Release that comes first ends the next Wait
+	idle.Release()
+	waited = make(chan struct{})
+	go func() {
+		idle.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait() after Release() did not return")
+	}
+}
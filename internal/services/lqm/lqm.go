@@ -21,8 +21,11 @@ import (
 	"time"
 
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/services"
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sync/semaphore"
+	"gorm.io/gorm"
 )
 
 const (
@@ -47,6 +50,7 @@ type SysinfoResponse struct {
 	Node        string             `json:"node"`
 	Lat         any                `json:"lat"`
 	Lon         any                `json:"lon"`
+	Gridsquare  string             `json:"grid_square"`
 	NodeDetails SysinfoNodeDetails `json:"node_details"`
 	Interfaces  []SysinfoInterface `json:"interfaces"`
 	Lqm         LQM                `json:"lqm"`
@@ -94,6 +98,7 @@ type Tracker struct {
 	IP                 string       `json:"ip"`
 	Lat                float64      `json:"lat"`
 	Lon                float64      `json:"lon"`
+	Gridsquare         string       `json:"gridsquare"`
 	Distance           float64      `json:"distance"`
 	LocalArea          bool         `json:"localarea"`
 	Model              string       `json:"model"`
@@ -138,6 +143,7 @@ const (
 
 type Service struct {
 	config              *config.Config
+	db                  *gorm.DB
 	trackers            map[string]*Tracker
 	mu                  sync.RWMutex
 	cancel              context.CancelFunc
@@ -150,13 +156,13 @@ type Service struct {
 	httpSem             *semaphore.Weighted
 	httpClient          *http.Client
 	startStopMu         sync.Mutex
-	stopping            bool
 	running             atomic.Bool
 }
 
-func NewService(config *config.Config) *Service {
+func NewService(config *config.Config, db *gorm.DB) *Service {
 	return &Service{
 		config:   config,
+		db:       db,
 		trackers: make(map[string]*Tracker),
 		pingSem:  semaphore.NewWeighted(10), // Limit concurrent pings
 		httpSem:  semaphore.NewWeighted(5),  // Limit concurrent HTTP requests
@@ -173,12 +179,6 @@ func NewService(config *config.Config) *Service {
 
 func (s *Service) Start() error {
 	s.startStopMu.Lock()
-	if s.stopping {
-		s.startStopMu.Unlock()
-		// Block forever to prevent busy loop in registry during shutdown
-		select {}
-	}
-
 	if !s.IsEnabled() {
 		s.startStopMu.Unlock()
 		return nil
@@ -191,8 +191,7 @@ func (s *Service) Start() error {
 	s.running.Store(true)
 	s.startStopMu.Unlock()
 
-	// Run synchronously so that the service registry doesn't spin in a tight loop restarting us.
-	// The registry expects Start() to block until the service exits.
+	// The supervisor expects Start() to block until the service exits.
 	s.run(ctx)
 
 	return nil
@@ -200,7 +199,6 @@ func (s *Service) Start() error {
 
 func (s *Service) Stop() error {
 	s.startStopMu.Lock()
-	s.stopping = true
 	if s.cancel != nil {
 		s.cancel()
 	}
@@ -223,6 +221,11 @@ func (s *Service) IsEnabled() bool {
 	return s.config.LQM.Enabled
 }
 
+// Dependencies are babeld, whose socket LQM reads neighbors and routes from
+func (s *Service) Dependencies() []services.ServiceName {
+	return []services.ServiceName{services.BabelServiceName}
+}
+
 func (s *Service) run(ctx context.Context) {
 	defer func() {
 		s.running.Store(false)
@@ -497,7 +500,9 @@ func (s *Service) remoteRefresh(ctx context.Context) {
 			defer s.httpSem.Release(1)
 			if err := s.refreshTracker(ctx, tracker); err != nil {
 				slog.Warn("LQM: Failed to refresh tracker", "mac", tracker.MAC, "ip", tracker.IP, "hostname", tracker.Hostname, "error", err)
+				return
 			}
+			s.savePeerLocation(tracker)
 		}()
 	}
 }
@@ -575,6 +580,7 @@ func (s *Service) refreshTracker(ctx context.Context, t *Tracker) error {
 		t.Lon = 0.0
 	}
 
+	t.Gridsquare = info.Gridsquare
 	t.Hostname = canonicalHostname(info.Node)
 	t.CanonicalIP = meshIPForHostname(ctx, t.Hostname)
 
@@ -646,6 +652,23 @@ func (s *Service) refreshTracker(ctx context.Context, t *Tracker) error {
 	return nil
 }
 
+// savePeerLocation copies where a Wireguard tracker's node is onto its
+// tunnel, for the tunnel map
+func (s *Service) savePeerLocation(t *Tracker) {
+	s.mu.RLock()
+	if t.Type != DeviceTypeWireguard || (t.Lat == 0 && t.Lon == 0) {
+		s.mu.RUnlock()
+		return
+	}
+	device, lat, lon, gridsquare, distance := t.Device, t.Lat, t.Lon, t.Gridsquare, t.Distance
+	s.mu.RUnlock()
+
+	err := models.UpdateTunnelPeerLocation(s.db, device, lat, lon, gridsquare, distance, time.Now())
+	if err != nil {
+		slog.Warn("LQM: Failed to save peer location", "device", device, "error", err)
+	}
+}
+
 func (s *Service) updateTrackingState(ctx context.Context) {
 	slog.Info("LQM: updateTrackingState started")
 	s.mu.Lock()
@@ -776,6 +799,49 @@ func (s *Service) writeState() {
 	}
 }
 
+// ReadTrackers reads the trackers from the state LQM last wrote, keyed by
+// neighbor MAC
+func ReadTrackers() (map[string]Tracker, error) {
+	file, err := os.Open(lqmInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var state struct {
+		Trackers map[string]Tracker `json:"trackers"`
+	}
+	if err := json.NewDecoder(file).Decode(&state); err != nil {
+		return nil, fmt.Errorf("failed to decode LQM state: %w", err)
+	}
+	return state.Trackers, nil
+}
+
+// TrackerForTunnel finds the tracker for a tunnel's peer by its address or
+// hostname. It returns nil if LQM hasn't seen the peer.
+func TrackerForTunnel(tunnel models.Tunnel, trackers map[string]Tracker) *Tracker {
+	tunnelIP := strings.TrimSpace(tunnel.IP)
+	canonicalHost := canonicalHostname(tunnel.Hostname)
+
+	for _, tracker := range trackers {
+		trackerCopy := tracker
+		if tunnelIP != "" {
+			if strings.TrimSpace(trackerCopy.IP) == tunnelIP {
+				return &trackerCopy
+			}
+			if strings.TrimSpace(trackerCopy.CanonicalIP) == tunnelIP {
+				return &trackerCopy
+			}
+		}
+
+		if canonicalHost != "" && canonicalHostname(trackerCopy.Hostname) == canonicalHost {
+			return &trackerCopy
+		}
+	}
+
+	return nil
+}
+
 func ipv6llToMac(ipv6ll string) string {
 	ip := net.ParseIP(ipv6ll)
 	if ip == nil {
@@ -0,0 +1,79 @@
+package meshlink
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// HostsPath is the file of "ip name" lines meshlink publishes for this
+	// node
+	HostsPath = "/etc/meshlink/hosts"
+	// ServicesPath is the file of url|protocol|name lines meshlink publishes
+	// for this node
+	ServicesPath = "/etc/meshlink/services"
+)
+
+func GenerateAndSave(config *config.Config, db *gorm.DB) error {
+	hosts, err := GenerateHosts(config, db)
+	if err != nil {
+		return err
+	}
+	//nolint:gosec
+	err = os.WriteFile(HostsPath, []byte(hosts), 0644)
+	if err != nil {
+		return err
+	}
+
+	services, err := GenerateServices(config, db)
+	if err != nil {
+		return err
+	}
+	//nolint:gosec
+	return os.WriteFile(ServicesPath, []byte(services), 0644)
+}
+
+// GenerateHosts is this node's own names followed by the LAN hosts it
+// advertises
+func GenerateHosts(config *config.Config, db *gorm.DB) (string, error) {
+	hosts, err := models.ListAdvertisedLocalHosts(db)
+	if err != nil {
+		return "", fmt.Errorf("failed to list local hosts: %w", err)
+	}
+
+	var ret strings.Builder
+	ret.WriteString(config.NodeIP + " " + config.ServerName + "\n")
+	if config.Supernode {
+		ret.WriteString(config.NodeIP + " supernode." + config.ServerName + ".local.mesh\n")
+	}
+	ret.WriteString(config.NodeIP + " dtdlink." + config.ServerName + ".local.mesh\n")
+	if ula, ok := config.Wireguard.ULA(); ok {
+		// br-dtdlink is given the first address of the ULA prefix
+		ret.WriteString(ula.Masked().Addr().Next().String() + " " + config.ServerName + "\n")
+	}
+	for _, host := range hosts {
+		ret.WriteString(host.IP + " " + host.Name + "\n")
+	}
+	return ret.String(), nil
+}
+
+// GenerateServices is this node's console followed by the services it
+// advertises
+func GenerateServices(config *config.Config, db *gorm.DB) (string, error) {
+	advertised, err := models.ListEnabledAdvertisedServices(db)
+	if err != nil {
+		return "", fmt.Errorf("failed to list advertised services: %w", err)
+	}
+
+	var ret strings.Builder
+	ret.WriteString("http://" + config.ServerName + "/|tcp|" + config.ServerName + "-console\n")
+	for _, service := range advertised {
+		ret.WriteString(service.Line() + "\n")
+	}
+	return ret.String(), nil
+}
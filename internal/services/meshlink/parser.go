@@ -237,7 +237,7 @@ func parseHosts() (ret []*Host, count int, totalCount int, serviceCount int, err
 					continue
 				}
 				// Check if the same base filename exists under the services directory
-				servicesFile := filepath.Join(servicesDir, host.IP.To4().String())
+				servicesFile := filepath.Join(servicesDir, host.IP.String())
 				if services, err := os.ReadFile(servicesFile); err == nil {
 					slog.Debug("parseHosts: Found services file for host", "file", servicesFile)
 					var servicesList []*MeshService
@@ -1,214 +1,202 @@
 package olsr
 
 import (
+	"embed"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
 
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
 	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
-	"github.com/USA-RedDragon/mesh-manager/internal/utils"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/vtun"
 	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
 	"gorm.io/gorm"
 )
 
 const (
-	snippetOlsrdConf = `# This file is generated by the Mesh Manager
-# Do not edit this file directly
-DebugLevel 0
-Pollrate 0.05
-AllowNoInt yes
-RtTable '30'
-RtTableDefault '31'
-IpVersion 4
-LinkQualityAlgorithm "etx_ffeth"
-Willingness 7
-MainIp ${MAIN_IP}
-
-LoadPlugin "olsrd_arprefresh.so.0.1"
-{
-}
-
-LoadPlugin "olsrd_txtinfo.so.1.1"
-{
-    PlParam "accept" "0.0.0.0"
-}
+	ConfigPath = "/etc/olsrd/olsrd.conf"
+	// rootTemplate is the template the config is rendered from. The others
+	// each define a named block it uses.
+	rootTemplate = "olsrd.conf.tmpl"
+)
 
-LoadPlugin "olsrd_jsoninfo.so.1.1"
-{
-    PlParam "accept" "0.0.0.0"
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// Conf is the olsrd config the templates render from
+type Conf struct {
+	MainIP               string
+	Pollrate             float64
+	LinkQualityAlgorithm string
+	Willingness          int
+	RtTable              int
+	RtTableDefault       int
+	Plugins              []Plugin
+	Interfaces           []Interface
+	// HNA4 are the networks this node announces to the mesh
+	HNA4 []HNA
 }
 
-LoadPlugin "olsrd_dot_draw.so.0.3"
-{
-    PlParam "accept" "0.0.0.0"
-    PlParam "port" "2004"
+// Plugin is a LoadPlugin block
+type Plugin struct {
+	Library string
+	Params  []Param
 }
 
-LoadPlugin "olsrd_watchdog.so.0.1"
-{
-    PlParam "file" "/tmp/olsrd.watchdog"
-    PlParam "interval" "5"
-}`
-
-	snippetOlsrdSupernodeConf = `# This file is generated by the Mesh Manager
-# Do not edit this file directly
-DebugLevel 0
-Pollrate 0.01
-AllowNoInt yes
-RtTable '30'
-RtTableDefault '31'
-IpVersion 4
-LinkQualityAlgorithm "etx_ffeth"
-Willingness 7
-MainIp ${MAIN_IP}
-
-LoadPlugin "olsrd_arprefresh.so.0.1"
-{
+// Param is a plugin's PlParam
+type Param struct {
+	Name  string
+	Value string
 }
 
-LoadPlugin "olsrd_txtinfo.so.1.1"
-{
-    PlParam "accept" "0.0.0.0"
+// Interface is an Interface block, which may cover more than one interface.
+// Zero values are left out.
+type Interface struct {
+	Names           []string
+	Mode            string
+	IP4Broadcast    string
+	HnaInterval     float64
+	HnaValidityTime float64
 }
 
-LoadPlugin "olsrd_jsoninfo.so.1.1"
-{
-    PlParam "accept" "0.0.0.0"
+type HNA struct {
+	Network string
+	Netmask string
 }
 
-LoadPlugin "olsrd_dot_draw.so.0.3"
-{
-    PlParam "accept" "0.0.0.0"
-    PlParam "port" "2004"
-}
+// NewConf is the olsrd config for this node, its enabled tunnels and the
+// services and LAN hosts it advertises
+func NewConf(config *config.Config, tunnels []models.Tunnel, advertised []models.AdvertisedService, hosts []models.LocalHost) Conf {
+	nameservice := []Param{
+		{"interval", "30"},
+		{"timeout", "300"},
+		{"name-change-script", "mesh-manager notify"},
+		{"name", config.ServerName},
+		{"service", "http://" + config.ServerName + "/|tcp|" + config.ServerName + "-console"},
+	}
+	for _, service := range advertised {
+		nameservice = append(nameservice, Param{"service", service.Line()})
+	}
+	// The nameservice plugin announces a host for any parameter named by an IP
+	for _, host := range hosts {
+		nameservice = append(nameservice, Param{host.IP, host.Name})
+	}
 
-LoadPlugin "olsrd_watchdog.so.0.1"
-{
-    PlParam "file" "/tmp/olsrd.watchdog"
-    PlParam "interval" "5"
-}`
-
-	snippetOlsrdConfInterfaceSupernode = `Interface "${IFACE}"
-{
-    Mode "isolated"
-    HnaInterval 1.0
-    HnaValidityTime 600.0
-}`
-
-	snippetOlsrdConfInterfaceStandard = `Interface "${IFACE}"
-{
-    Mode "ether"
-}`
-
-	snippetOlsrdConfNameservice = `LoadPlugin "olsrd_nameservice.so.0.4"
-{
-    PlParam "interval" "30"
-    PlParam "timeout" "300"
-    PlParam "name-change-script" "mesh-manager notify"
-    PlParam "name" "${SERVER_NAME}"
-    ${SERVICES}
-}`
-
-	snippetOlsrdConfSupernode = `Hna4
-{
-    10.0.0.0   255.0.0.0
-}`
-
-	snippetOlsrdConfTunnel = `Interface ${IFACES}
-{
-    Ip4Broadcast 255.255.255.255
-    Mode "ether"
-}`
-)
+	conf := Conf{
+		MainIP:               config.NodeIP,
+		Pollrate:             0.05,
+		LinkQualityAlgorithm: "etx_ffeth",
+		Willingness:          7,
+		RtTable:              30,
+		RtTableDefault:       31,
+		Plugins: []Plugin{
+			{Library: "olsrd_arprefresh.so.0.1"},
+			{Library: "olsrd_txtinfo.so.1.1", Params: []Param{{"accept", "0.0.0.0"}}},
+			{Library: "olsrd_jsoninfo.so.1.1", Params: []Param{{"accept", "0.0.0.0"}}},
+			{Library: "olsrd_dot_draw.so.0.3", Params: []Param{{"accept", "0.0.0.0"}, {"port", "2004"}}},
+			{Library: "olsrd_watchdog.so.0.1", Params: []Param{{"file", "/tmp/olsrd.watchdog"}, {"interval", "5"}}},
+			{Library: "olsrd_nameservice.so.0.4", Params: nameservice},
+		},
+		Interfaces: []Interface{{Names: []string{"br-dtdlink"}, Mode: "ether"}},
+	}
 
-// This file will generate the olsrd.conf file
+	if config.Supernode {
+		conf.Pollrate = 0.01
+		conf.Interfaces[0] = Interface{
+			Names:           []string{"br-dtdlink"},
+			Mode:            "isolated",
+			HnaInterval:     1.0,
+			HnaValidityTime: 600.0,
+		}
+		conf.HNA4 = []HNA{{Network: "10.0.0.0", Netmask: "255.0.0.0"}}
+	}
 
-func GenerateAndSave(config *config.Config, db *gorm.DB) error {
-	conf := Generate(config, db)
-	if conf == "" {
-		return fmt.Errorf("failed to generate olsrd.conf")
+	var tunnelIfaces []string
+	for _, tunnel := range tunnels {
+		if !tunnel.Enabled {
+			continue
+		}
+		if tunnel.Wireguard {
+			tunnelIfaces = append(tunnelIfaces, wireguard.GenerateWireguardInterfaceName(tunnel))
+		} else {
+			tunnelIfaces = append(tunnelIfaces, vtun.InterfaceName(tunnel))
+		}
+	}
+	if len(tunnelIfaces) > 0 {
+		conf.Interfaces = append(conf.Interfaces, Interface{
+			Names:        tunnelIfaces,
+			Mode:         "ether",
+			IP4Broadcast: "255.255.255.255",
+		})
 	}
 
-	//nolint:gosec
-	return os.WriteFile("/etc/olsrd/olsrd.conf", []byte(conf), 0644)
+	return conf
 }
 
-func Generate(config *config.Config, db *gorm.DB) string {
-	ret := snippetOlsrdConf
-	if config.Supernode {
-		ret = snippetOlsrdSupernodeConf
-	}
-	utils.ShellReplace(
-		&ret,
-		map[string]string{
-			"MAIN_IP": config.NodeIP,
-		},
-	)
-	ret += "\n\n"
-	if config.Supernode {
-		snippet := snippetOlsrdConfInterfaceSupernode
-		utils.ShellReplace(&snippet, map[string]string{"IFACE": "br-dtdlink"})
-		ret += snippet
-	} else {
-		snippet := snippetOlsrdConfInterfaceStandard
-		utils.ShellReplace(&snippet, map[string]string{"IFACE": "br-dtdlink"})
-		ret += snippet
+// Render renders the config from the built-in templates. Any .tmpl file in
+// templateDir replaces the built-in one of the same name, or can redefine
+// one of their blocks.
+func Render(conf Conf, templateDir string) (string, error) {
+	tmpl, err := template.New(rootTemplate).ParseFS(templates, "templates/*.tmpl")
+	if err != nil {
+		return "", fmt.Errorf("failed to parse olsrd templates: %w", err)
 	}
-	ret += "\n\n"
 
-	// We need to replace shell variables in the template with the actual values
-	cpSnippetOlsrdConfNameservice := snippetOlsrdConfNameservice
-	servicesText := "PlParam \"service\" \"http://${SERVER_NAME}/|tcp|${SERVER_NAME}-console\""
-
-	utils.ShellReplace(
-		&servicesText,
-		map[string]string{
-			"SERVER_NAME": config.ServerName,
-		},
-	)
+	if templateDir != "" {
+		overrides, err := filepath.Glob(filepath.Join(templateDir, "*.tmpl"))
+		if err != nil {
+			return "", fmt.Errorf("failed to list olsrd template overrides: %w", err)
+		}
+		if len(overrides) > 0 {
+			tmpl, err = tmpl.ParseFiles(overrides...)
+			if err != nil {
+				return "", fmt.Errorf("failed to parse olsrd template overrides: %w", err)
+			}
+		}
+	}
 
-	utils.ShellReplace(
-		&cpSnippetOlsrdConfNameservice,
-		map[string]string{
-			"SERVER_NAME": config.ServerName,
-			"SERVICES":    servicesText,
-		},
-	)
-	ret += cpSnippetOlsrdConfNameservice
+	var out strings.Builder
+	err = tmpl.ExecuteTemplate(&out, rootTemplate, conf)
+	if err != nil {
+		return "", fmt.Errorf("failed to render olsrd config: %w", err)
+	}
+	return out.String(), nil
+}
 
-	if config.Supernode {
-		ret += "\n\n"
-		ret += snippetOlsrdConfSupernode
+func GenerateAndSave(config *config.Config, db *gorm.DB) error {
+	conf, err := Generate(config, db)
+	if err != nil {
+		return err
 	}
 
+	//nolint:gosec
+	return os.WriteFile(ConfigPath, []byte(conf), 0644)
+}
+
+func Generate(config *config.Config, db *gorm.DB) (string, error) {
 	tunnels, err := models.ListWireguardTunnels(db)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("failed to list tunnels: %w", err)
 	}
-
-	if len(tunnels) > 0 {
-		tunnelString := ""
-		for _, tunnel := range tunnels {
-			if !tunnel.Enabled {
-				continue
-			}
-			iface := wireguard.GenerateWireguardInterfaceName(tunnel)
-			tunnelString += "\"" + iface + "\""
-			if tunnel != tunnels[len(tunnels)-1] {
-				tunnelString += " "
-			}
+	if config.VTun.Enabled {
+		vtunTunnels, err := models.ListVTunTunnels(db)
+		if err != nil {
+			return "", fmt.Errorf("failed to list vtun tunnels: %w", err)
 		}
+		tunnels = append(tunnels, vtunTunnels...)
+	}
+
+	advertised, err := models.ListEnabledAdvertisedServices(db)
+	if err != nil {
+		return "", fmt.Errorf("failed to list advertised services: %w", err)
+	}
 
-		ret += "\n\n"
-		cpSnippetOlsrdConfTunnel := snippetOlsrdConfTunnel
-		utils.ShellReplace(
-			&cpSnippetOlsrdConfTunnel,
-			map[string]string{
-				"IFACES": tunnelString,
-			},
-		)
-		ret += cpSnippetOlsrdConfTunnel
+	hosts, err := models.ListAdvertisedLocalHosts(db)
+	if err != nil {
+		return "", fmt.Errorf("failed to list local hosts: %w", err)
 	}
 
-	return ret
+	return Render(NewConf(config, tunnels, advertised, hosts), config.OLSRTemplateDir)
 }
@@ -0,0 +1,138 @@
+package olsr_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/olsr"
+)
+
+//nolint:gochecknoglobals
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	tunnels := []models.Tunnel{
+		{ID: 1, Hostname: "N0CALL-NODE", Wireguard: true, WireguardServerKey: "key", Enabled: true},
+		{ID: 2, Hostname: "N0CALL-OFF", Wireguard: true, Enabled: false},
+		{ID: 3, Hostname: "N0CALL-HUB", Wireguard: true, Client: true, Enabled: true},
+		{ID: 4, Hostname: "N0CALL-VTUN", Enabled: true},
+	}
+
+	tests := []struct {
+		name       string
+		cfg        *config.Config
+		tunnels    []models.Tunnel
+		advertised []models.AdvertisedService
+		hosts      []models.LocalHost
+	}{
+		{
+			name: "standard",
+			cfg:  &config.Config{ServerName: "KI5VMF-HUB", NodeIP: "10.12.34.56"},
+		},
+		{
+			name: "supernode",
+			cfg:  &config.Config{ServerName: "KI5VMF-SUPER", NodeIP: "10.12.34.57", Supernode: true},
+		},
+		{
+			name:    "tunnels",
+			cfg:     &config.Config{ServerName: "KI5VMF-HUB", NodeIP: "10.12.34.56"},
+			tunnels: tunnels,
+		},
+		{
+			name: "services",
+			cfg:  &config.Config{ServerName: "KI5VMF-HUB", NodeIP: "10.12.34.56"},
+			advertised: []models.AdvertisedService{
+				{Name: "Chat", URL: "http://KI5VMF-HUB:8080/chat", Protocol: "tcp", Enabled: true},
+				{Name: "Weather Station", URL: "http://10.12.34.56:0/", Protocol: "udp", Enabled: true},
+			},
+		},
+		{
+			name: "hosts",
+			cfg:  &config.Config{ServerName: "KI5VMF-HUB", NodeIP: "10.12.34.56"},
+			hosts: []models.LocalHost{
+				{Name: "KI5VMF-CAMERA", IP: "10.12.34.60", Advertise: true},
+				{Name: "KI5VMF-PI", IP: "10.12.34.61", MAC: "b8:27:eb:00:00:01", Advertise: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := olsr.Render(olsr.NewConf(tt.cfg, tt.tunnels, tt.advertised, tt.hosts), "")
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				err := os.WriteFile(golden, []byte(got), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(want) {
+				t.Errorf("Render() does not match %s, rerun with -update if that is expected:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestRenderOverrides(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	// A file can replace a built-in block
+	err := os.WriteFile(filepath.Join(dir, "interface.tmpl"), []byte(`{{ define "interface" }}Interface{{ range .Names }} "{{ . }}"{{ end }}
+{
+    Mode "{{ .Mode }}"
+    LinkQualityMult default 0.5
+}{{ end }}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// or the whole config, here with a different pollrate
+	err = os.WriteFile(filepath.Join(dir, "olsrd.conf.tmpl"), []byte(`Pollrate 0.1
+MainIp {{ .MainIP }}
+{{ range .Interfaces }}{{ template "interface" . }}
+{{ end }}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{ServerName: "KI5VMF-HUB", NodeIP: "10.12.34.56"}
+	got, err := olsr.Render(olsr.NewConf(cfg, nil, nil, nil), dir)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	want := `Pollrate 0.1
+MainIp 10.12.34.56
+Interface "br-dtdlink"
+{
+    Mode "ether"
+    LinkQualityMult default 0.5
+}
+`
+	if got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "broken.tmpl"), []byte(`{{ .Missing`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = olsr.Render(olsr.NewConf(cfg, nil, nil, nil), dir)
+	if err == nil || !strings.Contains(err.Error(), "overrides") {
+		t.Errorf("Render() error = %v, want a template override error", err)
+	}
+}
@@ -2,6 +2,7 @@ package olsr
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -10,6 +11,8 @@ import (
 	"github.com/USA-RedDragon/mesh-manager/internal/config"
 )
 
+var ErrNotRunning = errors.New("olsrd is not running")
+
 type Service struct {
 	config  *config.Config
 	olsrCmd *exec.Cmd
@@ -18,7 +21,7 @@ type Service struct {
 func NewService(config *config.Config) *Service {
 	return &Service{
 		config:  config,
-		olsrCmd: exec.CommandContext(context.Background(), "olsrd", "-f", "/etc/olsrd/olsrd.conf", "-nofork"),
+		olsrCmd: exec.CommandContext(context.Background(), "olsrd", "-f", ConfigPath, "-nofork"),
 	}
 }
 
@@ -27,7 +30,7 @@ func (s *Service) Start() error {
 		return s.olsrCmd.Wait()
 	}
 	if s.olsrCmd.ProcessState != nil {
-		s.olsrCmd = exec.CommandContext(context.Background(), "olsrd", "-f", "/etc/olsrd/olsrd.conf", "-nofork")
+		s.olsrCmd = exec.CommandContext(context.Background(), "olsrd", "-f", ConfigPath, "-nofork")
 	}
 	err := s.olsrCmd.Start()
 	if err != nil {
@@ -57,3 +60,10 @@ func (s *Service) IsRunning() bool {
 func (s *Service) IsEnabled() bool {
 	return true
 }
+
+func (s *Service) Ready(_ context.Context) error {
+	if !s.IsRunning() {
+		return ErrNotRunning
+	}
+	return nil
+}
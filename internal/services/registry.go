@@ -1,14 +1,30 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/puzpuzpuz/xsync/v4"
-	"golang.org/x/sync/errgroup"
+)
+
+var ErrDependencyCycle = errors.New("services depend on each other in a cycle")
+
+const (
+	// ReadyTimeout is how long StartAll waits for a service to become
+	// ready before starting the services after it anyway
+	ReadyTimeout = 30 * time.Second
+	// ReadyPollInterval is how often a starting service's readiness is probed
+	ReadyPollInterval = 250 * time.Millisecond
 )
 
 type Registry struct {
-	services *xsync.Map[string, Service]
+	services    *xsync.Map[string, Service]
+	supervisors *xsync.Map[string, *Supervisor]
 }
 
 type ServiceName string
@@ -19,47 +35,169 @@ const (
 	DNSMasqServiceName  ServiceName = "dnsmasq"
 	MeshLinkServiceName ServiceName = "meshlink"
 	LQMServiceName      ServiceName = "lqm"
+	VTunServiceName     ServiceName = "vtun"
 )
 
 func NewServiceRegistry() *Registry {
 	return &Registry{
-		services: xsync.NewMap[string, Service](),
+		services:    xsync.NewMap[string, Service](),
+		supervisors: xsync.NewMap[string, *Supervisor](),
 	}
 }
 
 func (r *Registry) Register(name ServiceName, service Service) {
 	r.services.Store(string(name), service)
+	r.supervisors.Store(string(name), NewSupervisor(name, service))
 }
 
 func (r *Registry) Get(name ServiceName) (Service, bool) {
 	return r.services.Load(string(name))
 }
 
-func (r *Registry) StartAll() {
+// Supervisor returns the supervisor that starts, stops and restarts the
+// named service
+func (r *Registry) Supervisor(name ServiceName) (*Supervisor, bool) {
+	return r.supervisors.Load(string(name))
+}
+
+// Statuses returns the status of every registered service, by name
+func (r *Registry) Statuses() []Status {
+	statuses := []Status{}
+	r.supervisors.Range(func(_ string, supervisor *Supervisor) bool {
+		statuses = append(statuses, supervisor.Status())
+		return true
+	})
+	slices.SortFunc(statuses, func(a, b Status) int {
+		return strings.Compare(string(a.Name), string(b.Name))
+	})
+	return statuses
+}
+
+// Order returns the enabled services with each one after the services it
+// depends on. Services that don't depend on each other are ordered by name.
+func (r *Registry) Order() ([]ServiceName, error) {
+	dependencies := make(map[ServiceName][]ServiceName)
 	r.services.Range(func(name string, service Service) bool {
-		if !service.IsEnabled() {
-			slog.Debug("service is disabled", "service", name)
-			return true
+		if service.IsEnabled() {
+			dependencies[ServiceName(name)] = nil
 		}
-		go func() {
-			for {
-				err := service.Start()
-				if err != nil {
-					slog.Warn("service failed to start", "service", name, "error", err)
-				}
-			}
-		}()
 		return true
 	})
+	for name := range dependencies {
+		service, _ := r.Get(name)
+		for _, dependency := range DependenciesOf(service) {
+			if _, ok := dependencies[dependency]; ok {
+				dependencies[name] = append(dependencies[name], dependency)
+			}
+		}
+	}
+
+	order := make([]ServiceName, 0, len(dependencies))
+	placed := make(map[ServiceName]bool, len(dependencies))
+	for len(order) < len(dependencies) {
+		// Each pass places the services whose dependencies are all placed
+		var next []ServiceName
+		for name, deps := range dependencies {
+			if placed[name] {
+				continue
+			}
+			if !slices.ContainsFunc(deps, func(dep ServiceName) bool { return !placed[dep] }) {
+				next = append(next, name)
+			}
+		}
+		if len(next) == 0 {
+			var stuck []string
+			for name := range dependencies {
+				if !placed[name] {
+					stuck = append(stuck, string(name))
+				}
+			}
+			slices.Sort(stuck)
+			return nil, fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(stuck, ", "))
+		}
+		slices.Sort(next)
+		for _, name := range next {
+			placed[name] = true
+		}
+		order = append(order, next...)
+	}
+	return order, nil
+}
+
+// StartAll starts the enabled services in dependency order, waiting for each
+// to be ready before starting the next
+func (r *Registry) StartAll() error {
+	order, err := r.Order()
+	if err != nil {
+		return err
+	}
+	for _, name := range order {
+		supervisor, _ := r.Supervisor(name)
+		err := supervisor.Start()
+		if err != nil {
+			slog.Warn("service failed to start", "service", name, "error", err)
+			continue
+		}
+		err = r.waitReady(name, supervisor.service)
+		if err != nil {
+			slog.Warn("service is not ready, starting the services after it anyway", "service", name, "error", err)
+		}
+	}
+	return nil
 }
 
+// StopAll stops the services in the reverse of the order they start in, so
+// none is left running without what it depends on
 func (r *Registry) StopAll() error {
-	errGrp := errgroup.Group{}
-	r.services.Range(func(_ string, service Service) bool {
-		errGrp.Go(func() error {
-			return service.Stop()
+	order, err := r.Order()
+	if err != nil {
+		// Still stop everything, just without the ordering
+		slog.Warn("stopping services in no particular order", "error", err)
+		order = nil
+		r.supervisors.Range(func(name string, _ *Supervisor) bool {
+			order = append(order, ServiceName(name))
+			return true
 		})
-		return true
-	})
-	return errGrp.Wait()
+	}
+
+	var errs []error
+	for _, name := range slices.Backward(order) {
+		supervisor, _ := r.Supervisor(name)
+		errs = append(errs, supervisor.Stop())
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Registry) waitReady(name ServiceName, service Service) error {
+	probe, ok := service.(ReadinessProbe)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ReadyTimeout)
+	defer cancel()
+	ticker := time.NewTicker(ReadyPollInterval)
+	defer ticker.Stop()
+	for {
+		err := probe.Ready(ctx)
+		if err == nil {
+			slog.Debug("service is ready", "service", name)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// DependenciesOf returns the services the service depends on, if it
+// declares any
+func DependenciesOf(service Service) []ServiceName {
+	dependent, ok := service.(Dependent)
+	if !ok {
+		return nil
+	}
+	return dependent.Dependencies()
 }
@@ -0,0 +1,86 @@
+package services_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/services"
+)
+
+// dependentService declares dependencies, and is never started
+type dependentService struct {
+	disabled     bool
+	dependencies []services.ServiceName
+}
+
+func (s *dependentService) Start() error    { return nil }
+func (s *dependentService) Stop() error     { return nil }
+func (s *dependentService) Reload() error   { return nil }
+func (s *dependentService) IsRunning() bool { return false }
+func (s *dependentService) IsEnabled() bool { return !s.disabled }
+func (s *dependentService) Dependencies() []services.ServiceName {
+	return s.dependencies
+}
+
+func TestRegistryOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		services map[services.ServiceName]*dependentService
+		want     []services.ServiceName
+		wantErr  error
+	}{
+		{
+			name: "dependencies first",
+			services: map[services.ServiceName]*dependentService{
+				services.DNSMasqServiceName:  {dependencies: []services.ServiceName{services.OLSRServiceName, services.MeshLinkServiceName}},
+				services.MeshLinkServiceName: {dependencies: []services.ServiceName{services.BabelServiceName}},
+				services.LQMServiceName:      {dependencies: []services.ServiceName{services.BabelServiceName}},
+				services.BabelServiceName:    {},
+				services.OLSRServiceName:     {},
+			},
+			want: []services.ServiceName{
+				services.BabelServiceName,
+				services.OLSRServiceName,
+				services.LQMServiceName,
+				services.MeshLinkServiceName,
+				services.DNSMasqServiceName,
+			},
+		},
+		{
+			name: "missing and disabled dependencies are skipped",
+			services: map[services.ServiceName]*dependentService{
+				services.DNSMasqServiceName: {dependencies: []services.ServiceName{services.OLSRServiceName, services.MeshLinkServiceName}},
+				services.OLSRServiceName:    {disabled: true},
+			},
+			want: []services.ServiceName{services.DNSMasqServiceName},
+		},
+		{
+			name: "cycle",
+			services: map[services.ServiceName]*dependentService{
+				services.BabelServiceName:    {dependencies: []services.ServiceName{services.MeshLinkServiceName}},
+				services.MeshLinkServiceName: {dependencies: []services.ServiceName{services.BabelServiceName}},
+				services.OLSRServiceName:     {},
+			},
+			wantErr: services.ErrDependencyCycle,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			registry := services.NewServiceRegistry()
+			for name, service := range tt.services {
+				registry.Register(name, service)
+			}
+			got, err := registry.Order()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Order() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Order() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package services
 
+import "context"
+
 type Service interface {
 	// Start starts the service
 	Start() error
@@ -16,3 +18,17 @@ type Service interface {
 	// IsEnabled returns true if the service is enabled
 	IsEnabled() bool
 }
+
+// Dependent is a Service that needs other services to be ready before it
+// starts, and to stop before they do. Dependencies that aren't registered or
+// are disabled are skipped.
+type Dependent interface {
+	Dependencies() []ServiceName
+}
+
+// ReadinessProbe is a Service that can tell when it is ready for the
+// services that depend on it. A service without one is ready once started.
+type ReadinessProbe interface {
+	// Ready returns an error until the service is ready
+	Ready(ctx context.Context) error
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var (
+	ErrServiceDisabled = errors.New("service is disabled")
+	ErrServiceStopping = errors.New("service is still stopping")
+)
+
+// State is where a supervised service is in its lifecycle
+type State string
+
+const (
+	// StateStarting is a service that hasn't yet stayed up for StartupGrace
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	// StateDegraded is a service that exited on its own and is waiting to
+	// be restarted, or one that is up but reports it isn't running
+	StateDegraded State = "degraded"
+	StateStopped  State = "stopped"
+)
+
+const (
+	// StartupGrace is how long a service must stay up to count as running
+	StartupGrace = 5 * time.Second
+	// RestartBackoffBase is the wait before restarting a service that
+	// exited, doubling with each exit in a row up to RestartBackoffMax
+	RestartBackoffBase = time.Second
+	RestartBackoffMax  = time.Minute
+	// StableAfter is how long a service must run before exiting no longer
+	// counts towards its backoff
+	StableAfter = 5 * time.Minute
+	// StopTimeout is how long Stop waits for the service's Start to return
+	StopTimeout = 30 * time.Second
+)
+
+// RestartBackoff is how long to wait before restarting a service that has
+// exited the given number of times in a row
+func RestartBackoff(exits uint) time.Duration {
+	backoff := RestartBackoffBase
+	for i := uint(1); i < exits && backoff < RestartBackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, RestartBackoffMax)
+}
+
+// Status is a snapshot of a supervised service
+type Status struct {
+	Name    ServiceName `json:"name"`
+	Enabled bool        `json:"enabled"`
+	State   State       `json:"state"`
+	// Running is what the service itself reports
+	Running   bool          `json:"running"`
+	DependsOn []ServiceName `json:"depends_on"`
+	// Restarts counts the times the service exited on its own
+	Restarts      uint       `json:"restarts"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	NextRestartAt *time.Time `json:"next_restart_at,omitempty"`
+}
+
+// Supervisor runs a service, restarting it with backoff whenever it exits
+// until it is stopped. A service's Start is expected to block while it runs.
+type Supervisor struct {
+	name    ServiceName
+	service Service
+
+	mu            sync.Mutex
+	state         State
+	restarts      uint
+	exitsInARow   uint
+	lastError     string
+	lastErrorAt   time.Time
+	startedAt     time.Time
+	nextRestartAt time.Time
+	// stop is closed to end the current run. It is nil while stopped.
+	stop chan struct{}
+	// done is closed once the last run's goroutine has returned
+	done chan struct{}
+}
+
+func NewSupervisor(name ServiceName, service Service) *Supervisor {
+	return &Supervisor{
+		name:    name,
+		service: service,
+		state:   StateStopped,
+	}
+}
+
+// Start starts supervising the service. It does nothing if the service is
+// already supervised, and fails if the last run's Start hasn't returned.
+func (s *Supervisor) Start() error {
+	if !s.service.IsEnabled() {
+		return fmt.Errorf("%w: %s", ErrServiceDisabled, s.name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return nil
+	}
+	if s.done != nil {
+		select {
+		case <-s.done:
+		default:
+			return fmt.Errorf("%w: %s", ErrServiceStopping, s.name)
+		}
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	s.exitsInARow = 0
+	s.state = StateStarting
+	s.startedAt = time.Now()
+	go s.supervise(s.stop, s.done)
+	return nil
+}
+
+// Stop stops the service and its supervision. It waits up to StopTimeout for
+// the service's Start to return, since the service can't be started again
+// until it has.
+func (s *Supervisor) Stop() error {
+	s.mu.Lock()
+	if s.stop == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	close(s.stop)
+	s.stop = nil
+	done := s.done
+	s.state = StateStopped
+	s.nextRestartAt = time.Time{}
+	s.mu.Unlock()
+
+	slog.Info("Stopping service", "service", s.name)
+	err := s.service.Stop()
+	if err != nil {
+		s.recordError(err)
+		return fmt.Errorf("failed to stop %s: %w", s.name, err)
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(StopTimeout):
+		err = fmt.Errorf("%w: %s did not exit within %v", ErrServiceStopping, s.name, StopTimeout)
+		s.recordError(err)
+		return err
+	}
+}
+
+func (s *Supervisor) Reload() error {
+	err := s.service.Reload()
+	if err != nil {
+		s.recordError(err)
+		return fmt.Errorf("failed to reload %s: %w", s.name, err)
+	}
+	return nil
+}
+
+func (s *Supervisor) Status() Status {
+	running := s.service.IsRunning()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := Status{
+		Name:      s.name,
+		Enabled:   s.service.IsEnabled(),
+		State:     s.state,
+		Running:   running,
+		DependsOn: DependenciesOf(s.service),
+		Restarts:  s.restarts,
+	}
+	if status.DependsOn == nil {
+		status.DependsOn = []ServiceName{}
+	}
+	if s.state == StateRunning && !running {
+		status.State = StateDegraded
+	}
+	// Copy the times so the status doesn't share them with the supervisor
+	lastErrorAt, startedAt, nextRestartAt := s.lastErrorAt, s.startedAt, s.nextRestartAt
+	if s.lastError != "" {
+		status.LastError = s.lastError
+		status.LastErrorAt = &lastErrorAt
+	}
+	if s.state != StateStopped {
+		status.StartedAt = &startedAt
+	}
+	if !nextRestartAt.IsZero() {
+		status.NextRestartAt = &nextRestartAt
+	}
+	return status
+}
+
+// supervise runs the service until stop is closed, then waits for the
+// service's Start to return and closes done
+func (s *Supervisor) supervise(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		startedAt := time.Now()
+		s.update(stop, func() {
+			s.state = StateStarting
+			s.startedAt = startedAt
+			s.nextRestartAt = time.Time{}
+		})
+		slog.Info("Starting service", "service", s.name)
+
+		exited := make(chan error, 1)
+		go func() {
+			exited <- s.service.Start()
+		}()
+
+		var err error
+		select {
+		case <-stop:
+			<-exited
+			return
+		case err = <-exited:
+		case <-time.After(StartupGrace):
+			s.update(stop, func() {
+				s.state = StateRunning
+			})
+			select {
+			case <-stop:
+				<-exited
+				return
+			case err = <-exited:
+			}
+		}
+
+		// A service may exit because it was stopped while we waited on it
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if err == nil {
+			err = errors.New("service exited")
+		}
+		var backoff time.Duration
+		s.update(stop, func() {
+			if time.Since(startedAt) >= StableAfter {
+				s.exitsInARow = 0
+			}
+			s.exitsInARow++
+			s.restarts++
+			s.lastError = err.Error()
+			s.lastErrorAt = time.Now()
+			backoff = RestartBackoff(s.exitsInARow)
+			s.nextRestartAt = time.Now().Add(backoff)
+			s.state = StateDegraded
+		})
+		slog.Warn("Service exited, restarting", "service", s.name, "error", err, "backoff", backoff)
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// update applies fn unless the run that stop belongs to has been stopped
+func (s *Supervisor) update(stop chan struct{}, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != stop {
+		return
+	}
+	fn()
+}
+
+func (s *Supervisor) recordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = err.Error()
+	s.lastErrorAt = time.Now()
+}
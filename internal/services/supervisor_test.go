@@ -0,0 +1,200 @@
+package services_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/services"
+)
+
+func TestRestartBackoff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		exits uint
+		want  time.Duration
+	}{
+		{exits: 1, want: time.Second},
+		{exits: 2, want: 2 * time.Second},
+		{exits: 6, want: 32 * time.Second},
+		{exits: 7, want: time.Minute},
+		{exits: 1000, want: time.Minute},
+	}
+	for _, tt := range tests {
+		got := services.RestartBackoff(tt.exits)
+		if got != tt.want {
+			t.Errorf("RestartBackoff(%d) = %v, want %v", tt.exits, got, tt.want)
+		}
+	}
+}
+
+// crashingService exits as soon as it is started
+type crashingService struct {
+	starts  atomic.Int32
+	enabled bool
+}
+
+func (s *crashingService) Start() error {
+	s.starts.Add(1)
+	return errors.New("exit status 1")
+}
+
+func (s *crashingService) Stop() error     { return nil }
+func (s *crashingService) Reload() error   { return nil }
+func (s *crashingService) IsRunning() bool { return false }
+func (s *crashingService) IsEnabled() bool { return s.enabled }
+
+func TestSupervisorRestartsCrashedService(t *testing.T) {
+	t.Parallel()
+
+	service := &crashingService{enabled: true}
+	supervisor := services.NewSupervisor("test", service)
+	err := supervisor.Start()
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for supervisor.Status().Restarts == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("service was not seen to exit")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := supervisor.Status()
+	if status.State != services.StateDegraded {
+		t.Errorf("State = %q, want %q", status.State, services.StateDegraded)
+	}
+	if status.LastError != "exit status 1" {
+		t.Errorf("LastError = %q, want %q", status.LastError, "exit status 1")
+	}
+	if status.NextRestartAt == nil {
+		t.Error("NextRestartAt is unset while waiting to restart")
+	}
+
+	err = supervisor.Stop()
+	if err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	status = supervisor.Status()
+	if status.State != services.StateStopped || status.NextRestartAt != nil {
+		t.Errorf("Status() after Stop = %+v, want stopped with no restart pending", status)
+	}
+	if starts := service.starts.Load(); starts != 1 {
+		t.Errorf("service started %d times within the first backoff, want 1", starts)
+	}
+}
+
+func TestSupervisorDisabledService(t *testing.T) {
+	t.Parallel()
+
+	supervisor := services.NewSupervisor("test", &crashingService{})
+	err := supervisor.Start()
+	if !errors.Is(err, services.ErrServiceDisabled) {
+		t.Errorf("Start() error = %v, want %v", err, services.ErrServiceDisabled)
+	}
+	if state := supervisor.Status().State; state != services.StateStopped {
+		t.Errorf("State = %q, want %q", state, services.StateStopped)
+	}
+}
+
+// blockingService runs from Start until release is closed, counting the
+// Starts in flight
+type blockingService struct {
+	running    atomic.Int32
+	maxRunning atomic.Int32
+	started    chan struct{}
+	release    chan struct{}
+}
+
+func newBlockingService() *blockingService {
+	return &blockingService{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (s *blockingService) Start() error {
+	running := s.running.Add(1)
+	defer s.running.Add(-1)
+	for {
+		highest := s.maxRunning.Load()
+		if running <= highest || s.maxRunning.CompareAndSwap(highest, running) {
+			break
+		}
+	}
+	s.started <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func (s *blockingService) Stop() error     { return nil }
+func (s *blockingService) Reload() error   { return nil }
+func (s *blockingService) IsRunning() bool { return s.running.Load() > 0 }
+func (s *blockingService) IsEnabled() bool { return true }
+
+func waitStarted(t *testing.T, service *blockingService) {
+	t.Helper()
+	select {
+	case <-service.started:
+	case <-time.After(time.Second):
+		t.Fatal("service was not started")
+	}
+}
+
+func TestSupervisorStopWaitsForStart(t *testing.T) {
+	t.Parallel()
+
+	service := newBlockingService()
+	supervisor := services.NewSupervisor("test", service)
+	err := supervisor.Start()
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	waitStarted(t, service)
+
+	// The service takes a while to exit after being told to stop
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- supervisor.Stop()
+	}()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Stop() returned %v before the service exited", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// It can't be started again until it has
+	err = supervisor.Start()
+	if !errors.Is(err, services.ErrServiceStopping) {
+		t.Errorf("Start() while stopping error = %v, want %v", err, services.ErrServiceStopping)
+	}
+
+	close(service.release)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("Stop() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Stop() did not return once the service exited")
+	}
+	if running := service.running.Load(); running != 0 {
+		t.Errorf("%d Starts still running after Stop", running)
+	}
+
+	service.release = make(chan struct{})
+	err = supervisor.Start()
+	if err != nil {
+		t.Fatalf("Start() after Stop error = %v", err)
+	}
+	waitStarted(t, service)
+	close(service.release)
+	err = supervisor.Stop()
+	if err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if highest := service.maxRunning.Load(); highest != 1 {
+		t.Errorf("service ran %d times at once, want 1", highest)
+	}
+}
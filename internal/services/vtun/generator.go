@@ -0,0 +1,235 @@
+package vtun
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	ServerConfigPath = "/etc/vtund/server.conf"
+	ClientConfigDir  = "/etc/vtund/clients"
+	// MTU leaves room for vtun's TCP framing
+	MTU = 1450
+)
+
+var (
+	ErrInvalidPassword    = errors.New("vtun password must not contain spaces, quotes, or semicolons")
+	ErrInvalidSessionName = errors.New("vtun session name must not contain spaces, quotes, or semicolons")
+)
+
+// configMetachars would let a value break out of its place in a vtund config
+const configMetachars = " \t\r\n\"';{}#\\"
+
+const (
+	snippetOptions = `# This file is generated by the Mesh Manager
+# Do not edit this file directly
+options {
+  port ${PORT};
+  timeout 60;
+  syslog daemon;
+  ip /sbin/ip;
+}
+`
+
+	snippetServerDefault = `
+default {
+  type tun;
+  proto tcp;
+  compress no;
+  encrypt no;
+  stat no;
+  keepalive yes;
+  multi killold;
+}
+`
+
+	snippetSession = `
+${SESSION} {
+  passwd ${PASSWORD};
+  device ${IFACE};
+  persist ${PERSIST};
+  up {
+    ip "addr add ${LOCAL_IP} peer ${REMOTE_IP} dev %%";
+    ip "link set %% mtu ${MTU} up";
+  };
+}
+`
+)
+
+// InterfaceName is the tun device vtund gives a tunnel. ifacewatcher picks
+// up tunnels by the tun prefix.
+func InterfaceName(tunnel models.Tunnel) string {
+	if tunnel.Client {
+		return fmt.Sprintf("tunc%d", tunnel.ID)
+	}
+	return fmt.Sprintf("tuns%d", tunnel.ID)
+}
+
+// SessionName is the name both ends know a tunnel by, which is the client
+// node's name and the tunnel network, as AREDN names them
+func SessionName(cfg *config.Config, tunnel models.Tunnel) string {
+	node := tunnel.Hostname
+	if tunnel.Client {
+		node = cfg.ServerName
+	}
+	return strings.ToUpper(node) + "-" + strings.ReplaceAll(tunnel.IP, ".", "-")
+}
+
+// ServerAddress splits a client tunnel's hostname into the server's host
+// and port, defaulting to the standard vtun port
+func ServerAddress(cfg *config.Config, tunnel models.Tunnel) (string, uint16) {
+	host, portStr, err := net.SplitHostPort(tunnel.Hostname)
+	if err != nil {
+		return tunnel.Hostname, cfg.VTun.Port
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil || port == 0 {
+		return host, cfg.VTun.Port
+	}
+	return host, uint16(port)
+}
+
+// ValidatePassword checks that password is safe to write into a config
+func ValidatePassword(password string) error {
+	if password == "" || strings.ContainsAny(password, configMetachars) {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// ValidateSessionName checks that the tunnel's session name is safe to
+// write into a config
+func ValidateSessionName(cfg *config.Config, tunnel models.Tunnel) error {
+	if strings.ContainsAny(SessionName(cfg, tunnel), configMetachars) {
+		return ErrInvalidSessionName
+	}
+	return nil
+}
+
+// ClientConfigPath is where a client tunnel's config is written
+func ClientConfigPath(tunnel models.Tunnel) string {
+	return filepath.Join(ClientConfigDir, strconv.FormatUint(uint64(tunnel.ID), 10)+".conf")
+}
+
+// GenerateServer builds the vtund server config, with a session for each
+// enabled server tunnel. The server end of a tunnel takes the first host
+// address of its /30, and the client the second.
+func GenerateServer(cfg *config.Config, tunnels []models.Tunnel) string {
+	ret := options(cfg.VTun.Port)
+	ret += snippetServerDefault
+	for _, tunnel := range tunnels {
+		if tunnel.Wireguard || tunnel.Client || !tunnel.Enabled {
+			continue
+		}
+		ret += session(cfg, tunnel, 1, 2, "no")
+	}
+	return ret
+}
+
+// GenerateClient builds the vtund config for a client tunnel
+func GenerateClient(cfg *config.Config, tunnel models.Tunnel) string {
+	_, port := ServerAddress(cfg, tunnel)
+	return options(port) + session(cfg, tunnel, 2, 1, "yes")
+}
+
+// GenerateAndSave writes the server config and a config for each enabled
+// client tunnel, removing configs for clients that are gone
+func GenerateAndSave(cfg *config.Config, db *gorm.DB) error {
+	tunnels, err := models.ListVTunTunnels(db)
+	if err != nil {
+		return fmt.Errorf("failed to list vtun tunnels: %w", err)
+	}
+
+	err = os.MkdirAll(ClientConfigDir, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create vtun config directory: %w", err)
+	}
+
+	// The configs hold tunnel passwords
+	err = os.WriteFile(ServerConfigPath, []byte(GenerateServer(cfg, tunnels)), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write vtun server config: %w", err)
+	}
+
+	wanted := make(map[string]struct{})
+	for _, tunnel := range tunnels {
+		if !tunnel.Client || !tunnel.Enabled {
+			continue
+		}
+		path := ClientConfigPath(tunnel)
+		wanted[path] = struct{}{}
+		err = os.WriteFile(path, []byte(GenerateClient(cfg, tunnel)), 0600)
+		if err != nil {
+			return fmt.Errorf("failed to write vtun client config: %w", err)
+		}
+	}
+
+	existing, err := filepath.Glob(filepath.Join(ClientConfigDir, "*.conf"))
+	if err != nil {
+		return fmt.Errorf("failed to list vtun client configs: %w", err)
+	}
+	for _, path := range existing {
+		if _, ok := wanted[path]; ok {
+			continue
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return fmt.Errorf("failed to remove vtun client config: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func options(port uint16) string {
+	ret := snippetOptions
+	utils.ShellReplace(&ret, map[string]string{"PORT": strconv.FormatUint(uint64(port), 10)})
+	return ret
+}
+
+// session builds a session for the tunnel, with the local and remote ends
+// at the given offsets into the tunnel's /30. A tunnel whose session name
+// would break the config is left out.
+func session(cfg *config.Config, tunnel models.Tunnel, local, remote int, persist string) string {
+	if err := ValidateSessionName(cfg, tunnel); err != nil {
+		slog.Warn("Skipping vtun tunnel", "tunnel", tunnel.ID, "error", err)
+		return ""
+	}
+	network, err := netip.ParseAddr(tunnel.IP)
+	if err != nil {
+		return ""
+	}
+	ret := snippetSession
+	utils.ShellReplace(
+		&ret,
+		map[string]string{
+			"SESSION":   SessionName(cfg, tunnel),
+			"PASSWORD":  tunnel.Password,
+			"IFACE":     InterfaceName(tunnel),
+			"PERSIST":   persist,
+			"LOCAL_IP":  offset(network, local).String(),
+			"REMOTE_IP": offset(network, remote).String(),
+			"MTU":       strconv.Itoa(MTU),
+		},
+	)
+	return ret
+}
+
+func offset(addr netip.Addr, n int) netip.Addr {
+	for range n {
+		addr = addr.Next()
+	}
+	return addr
+}
@@ -0,0 +1,93 @@
+package vtun_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/vtun"
+)
+
+func TestGenerateServer(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{ServerName: "KI5VMF-HUB", VTun: config.VTun{Port: 5525}}
+	tunnels := []models.Tunnel{
+		{ID: 1, Hostname: "N0CALL-NODE", IP: "172.31.0.4", Password: "secret", Enabled: true},
+		{ID: 2, Hostname: "N0CALL-OFF", IP: "172.31.0.8", Password: "secret", Enabled: false},
+		{ID: 3, Hostname: "vtun.example.com", IP: "172.31.0.12", Password: "secret", Enabled: true, Client: true},
+		{ID: 4, Hostname: "N0CALL-WG", IP: "172.31.0.16", Enabled: true, Wireguard: true},
+		{ID: 5, Hostname: "N0CALL;X", IP: "172.31.0.20", Password: "secret", Enabled: true},
+	}
+	conf := vtun.GenerateServer(cfg, tunnels)
+
+	for _, want := range []string{
+		"port 5525;",
+		"N0CALL-NODE-172-31-0-4 {",
+		"device tuns1;",
+		`ip "addr add 172.31.0.5 peer 172.31.0.6 dev %%";`,
+	} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("GenerateServer() is missing %q:\n%s", want, conf)
+		}
+	}
+	for _, unwanted := range []string{"N0CALL-OFF", "tunc3", "N0CALL-WG", "N0CALL;X", "tuns5"} {
+		if strings.Contains(conf, unwanted) {
+			t.Errorf("GenerateServer() has %q:\n%s", unwanted, conf)
+		}
+	}
+}
+
+func TestGenerateClient(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{ServerName: "ki5vmf-hub", VTun: config.VTun{Port: 5525}}
+	tunnel := models.Tunnel{ID: 3, Hostname: "vtun.example.com:6000", IP: "172.31.0.12", Password: "secret", Enabled: true, Client: true}
+	conf := vtun.GenerateClient(cfg, tunnel)
+
+	for _, want := range []string{
+		"port 6000;",
+		"KI5VMF-HUB-172-31-0-12 {",
+		"device tunc3;",
+		`ip "addr add 172.31.0.14 peer 172.31.0.13 dev %%";`,
+	} {
+		if !strings.Contains(conf, want) {
+			t.Errorf("GenerateClient() is missing %q:\n%s", want, conf)
+		}
+	}
+
+	host, port := vtun.ServerAddress(cfg, models.Tunnel{Hostname: "10.1.2.3"})
+	if host != "10.1.2.3" || port != 5525 {
+		t.Errorf("ServerAddress() = %s, %d, want 10.1.2.3, 5525", host, port)
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	t.Parallel()
+
+	for _, password := range []string{"", "two words", `quo"te`, "semi;colon", "brace}"} {
+		if err := vtun.ValidatePassword(password); !errors.Is(err, vtun.ErrInvalidPassword) {
+			t.Errorf("ValidatePassword(%q) error = %v, want %v", password, err, vtun.ErrInvalidPassword)
+		}
+	}
+	if err := vtun.ValidatePassword("Hunter2!"); err != nil {
+		t.Errorf("ValidatePassword() error = %v", err)
+	}
+}
+
+func TestValidateSessionName(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{ServerName: "KI5VMF-HUB"}
+	for _, hostname := range []string{"N0CALL;X", `N0CALL"`, "N0 CALL", "N0CALL{"} {
+		tunnel := models.Tunnel{Hostname: hostname, IP: "172.31.0.4"}
+		if err := vtun.ValidateSessionName(cfg, tunnel); !errors.Is(err, vtun.ErrInvalidSessionName) {
+			t.Errorf("ValidateSessionName(%q) error = %v, want %v", hostname, err, vtun.ErrInvalidSessionName)
+		}
+	}
+	if err := vtun.ValidateSessionName(cfg, models.Tunnel{Hostname: "N0CALL-NODE", IP: "172.31.0.4"}); err != nil {
+		t.Errorf("ValidateSessionName() error = %v", err)
+	}
+}
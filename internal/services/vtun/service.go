@@ -0,0 +1,185 @@
+package vtun
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/runner"
+	"gorm.io/gorm"
+)
+
+// clientRestartDelay is how long to wait before redialing a client tunnel
+// whose vtund exited
+const clientRestartDelay = 10 * time.Second
+
+// Service runs the vtund server for server tunnels and a vtund per client
+// tunnel. The configs are written by GenerateAndSave before Start and
+// Reload.
+type Service struct {
+	config *config.Config
+	db     *gorm.DB
+
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	server  *exec.Cmd
+	clients map[uint]*client
+}
+
+type client struct {
+	tunnel models.Tunnel
+	cancel context.CancelFunc
+}
+
+func NewService(config *config.Config, db *gorm.DB) *Service {
+	return &Service{
+		config:  config,
+		db:      db,
+		clients: make(map[uint]*client),
+	}
+}
+
+// Start runs the vtund server and the client tunnels until the server exits
+// or Stop is called
+func (s *Service) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.mu.Lock()
+	s.ctx = ctx
+	s.cancel = cancel
+	s.server = exec.CommandContext(ctx, "vtund", "-s", "-n", "-f", ServerConfigPath)
+	results, err := runner.Run(s.server)
+	if err != nil {
+		s.server = nil
+		s.mu.Unlock()
+		return fmt.Errorf("failed to start vtund server: %w", err)
+	}
+	err = s.syncClients()
+	s.mu.Unlock()
+	if err != nil {
+		slog.Error("Error starting vtun clients", "error", err)
+	}
+
+	err = <-results
+
+	s.mu.Lock()
+	s.stopClients()
+	s.server = nil
+	s.ctx = nil
+	s.cancel = nil
+	s.mu.Unlock()
+	return err
+}
+
+// Stop stops the server and every client tunnel. Canceling their context
+// has runner send them SIGTERM.
+func (s *Service) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return nil
+}
+
+// Reload has the server read its config again and starts or stops client
+// tunnels to match the database. If vtund isn't running, it reads the new
+// configs when it starts.
+func (s *Service) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.server == nil || s.server.Process == nil {
+		return nil
+	}
+	err := s.server.Process.Signal(syscall.SIGHUP)
+	if err != nil {
+		return fmt.Errorf("failed to reload vtund server: %w", err)
+	}
+	return s.syncClients()
+}
+
+func (s *Service) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.server != nil && s.server.Process != nil
+}
+
+func (s *Service) IsEnabled() bool {
+	return s.config.VTun.Enabled
+}
+
+// syncClients runs a vtund for each enabled client tunnel, restarting any
+// whose settings changed. s.mu must be held.
+func (s *Service) syncClients() error {
+	tunnels, err := models.ListVTunTunnels(s.db)
+	if err != nil {
+		return fmt.Errorf("failed to list vtun tunnels: %w", err)
+	}
+
+	wanted := make(map[uint]models.Tunnel)
+	for _, tunnel := range tunnels {
+		if tunnel.Client && tunnel.Enabled {
+			wanted[tunnel.ID] = tunnel
+		}
+	}
+
+	for id, running := range s.clients {
+		tunnel, ok := wanted[id]
+		if ok && tunnel.Hostname == running.tunnel.Hostname &&
+			tunnel.IP == running.tunnel.IP && tunnel.Password == running.tunnel.Password {
+			delete(wanted, id)
+			continue
+		}
+		running.cancel()
+		delete(s.clients, id)
+	}
+
+	for id, tunnel := range wanted {
+		ctx, cancel := context.WithCancel(s.ctx)
+		s.clients[id] = &client{tunnel: tunnel, cancel: cancel}
+		go s.superviseClient(ctx, tunnel)
+	}
+	return nil
+}
+
+// stopClients stops every client tunnel. s.mu must be held.
+func (s *Service) stopClients() {
+	for id, running := range s.clients {
+		running.cancel()
+		delete(s.clients, id)
+	}
+}
+
+// superviseClient keeps a client tunnel's vtund running until ctx is done.
+// vtund persists on its own through dropped connections, so this only has
+// to cover it exiting.
+func (s *Service) superviseClient(ctx context.Context, tunnel models.Tunnel) {
+	host, port := ServerAddress(s.config, tunnel)
+	for {
+		cmd := exec.CommandContext(ctx, "vtund", "-n", "-f", ClientConfigPath(tunnel),
+			"-P", strconv.FormatUint(uint64(port), 10), SessionName(s.config, tunnel), host)
+		results, err := runner.Run(cmd)
+		if err == nil {
+			err = <-results
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("vtun client exited, restarting", "tunnel", tunnel.Hostname, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(clientRestartDelay):
+		}
+	}
+}
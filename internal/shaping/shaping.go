@@ -0,0 +1,228 @@
+// Package shaping rate limits traffic on tunnel interfaces with tc.
+// Egress is shaped with a token bucket qdisc and ingress is policed,
+// since the kernel can't queue traffic it has already received.
+package shaping
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"syscall"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// Burst defaults to 100ms of traffic at the configured rate
+	defaultBurstDivisor = 10
+	minBurstBytes       = 1600
+	// Queue up to 50ms of traffic before dropping
+	latencyDivisor = 20
+)
+
+// Limits are rates in kilobits per second. A zero rate is unlimited.
+type Limits struct {
+	EgressKbps  uint32
+	IngressKbps uint32
+	// BurstKB is how far traffic may burst above the rate.
+	// Zero picks a default from the rate.
+	BurstKB uint32
+}
+
+func (l Limits) IsZero() bool {
+	return l.EgressKbps == 0 && l.IngressKbps == 0
+}
+
+// ForTunnel returns the limits a tunnel's interface should have. The quota
+// throttle caps the configured limits while it applies.
+func ForTunnel(tunnel models.Tunnel, action models.QuotaPolicy) Limits {
+	limits := Limits{
+		EgressKbps:  tunnel.RateLimit.EgressKbps,
+		IngressKbps: tunnel.RateLimit.IngressKbps,
+		BurstKB:     tunnel.RateLimit.BurstKB,
+	}
+	if action == models.QuotaPolicyThrottle && tunnel.QuotaThrottleKbps > 0 {
+		limits.EgressKbps = capRate(limits.EgressKbps, tunnel.QuotaThrottleKbps)
+		limits.IngressKbps = capRate(limits.IngressKbps, tunnel.QuotaThrottleKbps)
+	}
+	return limits
+}
+
+// Apply replaces any limits on the interface with the given ones
+func Apply(iface string, limits Limits) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return fmt.Errorf("failed to find interface %s: %w", iface, err)
+	}
+	index := link.Attrs().Index
+
+	if limits.EgressKbps > 0 {
+		rate := bytesPerSecond(limits.EgressKbps)
+		burst := limits.burstBytes(rate)
+		err = netlink.QdiscReplace(&netlink.Tbf{
+			QdiscAttrs: rootQdiscAttrs(index),
+			Rate:       rate,
+			Buffer:     netlink.Xmittime(rate, burst),
+			Limit:      clamp(uint64(burst) + rate/latencyDivisor),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to shape egress on %s: %w", iface, err)
+		}
+	} else if err := deleteQdisc(&netlink.Tbf{QdiscAttrs: rootQdiscAttrs(index)}); err != nil {
+		return fmt.Errorf("failed to remove egress shaping on %s: %w", iface, err)
+	}
+
+	if limits.IngressKbps > 0 {
+		if err := addIngressQdisc(index); err != nil {
+			return fmt.Errorf("failed to add ingress qdisc on %s: %w", iface, err)
+		}
+
+		rate := bytesPerSecond(limits.IngressKbps)
+		police := netlink.NewPoliceAction()
+		police.Rate = clamp(rate)
+		police.Burst = limits.burstBytes(rate)
+		police.ExceedAction = netlink.TC_POLICE_SHOT
+		err = netlink.FilterReplace(&netlink.MatchAll{
+			FilterAttrs: netlink.FilterAttrs{
+				LinkIndex: index,
+				Parent:    netlink.HANDLE_INGRESS,
+				Priority:  1,
+				Protocol:  syscall.ETH_P_ALL,
+			},
+			Actions: []netlink.Action{police},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to police ingress on %s: %w", iface, err)
+		}
+	} else if err := deleteQdisc(&netlink.Ingress{QdiscAttrs: ingressQdiscAttrs(index)}); err != nil {
+		return fmt.Errorf("failed to remove ingress policing on %s: %w", iface, err)
+	}
+
+	return nil
+}
+
+// Clear removes all limits from the interface. Interfaces that no longer
+// exist are ignored, since their limits went with them.
+func Clear(iface string) error {
+	err := Apply(iface, Limits{})
+	var notFound netlink.LinkNotFoundError
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	return err
+}
+
+// Status reads the limits in effect on the interface and how many packets
+// they have dropped
+func Status(iface string) (models.TunnelShaping, error) {
+	var status models.TunnelShaping
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return status, fmt.Errorf("failed to find interface %s: %w", iface, err)
+	}
+
+	qdiscs, err := netlink.QdiscList(link)
+	if err != nil {
+		return status, fmt.Errorf("failed to list qdiscs on %s: %w", iface, err)
+	}
+	for _, qdisc := range qdiscs {
+		tbf, ok := qdisc.(*netlink.Tbf)
+		if !ok || tbf.Parent != netlink.HANDLE_ROOT {
+			continue
+		}
+		status.EgressKbps = kbps(tbf.Rate)
+		if tbf.Statistics != nil && tbf.Statistics.Queue != nil {
+			status.EgressDrops = uint64(tbf.Statistics.Queue.Drops)
+		}
+	}
+
+	filters, err := netlink.FilterList(link, netlink.HANDLE_INGRESS)
+	if err != nil {
+		return status, fmt.Errorf("failed to list ingress filters on %s: %w", iface, err)
+	}
+	for _, filter := range filters {
+		matchAll, ok := filter.(*netlink.MatchAll)
+		if !ok {
+			continue
+		}
+		for _, action := range matchAll.Actions {
+			police, ok := action.(*netlink.PoliceAction)
+			if !ok {
+				continue
+			}
+			status.IngressKbps = kbps(uint64(police.Rate))
+			if police.Statistics != nil && police.Statistics.Queue != nil {
+				status.IngressDrops = uint64(police.Statistics.Queue.Drops)
+			}
+		}
+	}
+
+	return status, nil
+}
+
+func rootQdiscAttrs(index int) netlink.QdiscAttrs {
+	return netlink.QdiscAttrs{
+		LinkIndex: index,
+		Handle:    netlink.MakeHandle(1, 0),
+		Parent:    netlink.HANDLE_ROOT,
+	}
+}
+
+func ingressQdiscAttrs(index int) netlink.QdiscAttrs {
+	return netlink.QdiscAttrs{
+		LinkIndex: index,
+		Handle:    netlink.MakeHandle(0xffff, 0),
+		Parent:    netlink.HANDLE_INGRESS,
+	}
+}
+
+// addIngressQdisc adds the ingress qdisc if the interface doesn't have one.
+// The ingress qdisc can't be changed, so replacing an existing one fails.
+func addIngressQdisc(index int) error {
+	err := netlink.QdiscAdd(&netlink.Ingress{QdiscAttrs: ingressQdiscAttrs(index)})
+	if errors.Is(err, syscall.EEXIST) {
+		return nil
+	}
+	return err
+}
+
+// deleteQdisc removes a qdisc, ignoring the errors the kernel returns
+// when there is nothing to remove
+func deleteQdisc(qdisc netlink.Qdisc) error {
+	err := netlink.QdiscDel(qdisc)
+	if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.EINVAL) {
+		return nil
+	}
+	return err
+}
+
+func bytesPerSecond(kbps uint32) uint64 {
+	const bitsPerByte = 8
+	return uint64(kbps) * 1000 / bitsPerByte
+}
+
+func kbps(bytesPerSecond uint64) uint32 {
+	const bitsPerByte = 8
+	return uint32(bytesPerSecond * bitsPerByte / 1000) //nolint:gosec // rates are set from a uint32
+}
+
+// capRate returns the lower of two rates, where zero is unlimited
+func capRate(rate, ceiling uint32) uint32 {
+	if rate == 0 {
+		return ceiling
+	}
+	return min(rate, ceiling)
+}
+
+func (l Limits) burstBytes(rate uint64) uint32 {
+	if l.BurstKB > 0 {
+		return clamp(uint64(l.BurstKB) * 1024)
+	}
+	return clamp(max(rate/defaultBurstDivisor, minBurstBytes))
+}
+
+// clamp fits n into the 32 bits tc takes sizes and rates in
+func clamp(n uint64) uint32 {
+	return uint32(min(n, math.MaxUint32)) //nolint:gosec // n is at most math.MaxUint32
+}
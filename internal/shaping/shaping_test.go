@@ -0,0 +1,129 @@
+package shaping_test
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/shaping"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+func TestForTunnel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		tunnel models.Tunnel
+		action models.QuotaPolicy
+		want   shaping.Limits
+	}{
+		{
+			name:   "no limits",
+			tunnel: models.Tunnel{},
+			want:   shaping.Limits{},
+		},
+		{
+			name:   "rate limit",
+			tunnel: models.Tunnel{RateLimit: models.TunnelRateLimit{EgressKbps: 5000, BurstKB: 64}},
+			want:   shaping.Limits{EgressKbps: 5000, BurstKB: 64},
+		},
+		{
+			name:   "throttle without rate limit",
+			tunnel: models.Tunnel{QuotaThrottleKbps: 256},
+			action: models.QuotaPolicyThrottle,
+			want:   shaping.Limits{EgressKbps: 256, IngressKbps: 256},
+		},
+		{
+			name: "throttle caps rate limit",
+			tunnel: models.Tunnel{
+				RateLimit:         models.TunnelRateLimit{EgressKbps: 5000, IngressKbps: 128},
+				QuotaThrottleKbps: 256,
+			},
+			action: models.QuotaPolicyThrottle,
+			want:   shaping.Limits{EgressKbps: 256, IngressKbps: 128},
+		},
+		{
+			name: "throttle not applied",
+			tunnel: models.Tunnel{
+				RateLimit:         models.TunnelRateLimit{EgressKbps: 5000},
+				QuotaThrottleKbps: 256,
+			},
+			action: models.QuotaPolicyWarn,
+			want:   shaping.Limits{EgressKbps: 5000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := shaping.ForTunnel(tt.tunnel, tt.action); got != tt.want {
+				t.Errorf("ForTunnel() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTwice(t *testing.T) {
+	// Network namespaces belong to threads, so this can't run in parallel
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		t.Skipf("network namespaces unavailable: %v", err)
+	}
+	defer origin.Close()
+	ns, err := netns.New()
+	if err != nil {
+		t.Skipf("failed to create network namespace: %v", err)
+	}
+	defer func() {
+		if err := netns.Set(origin); err != nil {
+			t.Errorf("failed to restore network namespace: %v", err)
+		}
+		ns.Close()
+	}()
+
+	const iface = "shape0"
+	link := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: iface}, PeerName: iface + "p"}
+	if err := netlink.LinkAdd(link); err != nil {
+		t.Skipf("failed to add veth interface: %v", err)
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		t.Fatalf("failed to bring up %s: %v", iface, err)
+	}
+
+	for i, limits := range []shaping.Limits{
+		{EgressKbps: 1000, IngressKbps: 1000},
+		{EgressKbps: 2000, IngressKbps: 4000},
+	} {
+		err := shaping.Apply(iface, limits)
+		if i == 0 && errors.Is(err, syscall.ENOENT) {
+			t.Skipf("kernel lacks tc support: %v", err)
+		}
+		if err != nil {
+			t.Fatalf("Apply(%+v) error = %v", limits, err)
+		}
+		status, err := shaping.Status(iface)
+		if err != nil {
+			t.Fatalf("Status() error = %v", err)
+		}
+		if status.EgressKbps != limits.EgressKbps || status.IngressKbps != limits.IngressKbps {
+			t.Errorf("Status() = %+v, want %+v", status, limits)
+		}
+	}
+
+	if err := shaping.Clear(iface); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	status, err := shaping.Status(iface)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.EgressKbps != 0 || status.IngressKbps != 0 {
+		t.Errorf("Status() after Clear() = %+v, want no limits", status)
+	}
+}
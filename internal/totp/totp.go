@@ -0,0 +1,149 @@
+// Package totp implements RFC 6238 time-based one-time passwords, as used by
+// common authenticator apps (SHA-1, 6 digits, 30 second steps).
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // RFC 6238 and authenticator apps use SHA-1
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is the length of a single time step
+	Period = 30 * time.Second
+	// Digits is the number of digits in a code
+	Digits = 6
+	// Skew is the number of steps either side of the current one that are
+	// accepted, to allow for clock drift between the server and the device
+	Skew = 1
+
+	secretBytes = 20
+)
+
+var (
+	ErrInvalidSecret = errors.New("invalid TOTP secret")
+	ErrNoRandom      = errors.New("no random source available")
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a new random base32-encoded secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", ErrNoRandom
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Step returns the time step containing t
+func Step(t time.Time) int64 {
+	return t.Unix() / int64(Period/time.Second)
+}
+
+// Code returns the code for the given secret at time t
+func Code(secret string, t time.Time) (string, error) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return code(key, Step(t)), nil
+}
+
+// Validate checks code against the secret at time now, allowing for Skew.
+// It returns the matched time step so callers can reject a code that is
+// replayed within the window. Steps at or before lastStep are not accepted.
+func Validate(secret, input string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := decodeSecret(secret)
+	if err != nil {
+		return 0, false
+	}
+	input = strings.TrimSpace(input)
+	if len(input) != Digits {
+		return 0, false
+	}
+
+	current := Step(now)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(code(key, step)), []byte(input)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// URI returns an otpauth:// URI suitable for rendering as a QR code
+func URI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period/time.Second)))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+func decodeSecret(secret string) ([]byte, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
+
+func code(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step)) //nolint:gosec // steps are never negative
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, RFC 4226 section 5.3
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	const modulo = 1000000
+	return fmt.Sprintf("%0*d", Digits, value%modulo)
+}
+
+const recoveryCodeBytes = 10
+
+// GenerateRecoveryCodes returns n single-use codes that can stand in for a
+// TOTP code if the user loses their device
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for range n {
+		b := make([]byte, recoveryCodeBytes)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, ErrNoRandom
+		}
+		c := strings.ToLower(encoding.EncodeToString(b))
+		codes = append(codes, c[:8]+"-"+c[8:])
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode canonicalizes user input so that codes can be typed
+// without the dash or in either case
+func NormalizeRecoveryCode(input string) string {
+	input = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(input), "-", ""))
+	if len(input) <= 8 {
+		return input
+	}
+	return input[:8] + "-" + input[8:]
+}
@@ -0,0 +1,71 @@
+package totp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
+	"github.com/USA-RedDragon/mesh-manager/internal/totp"
+)
+
+// base32 of the RFC 6238 SHA-1 test key "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	t.Parallel()
+	// The RFC lists 8 digit codes, these are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := totp.Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("Code(%d) error = %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	clk := clock.NewFake(time.Unix(1111111111, 0))
+	code, err := totp.Code(rfcSecret, clk.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := totp.Validate(rfcSecret, code, clk.Now(), 0)
+	if !ok {
+		t.Fatal("expected current code to validate")
+	}
+	if step != totp.Step(clk.Now()) {
+		t.Errorf("step = %d, want %d", step, totp.Step(clk.Now()))
+	}
+
+	if _, ok := totp.Validate(rfcSecret, code, clk.Now(), step); ok {
+		t.Error("expected replayed code to be rejected")
+	}
+
+	clk.Advance(totp.Period)
+	if _, ok := totp.Validate(rfcSecret, code, clk.Now(), 0); !ok {
+		t.Error("expected code from the previous step to be accepted")
+	}
+
+	clk.Advance(totp.Period)
+	if _, ok := totp.Validate(rfcSecret, code, clk.Now(), 0); ok {
+		t.Error("expected code from two steps ago to be rejected")
+	}
+
+	if _, ok := totp.Validate("not base32!", code, clk.Now(), 0); ok {
+		t.Error("expected invalid secret to be rejected")
+	}
+}
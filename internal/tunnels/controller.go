@@ -0,0 +1,200 @@
+// Package tunnels applies changes to tunnels that happen outside of an API
+// request, keeping WireGuard and the routing daemons in step with the database.
+package tunnels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/services"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/babel"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/olsr"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/vtun"
+	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrServiceNotFound = errors.New("service not found")
+	ErrNotBabelService = errors.New("babel service has an unexpected type")
+	ErrNotWireguard    = errors.New("tunnel is not a WireGuard tunnel")
+)
+
+type Controller struct {
+	config           *config.Config
+	db               *gorm.DB
+	registry         *services.Registry
+	wireguardManager *wireguard.Manager
+}
+
+func NewController(config *config.Config, db *gorm.DB, registry *services.Registry, wireguardManager *wireguard.Manager) *Controller {
+	return &Controller{
+		config:           config,
+		db:               db,
+		registry:         registry,
+		wireguardManager: wireguardManager,
+	}
+}
+
+// InterfaceName is the interface a tunnel comes up on, whether it runs over
+// WireGuard or vtun
+func InterfaceName(tunnel models.Tunnel) string {
+	if !tunnel.Wireguard {
+		return vtun.InterfaceName(tunnel)
+	}
+	return wireguard.GenerateWireguardInterfaceName(tunnel)
+}
+
+// Tunnels lists the tunnels this node runs, including vtun tunnels when vtun
+// is enabled
+func (c *Controller) Tunnels() ([]models.Tunnel, error) {
+	tunnels, err := models.ListWireguardTunnels(c.db)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.VTun.Enabled {
+		vtunTunnels, err := models.ListVTunTunnels(c.db)
+		if err != nil {
+			return nil, err
+		}
+		tunnels = append(tunnels, vtunTunnels...)
+	}
+	return tunnels, nil
+}
+
+// SetEnabled saves the tunnel's Enabled flag and brings its interface up or
+// down. Callers should call Regenerate once they are done changing tunnels.
+func (c *Controller) SetEnabled(ctx context.Context, tunnel models.Tunnel, enabled bool) error {
+	err := c.db.Model(&tunnel).Update("enabled", enabled).Error
+	if err != nil {
+		return fmt.Errorf("failed to update tunnel: %w", err)
+	}
+	tunnel.Enabled = enabled
+
+	iface := InterfaceName(tunnel)
+	switch {
+	case !tunnel.Wireguard:
+		// vtun tunnels come up or down when Regenerate reloads vtund
+	case enabled:
+		err = c.wireguardManager.AddPeer(tunnel)
+		if err != nil {
+			return fmt.Errorf("failed to add wireguard peer: %w", err)
+		}
+	default:
+		err = c.wireguardManager.RemovePeer(tunnel)
+		if err != nil {
+			return fmt.Errorf("failed to remove wireguard peer: %w", err)
+		}
+	}
+
+	if c.config.Babel.Enabled {
+		babelService, err := c.babelService()
+		if err != nil {
+			return err
+		}
+		if enabled {
+			err = babelService.AddTunnel(ctx, iface)
+		} else {
+			err = babelService.RemoveTunnel(ctx, iface)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update babel tunnel: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Recreate tears down a WireGuard tunnel's interface and brings it back up,
+// handing the new interface to babeld. The tunnel's config is unchanged.
+func (c *Controller) Recreate(ctx context.Context, tunnel models.Tunnel) error {
+	if !tunnel.Wireguard {
+		return ErrNotWireguard
+	}
+
+	err := c.wireguardManager.RemovePeer(tunnel)
+	if err != nil {
+		return fmt.Errorf("failed to remove wireguard peer: %w", err)
+	}
+	err = c.wireguardManager.AddPeer(tunnel)
+	if err != nil {
+		return fmt.Errorf("failed to add wireguard peer: %w", err)
+	}
+
+	if c.config.Babel.Enabled {
+		babelService, err := c.babelService()
+		if err != nil {
+			return err
+		}
+		err = babelService.AddTunnel(ctx, InterfaceName(tunnel))
+		if err != nil {
+			return fmt.Errorf("failed to update babel tunnel: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Regenerate rewrites the olsrd, babel, and vtund configs from the database
+// and reloads the services that read them
+func (c *Controller) Regenerate() error {
+	if c.config.VTun.Enabled {
+		err := vtun.GenerateAndSave(c.config, c.db)
+		if err != nil {
+			return fmt.Errorf("failed to generate vtund config: %w", err)
+		}
+		err = c.reload(services.VTunServiceName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.config.OLSR {
+		err := olsr.GenerateAndSave(c.config, c.db)
+		if err != nil {
+			return fmt.Errorf("failed to generate olsrd config: %w", err)
+		}
+		err = c.reload(services.OLSRServiceName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.config.Babel.Enabled {
+		// Running tunnels are updated over the babel socket, this keeps
+		// the config in step for the next time babeld starts
+		err := babel.GenerateAndSave(c.config, c.db)
+		if err != nil {
+			return fmt.Errorf("failed to generate babel config: %w", err)
+		}
+	}
+
+	return c.reload(services.DNSMasqServiceName)
+}
+
+func (c *Controller) reload(name services.ServiceName) error {
+	service, ok := c.registry.Get(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrServiceNotFound, name)
+	}
+	err := service.Reload()
+	if err != nil {
+		return fmt.Errorf("failed to reload %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *Controller) babelService() (*babel.Service, error) {
+	service, ok := c.registry.Get(services.BabelServiceName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrServiceNotFound, services.BabelServiceName)
+	}
+	babelService, ok := service.(*babel.Service)
+	if !ok {
+		return nil, ErrNotBabelService
+	}
+	return babelService, nil
+}
@@ -0,0 +1,251 @@
+package tunnels
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/events"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"github.com/USA-RedDragon/mesh-manager/internal/shaping"
+	"gorm.io/gorm"
+)
+
+// QuotaInterval is how often tunnel quotas are checked
+const QuotaInterval = 10 * time.Second
+
+// QuotaEnforcer rolls over quota periods, sends events as tunnels cross
+// their quota thresholds, and applies each tunnel's policy once it is over.
+// A tunnel that an operator re-enables while over quota is left alone until
+// the next period.
+type QuotaEnforcer struct {
+	mu            sync.Mutex
+	db            *gorm.DB
+	clock         clock.Clock
+	controller    *Controller
+	eventsChannel chan events.Event
+	// throttled holds the limits applied to each interface, so they are only
+	// applied again when the interface is recreated
+	throttled map[string]shaping.Limits
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+func NewQuotaEnforcer(db *gorm.DB, clk clock.Clock, controller *Controller, eventsChannel chan events.Event) *QuotaEnforcer {
+	return &QuotaEnforcer{
+		db:            db,
+		clock:         clk,
+		controller:    controller,
+		eventsChannel: eventsChannel,
+		throttled:     make(map[string]shaping.Limits),
+	}
+}
+
+func (q *QuotaEnforcer) Start() error {
+	if q.cancel != nil {
+		return fmt.Errorf("quota enforcer already running")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	q.done = make(chan struct{})
+
+	go func() {
+		defer close(q.done)
+		ticker := time.NewTicker(QuotaInterval)
+		defer ticker.Stop()
+		for {
+			err := q.Enforce(ctx)
+			if err != nil {
+				slog.Error("Tunnel quota enforcer failed", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+func (q *QuotaEnforcer) Stop() error {
+	if q.cancel == nil {
+		return nil
+	}
+	q.cancel()
+	<-q.done
+	q.cancel = nil
+	return nil
+}
+
+// Enforce checks every tunnel's quotas and applies or lifts its policy
+func (q *QuotaEnforcer) Enforce(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	tunnels, err := q.controller.Tunnels()
+	if err != nil {
+		return fmt.Errorf("failed to list tunnels: %w", err)
+	}
+
+	now := q.clock.Now()
+	changed := false
+	for _, tunnel := range tunnels {
+		if !tunnel.HasQuota() && tunnel.QuotaAction == "" {
+			continue
+		}
+		regenerate, err := q.enforce(ctx, tunnel, now)
+		if err != nil {
+			slog.Error("Failed to enforce tunnel quota", "tunnel", tunnel.Hostname, "error", err)
+		}
+		changed = changed || regenerate
+	}
+
+	if !changed {
+		return nil
+	}
+	return q.controller.Regenerate()
+}
+
+// enforce brings one tunnel in line with its quotas and returns true if its
+// Enabled flag changed
+func (q *QuotaEnforcer) enforce(ctx context.Context, tunnel models.Tunnel, now time.Time) (bool, error) {
+	updates := make(map[string]interface{})
+	q.check(&tunnel, &tunnel.DailyQuota, models.QuotaPeriodDaily, models.DailyPeriodStart(now), updates)
+	q.check(&tunnel, &tunnel.MonthlyQuota, models.QuotaPeriodMonthly, models.MonthlyPeriodStart(now, tunnel.QuotaResetDay), updates)
+
+	var action models.QuotaPolicy
+	if tunnel.QuotaExceeded() && tunnel.QuotaPolicy != models.QuotaPolicyWarn {
+		action = tunnel.QuotaPolicy
+	}
+
+	// The action is only saved once applied, so failures are retried
+	regenerate, err := q.apply(ctx, tunnel, action, now)
+	if err == nil && action != tunnel.QuotaAction {
+		updates["quota_action"] = action
+	}
+
+	if len(updates) > 0 {
+		updateErr := q.db.Model(&tunnel).Updates(updates).Error
+		if updateErr != nil {
+			return regenerate, fmt.Errorf("failed to update tunnel: %w", updateErr)
+		}
+	}
+	return regenerate, err
+}
+
+// apply moves the tunnel from its current quota action to the given one
+// and returns true if its Enabled flag changed
+func (q *QuotaEnforcer) apply(ctx context.Context, tunnel models.Tunnel, action models.QuotaPolicy, now time.Time) (bool, error) {
+	regenerate := false
+	if action != tunnel.QuotaAction {
+		slog.Info("Tunnel quota action changed", "tunnel", tunnel.Hostname, "from", tunnel.QuotaAction, "to", action)
+		if tunnel.QuotaDisabled() && !tunnel.Enabled && tunnel.ScheduledEnabled(now) {
+			err := q.controller.SetEnabled(ctx, tunnel, true)
+			if err != nil {
+				return false, err
+			}
+			tunnel.Enabled = true
+			regenerate = true
+		}
+		if action == models.QuotaPolicyDisable && tunnel.Enabled {
+			err := q.controller.SetEnabled(ctx, tunnel, false)
+			if err != nil {
+				return regenerate, err
+			}
+			regenerate = true
+		}
+	}
+
+	return regenerate, q.throttle(tunnel, action)
+}
+
+// check rolls the quota into the current period and sends an event if it
+// crossed a threshold, adding any changed columns to updates
+func (q *QuotaEnforcer) check(tunnel *models.Tunnel, quota *models.TunnelQuota, period models.QuotaPeriod, start time.Time, updates map[string]interface{}) {
+	prefix := string(period) + "_quota_"
+	if quota.Roll(start) {
+		updates[prefix+"used_bytes"] = quota.UsedBytes
+		updates[prefix+"period_start"] = quota.PeriodStart
+		updates[prefix+"notified"] = quota.Notified
+	}
+
+	threshold, ok := quota.Notify()
+	if !ok {
+		return
+	}
+	updates[prefix+"notified"] = quota.Notified
+	if threshold == 0 {
+		return
+	}
+
+	policy := tunnel.QuotaPolicy
+	if policy == "" {
+		policy = models.QuotaPolicyWarn
+	}
+	slog.Info("Tunnel crossed quota threshold", "tunnel", tunnel.Hostname, "period", period, "threshold", threshold)
+	// This runs with q.mu held, so it mustn't wait on a slow consumer. If
+	// the channel is full, websocket listeners miss the event.
+	select {
+	case q.eventsChannel <- events.Event{
+		Type: events.EventTypeTunnelQuota,
+		Data: apimodels.WebsocketTunnelQuota{
+			ID:         tunnel.ID,
+			Hostname:   tunnel.Hostname,
+			Period:     period,
+			Threshold:  threshold,
+			UsedBytes:  quota.UsedBytes,
+			LimitBytes: quota.LimitBytes(),
+			Policy:     policy,
+		},
+	}:
+	default:
+		slog.Warn("Events channel is full, not broadcasting quota event", "tunnel", tunnel.Hostname, "period", period, "threshold", threshold)
+	}
+}
+
+// throttle shapes the tunnel's interface while the throttle policy applies
+// and puts back its configured rate limit otherwise
+func (q *QuotaEnforcer) throttle(tunnel models.Tunnel, action models.QuotaPolicy) error {
+	iface := InterfaceName(tunnel)
+	applied, ok := q.throttled[iface]
+
+	// Shaping goes away with the interface, so apply it again once it's back
+	if !tunnel.Active {
+		delete(q.throttled, iface)
+		return nil
+	}
+
+	limits := shaping.ForTunnel(tunnel, action)
+	if action != models.QuotaPolicyThrottle {
+		// Throttles applied before a restart aren't in the map
+		if !ok && tunnel.QuotaAction != models.QuotaPolicyThrottle {
+			return nil
+		}
+		delete(q.throttled, iface)
+		var err error
+		if limits.IsZero() {
+			err = shaping.Clear(iface)
+		} else {
+			err = shaping.Apply(iface, limits)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to clear throttle: %w", err)
+		}
+		return nil
+	}
+
+	if ok && applied == limits {
+		return nil
+	}
+	err := shaping.Apply(iface, limits)
+	if err != nil {
+		return fmt.Errorf("failed to throttle: %w", err)
+	}
+	q.throttled[iface] = limits
+	return nil
+}
@@ -0,0 +1,207 @@
+package tunnels
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/babel"
+	"github.com/USA-RedDragon/mesh-manager/internal/services/lqm"
+)
+
+// RemediationInterval is how often down tunnels are checked
+const RemediationInterval = 30 * time.Second
+
+// PeerProbe reports whether a tunnel's peer can be reached over the rest of
+// the mesh, without going through the tunnel itself
+type PeerProbe interface {
+	Reachable(ctx context.Context, tunnel models.Tunnel) (bool, error)
+}
+
+// MeshProbe finds a peer's mesh address in the trackers LQM saved while the
+// tunnel was up, and counts the peer as reachable if babel has a route to it
+type MeshProbe struct{}
+
+func (MeshProbe) Reachable(ctx context.Context, tunnel models.Tunnel) (bool, error) {
+	trackers, err := lqm.ReadTrackers()
+	if err != nil {
+		return false, fmt.Errorf("failed to read LQM trackers: %w", err)
+	}
+	tracker := lqm.TrackerForTunnel(tunnel, trackers)
+	if tracker == nil || tracker.CanonicalIP == "" {
+		return false, nil
+	}
+	routes, err := babel.FetchInstalledRouteMetrics(ctx)
+	if err != nil {
+		return false, err
+	}
+	_, ok := routes[tracker.CanonicalIP+"/32"]
+	return ok, nil
+}
+
+// TunnelRecreator lists the tunnels to watch and recreates them. Controller
+// is one.
+type TunnelRecreator interface {
+	Tunnels() ([]models.Tunnel, error)
+	Recreate(ctx context.Context, tunnel models.Tunnel) error
+}
+
+// RemediationBackoff is how long to wait after a tunnel's nth attempt before
+// trying again. It doubles from base with each attempt, up to limit.
+func RemediationBackoff(attempt int, base, limit time.Duration) time.Duration {
+	backoff := base
+	for i := 1; i < attempt && backoff < limit; i++ {
+		backoff *= 2
+	}
+	return min(backoff, limit)
+}
+
+// remediationState is what the Remediator remembers about a down tunnel
+type remediationState struct {
+	downSince   time.Time
+	attempts    int
+	nextAttempt time.Time
+}
+
+// Remediator recreates enabled WireGuard tunnels that ifacewatcher has had
+// down for a while even though their peer is reachable over the mesh, which
+// is usually a stale interface rather than a peer that is gone. Attempts on
+// the same tunnel back off so a flapping peer isn't torn down over and over,
+// and stop after Remediation.MaxAttempts until the tunnel comes back up.
+type Remediator struct {
+	mu         sync.Mutex
+	clock      clock.Clock
+	config     *config.Config
+	controller TunnelRecreator
+	probe      PeerProbe
+	states     map[uint]*remediationState
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func NewRemediator(config *config.Config, clk clock.Clock, controller TunnelRecreator, probe PeerProbe) *Remediator {
+	return &Remediator{
+		clock:      clk,
+		config:     config,
+		controller: controller,
+		probe:      probe,
+		states:     make(map[uint]*remediationState),
+	}
+}
+
+func (r *Remediator) Start() error {
+	if r.cancel != nil {
+		return fmt.Errorf("remediator already running")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(RemediationInterval)
+		defer ticker.Stop()
+		for {
+			err := r.Check(ctx)
+			if err != nil {
+				slog.Error("Tunnel remediator failed", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Remediator) Stop() error {
+	if r.cancel == nil {
+		return nil
+	}
+	r.cancel()
+	<-r.done
+	r.cancel = nil
+	return nil
+}
+
+// Check recreates each tunnel that has been down past the threshold, is due
+// another attempt, and has a reachable peer
+func (r *Remediator) Check(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tunnels, err := r.controller.Tunnels()
+	if err != nil {
+		return fmt.Errorf("failed to list tunnels: %w", err)
+	}
+
+	threshold := time.Duration(r.config.Remediation.DownThreshold) * time.Minute
+	limit := max(time.Duration(r.config.Remediation.MaxBackoff)*time.Minute, threshold)
+	now := r.clock.Now()
+	seen := make(map[uint]struct{}, len(tunnels))
+	for _, tunnel := range tunnels {
+		// vtund already restarts clients that exit and redials lost
+		// connections, so there's no interface to recreate
+		if !tunnel.Enabled || !tunnel.Wireguard {
+			continue
+		}
+		seen[tunnel.ID] = struct{}{}
+
+		state, ok := r.states[tunnel.ID]
+		if tunnel.Active {
+			if ok && state.attempts > 0 {
+				slog.Info("Tunnel recovered after remediation", "tunnel", tunnel.Hostname, "attempts", state.attempts, "down_for", now.Sub(state.downSince))
+			}
+			delete(r.states, tunnel.ID)
+			continue
+		}
+		if !ok {
+			state = &remediationState{downSince: now, nextAttempt: now.Add(threshold)}
+			r.states[tunnel.ID] = state
+		}
+		if now.Before(state.nextAttempt) || r.gaveUp(state) {
+			continue
+		}
+
+		reachable, err := r.probe.Reachable(ctx, tunnel)
+		if err != nil {
+			slog.Warn("Could not tell if tunnel peer is reachable", "tunnel", tunnel.Hostname, "error", err)
+			continue
+		}
+		if !reachable {
+			continue
+		}
+
+		state.attempts++
+		backoff := RemediationBackoff(state.attempts, threshold, limit)
+		state.nextAttempt = now.Add(backoff)
+		slog.Warn("Recreating tunnel whose peer is reachable over the mesh", "tunnel", tunnel.Hostname, "interface", InterfaceName(tunnel), "down_for", now.Sub(state.downSince), "attempt", state.attempts, "next_attempt_in", backoff)
+		err = r.controller.Recreate(ctx, tunnel)
+		if err != nil {
+			slog.Error("Failed to recreate tunnel", "tunnel", tunnel.Hostname, "attempt", state.attempts, "error", err)
+		}
+		if r.gaveUp(state) {
+			slog.Warn("Giving up on tunnel until it comes back up", "tunnel", tunnel.Hostname, "attempts", state.attempts, "down_for", now.Sub(state.downSince))
+		}
+	}
+
+	for id := range r.states {
+		if _, ok := seen[id]; !ok {
+			delete(r.states, id)
+		}
+	}
+	return nil
+}
+
+// gaveUp returns true once a tunnel has had all of its attempts
+func (r *Remediator) gaveUp(state *remediationState) bool {
+	limit := r.config.Remediation.MaxAttempts
+	return limit > 0 && state.attempts >= int(limit) //nolint:gosec // MaxAttempts is a handful
+}
@@ -0,0 +1,175 @@
+package tunnels_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/tunnels"
+)
+
+func TestRemediationBackoff(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		attempt int
+		want    time.Duration
+	}{
+		{name: "first attempt", attempt: 1, want: 5 * time.Minute},
+		{name: "second attempt", attempt: 2, want: 10 * time.Minute},
+		{name: "fourth attempt", attempt: 4, want: 40 * time.Minute},
+		{name: "capped", attempt: 5, want: time.Hour},
+		{name: "long after the cap", attempt: 100, want: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got := tunnels.RemediationBackoff(tt.attempt, 5*time.Minute, time.Hour)
+			if got != tt.want {
+				t.Errorf("RemediationBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeController serves a fixed set of tunnels and counts recreations
+type fakeController struct {
+	tunnels    []models.Tunnel
+	recreated  map[uint]int
+	recreateAt []time.Time
+	clock      *clock.Fake
+}
+
+func (c *fakeController) Tunnels() ([]models.Tunnel, error) {
+	return c.tunnels, nil
+}
+
+func (c *fakeController) Recreate(_ context.Context, tunnel models.Tunnel) error {
+	c.recreated[tunnel.ID]++
+	c.recreateAt = append(c.recreateAt, c.clock.Now())
+	return nil
+}
+
+// fakeProbe reports whether each tunnel's peer is reachable
+type fakeProbe map[uint]bool
+
+func (p fakeProbe) Reachable(_ context.Context, tunnel models.Tunnel) (bool, error) {
+	return p[tunnel.ID], nil
+}
+
+func newRemediator(maxAttempts uint, tunnel models.Tunnel, probe fakeProbe) (*tunnels.Remediator, *fakeController, *clock.Fake) {
+	clk := clock.NewFake(time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC))
+	cfg := &config.Config{Remediation: config.Remediation{DownThreshold: 5, MaxBackoff: 60, MaxAttempts: maxAttempts}}
+	controller := &fakeController{tunnels: []models.Tunnel{tunnel}, recreated: make(map[uint]int), clock: clk}
+	return tunnels.NewRemediator(cfg, clk, controller, probe), controller, clk
+}
+
+// checkEvery runs Check each RemediationInterval for d
+func checkEvery(t *testing.T, r *tunnels.Remediator, clk *clock.Fake, d time.Duration) {
+	t.Helper()
+	for end := clk.Now().Add(d); !clk.Now().After(end); clk.Advance(tunnels.RemediationInterval) {
+		err := r.Check(context.Background())
+		if err != nil {
+			t.Fatalf("Check() error = %v", err)
+		}
+	}
+}
+
+func TestRemediatorBacksOff(t *testing.T) {
+	t.Parallel()
+	// The watcher marks a tunnel inactive once its handshake goes stale
+	down := models.Tunnel{ID: 1, Hostname: "KI5VMF-A", Enabled: true, Wireguard: true}
+	r, controller, clk := newRemediator(0, down, fakeProbe{1: true})
+	start := clk.Now()
+
+	checkEvery(t, r, clk, 3*time.Hour)
+
+	// Down 5 minutes, then waits of 5, 10, 20, and 40 minutes, capped at 60
+	want := []time.Duration{5, 10, 20, 40, 80, 140}
+	if len(controller.recreateAt) != len(want) {
+		t.Fatalf("recreated at %v, want %d attempts", controller.recreateAt, len(want))
+	}
+	for i, minutes := range want {
+		if got := controller.recreateAt[i].Sub(start); got != minutes*time.Minute {
+			t.Errorf("attempt %d after %v, want %v", i+1, got, minutes*time.Minute)
+		}
+	}
+}
+
+func TestRemediatorLeavesTunnels(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		tunnel models.Tunnel
+		probe  fakeProbe
+	}{
+		{"up", models.Tunnel{ID: 1, Enabled: true, Wireguard: true, Active: true}, fakeProbe{1: true}},
+		{"peer unreachable", models.Tunnel{ID: 1, Enabled: true, Wireguard: true}, fakeProbe{}},
+		{"disabled", models.Tunnel{ID: 1, Wireguard: true}, fakeProbe{1: true}},
+		{"vtun", models.Tunnel{ID: 1, Enabled: true}, fakeProbe{1: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			r, controller, clk := newRemediator(0, tt.tunnel, tt.probe)
+			checkEvery(t, r, clk, time.Hour)
+			if n := controller.recreated[1]; n != 0 {
+				t.Errorf("recreated %d times, want 0", n)
+			}
+		})
+	}
+}
+
+func TestRemediatorGivesUp(t *testing.T) {
+	t.Parallel()
+	down := models.Tunnel{ID: 1, Enabled: true, Wireguard: true}
+	r, controller, clk := newRemediator(3, down, fakeProbe{1: true})
+
+	checkEvery(t, r, clk, 24*time.Hour)
+	if n := controller.recreated[1]; n != 3 {
+		t.Fatalf("recreated %d times, want 3", n)
+	}
+
+	// Coming back up starts the tunnel over with all of its attempts
+	controller.tunnels[0].Active = true
+	checkEvery(t, r, clk, time.Minute)
+	controller.tunnels[0].Active = false
+	checkEvery(t, r, clk, 4*time.Minute)
+	if n := controller.recreated[1]; n != 3 {
+		t.Errorf("recreated %d times within the threshold of going down again, want 3", n)
+	}
+	checkEvery(t, r, clk, 24*time.Hour)
+	if n := controller.recreated[1]; n != 6 {
+		t.Errorf("recreated %d times after going down again, want 6", n)
+	}
+}
+
+func TestRemediatorResetsWhenPeerReturns(t *testing.T) {
+	t.Parallel()
+	down := models.Tunnel{ID: 1, Enabled: true, Wireguard: true}
+	r, controller, clk := newRemediator(0, down, fakeProbe{1: true})
+
+	// Two attempts, leaving a 10 minute wait for the third
+	checkEvery(t, r, clk, 10*time.Minute)
+	if n := controller.recreated[1]; n != 2 {
+		t.Fatalf("recreated %d times, want 2", n)
+	}
+
+	// Once it has been up, the backoff starts over from the threshold
+	controller.tunnels[0].Active = true
+	checkEvery(t, r, clk, time.Minute)
+	controller.tunnels[0].Active = false
+	downAt := clk.Now()
+	checkEvery(t, r, clk, 6*time.Minute)
+	if n := controller.recreated[1]; n != 3 {
+		t.Fatalf("recreated %d times, want 3", n)
+	}
+	if got := controller.recreateAt[2].Sub(downAt); got != 5*time.Minute {
+		t.Errorf("attempt after going down again came after %v, want %v", got, 5*time.Minute)
+	}
+}
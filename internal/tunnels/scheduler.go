@@ -0,0 +1,110 @@
+package tunnels
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
+	"gorm.io/gorm"
+)
+
+// SchedulerInterval is how often tunnel expiry and schedules are checked,
+// and so the most a transition can lag behind its scheduled time
+const SchedulerInterval = 30 * time.Second
+
+// Scheduler enables and disables tunnels according to their ExpiresAt and
+// Schedule fields. It works from the desired state rather than counting on
+// being awake at each transition, so it catches up after a restart.
+type Scheduler struct {
+	mu         sync.Mutex
+	db         *gorm.DB
+	clock      clock.Clock
+	controller *Controller
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func NewScheduler(db *gorm.DB, clk clock.Clock, controller *Controller) *Scheduler {
+	return &Scheduler{
+		db:         db,
+		clock:      clk,
+		controller: controller,
+	}
+}
+
+func (s *Scheduler) Start() error {
+	if s.cancel != nil {
+		return fmt.Errorf("scheduler already running")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(SchedulerInterval)
+		defer ticker.Stop()
+		for {
+			err := s.Reconcile(ctx)
+			if err != nil {
+				slog.Error("Tunnel scheduler failed", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *Scheduler) Stop() error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	<-s.done
+	s.cancel = nil
+	return nil
+}
+
+// Reconcile brings every scheduled tunnel's Enabled flag in line with its
+// expiry and schedule
+func (s *Scheduler) Reconcile(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tunnels, err := s.controller.Tunnels()
+	if err != nil {
+		return fmt.Errorf("failed to list tunnels: %w", err)
+	}
+
+	now := s.clock.Now()
+	changed := false
+	for _, tunnel := range tunnels {
+		if !tunnel.IsScheduled() {
+			continue
+		}
+		// Don't bring back a tunnel that is over its quota
+		enabled := tunnel.ScheduledEnabled(now) && !tunnel.QuotaDisabled()
+		if enabled == tunnel.Enabled {
+			continue
+		}
+
+		slog.Info("Tunnel schedule transition", "tunnel", tunnel.Hostname, "enabled", enabled)
+		err := s.controller.SetEnabled(ctx, tunnel, enabled)
+		if err != nil {
+			slog.Error("Failed to apply tunnel schedule", "tunnel", tunnel.Hostname, "error", err)
+		}
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return s.controller.Regenerate()
+}
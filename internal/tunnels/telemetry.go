@@ -0,0 +1,229 @@
+package tunnels
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/clock"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/events"
+	"github.com/USA-RedDragon/mesh-manager/internal/metrics"
+	"github.com/USA-RedDragon/mesh-manager/internal/server/api/apimodels"
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"gorm.io/gorm"
+)
+
+// TelemetryInterval is how often WireGuard peers are polled
+const TelemetryInterval = 10 * time.Second
+
+// PeerTelemetry is what a poll learns about a tunnel's peer
+type PeerTelemetry struct {
+	// LastHandshake is zero if the peer hasn't completed one
+	LastHandshake time.Time
+	// Endpoint is empty until the peer has been heard from
+	Endpoint  string
+	Keepalive time.Duration
+}
+
+// ObservePeer picks the peer with the latest handshake, since a server
+// tunnel has a second peer for the old key during a key rotation grace
+// window. It returns false if the device has no peers.
+func ObservePeer(peers []wgtypes.Peer) (PeerTelemetry, bool) {
+	if len(peers) == 0 {
+		return PeerTelemetry{}, false
+	}
+	latest := peers[0]
+	for _, peer := range peers[1:] {
+		if peer.LastHandshakeTime.After(latest.LastHandshakeTime) {
+			latest = peer
+		}
+	}
+	telemetry := PeerTelemetry{
+		LastHandshake: latest.LastHandshakeTime,
+		Keepalive:     latest.PersistentKeepaliveInterval,
+	}
+	if latest.Endpoint != nil {
+		telemetry.Endpoint = latest.Endpoint.String()
+	}
+	return telemetry, true
+}
+
+// Telemetry polls the peers of active WireGuard tunnels, saving their
+// handshake, endpoint and keepalive to the tunnel, exporting them as
+// metrics, and sending an event when a peer roams to a new endpoint.
+type Telemetry struct {
+	mu            sync.Mutex
+	db            *gorm.DB
+	clock         clock.Clock
+	wgClient      *wgctrl.Client
+	eventsChannel chan events.Event
+	// reported holds the hostname each interface's metrics are labeled
+	// with, so they can be removed once the tunnel goes down
+	reported map[string]string
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewTelemetry(db *gorm.DB, clk clock.Clock, eventsChannel chan events.Event) (*Telemetry, error) {
+	wgClient, err := wgctrl.New()
+	if err != nil {
+		return nil, err
+	}
+	return &Telemetry{
+		db:            db,
+		clock:         clk,
+		wgClient:      wgClient,
+		eventsChannel: eventsChannel,
+		reported:      make(map[string]string),
+	}, nil
+}
+
+func (t *Telemetry) Start() error {
+	if t.cancel != nil {
+		return fmt.Errorf("telemetry poller already running")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+	t.done = make(chan struct{})
+
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(TelemetryInterval)
+		defer ticker.Stop()
+		for {
+			err := t.Poll()
+			if err != nil {
+				slog.Error("Tunnel telemetry poller failed", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+func (t *Telemetry) Stop() error {
+	if t.cancel == nil {
+		return nil
+	}
+	t.cancel()
+	<-t.done
+	t.cancel = nil
+	return nil
+}
+
+// Poll reads the peer of each active WireGuard tunnel and records it
+func (t *Telemetry) Poll() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tunnels, err := models.ListWireguardTunnels(t.db)
+	if err != nil {
+		return fmt.Errorf("failed to list tunnels: %w", err)
+	}
+
+	now := t.clock.Now()
+	seen := make(map[string]struct{}, len(tunnels))
+	for _, tunnel := range tunnels {
+		if !tunnel.Active {
+			continue
+		}
+		iface := InterfaceName(tunnel)
+		dev, err := t.wgClient.Device(iface)
+		if err != nil {
+			// The interface may have just gone down
+			slog.Debug("Error reading WireGuard device", "interface", iface, "error", err)
+			continue
+		}
+		peer, ok := ObservePeer(dev.Peers)
+		if !ok {
+			continue
+		}
+		seen[iface] = struct{}{}
+		err = t.record(tunnel, iface, peer, now)
+		if err != nil {
+			slog.Error("Failed to save tunnel telemetry", "tunnel", tunnel.Hostname, "error", err)
+		}
+	}
+
+	for iface, hostname := range t.reported {
+		if _, ok := seen[iface]; ok {
+			continue
+		}
+		metrics.WireguardPeerHandshakeAge.DeleteLabelValues(iface, hostname)
+		metrics.WireguardPeerKeepalive.DeleteLabelValues(iface, hostname)
+		delete(t.reported, iface)
+	}
+	return nil
+}
+
+// record saves what changed about the tunnel's peer and updates its metrics
+func (t *Telemetry) record(tunnel models.Tunnel, iface string, peer PeerTelemetry, now time.Time) error {
+	if hostname, ok := t.reported[iface]; ok && hostname != tunnel.Hostname {
+		metrics.WireguardPeerHandshakeAge.DeleteLabelValues(iface, hostname)
+		metrics.WireguardPeerKeepalive.DeleteLabelValues(iface, hostname)
+	}
+	t.reported[iface] = tunnel.Hostname
+
+	updates := make(map[string]interface{})
+	if !peer.LastHandshake.IsZero() {
+		if tunnel.LastHandshakeAt == nil || !tunnel.LastHandshakeAt.Equal(peer.LastHandshake) {
+			updates["last_handshake_at"] = peer.LastHandshake
+		}
+		metrics.WireguardPeerHandshakeAge.WithLabelValues(iface, tunnel.Hostname).Set(now.Sub(peer.LastHandshake).Seconds())
+	}
+
+	keepalive := uint16(peer.Keepalive / time.Second)
+	if keepalive != tunnel.KeepaliveSeconds {
+		updates["keepalive_seconds"] = keepalive
+	}
+	metrics.WireguardPeerKeepalive.WithLabelValues(iface, tunnel.Hostname).Set(peer.Keepalive.Seconds())
+
+	// The first endpoint a tunnel sees isn't a roam
+	roamed := false
+	if peer.Endpoint != "" && peer.Endpoint != tunnel.Endpoint {
+		updates["endpoint"] = peer.Endpoint
+		updates["endpoint_changed_at"] = now
+		if tunnel.Endpoint != "" {
+			roamed = true
+			updates["previous_endpoint"] = tunnel.Endpoint
+			updates["endpoint_changes"] = tunnel.EndpointChanges + 1
+		}
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+	err := t.db.Model(&models.Tunnel{}).Where("id = ?", tunnel.ID).UpdateColumns(updates).Error
+	if err != nil {
+		return err
+	}
+
+	if roamed {
+		slog.Info("Tunnel peer roamed", "tunnel", tunnel.Hostname, "previous", tunnel.Endpoint, "endpoint", peer.Endpoint)
+		metrics.WireguardPeerEndpointChanges.WithLabelValues(iface, tunnel.Hostname).Inc()
+		// Poll holds t.mu, so this mustn't wait on a slow consumer
+		select {
+		case t.eventsChannel <- events.Event{
+			Type: events.EventTypeTunnelRoam,
+			Data: apimodels.WebsocketTunnelRoam{
+				ID:              tunnel.ID,
+				Hostname:        tunnel.Hostname,
+				Client:          tunnel.Client,
+				EndpointChanges: tunnel.EndpointChanges + 1,
+				ChangedAt:       now,
+			},
+		}:
+		default:
+			slog.Warn("Events channel is full, not broadcasting roam event", "tunnel", tunnel.Hostname)
+		}
+	}
+	return nil
+}
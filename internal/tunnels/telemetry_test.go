@@ -0,0 +1,61 @@
+package tunnels_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/tunnels"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestObservePeer(t *testing.T) {
+	t.Parallel()
+
+	handshake := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	endpoint := &net.UDPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51820}
+
+	tests := []struct {
+		name   string
+		peers  []wgtypes.Peer
+		want   tunnels.PeerTelemetry
+		wantOK bool
+	}{
+		{
+			name: "no peers",
+		},
+		{
+			name:   "never connected",
+			peers:  []wgtypes.Peer{{PersistentKeepaliveInterval: 25 * time.Second}},
+			want:   tunnels.PeerTelemetry{Keepalive: 25 * time.Second},
+			wantOK: true,
+		},
+		{
+			name: "connected",
+			peers: []wgtypes.Peer{{
+				Endpoint:          endpoint,
+				LastHandshakeTime: handshake,
+			}},
+			want:   tunnels.PeerTelemetry{LastHandshake: handshake, Endpoint: "203.0.113.7:51820"},
+			wantOK: true,
+		},
+		{
+			name: "latest handshake during key rotation",
+			peers: []wgtypes.Peer{
+				{LastHandshakeTime: handshake.Add(-time.Hour)},
+				{Endpoint: endpoint, LastHandshakeTime: handshake},
+			},
+			want:   tunnels.PeerTelemetry{LastHandshake: handshake, Endpoint: "203.0.113.7:51820"},
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := tunnels.ObservePeer(tt.peers)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("ObservePeer() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -1,10 +1,20 @@
 package utils
 
 import (
+	"encoding/binary"
 	"fmt"
 	"net"
+	"net/netip"
+	"strings"
 )
 
+// IsEndpointHost returns true if host is a bare hostname or IP address that
+// is safe to write into a config
+func IsEndpointHost(host string) bool {
+	return host != "" && !strings.ContainsAny(host, " \t\r\n[]/") &&
+		(!strings.Contains(host, ":") || net.ParseIP(host) != nil)
+}
+
 // Generate a link-local address beginning with fe80 and ending with the 4 octets of the IPv4 address
 // The generation logic follows the upstream wireguard-tools implementation:
 // 1. Create a pseudo-MAC address: 00:00:IPv4
@@ -43,3 +53,46 @@ func GenerateIPv6LinkLocalAddress(ipv4 net.IP) (string, error) {
 	ipv6 := net.IP(ipv6Bytes)
 	return ipv6.String(), nil
 }
+
+// ClientTunnelIP returns the address of the client end of a WireGuard tunnel,
+// which is one past the tunnel's IP, skipping the .0 address if it wraps
+func ClientTunnelIP(tunnelIP net.IP) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	copy(ip, tunnelIP.To4())
+	ip[3]++
+	if ip[3] == 0 {
+		ip[2]++
+		ip[3] = 1
+		if ip[2] == 0 {
+			ip[1]++
+			if ip[1] == 0 {
+				ip[0]++
+			}
+		}
+	}
+	return ip
+}
+
+// ULAAddress returns the given host address in a /64 subnet of an IPv6
+// prefix, with subnets numbered from zero
+func ULAAddress(prefix netip.Prefix, subnet uint64, host uint64) netip.Addr {
+	b := prefix.Masked().Addr().As16()
+	binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(b[:8])|subnet)
+	binary.BigEndian.PutUint64(b[8:], host)
+	return netip.AddrFrom16(b)
+}
+
+// ULASubnet returns the number of the /64 subnet of prefix that addr is in
+func ULASubnet(prefix netip.Prefix, addr netip.Addr) (uint64, bool) {
+	if !addr.Is6() || !prefix.Contains(addr) {
+		return 0, false
+	}
+	b := addr.As16()
+	hostBits := 64 - prefix.Bits()
+	return binary.BigEndian.Uint64(b[:8]) & (1<<hostBits - 1), true
+}
+
+// IsULA returns true if addr is an IPv6 unique local address, in fc00::/7
+func IsULA(addr netip.Addr) bool {
+	return addr.Is6() && addr.As16()[0]&0xfe == 0xfc
+}
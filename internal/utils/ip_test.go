@@ -2,6 +2,7 @@ package utils
 
 import (
 	"net"
+	"net/netip"
 	"testing"
 )
 
@@ -51,3 +52,75 @@ func TestGenerateIPv6LinkLocalAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestClientTunnelIP(t *testing.T) {
+	tests := []struct {
+		tunnelIP string
+		expected string
+	}{
+		{tunnelIP: "172.31.0.4", expected: "172.31.0.5"},
+		{tunnelIP: "172.31.0.255", expected: "172.31.1.1"},
+		{tunnelIP: "172.31.255.255", expected: "172.32.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tunnelIP, func(t *testing.T) {
+			tunnelIP := net.ParseIP(tt.tunnelIP)
+			got := ClientTunnelIP(tunnelIP)
+			if got.String() != tt.expected {
+				t.Errorf("ClientTunnelIP() = %v, want %v", got, tt.expected)
+			}
+			if tunnelIP.String() != tt.tunnelIP {
+				t.Errorf("ClientTunnelIP() modified its argument to %v", tunnelIP)
+			}
+		})
+	}
+}
+
+func TestULAAddress(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		subnet   uint64
+		host     uint64
+		expected string
+	}{
+		{prefix: "fd5e:1a2b:3c4d::/48", subnet: 0, host: 1, expected: "fd5e:1a2b:3c4d::1"},
+		{prefix: "fd5e:1a2b:3c4d::/48", subnet: 1, host: 1, expected: "fd5e:1a2b:3c4d:1::1"},
+		{prefix: "fd5e:1a2b:3c4d::/48", subnet: 0xffff, host: 2, expected: "fd5e:1a2b:3c4d:ffff::2"},
+		{prefix: "fd5e:1a2b:3c4d:ab00::/56", subnet: 0x12, host: 1, expected: "fd5e:1a2b:3c4d:ab12::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			prefix := netip.MustParsePrefix(tt.prefix)
+			got := ULAAddress(prefix, tt.subnet, tt.host)
+			if got.String() != tt.expected {
+				t.Errorf("ULAAddress() = %v, want %v", got, tt.expected)
+			}
+			subnet, ok := ULASubnet(prefix, got)
+			if !ok || subnet != tt.subnet {
+				t.Errorf("ULASubnet() = %v, %v, want %v", subnet, ok, tt.subnet)
+			}
+		})
+	}
+
+	if _, ok := ULASubnet(netip.MustParsePrefix("fd5e:1a2b:3c4d::/48"), netip.MustParseAddr("fd5e:1a2b:3c4e::1")); ok {
+		t.Error("ULASubnet() accepted an address outside the prefix")
+	}
+}
+
+func TestIsULA(t *testing.T) {
+	tests := map[string]bool{
+		"fd00::1":     true,
+		"fc00::1":     true,
+		"fe80::1":     false,
+		"2001:db8::1": false,
+		"10.0.0.1":    false,
+	}
+
+	for addr, expected := range tests {
+		if got := IsULA(netip.MustParseAddr(addr)); got != expected {
+			t.Errorf("IsULA(%s) = %v, want %v", addr, got, expected)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -8,6 +9,8 @@ import (
 	"syscall"
 )
 
+var ErrProcessNotRunning = errors.New("process is not running")
+
 func ProcessIsRunning(pid int) bool {
 	// Check if the PID is running
 	process, err := os.FindProcess(pid)
@@ -49,3 +52,20 @@ func PIDFileIsRunning(pidFile string) bool {
 	}
 	return ProcessIsRunning(pid)
 }
+
+// CheckPIDFile returns an error unless the process in the PID file is
+// running. Unlike PIDFileIsRunning, it doesn't log, so it can be polled.
+func CheckPIDFile(pidFile string) error {
+	pid, err := PIDFromPIDFile(pidFile)
+	if err != nil {
+		return fmt.Errorf("failed to get PID from %s: %w", pidFile, err)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("failed to find process %d: %w", pid, err)
+	}
+	if process.Signal(syscall.Signal(0)) != nil {
+		return fmt.Errorf("%w: %d from %s", ErrProcessNotRunning, pid, pidFile)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const tokenBytes = 32
+
+// GenerateToken returns a random, high-entropy token with the given prefix
+func GenerateToken(prefix string) (string, error) {
+	b := make([]byte, tokenBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", ErrNoRandom
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// HashToken hashes a token generated by GenerateToken for storage.
+// Tokens are random rather than user-chosen, so a fast hash is sufficient
+// and lets them be looked up directly on every request.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,156 @@
+package wireguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/utils"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	// MTU is the MTU of both ends of a tunnel
+	MTU = 1420
+	// PersistentKeepalive is the keepalive interval, in seconds, given to
+	// both ends of a tunnel
+	PersistentKeepalive = 25
+)
+
+// passwordLength is the length of a server tunnel's password, which is the
+// server pubkey + client privkey + client pubkey
+const passwordLength = 3 * 44
+
+var (
+	ErrNotServerTunnel  = errors.New("tunnel is not a WireGuard server tunnel")
+	ErrInvalidPassword  = errors.New("tunnel password is not a valid key set")
+	ErrInvalidEndpoint  = errors.New("endpoint must be a hostname or IP address")
+	ErrNoPublicEndpoint = errors.New("no public endpoint is configured for the tunnel")
+)
+
+// ClientConfig is everything the client end of a server tunnel needs to
+// connect to this node
+type ClientConfig struct {
+	// Endpoint is the host:port the client connects to
+	Endpoint string
+	// AlternateEndpoints are this node's other public endpoints, such as
+	// another WAN, to fall back to if Endpoint stops working
+	AlternateEndpoints []string
+	ServerPublicKey    string
+	PrivateKey         string
+	// Addresses are the client's tunnel addresses, as assigned by addPeer
+	Addresses []string
+	// Network and Password are what AREDN's WireGuard client form asks for
+	Network  string
+	Password string
+	// NetworkIPv6 is the server's ULA address, if IPv6 is turned on, for
+	// mesh-manager clients to give as the tunnel's IPv6
+	NetworkIPv6 string
+}
+
+// NewClientConfig builds the client side of a server tunnel. host is the name
+// or address the client reaches this node at.
+func NewClientConfig(tunnel models.Tunnel, host string) (ClientConfig, error) {
+	if !isServerTunnel(tunnel) {
+		return ClientConfig{}, ErrNotServerTunnel
+	}
+	if err := ValidateEndpointHost(host); err != nil {
+		return ClientConfig{}, err
+	}
+	return newClientConfig(tunnel, net.JoinHostPort(host, strconv.FormatUint(uint64(tunnel.WireguardPort), 10)))
+}
+
+// NewPublicClientConfig builds the client side of a server tunnel pointed at
+// its public endpoints, as PublicEndpoints gives them
+func NewPublicClientConfig(cfg *config.Config, tunnel models.Tunnel) (ClientConfig, error) {
+	if !isServerTunnel(tunnel) {
+		return ClientConfig{}, ErrNotServerTunnel
+	}
+	endpoints := PublicEndpoints(cfg, tunnel)
+	if len(endpoints) == 0 {
+		return ClientConfig{}, ErrNoPublicEndpoint
+	}
+	clientConfig, err := newClientConfig(tunnel, endpoints[0])
+	if err != nil {
+		return ClientConfig{}, err
+	}
+	clientConfig.AlternateEndpoints = endpoints[1:]
+	return clientConfig, nil
+}
+
+func isServerTunnel(tunnel models.Tunnel) bool {
+	return tunnel.Wireguard && !tunnel.Client && tunnel.WireguardServerKey != ""
+}
+
+// newClientConfig builds the client side of a server tunnel reached at the
+// host:port endpoint
+func newClientConfig(tunnel models.Tunnel, endpoint string) (ClientConfig, error) {
+	if len(tunnel.Password) != passwordLength {
+		return ClientConfig{}, ErrInvalidPassword
+	}
+	for i := 0; i < passwordLength; i += 44 {
+		if _, err := wgtypes.ParseKey(tunnel.Password[i : i+44]); err != nil {
+			return ClientConfig{}, fmt.Errorf("%w: %w", ErrInvalidPassword, err)
+		}
+	}
+
+	tunnelIP := net.ParseIP(tunnel.IP).To4()
+	if tunnelIP == nil {
+		return ClientConfig{}, fmt.Errorf("invalid tunnel IP %q", tunnel.IP)
+	}
+	clientIP := utils.ClientTunnelIP(tunnelIP)
+	clientIP6, err := utils.GenerateIPv6LinkLocalAddress(clientIP)
+	if err != nil {
+		return ClientConfig{}, err
+	}
+
+	addresses := []string{clientIP.String() + "/32", clientIP6 + "/64"}
+	if tunnel.IPv6 != "" {
+		ula, err := netip.ParseAddr(tunnel.IPv6)
+		if err != nil {
+			return ClientConfig{}, fmt.Errorf("invalid tunnel IPv6 address %q", tunnel.IPv6)
+		}
+		addresses = append(addresses, netip.PrefixFrom(ula.Next(), 64).String())
+	}
+
+	return ClientConfig{
+		Endpoint:        endpoint,
+		ServerPublicKey: tunnel.Password[:44],
+		PrivateKey:      tunnel.Password[44:88],
+		Addresses:       addresses,
+		Network:         tunnel.IP,
+		NetworkIPv6:     tunnel.IPv6,
+		Password:        tunnel.Password,
+	}, nil
+}
+
+// ValidateEndpointHost checks that host is a bare hostname or IP address that
+// is safe to write into a config
+func ValidateEndpointHost(host string) error {
+	if !utils.IsEndpointHost(host) {
+		return ErrInvalidEndpoint
+	}
+	return nil
+}
+
+// WGQuick renders the config in wg-quick format. Routing is left to the mesh
+// routing daemon, so wg-quick is told not to install routes for AllowedIPs.
+func (c ClientConfig) WGQuick() string {
+	var sb strings.Builder
+	sb.WriteString("[Interface]\n")
+	fmt.Fprintf(&sb, "PrivateKey = %s\n", c.PrivateKey)
+	fmt.Fprintf(&sb, "Address = %s\n", strings.Join(c.Addresses, ", "))
+	fmt.Fprintf(&sb, "MTU = %d\n", MTU)
+	sb.WriteString("Table = off\n")
+	sb.WriteString("\n[Peer]\n")
+	fmt.Fprintf(&sb, "PublicKey = %s\n", c.ServerPublicKey)
+	fmt.Fprintf(&sb, "Endpoint = %s\n", c.Endpoint)
+	sb.WriteString("AllowedIPs = 0.0.0.0/0, ::/0\n")
+	fmt.Fprintf(&sb, "PersistentKeepalive = %d\n", PersistentKeepalive)
+	return sb.String()
+}
@@ -0,0 +1,111 @@
+package wireguard_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func serverTunnel(t *testing.T) models.Tunnel {
+	t.Helper()
+	serverKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.Tunnel{
+		ID:                 1,
+		Hostname:           "KI5VMF-HOME",
+		IP:                 "172.31.0.4",
+		Wireguard:          true,
+		WireguardPort:      5527,
+		WireguardServerKey: serverKey.String(),
+		Password:           serverKey.PublicKey().String() + clientKey.String() + clientKey.PublicKey().String(),
+	}
+}
+
+func TestNewClientConfig(t *testing.T) {
+	t.Parallel()
+	tunnel := serverTunnel(t)
+
+	config, err := wireguard.NewClientConfig(tunnel, "supernode.example.com")
+	if err != nil {
+		t.Fatalf("NewClientConfig() error = %v", err)
+	}
+	if config.Endpoint != "supernode.example.com:5527" {
+		t.Errorf("Endpoint = %q, want supernode.example.com:5527", config.Endpoint)
+	}
+	if config.Network != tunnel.IP {
+		t.Errorf("Network = %q, want %q", config.Network, tunnel.IP)
+	}
+
+	wgQuick := config.WGQuick()
+	for _, want := range []string{
+		"PrivateKey = " + tunnel.Password[44:88],
+		"Address = 172.31.0.5/32, fe80::200:acff:fe1f:5/64",
+		"PublicKey = " + tunnel.Password[:44],
+		"Endpoint = supernode.example.com:5527",
+	} {
+		if !strings.Contains(wgQuick, want+"\n") {
+			t.Errorf("WGQuick() is missing %q:\n%s", want, wgQuick)
+		}
+	}
+
+	config, err = wireguard.NewClientConfig(tunnel, "2001:db8::1")
+	if err != nil {
+		t.Fatalf("NewClientConfig() with an IPv6 endpoint error = %v", err)
+	}
+	if config.Endpoint != "[2001:db8::1]:5527" {
+		t.Errorf("Endpoint = %q, want [2001:db8::1]:5527", config.Endpoint)
+	}
+
+	tunnel.IPv6 = "fd5e:1a2b:3c4d:1::1"
+	config, err = wireguard.NewClientConfig(tunnel, "supernode.example.com")
+	if err != nil {
+		t.Fatalf("NewClientConfig() with IPv6 error = %v", err)
+	}
+	if config.NetworkIPv6 != tunnel.IPv6 {
+		t.Errorf("NetworkIPv6 = %q, want %q", config.NetworkIPv6, tunnel.IPv6)
+	}
+	want := "Address = 172.31.0.5/32, fe80::200:acff:fe1f:5/64, fd5e:1a2b:3c4d:1::2/64\n"
+	if wgQuick := config.WGQuick(); !strings.Contains(wgQuick, want) {
+		t.Errorf("WGQuick() is missing %q:\n%s", want, wgQuick)
+	}
+}
+
+func TestNewClientConfigErrors(t *testing.T) {
+	t.Parallel()
+	client := serverTunnel(t)
+	client.Client = true
+	badPassword := serverTunnel(t)
+	badPassword.Password = badPassword.Password[:88]
+
+	tests := []struct {
+		name   string
+		tunnel models.Tunnel
+		host   string
+		want   error
+	}{
+		{"client tunnel", client, "example.com", wireguard.ErrNotServerTunnel},
+		{"short password", badPassword, "example.com", wireguard.ErrInvalidPassword},
+		{"host with port", serverTunnel(t), "example.com:80", wireguard.ErrInvalidEndpoint},
+		{"host with newline", serverTunnel(t), "example.com\nPostUp = rm -rf /", wireguard.ErrInvalidEndpoint},
+		{"empty host", serverTunnel(t), "", wireguard.ErrInvalidEndpoint},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := wireguard.NewClientConfig(tt.tunnel, tt.host)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("NewClientConfig() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package wireguard
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+)
+
+//nolint:gochecknoglobals
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// Resolver looks up the addresses of a host, as net.Resolver does
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// EndpointCheck is what CheckEndpoints found out about a public endpoint
+type EndpointCheck struct {
+	Endpoint string `json:"endpoint"`
+	// TunnelID is set for a tunnel's own endpoint
+	TunnelID  uint     `json:"tunnel_id,omitempty"`
+	Addresses []string `json:"addresses"`
+	// Problems are reasons peers may not be able to reach the endpoint
+	Problems []string `json:"problems"`
+}
+
+func (c EndpointCheck) OK() bool {
+	return len(c.Problems) == 0
+}
+
+// PublicEndpoints are the host:port addresses a client reaches a server
+// tunnel at, most preferred first. A tunnel's own PublicEndpoint replaces
+// the configured ones. It is empty if neither is set.
+func PublicEndpoints(cfg *config.Config, tunnel models.Tunnel) []string {
+	if tunnel.PublicEndpoint != "" {
+		endpoint, err := config.ParseWireguardEndpoint(tunnel.PublicEndpoint)
+		if err == nil {
+			// A tunnel's own port isn't remapped, so it remaps from itself
+			address, ok := endpoint.Address(tunnel.WireguardPort, tunnel.WireguardPort)
+			if ok {
+				return []string{address}
+			}
+		}
+	}
+
+	addresses := []string{}
+	for _, endpoint := range cfg.Wireguard.PublicEndpoints() {
+		address, ok := endpoint.Address(tunnel.WireguardPort, cfg.Wireguard.StartingPort)
+		if ok {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// CheckEndpoints checks that the configured public endpoints and each
+// tunnel's own endpoint resolve to addresses peers on the internet can
+// reach, and that the configured ones have room to remap every server
+// tunnel's port
+func CheckEndpoints(ctx context.Context, cfg *config.Config, tunnels []models.Tunnel, resolver Resolver) []EndpointCheck {
+	checks := []EndpointCheck{}
+	for _, endpoint := range cfg.Wireguard.PublicEndpoints() {
+		check := checkHost(ctx, resolver, endpoint.Host)
+		check.Endpoint = endpoint.String()
+		for _, tunnel := range tunnels {
+			if !isServerTunnel(tunnel) || tunnel.PublicEndpoint != "" {
+				continue
+			}
+			if _, ok := endpoint.Address(tunnel.WireguardPort, cfg.Wireguard.StartingPort); !ok {
+				check.Problems = append(check.Problems, fmt.Sprintf("tunnel %s's port %d is out of range once remapped", tunnel.Hostname, tunnel.WireguardPort))
+			}
+		}
+		checks = append(checks, check)
+	}
+
+	for _, tunnel := range tunnels {
+		if tunnel.PublicEndpoint == "" {
+			continue
+		}
+		endpoint, err := config.ParseWireguardEndpoint(tunnel.PublicEndpoint)
+		if err != nil {
+			checks = append(checks, EndpointCheck{
+				Endpoint:  tunnel.PublicEndpoint,
+				TunnelID:  tunnel.ID,
+				Addresses: []string{},
+				Problems:  []string{err.Error()},
+			})
+			continue
+		}
+		check := checkHost(ctx, resolver, endpoint.Host)
+		check.Endpoint = tunnel.PublicEndpoint
+		check.TunnelID = tunnel.ID
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func checkHost(ctx context.Context, resolver Resolver, host string) EndpointCheck {
+	check := EndpointCheck{
+		Addresses: []string{},
+		Problems:  []string{},
+	}
+	addrs, err := resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		check.Problems = append(check.Problems, fmt.Sprintf("%s does not resolve: %v", host, err))
+		return check
+	}
+	for _, addr := range addrs {
+		addr = addr.Unmap()
+		check.Addresses = append(check.Addresses, addr.String())
+		switch {
+		case addr.IsLoopback(), addr.IsUnspecified(), addr.IsLinkLocalUnicast():
+			check.Problems = append(check.Problems, fmt.Sprintf("%s can't be reached from other hosts", addr))
+		case addr.IsPrivate():
+			check.Problems = append(check.Problems, fmt.Sprintf("%s is a private address, which peers outside this network can't reach", addr))
+		case cgnatPrefix.Contains(addr):
+			check.Problems = append(check.Problems, fmt.Sprintf("%s is behind carrier-grade NAT, which peers can't reach without a forward from the carrier", addr))
+		}
+	}
+	return check
+}
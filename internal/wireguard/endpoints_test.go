@@ -0,0 +1,91 @@
+package wireguard_test
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/config"
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"github.com/USA-RedDragon/mesh-manager/internal/wireguard"
+)
+
+type fakeResolver map[string][]netip.Addr
+
+func (r fakeResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func TestPublicEndpoints(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{Wireguard: config.Wireguard{
+		StartingPort: 5527,
+		Endpoints:    []string{"wan1.example.com", "203.0.113.7:6000"},
+	}}
+	tunnel := serverTunnel(t)
+	tunnel.WireguardPort = 5530
+
+	want := []string{"wan1.example.com:5530", "203.0.113.7:6003"}
+	if got := wireguard.PublicEndpoints(cfg, tunnel); !reflect.DeepEqual(got, want) {
+		t.Errorf("PublicEndpoints() = %v, want %v", got, want)
+	}
+
+	clientConfig, err := wireguard.NewPublicClientConfig(cfg, tunnel)
+	if err != nil {
+		t.Fatalf("NewPublicClientConfig() error = %v", err)
+	}
+	if clientConfig.Endpoint != want[0] || !reflect.DeepEqual(clientConfig.AlternateEndpoints, want[1:]) {
+		t.Errorf("NewPublicClientConfig() endpoints = %q, %v, want %q, %v", clientConfig.Endpoint, clientConfig.AlternateEndpoints, want[0], want[1:])
+	}
+
+	tunnel.PublicEndpoint = "home.example.com:7000"
+	want = []string{"home.example.com:7000"}
+	if got := wireguard.PublicEndpoints(cfg, tunnel); !reflect.DeepEqual(got, want) {
+		t.Errorf("PublicEndpoints() with a tunnel endpoint = %v, want %v", got, want)
+	}
+
+	_, err = wireguard.NewPublicClientConfig(&config.Config{}, serverTunnel(t))
+	if !errors.Is(err, wireguard.ErrNoPublicEndpoint) {
+		t.Errorf("NewPublicClientConfig() without endpoints error = %v, want %v", err, wireguard.ErrNoPublicEndpoint)
+	}
+}
+
+func TestCheckEndpoints(t *testing.T) {
+	t.Parallel()
+
+	resolver := fakeResolver{
+		"public.example.com":  {netip.MustParseAddr("203.0.113.7")},
+		"private.example.com": {netip.MustParseAddr("192.168.1.10")},
+		"cgnat.example.com":   {netip.MustParseAddr("100.72.1.1")},
+	}
+	tunnel := serverTunnel(t)
+	tunnel.WireguardPort = 5600
+
+	tests := []struct {
+		endpoint string
+		problems int
+	}{
+		{"public.example.com", 0},
+		{"private.example.com", 1},
+		{"cgnat.example.com", 1},
+		{"missing.example.com", 1},
+		{"public.example.com:65500", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			t.Parallel()
+			cfg := &config.Config{Wireguard: config.Wireguard{StartingPort: 5527, Endpoints: []string{tt.endpoint}}}
+			checks := wireguard.CheckEndpoints(context.Background(), cfg, []models.Tunnel{tunnel}, resolver)
+			if len(checks) != 1 || len(checks[0].Problems) != tt.problems {
+				t.Errorf("CheckEndpoints() = %+v, want 1 check with %d problems", checks, tt.problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package wireguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/USA-RedDragon/mesh-manager/internal/db/models"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"gorm.io/gorm"
+)
+
+// KeyCheckInterval is how often the Manager looks for rotated keys and
+// ends grace periods
+const KeyCheckInterval = 10 * time.Second
+
+// GenerateServerTunnelKeys generates the keys for a new server tunnel. The
+// password is what the client is given: the server pubkey + client privkey +
+// client pubkey.
+func GenerateServerTunnelKeys() (serverKey string, password string, err error) {
+	server, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate server key: %w", err)
+	}
+	client, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate client key: %w", err)
+	}
+	return server.String(), server.PublicKey().String() + client.String() + client.PublicKey().String(), nil
+}
+
+// CanRotateKeys returns an error if the tunnel has no keys RotateKeys can
+// rotate
+func CanRotateKeys(tunnel models.Tunnel) error {
+	if !tunnel.Wireguard || tunnel.Client || tunnel.WireguardServerKey == "" {
+		return ErrNotServerTunnel
+	}
+	if len(tunnel.Password) != passwordLength {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// RotateKeys gives a server tunnel a new client keypair, and a new server key
+// too if rotateServerKey is set. The client may keep connecting with its old
+// keys for the grace period, or until it first connects with the new ones.
+// A new server key can't be given a grace period, since the interface only
+// has one private key, so the old client config stops working immediately.
+// The Manager picks up the new keys on its next key check, or immediately
+// with Reconfigure.
+func RotateKeys(db *gorm.DB, tunnel models.Tunnel, now time.Time, grace time.Duration, rotateServerKey bool) (models.Tunnel, error) {
+	if err := CanRotateKeys(tunnel); err != nil {
+		return tunnel, err
+	}
+
+	serverKey, password, err := GenerateServerTunnelKeys()
+	if err != nil {
+		return tunnel, err
+	}
+	if !rotateServerKey {
+		// Keep the server key, and with it the server pubkey the client has
+		serverKey = tunnel.WireguardServerKey
+		password = tunnel.Password[:44] + password[44:]
+	}
+
+	previous := tunnel.Password[88:]
+	if tunnel.InKeyGrace(now) {
+		// The client may not have picked up the last rotation either,
+		// in which case it's still on the key from before that
+		previous = tunnel.PreviousClientPublicKey
+	}
+
+	rotatedAt := now
+	tunnel.WireguardServerKey = serverKey
+	tunnel.Password = password
+	tunnel.KeyRotatedAt = &rotatedAt
+	tunnel.PreviousClientPublicKey = ""
+	tunnel.KeyGraceUntil = nil
+	if grace > 0 && !rotateServerKey {
+		graceUntil := now.Add(grace)
+		tunnel.PreviousClientPublicKey = previous
+		tunnel.KeyGraceUntil = &graceUntil
+	}
+
+	err = db.Model(&tunnel).Select("wireguard_server_key", "password", "key_rotated_at", "previous_client_public_key", "key_grace_until").Updates(&tunnel).Error
+	if err != nil {
+		return tunnel, fmt.Errorf("failed to save rotated keys: %w", err)
+	}
+	return tunnel, nil
+}
+
+// serverPeerConfigs returns the peers of a server tunnel's interface. During
+// a key grace period the previous client key keeps the routes, and the new
+// key is only allowed to handshake. Once it has, the grace period ends and
+// the new key takes over the routes.
+func serverPeerConfigs(tunnel models.Tunnel, now time.Time) ([]wgtypes.PeerConfig, error) {
+	if len(tunnel.Password) != passwordLength {
+		return nil, ErrInvalidPassword
+	}
+	// tunnel.Password is our server pubkey + client privkey + client pubkey
+	clientPubkey, err := wgtypes.ParseKey(tunnel.Password[88:])
+	if err != nil {
+		return nil, err
+	}
+	keepalive := PersistentKeepalive * time.Second
+	allIPs := []net.IPNet{
+		{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)},
+		{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)},
+	}
+
+	if !tunnel.InKeyGrace(now) {
+		return []wgtypes.PeerConfig{
+			{
+				PublicKey:                   clientPubkey,
+				ReplaceAllowedIPs:           true,
+				AllowedIPs:                  allIPs,
+				PersistentKeepaliveInterval: &keepalive,
+			},
+		}, nil
+	}
+
+	previousPubkey, err := wgtypes.ParseKey(tunnel.PreviousClientPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return []wgtypes.PeerConfig{
+		{
+			PublicKey:                   previousPubkey,
+			ReplaceAllowedIPs:           true,
+			AllowedIPs:                  allIPs,
+			PersistentKeepaliveInterval: &keepalive,
+		},
+		{
+			PublicKey:                   clientPubkey,
+			ReplaceAllowedIPs:           true,
+			PersistentKeepaliveInterval: &keepalive,
+		},
+	}, nil
+}
+
+// Reconfigure applies a server tunnel's current keys to its interface, if it
+// is up, without dropping the sessions of peers that are kept
+func (m *Manager) Reconfigure(tunnel models.Tunnel) error {
+	if tunnel.WireguardServerKey == "" {
+		return ErrNotServerTunnel
+	}
+	iface := GenerateWireguardInterfaceName(tunnel)
+	if _, ok := m.activePeers.Load(iface); !ok {
+		return nil
+	}
+
+	privkey, err := wgtypes.ParseKey(tunnel.WireguardServerKey)
+	if err != nil {
+		return fmt.Errorf("failed to parse server private key: %w", err)
+	}
+	peers, err := serverPeerConfigs(tunnel, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to parse client pubkey: %w", err)
+	}
+
+	device, err := m.wgClient.Device(iface)
+	if err != nil {
+		return fmt.Errorf("failed to get wireguard device %s: %w", iface, err)
+	}
+	wanted := make(map[wgtypes.Key]struct{}, len(peers))
+	for _, peer := range peers {
+		wanted[peer.PublicKey] = struct{}{}
+	}
+	for _, peer := range device.Peers {
+		if _, ok := wanted[peer.PublicKey]; !ok {
+			peers = append(peers, wgtypes.PeerConfig{PublicKey: peer.PublicKey, Remove: true})
+		}
+	}
+
+	err = m.wgClient.ConfigureDevice(iface, wgtypes.Config{
+		PrivateKey: &privkey,
+		Peers:      peers,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure wireguard device %s: %w", iface, err)
+	}
+	m.activePeers.Store(iface, tunnel)
+	return nil
+}
+
+// watchKeys applies keys rotated by another process, such as the CLI, and
+// ends grace periods once the client connects with its new key or the
+// period runs out
+func (m *Manager) watchKeys(ctx context.Context) {
+	defer close(m.keysDone)
+	ticker := time.NewTicker(KeyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.activePeers.Range(func(key, value interface{}) bool {
+				active, ok := value.(models.Tunnel)
+				if !ok || active.WireguardServerKey == "" {
+					return true
+				}
+				iface, _ := key.(string)
+				err := m.checkKeys(iface, active)
+				if err != nil {
+					slog.Error("failed to check wireguard keys", "iface", iface, "peer", active.Hostname, "error", err)
+				}
+				return true
+			})
+		}
+	}
+}
+
+func (m *Manager) checkKeys(iface string, active models.Tunnel) error {
+	tunnel, err := models.FindTunnelByID(m.db, active.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	if tunnel.PreviousClientPublicKey != "" && len(tunnel.Password) == passwordLength && tunnel.KeyRotatedAt != nil {
+		ended := !tunnel.InKeyGrace(now)
+		if !ended {
+			ended, err = m.handshakeSince(iface, tunnel.Password[88:], *tunnel.KeyRotatedAt)
+			if err != nil {
+				return err
+			}
+		}
+		if ended {
+			err = models.EndTunnelKeyGrace(m.db, tunnel.ID)
+			if err != nil {
+				return fmt.Errorf("failed to end key grace period: %w", err)
+			}
+			slog.Info("Ended wireguard key grace period", "peer", tunnel.Hostname)
+			tunnel.PreviousClientPublicKey = ""
+			tunnel.KeyGraceUntil = nil
+		}
+	}
+
+	if tunnel.WireguardServerKey == active.WireguardServerKey &&
+		tunnel.Password == active.Password &&
+		tunnel.PreviousClientPublicKey == active.PreviousClientPublicKey {
+		return nil
+	}
+	return m.Reconfigure(tunnel)
+}
+
+// handshakeSince returns true if the peer with the given public key has
+// completed a handshake since the given time
+func (m *Manager) handshakeSince(iface string, pubkey string, since time.Time) (bool, error) {
+	key, err := wgtypes.ParseKey(pubkey)
+	if err != nil {
+		return false, err
+	}
+	device, err := m.wgClient.Device(iface)
+	if err != nil {
+		return false, fmt.Errorf("failed to get wireguard device %s: %w", iface, err)
+	}
+	for _, peer := range device.Peers {
+		if peer.PublicKey == key {
+			return peer.LastHandshakeTime.After(since), nil
+		}
+	}
+	return false, nil
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"net/netip"
 	"strconv"
 	"strings"
 	"sync"
@@ -34,6 +35,8 @@ type Manager struct {
 	shutdownConfirmChan   chan struct{}
 	activePeers           sync.Map
 	wgClient              *wgctrl.Client
+	keysCancel            context.CancelFunc
+	keysDone              chan struct{}
 }
 
 func NewManager(db *gorm.DB) (*Manager, error) {
@@ -56,6 +59,10 @@ func NewManager(db *gorm.DB) (*Manager, error) {
 
 func (m *Manager) Run() error {
 	go m.run()
+	ctx, cancel := context.WithCancel(context.Background())
+	m.keysCancel = cancel
+	m.keysDone = make(chan struct{})
+	go m.watchKeys(ctx)
 	return m.initializeTunnels()
 }
 
@@ -76,6 +83,11 @@ func (m *Manager) removeAllPeers() error {
 }
 
 func (m *Manager) Stop() error {
+	if m.keysCancel != nil {
+		m.keysCancel()
+		<-m.keysDone
+	}
+
 	// Remove all peers, then stop the thread and close the channels
 	err := m.removeAllPeers()
 	if err != nil {
@@ -153,7 +165,7 @@ func (m *Manager) addPeer(ctx context.Context, peer models.Tunnel) {
 	} else {
 		la := netlink.NewLinkAttrs()
 		la.Name = iface
-		la.MTU = 1420
+		la.MTU = MTU
 		wgdev = &WG{LinkAttrs: la}
 		err := netlink.LinkAdd(wgdev)
 		if err != nil {
@@ -174,19 +186,7 @@ func (m *Manager) addPeer(ctx context.Context, peer models.Tunnel) {
 	// Add an IP address to the interface
 	peerIP := net.ParseIP(peer.IP)
 	if peer.WireguardServerKey == "" {
-		// Add one to the peer IP for the client side
-		peerIP = peerIP.To4()
-		peerIP[3]++
-		if peerIP[3] == 0 {
-			peerIP[2]++
-			peerIP[3] = 1
-			if peerIP[2] == 0 {
-				peerIP[1]++
-				if peerIP[1] == 0 {
-					peerIP[0]++
-				}
-			}
-		}
+		peerIP = utils.ClientTunnelIP(peerIP)
 	}
 
 	err = netlink.AddrReplace(wgdev, &netlink.Addr{IPNet: &net.IPNet{IP: peerIP, Mask: net.CIDRMask(32, 32)}})
@@ -243,6 +243,23 @@ func (m *Manager) addPeer(ctx context.Context, peer models.Tunnel) {
 		}
 	}
 
+	if peer.IPv6 != "" {
+		// Add the tunnel's ULA address, the next one up for the client end
+		peerULA, err := netip.ParseAddr(peer.IPv6)
+		if err != nil {
+			slog.Error("failed to parse tunnel IPv6 address", "peer", peer.Hostname, "error", err)
+			return
+		}
+		if peer.WireguardServerKey == "" {
+			peerULA = peerULA.Next()
+		}
+		err = netlink.AddrReplace(wgdev, &netlink.Addr{IPNet: &net.IPNet{IP: peerULA.AsSlice(), Mask: net.CIDRMask(64, 128)}})
+		if err != nil {
+			slog.Error("failed to add IPv6 address to wireguard device", "iface", iface, "peer", peer.Hostname, "error", err)
+			return
+		}
+	}
+
 	var privkey wgtypes.Key
 	portInt := int(peer.WireguardPort)
 	var peers []wgtypes.PeerConfig
@@ -259,7 +276,7 @@ func (m *Manager) addPeer(ctx context.Context, peer models.Tunnel) {
 		return
 	}
 
-	duration := time.Second * 25
+	duration := time.Second * PersistentKeepalive
 
 	if peer.WireguardServerKey != "" {
 		var err error
@@ -269,21 +286,11 @@ func (m *Manager) addPeer(ctx context.Context, peer models.Tunnel) {
 			return
 		}
 
-		// tunnel.Password is our server pubkey + client privkey + client pubkey
-		pubkeyPart := peer.Password[88:]
-		clientPubkey, err := wgtypes.ParseKey(pubkeyPart)
+		peers, err = serverPeerConfigs(peer, time.Now())
 		if err != nil {
 			slog.Error("failed to parse client pubkey", "error", err)
 			return
 		}
-
-		peers = []wgtypes.PeerConfig{
-			{
-				PublicKey:                   clientPubkey,
-				AllowedIPs:                  []net.IPNet{*netip, *ipv6netip},
-				PersistentKeepaliveInterval: &duration,
-			},
-		}
 	} else {
 		var err error
 		portInt = freeport.GetPort()